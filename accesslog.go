@@ -0,0 +1,134 @@
+package main
+
+import (
+	"encoding/json"
+	"fmt"
+	"io"
+	"net/http"
+	"net/netip"
+	"net/url"
+	"os"
+	"strings"
+	"sync"
+	"time"
+)
+
+// accessLogEntry describes a single request handled by the proxy.
+type accessLogEntry struct {
+	Time       time.Time `json:"time"`
+	RequestID  string    `json:"requestId"`
+	Client     string    `json:"client"`
+	User       string    `json:"user,omitempty"`
+	Method     string    `json:"method"`
+	Path       string    `json:"path"`
+	Protocol   string    `json:"protocol"`
+	Status     int       `json:"status"`
+	Bytes      int64     `json:"bytes"`
+	DurationMs float64   `json:"durationMs"`
+	Referer    string    `json:"referer,omitempty"`
+	UserAgent  string    `json:"userAgent,omitempty"`
+}
+
+// accessLogger writes an access log line for every request to stdout, either as JSON
+// or in the Apache combined log format.
+type accessLogger struct {
+	mu             sync.Mutex
+	out            io.Writer
+	format         string
+	trustedProxies []netip.Prefix
+}
+
+// accessLoggerFromEnv returns the access logger configured by BW_ACCESS_LOG, which is
+// "json" or "combined", or nil if access logging is disabled.
+func accessLoggerFromEnv(trustedProxies []netip.Prefix) (*accessLogger, error) {
+	switch format := os.Getenv("BW_ACCESS_LOG"); format {
+	case "":
+		return nil, nil
+	case "json", "combined":
+		return &accessLogger{out: consoleWriter(os.Stdout), format: format, trustedProxies: trustedProxies}, nil
+	default:
+		return nil, fmt.Errorf("invalid BW_ACCESS_LOG '%s', expected 'json' or 'combined'", format)
+	}
+}
+
+// middleware logs every request once it has been answered.
+func (l *accessLogger) middleware(next http.Handler) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		start := time.Now()
+		rec := &statusRecorder{ResponseWriter: w, status: http.StatusOK}
+		next.ServeHTTP(rec, r)
+
+		entry := accessLogEntry{
+			Time:       start,
+			RequestID:  requestID(r),
+			Client:     "-",
+			Method:     r.Method,
+			Path:       templatedPath(r.URL),
+			Protocol:   r.Proto,
+			Status:     rec.status,
+			Bytes:      rec.bytes,
+			DurationMs: float64(time.Since(start).Microseconds()) / 1000,
+			Referer:    r.Referer(),
+			UserAgent:  r.UserAgent(),
+		}
+		if addr := clientIP(r, l.trustedProxies); addr.IsValid() {
+			entry.Client = addr.String()
+		}
+		if user, _, ok := r.BasicAuth(); ok {
+			entry.User = user
+		}
+		l.log(entry)
+	})
+}
+
+// log writes an entry. Failures are reported, but never fail the request.
+func (l *accessLogger) log(entry accessLogEntry) {
+	var line []byte
+	if l.format == "json" {
+		var err error
+		if line, err = json.Marshal(entry); err != nil {
+			proxyLog.Error("Failed to encode access log entry", "error", err)
+			return
+		}
+	} else {
+		line = []byte(combinedLogLine(entry))
+	}
+	l.mu.Lock()
+	defer l.mu.Unlock()
+	if _, err := l.out.Write(append(line, '\n')); err != nil {
+		proxyLog.Error("Failed to write access log entry", "error", err)
+	}
+}
+
+// combinedLogLine formats an entry in the Apache combined log format.
+func combinedLogLine(e accessLogEntry) string {
+	size := "-"
+	if e.Bytes > 0 {
+		size = fmt.Sprint(e.Bytes)
+	}
+	return fmt.Sprintf(`%s - %s [%s] "%s %s %s" %d %s %q %q`,
+		e.Client, orDash(e.User), e.Time.Format("02/Jan/2006:15:04:05 -0700"),
+		e.Method, e.Path, e.Protocol, e.Status, size, orDash(e.Referer), orDash(e.UserAgent))
+}
+
+// orDash returns "-" for empty fields, as the combined log format does.
+func orDash(s string) string {
+	if s == "" {
+		return "-"
+	}
+	return s
+}
+
+// templatedPath returns the path of a request with the values of its query parameters
+// masked, since searches and filters may contain secret values.
+func templatedPath(u *url.URL) string {
+	if u.RawQuery == "" {
+		return u.Path
+	}
+	params := strings.Split(u.RawQuery, "&")
+	for i, param := range params {
+		key, _, _ := strings.Cut(param, "=")
+		params[i] = key + "=***"
+	}
+	return u.Path + "?" + strings.Join(params, "&")
+}
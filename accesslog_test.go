@@ -0,0 +1,57 @@
+package main
+
+import (
+	"bytes"
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"regexp"
+	"testing"
+)
+
+func TestAccessLog(t *testing.T) {
+	handler := http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.WriteHeader(http.StatusNotFound)
+		_, _ = w.Write([]byte("Not found"))
+	})
+
+	var out bytes.Buffer
+	l := &accessLogger{out: &out, format: "json"}
+	req := httptest.NewRequest("GET", "/list/object/items?search=hunter2&folderid=abc", nil)
+	req.SetBasicAuth("eso", "secret")
+	l.middleware(handler).ServeHTTP(httptest.NewRecorder(), req)
+
+	var entry accessLogEntry
+	if err := json.Unmarshal(out.Bytes(), &entry); err != nil {
+		t.Fatalf("expected a JSON line, got %q: %v", out.String(), err)
+	}
+	if entry.Path != "/list/object/items?search=***&folderid=***" {
+		t.Errorf("path = %q, want query values masked", entry.Path)
+	}
+	if entry.Status != http.StatusNotFound || entry.Bytes != 9 || entry.User != "eso" || entry.Client != "192.0.2.1" {
+		t.Errorf("unexpected entry %+v", entry)
+	}
+
+	out.Reset()
+	l.format = "combined"
+	l.middleware(handler).ServeHTTP(httptest.NewRecorder(), httptest.NewRequest("GET", "/object/item/item-1", nil))
+	pattern := `^192\.0\.2\.1 - - \[[^\]]+\] "GET /object/item/item-1 HTTP/1\.1" 404 9 "-" "-"\n$`
+	if !regexp.MustCompile(pattern).Match(out.Bytes()) {
+		t.Errorf("combined log line %q does not match %s", out.String(), pattern)
+	}
+}
+
+func TestTemplatedPath(t *testing.T) {
+	tests := map[string]string{
+		"/object/item/item-1":           "/object/item/item-1",
+		"/list/object/items?search=foo": "/list/object/items?search=***",
+		"/object/item/item-1?reveal":    "/object/item/item-1?reveal=***",
+	}
+	for raw, want := range tests {
+		u, _ := url.Parse(raw)
+		if got := templatedPath(u); got != want {
+			t.Errorf("templatedPath(%q) = %q, want %q", raw, got, want)
+		}
+	}
+}
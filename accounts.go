@@ -0,0 +1,283 @@
+package main
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"fmt"
+	"io"
+	"net/http"
+	"net/http/httputil"
+	"net/url"
+	"os"
+	"os/exec"
+	"path/filepath"
+	"regexp"
+	"sort"
+	"strconv"
+	"strings"
+	"sync"
+	"syscall"
+)
+
+const defaultAccountsBasePort = 9100
+
+var accountNamePattern = regexp.MustCompile(`^[a-z0-9][a-z0-9-]*$`)
+
+// frontendSettings are handled by the multi-account proxy in front of the accounts,
+// so they are cleared for the accounts themselves.
+var frontendSettings = []string{
+	"BW_PROXY_TLS_CERT",
+	"BW_PROXY_TLS_KEY",
+	"BW_PROXY_TLS_SELF_SIGNED",
+	"BW_PROXY_ALLOW_CIDRS",
+	"BW_PROXY_RATE_LIMIT",
+	"BW_PROXY_SOCKET",
+	"BW_METRICS_PORT",
+	"BW_DEBUG_PORT",
+	"BW_LOG_FILE",
+}
+
+// account is one of several Bitwarden accounts served by a single container.
+// Each account is handled by its own instance of the wrapper, running in a
+// separate process with its own CLI data directory, 'bw serve' and session.
+type account struct {
+	name      string
+	proxyPort string
+	dataDir   string
+	env       []string
+}
+
+// runAccounts starts one wrapper process per account listed in BW_ACCOUNTS and
+// routes /accounts/<name>/... on the proxy port to the respective account.
+func runAccounts(names string) {
+	basePort := defaultAccountsBasePort
+	if val := os.Getenv("BW_ACCOUNTS_BASE_PORT"); val != "" {
+		if p, err := strconv.Atoi(val); err == nil && p > 0 {
+			basePort = p
+		} else {
+			accountsLog.Warn("Invalid format for BW_ACCOUNTS_BASE_PORT, using default", "value", val, "default", basePort)
+		}
+	}
+	dataDir := getEnv("BW_ACCOUNTS_DATA_DIR", filepath.Join(os.TempDir(), "bw-accounts"))
+
+	accounts, err := parseAccounts(names, os.Environ(), dataDir, basePort)
+	if err != nil {
+		fatal(accountsLog, "Invalid account configuration", "error", err)
+	}
+	exe, err := os.Executable()
+	if err != nil {
+		fatal(accountsLog, "Failed to locate the wrapper executable", "error", err)
+	}
+
+	ctx, stop := shutdownSignals()
+	defer stop()
+
+	targets := make(map[string]*url.URL, len(accounts))
+	processes := make([]*accountProcess, 0, len(accounts))
+	for _, a := range accounts {
+		p, err := startAccount(exe, a)
+		if err != nil {
+			fatal(accountsLog, "Failed to start account", "account", a.name, "error", err)
+		}
+		processes = append(processes, p)
+		targets[a.name] = &url.URL{Scheme: "http", Host: "127.0.0.1:" + a.proxyPort}
+	}
+
+	// The accounts reload their own configuration, and handle operator signals.
+	onReload(func() {
+		for _, p := range processes {
+			_ = p.cmd.Process.Signal(syscall.SIGHUP)
+		}
+	})
+	watchOperatorSignals(func(sig os.Signal) {
+		for _, p := range processes {
+			_ = p.cmd.Process.Signal(sig)
+		}
+	})
+
+	bwProxyPort := getEnv("BW_PROXY_PORT", "8087")
+	accountsLog.Info("Starting multi-account proxy server", "port", bwProxyPort, "accounts", names)
+	supervise("proxy server", func() error { return listenAndServe(bwProxyPort, setupAccountsRouter(targets)) })
+	sdNotify("READY=1")
+
+	// The accounts only receive signals sent to the container through this process.
+	awaitShutdown(ctx, func(ctx context.Context) {
+		for _, p := range processes {
+			_ = p.cmd.Process.Signal(syscall.SIGTERM)
+		}
+		for _, p := range processes {
+			select {
+			case <-p.done:
+			case <-ctx.Done():
+				accountsLog.Warn("Account did not stop in time", "account", p.name)
+			}
+		}
+	}, shutdownTracing)
+}
+
+// accountProcess is the running wrapper of an account.
+type accountProcess struct {
+	name string
+	cmd  *exec.Cmd
+	done chan struct{}
+}
+
+// parseAccounts builds the account configurations. Every account inherits the
+// environment, overridden by variables of the form BW_ACCOUNT_<NAME>_<VAR>, which
+// are passed on as BW_<VAR>. Ports are assigned consecutively from basePort.
+func parseAccounts(names string, environ []string, dataDir string, basePort int) ([]account, error) {
+	var accounts []account
+	seen := map[string]bool{}
+	for _, name := range strings.Split(names, ",") {
+		name = strings.TrimSpace(name)
+		if !accountNamePattern.MatchString(name) {
+			return nil, fmt.Errorf("invalid account name '%s', only lowercase letters, digits and '-' are allowed", name)
+		}
+		if seen[name] {
+			return nil, fmt.Errorf("duplicate account name '%s'", name)
+		}
+		seen[name] = true
+		accounts = append(accounts, account{name: name})
+	}
+
+	// Match longer account names first, so BW_ACCOUNT_A_B_X belongs to "a-b" rather than "a".
+	byPrefix := make([]int, len(accounts))
+	for i := range byPrefix {
+		byPrefix[i] = i
+	}
+	sort.Slice(byPrefix, func(i, j int) bool { return len(accounts[byPrefix[i]].name) > len(accounts[byPrefix[j]].name) })
+
+	var shared []string
+	overrides := make([][]string, len(accounts))
+	for _, kv := range environ {
+		key, value, _ := strings.Cut(kv, "=")
+		if key == "BW_ACCOUNTS" || strings.HasPrefix(key, "BW_ACCOUNTS_") {
+			continue
+		}
+		rest, ok := strings.CutPrefix(key, "BW_ACCOUNT_")
+		if !ok {
+			shared = append(shared, kv)
+			continue
+		}
+		for _, i := range byPrefix {
+			prefix := strings.ToUpper(strings.ReplaceAll(accounts[i].name, "-", "_")) + "_"
+			if variable, ok := strings.CutPrefix(rest, prefix); ok && variable != "" {
+				overrides[i] = append(overrides[i], "BW_"+variable+"="+value)
+				break
+			}
+		}
+	}
+
+	for i := range accounts {
+		a := &accounts[i]
+		a.proxyPort = strconv.Itoa(basePort + 2*i)
+		a.dataDir = filepath.Join(dataDir, a.name)
+		env := append([]string{}, shared...)
+		env = append(env,
+			"BITWARDENCLI_APPDATA_DIR="+a.dataDir,
+			"BW_PROXY_PORT="+a.proxyPort,
+			"BW_SERVE_PORT="+strconv.Itoa(basePort+2*i+1),
+			"BW_LOG_ACCOUNT="+a.name,
+		)
+		// Later entries take precedence, so account specific settings win.
+		env = append(env, overrides[i]...)
+		for _, key := range frontendSettings {
+			env = append(env, key+"=")
+		}
+		// The accounts are only reached through the multi-account proxy.
+		a.env = append(env, "BW_PROXY_BIND=127.0.0.1")
+	}
+	return accounts, nil
+}
+
+// startAccount runs the wrapper for a single account. If it exits other than on
+// shutdown, the whole container exits, matching the behaviour of a single account setup.
+func startAccount(exe string, a account) (*accountProcess, error) {
+	if err := os.MkdirAll(a.dataDir, 0o700); err != nil {
+		return nil, fmt.Errorf("failed to create data directory: %v", err)
+	}
+
+	cmd := exec.Command(exe)
+	cmd.Env = a.env
+	// The output of the accounts goes to the log file of the multi-account process.
+	stdout, stderr := consoleWriter(os.Stdout), consoleWriter(os.Stderr)
+	cmd.Stdout = &prefixWriter{w: stdout, prefix: "[" + a.name + "] "}
+	cmd.Stderr = &prefixWriter{w: stderr, prefix: "[" + a.name + "] "}
+	if logFormatJSON() {
+		// JSON log lines carry the account as an attribute instead, a prefix would break them.
+		cmd.Stderr = stderr
+	}
+	if err := cmd.Start(); err != nil {
+		return nil, err
+	}
+	p := &accountProcess{name: a.name, cmd: cmd, done: make(chan struct{})}
+	go func() {
+		err := cmd.Wait()
+		close(p.done)
+		if shuttingDown.Load() {
+			return
+		}
+		// The remaining accounts are stopped as well, so the container gets restarted.
+		failTask(fmt.Errorf("account '%s' exited unexpectedly: %w", a.name, err))
+	}()
+	return p, nil
+}
+
+// setupAccountsRouter routes /accounts/<name>/... to the proxy of each account,
+// with the prefix stripped.
+func setupAccountsRouter(targets map[string]*url.URL) *http.ServeMux {
+	mux := http.NewServeMux()
+
+	mux.HandleFunc("/healthz", func(w http.ResponseWriter, r *http.Request) {
+		w.WriteHeader(http.StatusOK)
+		_, _ = fmt.Fprint(w, "OK")
+	})
+
+	names := make([]string, 0, len(targets))
+	for name, target := range targets {
+		names = append(names, name)
+		proxy := &httputil.ReverseProxy{
+			Rewrite: func(pr *httputil.ProxyRequest) {
+				pr.SetURL(target)
+			},
+		}
+		prefix := "/accounts/" + name
+		mux.Handle(prefix+"/", http.StripPrefix(prefix, proxy))
+	}
+	sort.Strings(names)
+
+	mux.HandleFunc("/accounts", func(w http.ResponseWriter, r *http.Request) {
+		w.Header().Set("Content-Type", "application/json")
+		_ = json.NewEncoder(w).Encode(names)
+	})
+
+	return mux
+}
+
+// prefixWriter prefixes every line written to w, so the output of several
+// account processes can be told apart.
+type prefixWriter struct {
+	mu     sync.Mutex
+	w      io.Writer
+	prefix string
+	buf    []byte
+}
+
+func (p *prefixWriter) Write(b []byte) (int, error) {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+
+	p.buf = append(p.buf, b...)
+	for {
+		i := bytes.IndexByte(p.buf, '\n')
+		if i < 0 {
+			break
+		}
+		if _, err := io.WriteString(p.w, p.prefix+string(p.buf[:i+1])); err != nil {
+			return 0, err
+		}
+		p.buf = p.buf[i+1:]
+	}
+	return len(b), nil
+}
@@ -0,0 +1,113 @@
+package main
+
+import (
+	"bytes"
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"strings"
+	"testing"
+)
+
+func TestParseAccounts(t *testing.T) {
+	environ := []string{
+		"BW_ACCOUNTS=work,work-eu",
+		"BW_SYNC_INTERVAL=5m",
+		"BW_CLIENTID=shared-id",
+		"BW_ACCOUNT_WORK_CLIENTID=work-id",
+		"BW_ACCOUNT_WORK_EU_CLIENTID=work-eu-id",
+		"BW_ACCOUNT_WORK_EU_HOST=https://vault.example.eu",
+	}
+
+	accounts, err := parseAccounts("work, work-eu", environ, "/data", 9100)
+	if err != nil {
+		t.Fatalf("expected nil, got %v", err)
+	}
+	if len(accounts) != 2 {
+		t.Fatalf("got %d accounts, want 2", len(accounts))
+	}
+
+	work, workEU := accounts[0], accounts[1]
+	if work.proxyPort != "9100" || workEU.proxyPort != "9102" {
+		t.Errorf("proxy ports = %s, %s, want 9100, 9102", work.proxyPort, workEU.proxyPort)
+	}
+	if lookupEnv(work.env, "BW_CLIENTID") != "work-id" {
+		t.Errorf("work BW_CLIENTID = %q, want work-id", lookupEnv(work.env, "BW_CLIENTID"))
+	}
+	if lookupEnv(work.env, "BW_HOST") != "" {
+		t.Errorf("work BW_HOST = %q, want it unset", lookupEnv(work.env, "BW_HOST"))
+	}
+	if lookupEnv(workEU.env, "BW_CLIENTID") != "work-eu-id" || lookupEnv(workEU.env, "BW_HOST") != "https://vault.example.eu" {
+		t.Errorf("work-eu env = %v, want its own client ID and host", workEU.env)
+	}
+	for _, a := range accounts {
+		if lookupEnv(a.env, "BW_SYNC_INTERVAL") != "5m" {
+			t.Errorf("%s did not inherit shared settings", a.name)
+		}
+		if lookupEnv(a.env, "BW_ACCOUNTS") != "" {
+			t.Errorf("%s must not inherit BW_ACCOUNTS", a.name)
+		}
+		if lookupEnv(a.env, "BITWARDENCLI_APPDATA_DIR") != "/data/"+a.name {
+			t.Errorf("%s data dir = %q, want /data/%s", a.name, lookupEnv(a.env, "BITWARDENCLI_APPDATA_DIR"), a.name)
+		}
+	}
+}
+
+func TestParseAccounts_InvalidNames(t *testing.T) {
+	for _, names := range []string{"Work", "work,work", "", "a/b"} {
+		if _, err := parseAccounts(names, nil, "/data", 9100); err == nil {
+			t.Errorf("parseAccounts(%q) expected error", names)
+		}
+	}
+}
+
+// lookupEnv returns the effective value of key in env, where later entries win.
+func lookupEnv(env []string, key string) string {
+	var value string
+	for _, kv := range env {
+		if v, ok := strings.CutPrefix(kv, key+"="); ok {
+			value = v
+		}
+	}
+	return value
+}
+
+func TestAccountsRouter(t *testing.T) {
+	backend := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		_, _ = w.Write([]byte(r.URL.Path))
+	}))
+	defer backend.Close()
+
+	target, _ := url.Parse(backend.URL)
+	router := setupAccountsRouter(map[string]*url.URL{"work": target})
+
+	req, _ := http.NewRequest("GET", "/accounts/work/object/item/123", nil)
+	rr := httptest.NewRecorder()
+	router.ServeHTTP(rr, req)
+
+	if rr.Code != http.StatusOK {
+		t.Fatalf("handler returned wrong status code: got %v want %v", rr.Code, http.StatusOK)
+	}
+	if rr.Body.String() != "/object/item/123" {
+		t.Errorf("backend saw path %q, want /object/item/123", rr.Body.String())
+	}
+
+	req, _ = http.NewRequest("GET", "/accounts/unknown/status", nil)
+	rr = httptest.NewRecorder()
+	router.ServeHTTP(rr, req)
+	if rr.Code != http.StatusNotFound {
+		t.Errorf("unknown account returned status %v, want %v", rr.Code, http.StatusNotFound)
+	}
+}
+
+func TestPrefixWriter(t *testing.T) {
+	var out bytes.Buffer
+	w := &prefixWriter{w: &out, prefix: "[work] "}
+	_, _ = w.Write([]byte("first line\nsecond "))
+	_, _ = w.Write([]byte("line\n"))
+
+	want := "[work] first line\n[work] second line\n"
+	if out.String() != want {
+		t.Errorf("output = %q, want %q", out.String(), want)
+	}
+}
@@ -0,0 +1,187 @@
+package main
+
+import (
+	"context"
+	"crypto/subtle"
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"os"
+	"strings"
+)
+
+// registerAdminRoutes adds the administrative endpoints. They are only available
+// when BW_ADMIN_TOKEN is configured, and require it as a bearer token.
+func registerAdminRoutes(mux *http.ServeMux) {
+	mux.HandleFunc("/admin/relogin", requireAdminToken(handleRelogin))
+	mux.HandleFunc("/admin/loglevel", requireAdminToken(handleLogLevel))
+	mux.HandleFunc("/admin/events", requireAdminToken(handleEvents))
+	mux.HandleFunc("/admin/lameduck", requireAdminToken(handleLameDuck))
+	mux.HandleFunc("/admin/sync/pause", requireAdminToken(handleSyncPause(true)))
+	mux.HandleFunc("/admin/sync/resume", requireAdminToken(handleSyncPause(false)))
+	mux.HandleFunc("/admin/cache/flush", requireAdminToken(handleCacheFlush))
+}
+
+// requireAdminToken rejects requests that don't carry the admin token.
+func requireAdminToken(next http.HandlerFunc) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		adminToken, err := getSecret("BW_ADMIN_TOKEN")
+		if err != nil || adminToken == "" {
+			http.NotFound(w, r)
+			return
+		}
+		token, ok := strings.CutPrefix(r.Header.Get("Authorization"), "Bearer ")
+		if !ok || subtle.ConstantTimeCompare([]byte(token), []byte(adminToken)) != 1 {
+			w.Header().Set("WWW-Authenticate", `Bearer realm="admin"`)
+			http.Error(w, "Unauthorized", http.StatusUnauthorized)
+			return
+		}
+		next(w, r)
+	}
+}
+
+// reloginRequest carries optional new credentials. Omitted fields keep their current value.
+type reloginRequest struct {
+	ClientID     string `json:"clientId"`
+	ClientSecret string `json:"clientSecret"`
+	Password     string `json:"password"`
+}
+
+// handleRelogin rotates the credentials at runtime: it logs out, logs in and unlocks
+// with the new credentials, then swaps 'bw serve' over to the new session.
+func handleRelogin(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodPost {
+		http.Error(w, "Method not allowed", http.StatusMethodNotAllowed)
+		return
+	}
+
+	var req reloginRequest
+	if r.ContentLength != 0 {
+		if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+			http.Error(w, fmt.Sprintf("Invalid request body: %v", err), http.StatusBadRequest)
+			return
+		}
+	}
+
+	if source := externalPasswordSource(); req.Password != "" && source != "" {
+		http.Error(w, fmt.Sprintf("The master password is read from %s and cannot be replaced", source), http.StatusConflict)
+		return
+	}
+	if err := relogin(getEnv("BW_SERVE_PORT", "8088"), req); err != nil {
+		adminLog.Error("Relogin failed", "request_id", requestID(r), "error", err)
+		recordEvent(eventReloginFailed, "Relogin failed", err)
+		http.Error(w, fmt.Sprintf("Relogin failed: %v", err), http.StatusInternalServerError)
+		return
+	}
+	w.WriteHeader(http.StatusOK)
+	_, _ = fmt.Fprint(w, "Relogin successful")
+}
+
+// relogin performs logout, login and unlock with the given credentials and
+// restarts 'bw serve' with the resulting session. Proxied requests are held back
+// until 'bw serve' is back. If the login fails, the previous credentials are
+// restored and used to log in again, so a typo doesn't leave the proxy logged out.
+func relogin(port string, req reloginRequest) error {
+	reunlockMu.Lock()
+	defer reunlockMu.Unlock()
+
+	var previous []savedSecret
+	restore := func() {
+		for _, s := range previous {
+			s.restore()
+		}
+	}
+	for key, value := range map[string]string{
+		"BW_CLIENTID":     req.ClientID,
+		"BW_CLIENTSECRET": req.ClientSecret,
+		"BW_PASSWORD":     req.Password,
+	} {
+		if value == "" {
+			continue
+		}
+		previous = append(previous, saveSecret(key))
+		storeSecret(key, value)
+	}
+
+	sessionGate.close()
+	defer sessionGate.open()
+
+	adminLog.Info("Logging out for relogin")
+	ctx, cancel, err := cliContext(context.Background())
+	if err != nil {
+		restore()
+		return err
+	}
+	output, err := observeCLIOutput("bw logout", execCommand(ctx, "bw", "logout").CombinedOutput)
+	cancel()
+	if err != nil {
+		adminLog.Warn("bw logout failed", "output", strings.TrimSpace(string(output)), "error", err)
+	}
+
+	session, err := login()
+	if err != nil {
+		if len(previous) == 0 {
+			return err
+		}
+		adminLog.Warn("Login with the new credentials failed, restoring the previous ones", "error", err)
+		restore()
+		restored, restoreErr := login()
+		if restoreErr != nil {
+			return fmt.Errorf("%v; logging in again with the previous credentials failed: %v", err, restoreErr)
+		}
+		if useErr := useSession(port, restored); useErr != nil {
+			return fmt.Errorf("%v; restoring the previous session failed: %v", err, useErr)
+		}
+		return err
+	}
+	if err := useSession(port, session); err != nil {
+		return err
+	}
+	adminLog.Info("Relogin successful, 'bw serve' restarted with the new session")
+	recordEvent(eventRelogin, "Relogin successful", nil)
+	return nil
+}
+
+// useSession makes the session of a new login available to child processes and
+// restarts 'bw serve' with it.
+func useSession(port, session string) error {
+	recordLogin()
+	if err := os.Setenv("BW_SESSION", session); err != nil {
+		return fmt.Errorf("failed to set BW_SESSION environment variable: %v", err)
+	}
+	recordSessionStart()
+	persistSession(session)
+	return restartWithSession(port, session)
+}
+
+// logLevelRequest is the body of GET and PUT /admin/loglevel.
+type logLevelRequest struct {
+	Level string `json:"level"`
+}
+
+// handleLogLevel reports or changes the log level at runtime, e.g. to debug an issue
+// without restarting the container. The change is lost on restart.
+func handleLogLevel(w http.ResponseWriter, r *http.Request) {
+	switch r.Method {
+	case http.MethodGet:
+	case http.MethodPut:
+		var req logLevelRequest
+		if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+			http.Error(w, fmt.Sprintf("Invalid request body: %v", err), http.StatusBadRequest)
+			return
+		}
+		level, err := parseLogLevel(req.Level)
+		if err != nil {
+			http.Error(w, fmt.Sprintf("Invalid log level '%s', expected debug, info, warn or error", req.Level), http.StatusBadRequest)
+			return
+		}
+		adminLog.Info("Changing the log level", "request_id", requestID(r), "from", logLevel.Level(), "to", level)
+		logLevel.Set(level)
+	default:
+		http.Error(w, "Method not allowed", http.StatusMethodNotAllowed)
+		return
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	_ = json.NewEncoder(w).Encode(logLevelRequest{Level: strings.ToLower(logLevel.Level().String())})
+}
@@ -0,0 +1,238 @@
+package main
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"net/http/httputil"
+	"net/url"
+	"os"
+	"os/exec"
+	"path/filepath"
+	"strings"
+	"testing"
+)
+
+func TestAdminRelogin_Disabled(t *testing.T) {
+	t.Setenv("BW_ADMIN_TOKEN", "")
+
+	u, _ := url.Parse("http://localhost:8080")
+	router := setupRouter(httputil.NewSingleHostReverseProxy(u))
+
+	req, _ := http.NewRequest("POST", "/admin/relogin", nil)
+	req.Header.Set("Authorization", "Bearer anything")
+	rr := httptest.NewRecorder()
+	router.ServeHTTP(rr, req)
+
+	if rr.Code != http.StatusNotFound {
+		t.Errorf("handler returned wrong status code: got %v want %v", rr.Code, http.StatusNotFound)
+	}
+}
+
+func TestAdminRelogin_Unauthorized(t *testing.T) {
+	t.Setenv("BW_ADMIN_TOKEN", "admin-token")
+
+	u, _ := url.Parse("http://localhost:8080")
+	router := setupRouter(httputil.NewSingleHostReverseProxy(u))
+
+	for _, header := range []string{"", "Bearer wrong-token", "admin-token"} {
+		req, _ := http.NewRequest("POST", "/admin/relogin", nil)
+		if header != "" {
+			req.Header.Set("Authorization", header)
+		}
+		rr := httptest.NewRecorder()
+		router.ServeHTTP(rr, req)
+
+		if rr.Code != http.StatusUnauthorized {
+			t.Errorf("Authorization %q: got status %v want %v", header, rr.Code, http.StatusUnauthorized)
+		}
+	}
+}
+
+func TestAdminRelogin_MethodNotAllowed(t *testing.T) {
+	t.Setenv("BW_ADMIN_TOKEN", "admin-token")
+
+	u, _ := url.Parse("http://localhost:8080")
+	router := setupRouter(httputil.NewSingleHostReverseProxy(u))
+
+	req, _ := http.NewRequest("GET", "/admin/relogin", nil)
+	req.Header.Set("Authorization", "Bearer admin-token")
+	rr := httptest.NewRecorder()
+	router.ServeHTTP(rr, req)
+
+	if rr.Code != http.StatusMethodNotAllowed {
+		t.Errorf("handler returned wrong status code: got %v want %v", rr.Code, http.StatusMethodNotAllowed)
+	}
+}
+
+func TestAdminRelogin(t *testing.T) {
+	stateFile := filepath.Join(t.TempDir(), "logged-in")
+	if err := os.WriteFile(stateFile, nil, 0o600); err != nil {
+		t.Fatal(err)
+	}
+	execCommand = mockExecCommandEnv("MOCK_BW_STATE_FILE=" + stateFile)
+	defer func() { execCommand = exec.CommandContext }()
+	t.Cleanup(func() {
+		scrubbedSecretsMu.Lock()
+		scrubbedSecrets = map[string]string{}
+		scrubbedSecretsMu.Unlock()
+	})
+
+	ts := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.WriteHeader(http.StatusOK)
+		_, _ = w.Write([]byte(`{"data": {"template": {"status": "unlocked"}}}`))
+	}))
+	defer ts.Close()
+	u, _ := url.Parse(ts.URL)
+
+	t.Setenv("BW_ADMIN_TOKEN", "admin-token")
+	t.Setenv("BW_SERVE_PORT", u.Port())
+	t.Setenv("BW_SERVE_WAIT_INTERVAL", "10ms")
+	t.Setenv("BW_LOGIN_METHOD", "password")
+	t.Setenv("BW_EMAIL", "user@example.com")
+	t.Setenv("BW_PASSWORD", "old-password")
+	t.Setenv("BW_SESSION", "old-session")
+	t.Setenv("BW_SESSION_STATE_FILE", "")
+
+	if err := bwServe.start(u.Port(), "old-session"); err != nil {
+		t.Fatalf("start failed: %v", err)
+	}
+	defer bwServe.stop()
+
+	router := setupRouter(httputil.NewSingleHostReverseProxy(u))
+	req, _ := http.NewRequest("POST", "/admin/relogin", strings.NewReader(`{"password":"test-password"}`))
+	req.Header.Set("Authorization", "Bearer admin-token")
+	rr := httptest.NewRecorder()
+	router.ServeHTTP(rr, req)
+
+	if rr.Code != http.StatusOK {
+		t.Fatalf("handler returned wrong status code: got %v want %v, body: %s", rr.Code, http.StatusOK, rr.Body.String())
+	}
+	if got := os.Getenv("BW_SESSION"); got != "test-session-token" {
+		t.Errorf("BW_SESSION = %q, want %q", got, "test-session-token")
+	}
+	if _, ok := os.LookupEnv("BW_PASSWORD"); ok {
+		t.Error("BW_PASSWORD should be replaced by the in-memory credential")
+	}
+	if got, _ := getSecret("BW_PASSWORD"); got != "test-password" {
+		t.Errorf("getSecret(BW_PASSWORD) = %q, want %q", got, "test-password")
+	}
+	if !containsArgs(bwServe.cmd.Args, "--session", "test-session-token") {
+		t.Errorf("'bw serve' args = %v, want new session", bwServe.cmd.Args)
+	}
+}
+
+func TestAdminLogLevel(t *testing.T) {
+	t.Setenv("BW_ADMIN_TOKEN", "admin-token")
+	defer logLevel.Set(logLevel.Level())
+
+	u, _ := url.Parse("http://localhost:8080")
+	router := setupRouter(httputil.NewSingleHostReverseProxy(u))
+
+	tests := []struct {
+		method, body string
+		wantStatus   int
+		wantBody     string
+	}{
+		{"PUT", `{"level":"debug"}`, http.StatusOK, `{"level":"debug"}`},
+		{"GET", "", http.StatusOK, `{"level":"debug"}`},
+		{"PUT", `{"level":"verbose"}`, http.StatusBadRequest, ""},
+		{"PUT", `{"level":"warn"}`, http.StatusOK, `{"level":"warn"}`},
+		{"POST", "", http.StatusMethodNotAllowed, ""},
+	}
+	for _, tt := range tests {
+		req, _ := http.NewRequest(tt.method, "/admin/loglevel", strings.NewReader(tt.body))
+		req.Header.Set("Authorization", "Bearer admin-token")
+		rr := httptest.NewRecorder()
+		router.ServeHTTP(rr, req)
+
+		if rr.Code != tt.wantStatus {
+			t.Errorf("%s %s: got status %v want %v", tt.method, tt.body, rr.Code, tt.wantStatus)
+		}
+		if tt.wantBody != "" && strings.TrimSpace(rr.Body.String()) != tt.wantBody {
+			t.Errorf("%s %s: got body %q want %q", tt.method, tt.body, rr.Body.String(), tt.wantBody)
+		}
+	}
+}
+
+func TestAdminRelogin_LoginFails(t *testing.T) {
+	stateFile := filepath.Join(t.TempDir(), "logged-in")
+	if err := os.WriteFile(stateFile, nil, 0o600); err != nil {
+		t.Fatal(err)
+	}
+	execCommand = mockExecCommandEnv("MOCK_BW_STATE_FILE=" + stateFile)
+	defer func() { execCommand = exec.CommandContext }()
+	t.Cleanup(func() {
+		scrubbedSecretsMu.Lock()
+		scrubbedSecrets = map[string]string{}
+		scrubbedSecretsMu.Unlock()
+	})
+
+	ts := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.WriteHeader(http.StatusOK)
+		_, _ = w.Write([]byte(`{"data": {"template": {"status": "unlocked"}}}`))
+	}))
+	defer ts.Close()
+	u, _ := url.Parse(ts.URL)
+
+	t.Setenv("BW_ADMIN_TOKEN", "admin-token")
+	t.Setenv("BW_SERVE_PORT", u.Port())
+	t.Setenv("BW_SERVE_WAIT_INTERVAL", "10ms")
+	t.Setenv("BW_LOGIN_METHOD", "password")
+	t.Setenv("BW_EMAIL", "user@example.com")
+	passwordFile := filepath.Join(t.TempDir(), "password")
+	if err := os.WriteFile(passwordFile, []byte("test-password\n"), 0o600); err != nil {
+		t.Fatal(err)
+	}
+	t.Setenv("BW_PASSWORD", "")
+	t.Setenv("BW_PASSWORD_FILE", passwordFile)
+	t.Setenv("BW_SESSION", "old-session")
+	t.Setenv("BW_SESSION_STATE_FILE", "")
+	t.Setenv("BW_LOGIN_RETRIES", "1")
+
+	if err := bwServe.start(u.Port(), "old-session"); err != nil {
+		t.Fatalf("start failed: %v", err)
+	}
+	defer bwServe.stop()
+
+	router := setupRouter(httputil.NewSingleHostReverseProxy(u))
+	req, _ := http.NewRequest("POST", "/admin/relogin", strings.NewReader(`{"password":"wrong-password"}`))
+	req.Header.Set("Authorization", "Bearer admin-token")
+	rr := httptest.NewRecorder()
+	router.ServeHTTP(rr, req)
+
+	if rr.Code != http.StatusInternalServerError {
+		t.Fatalf("handler returned wrong status code: got %v want %v", rr.Code, http.StatusInternalServerError)
+	}
+	if got, _ := getSecret("BW_PASSWORD"); got != "test-password" {
+		t.Errorf("getSecret(BW_PASSWORD) = %q, want the previous password", got)
+	}
+	if got := os.Getenv("BW_PASSWORD_FILE"); got != passwordFile {
+		t.Errorf("BW_PASSWORD_FILE = %q, want it restored to %q", got, passwordFile)
+	}
+	// Logged in again with the previous password, 'bw serve' serves a working session.
+	if got := os.Getenv("BW_SESSION"); got != "test-session-token" {
+		t.Errorf("BW_SESSION = %q, want %q", got, "test-session-token")
+	}
+	if !containsArgs(bwServe.cmd.Args, "--session", "test-session-token") {
+		t.Errorf("'bw serve' args = %v, want the restored session", bwServe.cmd.Args)
+	}
+	if _, err := os.Stat(stateFile); err != nil {
+		t.Error("expected the CLI to be logged in again")
+	}
+}
+
+func TestAdminRelogin_ExternalPasswordSource(t *testing.T) {
+	t.Setenv("BW_ADMIN_TOKEN", "admin-token")
+	t.Setenv("BW_PASSWORD_GCP_SECRET", "projects/p/secrets/bw-password/versions/latest")
+
+	u, _ := url.Parse("http://localhost:8080")
+	router := setupRouter(httputil.NewSingleHostReverseProxy(u))
+	req, _ := http.NewRequest("POST", "/admin/relogin", strings.NewReader(`{"password":"test-password"}`))
+	req.Header.Set("Authorization", "Bearer admin-token")
+	rr := httptest.NewRecorder()
+	router.ServeHTTP(rr, req)
+
+	if rr.Code != http.StatusConflict || !strings.Contains(rr.Body.String(), "BW_PASSWORD_GCP_SECRET") {
+		t.Errorf("got %v %q, want 409 naming the password source", rr.Code, rr.Body.String())
+	}
+}
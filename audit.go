@@ -0,0 +1,132 @@
+package main
+
+import (
+	"encoding/json"
+	"fmt"
+	"io"
+	"net/http"
+	"os"
+	"slices"
+	"strings"
+	"sync"
+	"time"
+)
+
+// auditEntry records a single access to vault items.
+type auditEntry struct {
+	Time      time.Time `json:"time"`
+	RequestID string    `json:"requestId"`
+	Client    string    `json:"client"`
+	Identity  string    `json:"identity,omitempty"`
+	Method    string    `json:"method"`
+	Path      string    `json:"path"`
+	Object    string    `json:"object"`
+	ObjectID  string    `json:"objectId,omitempty"`
+	Status    int       `json:"status"`
+}
+
+// auditLogger writes audit entries as JSON lines, separate from the regular logs.
+type auditLogger struct {
+	mu  sync.Mutex
+	out io.Writer
+}
+
+// auditLoggerFromEnv opens the audit log configured by BW_AUDIT_LOG, which is either
+// "stdout", "stderr" or a file path. It returns nil if auditing is disabled.
+func auditLoggerFromEnv() (*auditLogger, error) {
+	switch target := os.Getenv("BW_AUDIT_LOG"); target {
+	case "":
+		return nil, nil
+	case "stdout":
+		return &auditLogger{out: consoleWriter(os.Stdout)}, nil
+	case "stderr":
+		return &auditLogger{out: consoleWriter(os.Stderr)}, nil
+	default:
+		f, err := os.OpenFile(target, os.O_WRONLY|os.O_APPEND|os.O_CREATE, 0o600)
+		if err != nil {
+			return nil, fmt.Errorf("failed to open audit log '%s': %v", target, err)
+		}
+		return &auditLogger{out: f}, nil
+	}
+}
+
+// log writes an entry. Failures are reported, but never fail the request.
+func (l *auditLogger) log(entry auditEntry) {
+	line, err := json.Marshal(entry)
+	if err != nil {
+		auditLog.Error("Failed to encode audit entry", "error", err)
+		return
+	}
+	l.mu.Lock()
+	defer l.mu.Unlock()
+	if _, err := l.out.Write(append(line, '\n')); err != nil {
+		auditLog.Error("Failed to write audit entry", "error", err)
+	}
+}
+
+// auditedObject returns the kind and id of the vault object a request accesses, and
+// whether the request is audited at all. Audited are item lists and all requests for
+// items, their fields and attachments.
+func auditedObject(r *http.Request) (string, string, bool) {
+	parts := strings.Split(strings.Trim(r.URL.Path, "/"), "/")
+	switch {
+	case len(parts) == 3 && parts[0] == "list" && parts[1] == "object" && parts[2] == "items":
+		return "items", "", true
+	case len(parts) == 2 && parts[0] == "object" && (parts[1] == "item" || parts[1] == "attachment"):
+		return parts[1], "", true
+	case len(parts) == 3 && parts[0] == "object" && (parts[1] == "attachment" || slices.Contains(itemObjectKinds, parts[1])):
+		return parts[1], parts[2], true
+	case len(parts) == 3 && parts[0] == "restore" && parts[1] == "item":
+		return "item", parts[2], true
+	}
+	return "", "", false
+}
+
+// middleware records every audited request with the status it was answered with.
+func (l *auditLogger) middleware(next http.Handler) http.Handler {
+	trustedProxies, _ := parseCIDRs(os.Getenv("BW_PROXY_TRUSTED_PROXIES"))
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		object, objectID, ok := auditedObject(r)
+		if !ok {
+			next.ServeHTTP(w, r)
+			return
+		}
+
+		rec := &statusRecorder{ResponseWriter: w, status: http.StatusOK}
+		next.ServeHTTP(rec, r)
+		l.log(auditEntry{
+			Time:      time.Now().UTC(),
+			RequestID: requestID(r),
+			Client:    clientIP(r, trustedProxies).String(),
+			Identity:  requestIdentity(r),
+			Method:    r.Method,
+			Path:      r.URL.Path,
+			Object:    object,
+			ObjectID:  objectID,
+			Status:    rec.status,
+		})
+	})
+}
+
+// statusRecorder remembers the status code and size of a response.
+type statusRecorder struct {
+	http.ResponseWriter
+	status int
+	bytes  int64
+}
+
+func (s *statusRecorder) WriteHeader(status int) {
+	s.status = status
+	s.ResponseWriter.WriteHeader(status)
+}
+
+func (s *statusRecorder) Write(b []byte) (int, error) {
+	n, err := s.ResponseWriter.Write(b)
+	s.bytes += int64(n)
+	return n, err
+}
+
+// Unwrap allows http.ResponseController to reach the underlying writer, e.g. to flush.
+func (s *statusRecorder) Unwrap() http.ResponseWriter {
+	return s.ResponseWriter
+}
@@ -0,0 +1,70 @@
+package main
+
+import (
+	"bufio"
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"testing"
+)
+
+func TestAuditLog(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "audit.log")
+	t.Setenv("BW_AUDIT_LOG", path)
+	t.Setenv("BW_SCOPE_ORGANIZATIONS", "org-a")
+	router := newScopeTestRouter(t)
+
+	for _, p := range []string{"/object/item/item-a", "/object/password/item-b", "/list/object/items", "/status"} {
+		req, _ := http.NewRequest("GET", p, nil)
+		req.RemoteAddr = "10.0.0.1:1234"
+		router.ServeHTTP(httptest.NewRecorder(), req)
+	}
+
+	f, err := os.Open(path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer func() { _ = f.Close() }()
+
+	var entries []auditEntry
+	scanner := bufio.NewScanner(f)
+	for scanner.Scan() {
+		var entry auditEntry
+		if err := json.Unmarshal(scanner.Bytes(), &entry); err != nil {
+			t.Fatalf("invalid audit entry %q: %v", scanner.Text(), err)
+		}
+		entries = append(entries, entry)
+	}
+
+	if len(entries) != 3 {
+		t.Fatalf("expected 3 audit entries, got %d: %+v", len(entries), entries)
+	}
+	want := []struct {
+		object, id string
+		status     int
+	}{
+		{"item", "item-a", http.StatusOK},
+		{"password", "item-b", http.StatusForbidden},
+		{"items", "", http.StatusOK},
+	}
+	for i, w := range want {
+		e := entries[i]
+		if e.Object != w.object || e.ObjectID != w.id || e.Status != w.status || e.Client != "10.0.0.1" || e.Method != "GET" {
+			t.Errorf("entry %d = %+v, want %s %s %d from 10.0.0.1", i, e, w.object, w.id, w.status)
+		}
+	}
+}
+
+func TestAuditLogUnavailable(t *testing.T) {
+	t.Setenv("BW_AUDIT_LOG", filepath.Join(t.TempDir(), "missing", "audit.log"))
+	router := newTestUpstream(t)
+
+	req, _ := http.NewRequest("GET", "/object/item/item-a", nil)
+	rr := httptest.NewRecorder()
+	router.ServeHTTP(rr, req)
+	if rr.Code != http.StatusInternalServerError {
+		t.Errorf("got status %v want %v", rr.Code, http.StatusInternalServerError)
+	}
+}
@@ -0,0 +1,489 @@
+package main
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"os"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// Supported values for BW_LOGIN_METHOD.
+const (
+	loginMethodAPIKey   = "apikey"
+	loginMethodPassword = "password"
+	loginMethodSSO      = "sso"
+)
+
+// Supported values for BW_UNLOCK_METHOD.
+const (
+	unlockMethodPassword     = "password"
+	unlockMethodKeyConnector = "keyconnector"
+)
+
+const (
+	defaultLoginRetries = 5
+	defaultLoginBackoff = 2 * time.Second
+	maxLoginBackoff     = 1 * time.Minute
+)
+
+// errTwoStepRequired is returned when the account requires a two-step login code
+// but no way to obtain one has been configured.
+var errTwoStepRequired = errors.New("two-step login is required but BW_TOTP_SECRET is not configured")
+
+// permanentError marks an error that retrying will not fix, such as denied access.
+type permanentError struct{ error }
+
+func (e permanentError) Unwrap() error { return e.error }
+
+// totpCodeProvider returns the authenticator code passed to 'bw login', or an empty
+// string if two-step login is not configured. It can be swapped out to source codes
+// from elsewhere.
+var totpCodeProvider = defaultTOTPCodeProvider
+
+// defaultTOTPCodeProvider computes the code from BW_TOTP_SECRET.
+func defaultTOTPCodeProvider() (string, error) {
+	secret, err := getSecret("BW_TOTP_SECRET")
+	if err != nil || secret == "" {
+		return "", err
+	}
+	return generateTOTP(secret, time.Now())
+}
+
+// loginAndGetSession handles the full Bitwarden authentication and returns the session token.
+func loginAndGetSession() (string, error) {
+	// A session injected by an orchestrator or sidecar avoids consuming API key
+	// logins on every restart, as long as it is still valid.
+	existingSession, err := getSecret("BW_SESSION")
+	if err != nil {
+		return "", err
+	}
+	if existingSession != "" {
+		if isSessionValid(existingSession) {
+			authLog.Info("Using the supplied BW_SESSION, skipping login and unlock")
+			return existingSession, nil
+		}
+		authLog.Warn("The supplied BW_SESSION is not valid, falling back to login")
+	}
+
+	// Resume a session persisted by a previous run of the container, if enabled.
+	if persistedSession := loadPersistedSession(); persistedSession != "" {
+		if isSessionValid(persistedSession) {
+			authLog.Info("Resuming the persisted session, skipping login and unlock")
+			return persistedSession, nil
+		}
+		authLog.Warn("The persisted session is no longer valid, falling back to login")
+	}
+
+	session, err := login()
+	if err != nil {
+		return "", err
+	}
+	recordLogin()
+	if session != "" {
+		persistSession(session)
+	}
+	return session, nil
+}
+
+// login performs the configured login method and, where needed, unlocks the
+// vault. It returns the resulting session token.
+func login() (string, error) {
+	authLog.Info("Executing Bitwarden login")
+	host := os.Getenv("BW_HOST")
+	method := getEnv("BW_LOGIN_METHOD", loginMethodAPIKey)
+
+	password, err := getPassword()
+	if err != nil {
+		return "", err
+	}
+
+	switch method {
+	case loginMethodAPIKey:
+		clientID, err := getSecret("BW_CLIENTID")
+		if err != nil {
+			return "", err
+		}
+		clientSecret, err := getSecret("BW_CLIENTSECRET")
+		if err != nil {
+			return "", err
+		}
+		orgKey := organizationIDFromClientID(clientID) != ""
+		if clientID == "" || clientSecret == "" || (password == "" && !orgKey && !usesKeyConnector()) {
+			return "", fmt.Errorf("missing one or more required environment variables (BW_CLIENTID, BW_CLIENTSECRET, BW_PASSWORD or their _FILE variants)")
+		}
+
+		loggedIn, err := prepareLogin(host, "")
+		if err != nil {
+			return "", err
+		}
+		if !loggedIn {
+			if err := loginWithAPIKey(clientID, clientSecret); err != nil {
+				return "", err
+			}
+		}
+		if orgKey {
+			// Organization API keys only grant access to organization management
+			// commands and have no vault that could be unlocked.
+			authLog.Info("Logged in with an organization API key, skipping vault unlock")
+			return "", nil
+		}
+		return unlock(password)
+
+	case loginMethodPassword:
+		email, err := getSecret("BW_EMAIL")
+		if err != nil {
+			return "", err
+		}
+		if email == "" || password == "" {
+			return "", fmt.Errorf("missing one or more required environment variables (BW_EMAIL, BW_PASSWORD or their _FILE variants)")
+		}
+		if usesKeyConnector() {
+			return "", fmt.Errorf("BW_UNLOCK_METHOD '%s' requires BW_LOGIN_METHOD '%s' or '%s'", unlockMethodKeyConnector, loginMethodAPIKey, loginMethodSSO)
+		}
+
+		loggedIn, err := prepareLogin(host, email)
+		if err != nil {
+			return "", err
+		}
+		if loggedIn {
+			return unlock(password)
+		}
+		return loginWithPassword(email, password)
+
+	case loginMethodSSO:
+		orgIdentifier := os.Getenv("BW_SSO_ORG_IDENTIFIER")
+		if orgIdentifier == "" || (password == "" && !usesKeyConnector()) {
+			return "", fmt.Errorf("missing one or more required environment variables (BW_SSO_ORG_IDENTIFIER, BW_PASSWORD or its _FILE variant)")
+		}
+		clientID, err := getSecret("BW_CLIENTID")
+		if err != nil {
+			return "", err
+		}
+		clientSecret, err := getSecret("BW_CLIENTSECRET")
+		if err != nil {
+			return "", err
+		}
+
+		loggedIn, err := prepareLogin(host, "")
+		if err != nil {
+			return "", err
+		}
+		if !loggedIn {
+			// SSO accounts may also use their personal API key, which works without a
+			// browser and is therefore preferred inside a container.
+			if clientID != "" && clientSecret != "" {
+				authLog.Info("API key supplied for SSO account, using API key login")
+				if err := loginWithAPIKey(clientID, clientSecret); err != nil {
+					return "", err
+				}
+			} else if err := loginWithSSO(orgIdentifier); err != nil {
+				return "", err
+			}
+		}
+		return unlock(password)
+
+	default:
+		return "", fmt.Errorf("unsupported BW_LOGIN_METHOD '%s' (expected '%s', '%s' or '%s')", method, loginMethodAPIKey, loginMethodPassword, loginMethodSSO)
+	}
+}
+
+// bwCLIStatus is the output of 'bw status'.
+type bwCLIStatus struct {
+	ServerURL string `json:"serverUrl"`
+	UserEmail string `json:"userEmail"`
+	Status    string `json:"status"`
+}
+
+// getCLIStatus runs 'bw status' and parses its output.
+func getCLIStatus() (*bwCLIStatus, error) {
+	ctx, cancel, err := cliContext(context.Background())
+	if err != nil {
+		return nil, err
+	}
+	defer cancel()
+	output, err := observeCLIOutput("bw status", execCommand(ctx, "bw", "status").Output)
+	if err != nil {
+		return nil, fmt.Errorf("bw status failed: %v", err)
+	}
+	var status bwCLIStatus
+	if err := json.Unmarshal(output, &status); err != nil {
+		return nil, fmt.Errorf("failed to parse bw status output: %v", err)
+	}
+	return &status, nil
+}
+
+// prepareLogin reconciles the CLI state with the desired login before logging in.
+// When the CLI data directory is persisted, an existing login is reused unless
+// BW_FORCE_RELOGIN is set, or it belongs to a different server or account, in which
+// case it is logged out first. It reports whether an existing login is reused; if not,
+// the server has been configured and a fresh login is needed.
+func prepareLogin(host, email string) (bool, error) {
+	status, err := getCLIStatus()
+	if err != nil {
+		authLog.Warn("Could not determine current login state, assuming logged out", "error", err)
+	} else if status.Status != "" && status.Status != "unauthenticated" {
+		relogin := getEnv("BW_FORCE_RELOGIN", "false") == "true"
+		if host != "" && strings.TrimRight(status.ServerURL, "/") != strings.TrimRight(host, "/") {
+			authLog.Info("Existing login is for a different server", "server", status.ServerURL, "expected", host)
+			relogin = true
+		}
+		if email != "" && !strings.EqualFold(status.UserEmail, email) {
+			authLog.Info("Existing login is for a different account", "account", status.UserEmail, "expected", email)
+			relogin = true
+		}
+		if !relogin {
+			authLog.Info("Already logged in, reusing the existing login", "account", status.UserEmail)
+			return true, nil
+		}
+
+		authLog.Info("Logging out of the existing session before logging in again")
+		ctx, cancel, err := cliContext(context.Background())
+		if err != nil {
+			return false, err
+		}
+		output, err := observeCLIOutput("bw logout", execCommand(ctx, "bw", "logout").CombinedOutput)
+		cancel()
+		if err != nil {
+			return false, fmt.Errorf("bw logout failed: %s - %v", string(output), err)
+		}
+	}
+
+	return false, configureServer(host)
+}
+
+// isSessionValid reports whether the given session key unlocks the vault.
+func isSessionValid(session string) bool {
+	ctx, cancel, err := cliContext(context.Background())
+	if err != nil {
+		authLog.Debug("Could not check the session", "error", err)
+		return false
+	}
+	defer cancel()
+	cmdCheck := withEnv(execCommand(ctx, "bw", "unlock", "--check"), "BW_SESSION="+session)
+	if output, err := observeCLIOutput("bw unlock --check", cmdCheck.CombinedOutput); err != nil {
+		authLog.Debug("bw unlock --check failed", "output", strings.TrimSpace(string(output)), "error", err)
+		return false
+	}
+	return true
+}
+
+// organizationIDFromClientID returns the organization ID embedded in an
+// organization API key client ID ("organization.<id>"), or an empty string for
+// personal API keys.
+func organizationIDFromClientID(clientID string) string {
+	orgID, ok := strings.CutPrefix(clientID, "organization.")
+	if !ok {
+		return ""
+	}
+	return orgID
+}
+
+// withLoginRetry runs a login step until it succeeds, retrying with exponential
+// backoff so that transient network issues at startup are not fatal. The number
+// of attempts and the initial backoff are configured via BW_LOGIN_RETRIES and
+// BW_LOGIN_BACKOFF. Errors wrapping errTwoStepRequired or a permanentError are
+// not retried.
+func withLoginRetry(step string, fn func() error) error {
+	retries := defaultLoginRetries
+	if val := os.Getenv("BW_LOGIN_RETRIES"); val != "" {
+		if r, err := strconv.Atoi(val); err == nil && r > 0 {
+			retries = r
+		} else {
+			authLog.Warn("Invalid format for BW_LOGIN_RETRIES, using default", "value", val, "default", retries)
+		}
+	}
+	backoff := defaultLoginBackoff
+	if val := os.Getenv("BW_LOGIN_BACKOFF"); val != "" {
+		if d, err := time.ParseDuration(val); err == nil {
+			backoff = d
+		} else {
+			authLog.Warn("Invalid format for BW_LOGIN_BACKOFF, using default", "value", val, "default", backoff, "error", err)
+		}
+	}
+
+	var err error
+	for attempt := 1; ; attempt++ {
+		if err = fn(); err == nil {
+			return nil
+		}
+		var permanent permanentError
+		if attempt >= retries || errors.Is(err, errTwoStepRequired) || errors.As(err, &permanent) {
+			return err
+		}
+		authLog.Warn("Step failed, retrying", "step", step, "attempt", attempt, "retries", retries, "backoff", backoff, "error", err)
+		time.Sleep(backoff)
+		backoff = min(backoff*2, maxLoginBackoff)
+	}
+}
+
+// configureServer points bw-cli at a custom server if a host is specified.
+func configureServer(host string) error {
+	if host == "" {
+		return nil
+	}
+	authLog.Info("Configuring bw-cli to use the supplied host", "host", host)
+	enterStartupStage(stageConfigure)
+	return withLoginRetry("bw config server", func() error {
+		ctx, cancel, err := cliContext(context.Background())
+		if err != nil {
+			return err
+		}
+		defer cancel()
+		cmdConfig := execCommand(ctx, "bw", "config", "server", host)
+		configResult, err := observeCLIOutput("bw config server", cmdConfig.CombinedOutput)
+		if err != nil {
+			return fmt.Errorf("bw config server failed: %s - %v", string(configResult), err)
+		}
+		return nil
+	})
+}
+
+// loginWithAPIKey logs in using the personal API key. The vault stays locked afterwards.
+func loginWithAPIKey(clientID, clientSecret string) error {
+	enterStartupStage(stageLogin)
+	err := withLoginRetry("bw login", func() error {
+		ctx, cancel, err := cliContext(context.Background())
+		if err != nil {
+			return err
+		}
+		defer cancel()
+		cmdLogin := withEnv(execCommand(ctx, "bw", "login", "--apikey"), "BW_CLIENTID="+clientID, "BW_CLIENTSECRET="+clientSecret)
+		loginOutput, err := observeCLIOutput("bw login", cmdLogin.CombinedOutput)
+		if err != nil {
+			return fmt.Errorf("bw login failed: %s - %v", string(loginOutput), err)
+		}
+		return nil
+	})
+	if err != nil {
+		return err
+	}
+	authLog.Info("Logged in successfully")
+	return nil
+}
+
+// loginWithPassword logs in using email and master password. A password login
+// also unlocks the vault, so the session key is returned directly.
+func loginWithPassword(email, password string) (string, error) {
+	enterStartupStage(stageLogin)
+	var session string
+	err := withLoginRetry("bw login", func() error {
+		// Generate the code on every attempt, as a backoff may outlast its validity.
+		code, err := totpCodeProvider()
+		if err != nil {
+			return fmt.Errorf("failed to generate two-step login code: %v", err)
+		}
+
+		args := []string{"login", email, "--passwordenv", "BW_PASSWORD", "--raw"}
+		if code != "" {
+			// Method 0 is the authenticator app (TOTP) provider.
+			args = append(args, "--method", "0", "--code", code)
+		}
+		ctx, cancel, err := cliContext(context.Background())
+		if err != nil {
+			return err
+		}
+		defer cancel()
+		cmdLogin := withEnv(execCommand(ctx, "bw", args...), "BW_PASSWORD="+password)
+		loginOutput, err := observeCLIOutput("bw login", cmdLogin.CombinedOutput)
+		if err != nil {
+			if code == "" && isTwoStepRequired(string(loginOutput)) {
+				return fmt.Errorf("%w: %s", errTwoStepRequired, strings.TrimSpace(string(loginOutput)))
+			}
+			return fmt.Errorf("bw login failed: %s - %v", string(loginOutput), err)
+		}
+		session = strings.TrimSpace(string(loginOutput))
+		return nil
+	})
+	if err != nil {
+		return "", err
+	}
+	authLog.Info("Logged in successfully")
+	return session, nil
+}
+
+// isTwoStepRequired reports whether the output of a failed 'bw login' indicates
+// that a two-step login code was expected.
+func isTwoStepRequired(output string) bool {
+	output = strings.ToLower(output)
+	return strings.Contains(output, "two-step") || strings.Contains(output, "code is required")
+}
+
+// loginWithSSO runs the interactive 'bw login --sso' flow for the given organization
+// identifier. The CLI prints an authorization URL which has to be opened by the
+// operator, so its output is streamed rather than captured.
+func loginWithSSO(orgIdentifier string) error {
+	authLog.Info("Starting SSO login, follow the instructions below to authorize this device", "organization", orgIdentifier)
+	enterStartupStage(stageLogin)
+	// The operator has to authorize the device first, so the login is not bound by BW_CLI_TIMEOUT.
+	cmdLogin := execCommand(context.Background(), "bw", "login", "--sso")
+	cmdLogin.Stdin = strings.NewReader(orgIdentifier + "\n")
+	cmdLogin.Stdout = consoleWriter(os.Stdout)
+	cmdLogin.Stderr = consoleWriter(os.Stderr)
+	if err := observeCLI("bw login --sso", cmdLogin.Run); err != nil {
+		return fmt.Errorf("bw login --sso failed: %v", err)
+	}
+	authLog.Info("Logged in successfully")
+	return nil
+}
+
+// usesKeyConnector reports whether the vault is unlocked through Key Connector
+// rather than with a master password.
+func usesKeyConnector() bool {
+	return getEnv("BW_UNLOCK_METHOD", unlockMethodPassword) == unlockMethodKeyConnector
+}
+
+// unlock unlocks the vault using the configured BW_UNLOCK_METHOD and returns the session key.
+func unlock(password string) (string, error) {
+	enterStartupStage(stageUnlock)
+	if usesKeyConnector() {
+		return unlockWithKeyConnector()
+	}
+	return unlockVault(password)
+}
+
+// unlockWithKeyConnector unlocks the vault of an account whose key is held by its
+// organization's Key Connector. Such accounts have no master password, so the CLI
+// retrieves the key from the Key Connector of the logged in account instead.
+func unlockWithKeyConnector() (string, error) {
+	authLog.Info("Unlocking vault with Key Connector")
+	var session string
+	err := withLoginRetry("bw unlock", func() error {
+		ctx, cancel, err := cliContext(context.Background())
+		if err != nil {
+			return err
+		}
+		defer cancel()
+		unlockOutput, err := observeCLIOutput("bw unlock", execCommand(ctx, "bw", "unlock", "--raw").CombinedOutput)
+		if err != nil {
+			return fmt.Errorf("bw unlock with Key Connector failed: %s - %v", string(unlockOutput), err)
+		}
+		session = strings.TrimSpace(string(unlockOutput))
+		return nil
+	})
+	return session, err
+}
+
+// unlockVault unlocks the vault with the master password and returns the session key.
+func unlockVault(password string) (string, error) {
+	authLog.Info("Unlocking vault")
+	var session string
+	err := withLoginRetry("bw unlock", func() error {
+		ctx, cancel, err := cliContext(context.Background())
+		if err != nil {
+			return err
+		}
+		defer cancel()
+		cmdUnlock := withEnv(execCommand(ctx, "bw", "unlock", "--passwordenv", "BW_PASSWORD", "--raw"), "BW_PASSWORD="+password)
+		unlockOutput, err := observeCLIOutput("bw unlock", cmdUnlock.CombinedOutput)
+		if err != nil {
+			return fmt.Errorf("bw unlock failed: %s - %v", string(unlockOutput), err)
+		}
+		session = strings.TrimSpace(string(unlockOutput))
+		return nil
+	})
+	return session, err
+}
@@ -0,0 +1,350 @@
+package main
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"os"
+	"os/exec"
+	"path/filepath"
+	"testing"
+)
+
+func TestLoginAndGetSession_FileCredentials(t *testing.T) {
+	execCommand = mockExecCommand
+	defer func() { execCommand = exec.CommandContext }()
+
+	dir := t.TempDir()
+	for name, value := range map[string]string{
+		"BW_CLIENTID":     "user.test-id",
+		"BW_CLIENTSECRET": "test-secret",
+		"BW_PASSWORD":     "test-password",
+	} {
+		path := filepath.Join(dir, name)
+		if err := os.WriteFile(path, []byte(value+"\n"), 0o600); err != nil {
+			t.Fatal(err)
+		}
+		t.Setenv(name, "")
+		t.Setenv(name+"_FILE", path)
+	}
+	t.Setenv("BW_HOST", "")
+
+	session, err := loginAndGetSession()
+	if err != nil {
+		t.Fatalf("expected nil, got %v", err)
+	}
+	if session != "test-session-token" {
+		t.Errorf("session = %q, want %q", session, "test-session-token")
+	}
+}
+
+func TestLoginAndGetSession_PasswordMethod(t *testing.T) {
+	execCommand = mockExecCommand
+	defer func() { execCommand = exec.CommandContext }()
+
+	t.Setenv("BW_LOGIN_METHOD", "password")
+	t.Setenv("BW_EMAIL", "user@example.com")
+	t.Setenv("BW_PASSWORD", "test-password")
+	t.Setenv("BW_HOST", "")
+
+	session, err := loginAndGetSession()
+	if err != nil {
+		t.Fatalf("expected nil, got %v", err)
+	}
+	if session != "test-session-token" {
+		t.Errorf("session = %q, want %q", session, "test-session-token")
+	}
+}
+
+func TestLoginAndGetSession_PasswordMethodMissingEmail(t *testing.T) {
+	t.Setenv("BW_LOGIN_METHOD", "password")
+	t.Setenv("BW_EMAIL", "")
+	t.Setenv("BW_PASSWORD", "test-password")
+
+	if _, err := loginAndGetSession(); err == nil {
+		t.Fatal("expected error when BW_EMAIL is missing")
+	}
+}
+
+func TestLoginAndGetSession_UnknownMethod(t *testing.T) {
+	t.Setenv("BW_LOGIN_METHOD", "carrier-pigeon")
+
+	if _, err := loginAndGetSession(); err == nil {
+		t.Fatal("expected error for unsupported login method")
+	}
+}
+
+func TestLoginAndGetSession_SSOMethod(t *testing.T) {
+	execCommand = mockExecCommand
+	defer func() { execCommand = exec.CommandContext }()
+
+	t.Setenv("BW_LOGIN_METHOD", "sso")
+	t.Setenv("BW_SSO_ORG_IDENTIFIER", "test-org")
+	t.Setenv("BW_CLIENTID", "")
+	t.Setenv("BW_CLIENTSECRET", "")
+	t.Setenv("BW_PASSWORD", "test-password")
+	t.Setenv("BW_HOST", "")
+
+	session, err := loginAndGetSession()
+	if err != nil {
+		t.Fatalf("expected nil, got %v", err)
+	}
+	if session != "test-session-token" {
+		t.Errorf("session = %q, want %q", session, "test-session-token")
+	}
+}
+
+func TestLoginAndGetSession_SSOMethodMissingIdentifier(t *testing.T) {
+	t.Setenv("BW_LOGIN_METHOD", "sso")
+	t.Setenv("BW_SSO_ORG_IDENTIFIER", "")
+	t.Setenv("BW_PASSWORD", "test-password")
+
+	if _, err := loginAndGetSession(); err == nil {
+		t.Fatal("expected error when BW_SSO_ORG_IDENTIFIER is missing")
+	}
+}
+
+func TestLoginAndGetSession_TwoStepCode(t *testing.T) {
+	execCommand = mockExecCommand
+	defer func() { execCommand = exec.CommandContext }()
+	totpCodeProvider = func() (string, error) { return "123456", nil }
+	defer func() { totpCodeProvider = defaultTOTPCodeProvider }()
+
+	t.Setenv("BW_LOGIN_METHOD", "password")
+	t.Setenv("BW_EMAIL", "2fa@example.com")
+	t.Setenv("BW_PASSWORD", "test-password")
+	t.Setenv("BW_HOST", "")
+
+	session, err := loginAndGetSession()
+	if err != nil {
+		t.Fatalf("expected nil, got %v", err)
+	}
+	if session != "test-session-token" {
+		t.Errorf("session = %q, want %q", session, "test-session-token")
+	}
+}
+
+func TestLoginAndGetSession_TwoStepRequired(t *testing.T) {
+	execCommand = mockExecCommand
+	defer func() { execCommand = exec.CommandContext }()
+
+	t.Setenv("BW_LOGIN_METHOD", "password")
+	t.Setenv("BW_EMAIL", "2fa@example.com")
+	t.Setenv("BW_PASSWORD", "test-password")
+	t.Setenv("BW_TOTP_SECRET", "")
+	t.Setenv("BW_HOST", "")
+
+	_, err := loginAndGetSession()
+	if !errors.Is(err, errTwoStepRequired) {
+		t.Fatalf("expected errTwoStepRequired, got %v", err)
+	}
+}
+
+func TestLoginAndGetSession_OrganizationAPIKey(t *testing.T) {
+	execCommand = mockExecCommand
+	defer func() { execCommand = exec.CommandContext }()
+
+	t.Setenv("BW_LOGIN_METHOD", "")
+	t.Setenv("BW_CLIENTID", "organization.test-org-id")
+	t.Setenv("BW_CLIENTSECRET", "test-secret")
+	t.Setenv("BW_PASSWORD", "")
+	t.Setenv("BW_HOST", "")
+
+	session, err := loginAndGetSession()
+	if err != nil {
+		t.Fatalf("expected nil, got %v", err)
+	}
+	if session != "" {
+		t.Errorf("session = %q, want empty session for organization API key", session)
+	}
+}
+
+func TestOrganizationIDFromClientID(t *testing.T) {
+	tests := []struct {
+		clientID string
+		want     string
+	}{
+		{"organization.0f6e3c5e-1234", "0f6e3c5e-1234"},
+		{"user.0f6e3c5e-1234", ""},
+		{"", ""},
+	}
+
+	for _, tt := range tests {
+		if got := organizationIDFromClientID(tt.clientID); got != tt.want {
+			t.Errorf("organizationIDFromClientID(%q) = %q, want %q", tt.clientID, got, tt.want)
+		}
+	}
+}
+
+func TestWithLoginRetry_RecoversFromTransientFailure(t *testing.T) {
+	t.Setenv("BW_LOGIN_RETRIES", "3")
+	t.Setenv("BW_LOGIN_BACKOFF", "1ms")
+
+	calls := 0
+	err := withLoginRetry("test step", func() error {
+		calls++
+		if calls < 3 {
+			return errors.New("connection refused")
+		}
+		return nil
+	})
+	if err != nil {
+		t.Fatalf("expected nil, got %v", err)
+	}
+	if calls != 3 {
+		t.Errorf("step called %d times, want 3", calls)
+	}
+}
+
+func TestWithLoginRetry_Exhausted(t *testing.T) {
+	t.Setenv("BW_LOGIN_RETRIES", "2")
+	t.Setenv("BW_LOGIN_BACKOFF", "1ms")
+
+	calls := 0
+	err := withLoginRetry("test step", func() error {
+		calls++
+		return errors.New("connection refused")
+	})
+	if err == nil {
+		t.Fatal("expected error after exhausting retries")
+	}
+	if calls != 2 {
+		t.Errorf("step called %d times, want 2", calls)
+	}
+}
+
+func TestWithLoginRetry_TwoStepRequiredNotRetried(t *testing.T) {
+	t.Setenv("BW_LOGIN_RETRIES", "5")
+	t.Setenv("BW_LOGIN_BACKOFF", "1ms")
+
+	calls := 0
+	_ = withLoginRetry("test step", func() error {
+		calls++
+		return errTwoStepRequired
+	})
+	if calls != 1 {
+		t.Errorf("step called %d times, want 1", calls)
+	}
+}
+
+func TestLoginAndGetSession_ValidExistingSession(t *testing.T) {
+	execCommand = mockExecCommand
+	defer func() { execCommand = exec.CommandContext }()
+
+	t.Setenv("BW_SESSION", "test-session-token")
+	// No credentials are configured, so any login attempt would fail.
+	t.Setenv("BW_CLIENTID", "")
+	t.Setenv("BW_PASSWORD", "")
+
+	session, err := loginAndGetSession()
+	if err != nil {
+		t.Fatalf("expected nil, got %v", err)
+	}
+	if session != "test-session-token" {
+		t.Errorf("session = %q, want %q", session, "test-session-token")
+	}
+}
+
+func TestLoginAndGetSession_InvalidExistingSession(t *testing.T) {
+	execCommand = mockExecCommand
+	defer func() { execCommand = exec.CommandContext }()
+
+	t.Setenv("BW_SESSION", "expired-session")
+	t.Setenv("BW_LOGIN_METHOD", "")
+	t.Setenv("BW_CLIENTID", "user.test-id")
+	t.Setenv("BW_CLIENTSECRET", "test-secret")
+	t.Setenv("BW_PASSWORD", "test-password")
+	t.Setenv("BW_HOST", "")
+
+	session, err := loginAndGetSession()
+	if err != nil {
+		t.Fatalf("expected nil, got %v", err)
+	}
+	if session != "test-session-token" {
+		t.Errorf("session = %q, want %q", session, "test-session-token")
+	}
+}
+
+func TestLoginAndGetSession_ReusesExistingLogin(t *testing.T) {
+	stateFile := filepath.Join(t.TempDir(), "logged-in")
+	if err := os.WriteFile(stateFile, nil, 0o600); err != nil {
+		t.Fatal(err)
+	}
+	execCommand = mockExecCommandEnv("MOCK_BW_STATE_FILE=" + stateFile)
+	defer func() { execCommand = exec.CommandContext }()
+
+	t.Setenv("BW_FORCE_RELOGIN", "")
+	t.Setenv("BW_LOGIN_METHOD", "")
+	t.Setenv("BW_CLIENTID", "user.test-id")
+	t.Setenv("BW_CLIENTSECRET", "test-secret")
+	t.Setenv("BW_PASSWORD", "test-password")
+	t.Setenv("BW_HOST", "https://vault.example.com/")
+
+	session, err := loginAndGetSession()
+	if err != nil {
+		t.Fatalf("expected nil, got %v", err)
+	}
+	if session != "test-session-token" {
+		t.Errorf("session = %q, want %q", session, "test-session-token")
+	}
+}
+
+func TestLoginAndGetSession_ForceRelogin(t *testing.T) {
+	stateFile := filepath.Join(t.TempDir(), "logged-in")
+	if err := os.WriteFile(stateFile, nil, 0o600); err != nil {
+		t.Fatal(err)
+	}
+	calls := []string{}
+	mock := mockExecCommandEnv("MOCK_BW_STATE_FILE=" + stateFile)
+	execCommand = func(ctx context.Context, command string, args ...string) *exec.Cmd {
+		calls = append(calls, args[0])
+		return mock(ctx, command, args...)
+	}
+	defer func() { execCommand = exec.CommandContext }()
+
+	t.Setenv("BW_FORCE_RELOGIN", "true")
+	t.Setenv("BW_LOGIN_METHOD", "")
+	t.Setenv("BW_CLIENTID", "user.test-id")
+	t.Setenv("BW_CLIENTSECRET", "test-secret")
+	t.Setenv("BW_PASSWORD", "test-password")
+	t.Setenv("BW_HOST", "")
+
+	if _, err := loginAndGetSession(); err != nil {
+		t.Fatalf("expected nil, got %v", err)
+	}
+	want := []string{"status", "logout", "login", "unlock"}
+	if fmt.Sprint(calls) != fmt.Sprint(want) {
+		t.Errorf("bw commands = %v, want %v", calls, want)
+	}
+}
+
+func TestLoginAndGetSession_KeyConnector(t *testing.T) {
+	execCommand = mockExecCommand
+	defer func() { execCommand = exec.CommandContext }()
+
+	t.Setenv("BW_LOGIN_METHOD", "")
+	t.Setenv("BW_UNLOCK_METHOD", "keyconnector")
+	t.Setenv("BW_CLIENTID", "user.test-id")
+	t.Setenv("BW_CLIENTSECRET", "test-secret")
+	t.Setenv("BW_PASSWORD", "")
+	t.Setenv("BW_HOST", "")
+
+	session, err := loginAndGetSession()
+	if err != nil {
+		t.Fatalf("expected nil, got %v", err)
+	}
+	if session != "test-session-token" {
+		t.Errorf("session = %q, want %q", session, "test-session-token")
+	}
+}
+
+func TestLoginAndGetSession_KeyConnectorWithPasswordLogin(t *testing.T) {
+	t.Setenv("BW_LOGIN_METHOD", "password")
+	t.Setenv("BW_UNLOCK_METHOD", "keyconnector")
+	t.Setenv("BW_EMAIL", "user@example.com")
+	t.Setenv("BW_PASSWORD", "test-password")
+
+	if _, err := loginAndGetSession(); err == nil {
+		t.Fatal("expected error when combining password login with Key Connector")
+	}
+}
@@ -0,0 +1,111 @@
+package main
+
+import (
+	"context"
+	"encoding/base64"
+	"fmt"
+	"strings"
+
+	"github.com/aws/aws-sdk-go-v2/aws"
+	"github.com/aws/aws-sdk-go-v2/aws/arn"
+	"github.com/aws/aws-sdk-go-v2/config"
+	"github.com/aws/aws-sdk-go-v2/service/kms"
+	"github.com/aws/aws-sdk-go-v2/service/secretsmanager"
+	"github.com/aws/aws-sdk-go-v2/service/ssm"
+)
+
+// loadAWSConfig loads the default AWS configuration, which picks up credentials
+// from the environment, the ECS task role or the EKS pod identity.
+func loadAWSConfig(ctx context.Context, region string) (aws.Config, error) {
+	var opts []func(*config.LoadOptions) error
+	if region != "" {
+		opts = append(opts, config.WithRegion(region))
+	}
+	cfg, err := config.LoadDefaultConfig(ctx, opts...)
+	if err != nil {
+		return aws.Config{}, fmt.Errorf("failed to load AWS configuration: %v", err)
+	}
+	return cfg, nil
+}
+
+// fetchAWSSecret retrieves the string value of a Secrets Manager secret.
+// If secretID is a full ARN, its region is used for the request.
+func fetchAWSSecret(secretID string) (string, error) {
+	ctx, cancel := context.WithTimeout(context.Background(), secretStoreTimeout)
+	defer cancel()
+
+	var region string
+	if parsed, err := arn.Parse(secretID); err == nil {
+		region = parsed.Region
+	}
+	cfg, err := loadAWSConfig(ctx, region)
+	if err != nil {
+		return "", err
+	}
+
+	out, err := secretsmanager.NewFromConfig(cfg).GetSecretValue(ctx, &secretsmanager.GetSecretValueInput{
+		SecretId: aws.String(secretID),
+	})
+	if err != nil {
+		return "", fmt.Errorf("failed to get secret '%s' from AWS Secrets Manager: %v", secretID, err)
+	}
+	if out.SecretString == nil {
+		return "", fmt.Errorf("AWS Secrets Manager secret '%s' has no string value", secretID)
+	}
+	return strings.TrimSpace(*out.SecretString), nil
+}
+
+// fetchAWSParameter retrieves and decrypts an SSM Parameter Store parameter.
+func fetchAWSParameter(name string) (string, error) {
+	ctx, cancel := context.WithTimeout(context.Background(), secretStoreTimeout)
+	defer cancel()
+
+	cfg, err := loadAWSConfig(ctx, "")
+	if err != nil {
+		return "", err
+	}
+
+	out, err := ssm.NewFromConfig(cfg).GetParameter(ctx, &ssm.GetParameterInput{
+		Name:           aws.String(name),
+		WithDecryption: aws.Bool(true),
+	})
+	if err != nil {
+		return "", fmt.Errorf("failed to get parameter '%s' from AWS SSM: %v", name, err)
+	}
+	if out.Parameter == nil || out.Parameter.Value == nil {
+		return "", fmt.Errorf("AWS SSM parameter '%s' has no value", name)
+	}
+	return strings.TrimSpace(*out.Parameter.Value), nil
+}
+
+// decryptAWSKMS decrypts a base64 encoded ciphertext, as produced by 'aws kms encrypt',
+// in memory. The key ID is optional for symmetric keys, but pins decryption to the
+// expected key; if it is a full ARN, its region is used for the request.
+func decryptAWSKMS(ciphertext, keyID string) (string, error) {
+	blob, err := base64.StdEncoding.DecodeString(strings.TrimSpace(ciphertext))
+	if err != nil {
+		return "", fmt.Errorf("BW_PASSWORD_ENCRYPTED is not valid base64: %v", err)
+	}
+
+	ctx, cancel := context.WithTimeout(context.Background(), secretStoreTimeout)
+	defer cancel()
+
+	var region string
+	if parsed, err := arn.Parse(keyID); err == nil {
+		region = parsed.Region
+	}
+	cfg, err := loadAWSConfig(ctx, region)
+	if err != nil {
+		return "", err
+	}
+
+	input := &kms.DecryptInput{CiphertextBlob: blob}
+	if keyID != "" {
+		input.KeyId = aws.String(keyID)
+	}
+	out, err := kms.NewFromConfig(cfg).Decrypt(ctx, input)
+	if err != nil {
+		return "", fmt.Errorf("failed to decrypt BW_PASSWORD_ENCRYPTED with AWS KMS: %v", err)
+	}
+	return strings.TrimSpace(string(out.Plaintext)), nil
+}
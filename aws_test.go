@@ -0,0 +1,98 @@
+package main
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"testing"
+)
+
+// fakeAWSEndpoint serves canned responses for AWS JSON protocol requests,
+// keyed by the X-Amz-Target header.
+func fakeAWSEndpoint(t *testing.T, responses map[string]string) {
+	t.Helper()
+	ts := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		body, ok := responses[r.Header.Get("X-Amz-Target")]
+		if !ok {
+			w.WriteHeader(http.StatusBadRequest)
+			_, _ = w.Write([]byte(`{"__type":"ResourceNotFoundException","message":"not found"}`))
+			return
+		}
+		w.Header().Set("Content-Type", "application/x-amz-json-1.1")
+		_, _ = w.Write([]byte(body))
+	}))
+	t.Cleanup(ts.Close)
+
+	t.Setenv("AWS_ENDPOINT_URL", ts.URL)
+	t.Setenv("AWS_ACCESS_KEY_ID", "test")
+	t.Setenv("AWS_SECRET_ACCESS_KEY", "test")
+	t.Setenv("AWS_REGION", "eu-central-1")
+	t.Setenv("AWS_EC2_METADATA_DISABLED", "true")
+}
+
+func TestGetPassword_AWSSecretsManager(t *testing.T) {
+	fakeAWSEndpoint(t, map[string]string{
+		"secretsmanager.GetSecretValue": `{"SecretString":"aws-password\n"}`,
+	})
+	t.Setenv("BW_PASSWORD", "env-password")
+	t.Setenv("BW_PASSWORD_AWS_SECRET_ARN", "arn:aws:secretsmanager:eu-central-1:123456789012:secret:bw-password")
+
+	got, err := getPassword()
+	if err != nil {
+		t.Fatalf("expected nil, got %v", err)
+	}
+	if got != "aws-password" {
+		t.Errorf("getPassword() = %q, want %q", got, "aws-password")
+	}
+}
+
+func TestGetPassword_AWSSSMParameter(t *testing.T) {
+	fakeAWSEndpoint(t, map[string]string{
+		"AmazonSSM.GetParameter": `{"Parameter":{"Name":"/bw/password","Value":"ssm-password"}}`,
+	})
+	t.Setenv("BW_PASSWORD_AWS_SECRET_ARN", "")
+	t.Setenv("BW_PASSWORD_AWS_SSM_PARAMETER", "/bw/password")
+
+	got, err := getPassword()
+	if err != nil {
+		t.Fatalf("expected nil, got %v", err)
+	}
+	if got != "ssm-password" {
+		t.Errorf("getPassword() = %q, want %q", got, "ssm-password")
+	}
+}
+
+func TestGetPassword_AWSSecretNotFound(t *testing.T) {
+	fakeAWSEndpoint(t, map[string]string{})
+	t.Setenv("BW_PASSWORD_AWS_SECRET_ARN", "bw-password")
+
+	if _, err := getPassword(); err == nil {
+		t.Fatal("expected error for missing secret")
+	}
+}
+
+func TestGetPassword_KMSEncrypted(t *testing.T) {
+	fakeAWSEndpoint(t, map[string]string{
+		// base64 of "kms-password"
+		"TrentService.Decrypt": `{"KeyId":"arn:aws:kms:eu-central-1:123456789012:key/test","Plaintext":"a21zLXBhc3N3b3Jk"}`,
+	})
+	t.Setenv("BW_PASSWORD_AWS_SECRET_ARN", "")
+	t.Setenv("BW_PASSWORD_AWS_SSM_PARAMETER", "")
+	t.Setenv("BW_PASSWORD_GCP_SECRET", "")
+	t.Setenv("BW_PASSWORD_AZURE_KEYVAULT_URI", "")
+	t.Setenv("BW_PASSWORD_ENCRYPTED", "Y2lwaGVydGV4dA==")
+	t.Setenv("BW_PASSWORD_KMS_KEY_ID", "arn:aws:kms:eu-central-1:123456789012:key/test")
+
+	got, err := getPassword()
+	if err != nil {
+		t.Fatalf("expected nil, got %v", err)
+	}
+	if got != "kms-password" {
+		t.Errorf("getPassword() = %q, want %q", got, "kms-password")
+	}
+}
+
+func TestDecryptAWSKMS_InvalidBase64(t *testing.T) {
+	if _, err := decryptAWSKMS("not base64!", ""); err == nil {
+		t.Fatal("expected error for invalid base64 ciphertext")
+	}
+}
@@ -0,0 +1,88 @@
+package main
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"io"
+	"net/http"
+	"net/url"
+	"strings"
+
+	"github.com/Azure/azure-sdk-for-go/sdk/azcore"
+	"github.com/Azure/azure-sdk-for-go/sdk/azcore/policy"
+	"github.com/Azure/azure-sdk-for-go/sdk/azidentity"
+)
+
+const azureKeyVaultAPIVersion = "7.4"
+
+// azureCredential provides the credentials for Key Vault requests. By default this
+// is the DefaultAzureCredential chain, which covers managed identities on ACI and
+// AKS as well as AKS workload identity.
+var azureCredential = defaultAzureCredential
+
+func defaultAzureCredential() (azcore.TokenCredential, error) {
+	return azidentity.NewDefaultAzureCredential(nil)
+}
+
+// fetchAzureKeyVaultSecret retrieves a secret given by its Key Vault URI, e.g.
+// https://<vault>.vault.azure.net/secrets/<name>[/<version>]. Without a version,
+// the latest version is returned.
+func fetchAzureKeyVaultSecret(secretURI string) (string, error) {
+	u, err := url.Parse(secretURI)
+	if err != nil || u.Host == "" || !strings.HasPrefix(u.Path, "/secrets/") {
+		return "", fmt.Errorf("invalid BW_PASSWORD_AZURE_KEYVAULT_URI '%s', expected https://<vault>.vault.azure.net/secrets/<name>", secretURI)
+	}
+	query := u.Query()
+	query.Set("api-version", azureKeyVaultAPIVersion)
+	u.RawQuery = query.Encode()
+
+	var secret string
+	err = withLoginRetry("Azure Key Vault access", func() error {
+		ctx, cancel := context.WithTimeout(context.Background(), secretStoreTimeout)
+		defer cancel()
+
+		cred, err := azureCredential()
+		if err != nil {
+			return permanentError{fmt.Errorf("failed to find Azure credentials: %v", err)}
+		}
+		token, err := cred.GetToken(ctx, policy.TokenRequestOptions{Scopes: []string{"https://vault.azure.net/.default"}})
+		if err != nil {
+			return fmt.Errorf("failed to get Azure access token: %v", err)
+		}
+
+		req, err := http.NewRequestWithContext(ctx, http.MethodGet, u.String(), nil)
+		if err != nil {
+			return permanentError{err}
+		}
+		req.Header.Set("Authorization", "Bearer "+token.Token)
+		resp, err := http.DefaultClient.Do(req)
+		if err != nil {
+			return fmt.Errorf("request to Azure Key Vault failed: %v", err)
+		}
+		defer func() { _ = resp.Body.Close() }()
+
+		body, err := io.ReadAll(resp.Body)
+		if err != nil {
+			return fmt.Errorf("failed to read Azure Key Vault response: %v", err)
+		}
+		switch {
+		case resp.StatusCode == http.StatusForbidden || resp.StatusCode == http.StatusUnauthorized:
+			return permanentError{fmt.Errorf("access to Azure Key Vault secret '%s' denied, make sure the managed identity may get secrets: %s", secretURI, string(body))}
+		case resp.StatusCode == http.StatusNotFound:
+			return permanentError{fmt.Errorf("secret '%s' not found in Azure Key Vault", secretURI)}
+		case resp.StatusCode != http.StatusOK:
+			return fmt.Errorf("unexpected status %d from Azure Key Vault: %s", resp.StatusCode, string(body))
+		}
+
+		var v struct {
+			Value string `json:"value"`
+		}
+		if err := json.Unmarshal(body, &v); err != nil {
+			return fmt.Errorf("failed to parse Azure Key Vault response: %v", err)
+		}
+		secret = strings.TrimSpace(v.Value)
+		return nil
+	})
+	return secret, err
+}
@@ -0,0 +1,55 @@
+package main
+
+import (
+	"context"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+
+	"github.com/Azure/azure-sdk-for-go/sdk/azcore"
+	"github.com/Azure/azure-sdk-for-go/sdk/azcore/policy"
+)
+
+type staticAzureCredential struct{}
+
+func (staticAzureCredential) GetToken(context.Context, policy.TokenRequestOptions) (azcore.AccessToken, error) {
+	return azcore.AccessToken{Token: "test-token", ExpiresOn: time.Now().Add(time.Hour)}, nil
+}
+
+func TestGetPassword_AzureKeyVault(t *testing.T) {
+	ts := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.URL.Path != "/secrets/bw-password" || r.URL.Query().Get("api-version") == "" {
+			http.NotFound(w, r)
+			return
+		}
+		if r.Header.Get("Authorization") != "Bearer test-token" {
+			w.WriteHeader(http.StatusUnauthorized)
+			return
+		}
+		_, _ = w.Write([]byte(`{"value":"azure-password","id":"https://vault/secrets/bw-password/1"}`))
+	}))
+	defer ts.Close()
+
+	azureCredential = func() (azcore.TokenCredential, error) { return staticAzureCredential{}, nil }
+	defer func() { azureCredential = defaultAzureCredential }()
+
+	t.Setenv("BW_PASSWORD_AWS_SECRET_ARN", "")
+	t.Setenv("BW_PASSWORD_AWS_SSM_PARAMETER", "")
+	t.Setenv("BW_PASSWORD_GCP_SECRET", "")
+	t.Setenv("BW_PASSWORD_AZURE_KEYVAULT_URI", ts.URL+"/secrets/bw-password")
+
+	got, err := getPassword()
+	if err != nil {
+		t.Fatalf("expected nil, got %v", err)
+	}
+	if got != "azure-password" {
+		t.Errorf("getPassword() = %q, want %q", got, "azure-password")
+	}
+}
+
+func TestFetchAzureKeyVaultSecret_InvalidURI(t *testing.T) {
+	if _, err := fetchAzureKeyVaultSecret("https://myvault.vault.azure.net/keys/bw-password"); err == nil {
+		t.Fatal("expected error for a non-secret URI")
+	}
+}
@@ -0,0 +1,120 @@
+package main
+
+import (
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"os"
+	"strings"
+)
+
+// runSecretsManager serves Bitwarden Secrets Manager instead of a user vault. The
+// bws CLI authenticates every command with a machine account access token, so
+// there is no login, unlock or 'bw serve' process involved.
+func runSecretsManager() {
+	if token, err := getSecret("BWS_ACCESS_TOKEN"); err != nil || token == "" {
+		fatal(bwsLog, "BWS_ACCESS_TOKEN (or BWS_ACCESS_TOKEN_FILE) is required for the bws backend", "error", err)
+	}
+
+	// The token is passed to each bws command explicitly
+	scrubCredentials()
+	detectCLIVersion("bws")
+
+	ctx, stop := shutdownSignals()
+	defer stop()
+
+	bwProxyPort := getEnv("BW_PROXY_PORT", "8087")
+	bwsLog.Info("Starting Secrets Manager proxy server", "port", bwProxyPort)
+	supervise("proxy server", func() error { return listenAndServe(bwProxyPort, setupSecretsManagerRouter()) })
+	sdNotify("READY=1")
+
+	awaitShutdown(ctx, shutdownTracing)
+}
+
+// setupSecretsManagerRouter configures the endpoints of the bws backend.
+func setupSecretsManagerRouter() *http.ServeMux {
+	mux := http.NewServeMux()
+
+	mux.HandleFunc("/healthz", func(w http.ResponseWriter, r *http.Request) {
+		w.WriteHeader(http.StatusOK)
+		_, _ = fmt.Fprint(w, "OK")
+	})
+
+	mux.HandleFunc("/version", handleVersion)
+
+	mux.HandleFunc("/secrets", func(w http.ResponseWriter, r *http.Request) {
+		if r.Method != http.MethodGet {
+			http.Error(w, "Method not allowed", http.StatusMethodNotAllowed)
+			return
+		}
+		args := []string{"secret", "list"}
+		if projectID := r.URL.Query().Get("projectid"); projectID != "" {
+			args = append(args, projectID)
+		}
+		runBwsCommand(w, r, args...)
+	})
+
+	mux.HandleFunc("/secrets/{id}", func(w http.ResponseWriter, r *http.Request) {
+		if r.Method != http.MethodGet {
+			http.Error(w, "Method not allowed", http.StatusMethodNotAllowed)
+			return
+		}
+		runBwsCommand(w, r, "secret", "get", r.PathValue("id"))
+	})
+
+	mux.HandleFunc("/projects", func(w http.ResponseWriter, r *http.Request) {
+		if r.Method != http.MethodGet {
+			http.Error(w, "Method not allowed", http.StatusMethodNotAllowed)
+			return
+		}
+		runBwsCommand(w, r, "project", "list")
+	})
+
+	mux.HandleFunc("/projects/{id}", func(w http.ResponseWriter, r *http.Request) {
+		if r.Method != http.MethodGet {
+			http.Error(w, "Method not allowed", http.StatusMethodNotAllowed)
+			return
+		}
+		runBwsCommand(w, r, "project", "get", r.PathValue("id"))
+	})
+
+	return mux
+}
+
+// runBwsCommand executes a bws command with the configured access token and writes
+// its JSON output as the response.
+func runBwsCommand(w http.ResponseWriter, r *http.Request, args ...string) {
+	token, err := getSecret("BWS_ACCESS_TOKEN")
+	if err != nil {
+		http.Error(w, fmt.Sprintf("Failed to read access token: %v", err), http.StatusInternalServerError)
+		return
+	}
+
+	args = append(args, "--output", "json")
+	env := []string{"BWS_ACCESS_TOKEN=" + token}
+	if host := os.Getenv("BW_HOST"); host != "" {
+		env = append(env, "BWS_SERVER_URL="+host)
+	}
+	ctx, cancel, err := cliContext(r.Context())
+	if err != nil {
+		cliUnavailable(w, r, err)
+		return
+	}
+	defer cancel()
+	cmd := withEnv(execCommand(ctx, "bws", args...), env...)
+	var out, errOut bytes.Buffer
+	cmd.Stdout = &out
+	cmd.Stderr = &errOut
+	if err := runTraced(r.Context(), "bws "+args[0]+" "+args[1], cmd.Run); err != nil {
+		bwsLog.Error("bws command failed", "command", args[0]+" "+args[1], "output", strings.TrimSpace(errOut.String()))
+		http.Error(w, fmt.Sprintf("Command failed: %s", errOut.String()), http.StatusBadGateway)
+		return
+	}
+
+	if json.Valid(out.Bytes()) {
+		w.Header().Set("Content-Type", "application/json")
+	}
+	w.WriteHeader(http.StatusOK)
+	_, _ = w.Write(out.Bytes())
+}
@@ -0,0 +1,66 @@
+package main
+
+import (
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"os/exec"
+	"testing"
+)
+
+func TestSecretsManagerGetSecret(t *testing.T) {
+	execCommand = mockExecCommand
+	defer func() { execCommand = exec.CommandContext }()
+	t.Setenv("BWS_ACCESS_TOKEN", "test-access-token")
+
+	router := setupSecretsManagerRouter()
+	req, _ := http.NewRequest("GET", "/secrets/secret-1", nil)
+	rr := httptest.NewRecorder()
+
+	router.ServeHTTP(rr, req)
+
+	if status := rr.Code; status != http.StatusOK {
+		t.Fatalf("handler returned wrong status code: got %v want %v: %s",
+			status, http.StatusOK, rr.Body.String())
+	}
+	var secret struct {
+		ID    string `json:"id"`
+		Value string `json:"value"`
+	}
+	if err := json.Unmarshal(rr.Body.Bytes(), &secret); err != nil {
+		t.Fatalf("invalid JSON response: %v", err)
+	}
+	if secret.ID != "secret-1" || secret.Value != "test-value" {
+		t.Errorf("unexpected secret: %+v", secret)
+	}
+}
+
+func TestSecretsManagerInvalidToken(t *testing.T) {
+	execCommand = mockExecCommand
+	defer func() { execCommand = exec.CommandContext }()
+	t.Setenv("BWS_ACCESS_TOKEN", "wrong-token")
+
+	router := setupSecretsManagerRouter()
+	req, _ := http.NewRequest("GET", "/projects", nil)
+	rr := httptest.NewRecorder()
+
+	router.ServeHTTP(rr, req)
+
+	if status := rr.Code; status != http.StatusBadGateway {
+		t.Errorf("handler returned wrong status code: got %v want %v",
+			status, http.StatusBadGateway)
+	}
+}
+
+func TestSecretsManagerMethodNotAllowed(t *testing.T) {
+	router := setupSecretsManagerRouter()
+	req, _ := http.NewRequest("POST", "/secrets", nil)
+	rr := httptest.NewRecorder()
+
+	router.ServeHTTP(rr, req)
+
+	if status := rr.Code; status != http.StatusMethodNotAllowed {
+		t.Errorf("handler returned wrong status code: got %v want %v",
+			status, http.StatusMethodNotAllowed)
+	}
+}
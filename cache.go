@@ -0,0 +1,82 @@
+package main
+
+import (
+	"encoding/json"
+	"net/http"
+	"slices"
+	"strings"
+	"sync"
+)
+
+// responseCache is a cache of responses of 'bw serve', which a sync may make outdated.
+type responseCache interface {
+	// invalidate removes the entries whose key, the request URI, matches and returns
+	// their number.
+	invalidate(match func(key string) bool) int
+}
+
+var (
+	responseCachesMu sync.Mutex
+	responseCaches   []responseCache
+)
+
+// registerResponseCache has c invalidated after syncs and by /admin/cache/flush.
+func registerResponseCache(c responseCache) {
+	responseCachesMu.Lock()
+	defer responseCachesMu.Unlock()
+	responseCaches = append(responseCaches, c)
+}
+
+// invalidateResponseCaches removes the matching entries from all caches and returns
+// their number.
+func invalidateResponseCaches(match func(key string) bool) int {
+	responseCachesMu.Lock()
+	defer responseCachesMu.Unlock()
+	n := 0
+	for _, c := range responseCaches {
+		n += c.invalidate(match)
+	}
+	return n
+}
+
+// flushResponseCaches empties all caches.
+func flushResponseCaches() int {
+	return invalidateResponseCaches(func(string) bool { return true })
+}
+
+// invalidateChangedItems removes the cached responses a sync made outdated: those of
+// the changed items and all lists.
+func invalidateChangedItems(change vaultChange) int {
+	ids := slices.Concat(change.Added, change.Modified, change.Deleted)
+	if len(ids) == 0 {
+		return 0
+	}
+	return invalidateResponseCaches(func(key string) bool {
+		if strings.HasPrefix(key, "/list/") {
+			return true
+		}
+		for _, id := range ids {
+			if strings.Contains(key, id) {
+				return true
+			}
+		}
+		return false
+	})
+}
+
+// cacheFlushResponse is the response of /admin/cache/flush.
+type cacheFlushResponse struct {
+	Flushed int `json:"flushed"`
+}
+
+// handleCacheFlush empties all response caches.
+func handleCacheFlush(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodPost {
+		http.Error(w, "Method not allowed", http.StatusMethodNotAllowed)
+		return
+	}
+	n := flushResponseCaches()
+	adminLog.Info("Flushed the response caches", "request_id", requestID(r), "entries", n)
+	w.Header().Set("Content-Type", "application/json")
+	_ = json.NewEncoder(w).Encode(cacheFlushResponse{Flushed: n})
+}
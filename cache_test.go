@@ -0,0 +1,46 @@
+package main
+
+import (
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"net/http/httputil"
+	"net/url"
+	"testing"
+)
+
+func TestInvalidateResponseCaches(t *testing.T) {
+	defer func() { responseCaches = nil }()
+	responseCaches = nil
+	t.Setenv("BW_STALE_CACHE", "true")
+	cache := staleCacheFromEnv()
+	fill := func() {
+		for _, key := range []string{"/object/item/a", "/object/totp/a", "/object/item/b", "/list/object/items?search=x"} {
+			cache.store(key, http.Header{}, []byte("{}"))
+		}
+	}
+
+	fill()
+	if n := invalidateChangedItems(vaultChange{Modified: []string{"a"}}); n != 3 {
+		t.Errorf("invalidated %d entries, want 3", n)
+	}
+	if cache.load("/object/item/b") == nil || cache.load("/object/item/a") != nil {
+		t.Error("expected only the entries of the changed item and the lists to be removed")
+	}
+	if n := invalidateChangedItems(vaultChange{}); n != 0 {
+		t.Errorf("invalidated %d entries without changes, want 0", n)
+	}
+
+	fill()
+	t.Setenv("BW_ADMIN_TOKEN", "admin-token")
+	u, _ := url.Parse("http://localhost:8080")
+	router := setupRouter(httputil.NewSingleHostReverseProxy(u))
+	req := httptest.NewRequest("POST", "/admin/cache/flush", nil)
+	req.Header.Set("Authorization", "Bearer admin-token")
+	rr := httptest.NewRecorder()
+	router.ServeHTTP(rr, req)
+	var resp cacheFlushResponse
+	if err := json.NewDecoder(rr.Body).Decode(&resp); err != nil || resp.Flushed != 4 {
+		t.Errorf("got %v %+v: %v", rr.Code, resp, err)
+	}
+}
@@ -0,0 +1,116 @@
+package main
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"net/http"
+	"os"
+	"slices"
+	"strings"
+	"time"
+)
+
+// persistedEntry is a cached response as stored in BW_CACHE_FILE.
+type persistedEntry struct {
+	Key    string      `json:"key"`
+	Header http.Header `json:"header"`
+	Body   []byte      `json:"body"`
+	Stored time.Time   `json:"stored"`
+}
+
+// restoreCacheFile loads the responses saved by the previous run from BW_CACHE_FILE,
+// so a restarted container answers reads as soon as the vault is unlocked. They are
+// served until the first sync, which is requested right away, replaces them. The file
+// is encrypted with the same key as BW_SESSION_STATE_FILE.
+func restoreCacheFile() {
+	path := os.Getenv("BW_CACHE_FILE")
+	c := activeTTLCache()
+	if path == "" || c == nil {
+		return
+	}
+
+	data, err := os.ReadFile(path)
+	if err != nil {
+		if !errors.Is(err, os.ErrNotExist) {
+			proxyLog.Warn("Failed to read cache file", "path", path, "error", err)
+		}
+		return
+	}
+	passphrase, err := sessionStatePassphrase()
+	if err != nil || passphrase == "" {
+		proxyLog.Warn("No key available to decrypt cache file", "path", path)
+		return
+	}
+	plaintext, err := decryptState(data, passphrase)
+	if err != nil {
+		proxyLog.Warn("Failed to decrypt cache file", "path", path, "error", err)
+		return
+	}
+	var entries []persistedEntry
+	if err := json.Unmarshal(plaintext, &entries); err != nil {
+		proxyLog.Warn("Invalid cache file", "path", path, "error", err)
+		return
+	}
+
+	// The most recent responses are kept if the cache has become smaller.
+	slices.SortFunc(entries, func(a, b persistedEntry) int { return b.Stored.Compare(a.Stored) })
+	entries = entries[:min(len(entries), c.maxEntries)]
+	expires := time.Now().Add(c.ttl)
+	c.mu.Lock()
+	for _, e := range entries {
+		c.entries[e.Key] = &cacheEntry{header: e.Header, body: e.Body, stored: e.Stored, expires: expires}
+	}
+	c.mu.Unlock()
+	proxyLog.Info("Restored cached responses", "path", path, "entries", len(entries))
+	if len(entries) > 0 {
+		requestSync()
+	}
+}
+
+// saveCacheFile encrypts the cached responses and writes them to BW_CACHE_FILE, if set,
+// as a shutdown step. With BW_WIPE_ON_EXIT, the file is removed instead.
+func saveCacheFile(context.Context) {
+	path := os.Getenv("BW_CACHE_FILE")
+	c := activeTTLCache()
+	if path == "" || c == nil {
+		return
+	}
+	if wipeOnExitEnabled() {
+		if err := os.Remove(path); err != nil && !errors.Is(err, os.ErrNotExist) {
+			proxyLog.Warn("Failed to remove cache file", "path", path, "error", err)
+		}
+		return
+	}
+
+	var entries []persistedEntry
+	c.mu.Lock()
+	for key, e := range c.entries {
+		// TOTP codes are outdated by the next start.
+		if !strings.HasPrefix(key, "/object/totp/") {
+			entries = append(entries, persistedEntry{Key: key, Header: e.header, Body: e.body, Stored: e.stored})
+		}
+	}
+	c.mu.Unlock()
+	plaintext, err := json.Marshal(entries)
+	if err != nil {
+		proxyLog.Warn("Failed to encode cached responses", "error", err)
+		return
+	}
+
+	passphrase, err := sessionStatePassphrase()
+	if err != nil || passphrase == "" {
+		proxyLog.Warn("No key available to encrypt the cache file, not saving it")
+		return
+	}
+	data, err := encryptState(plaintext, passphrase)
+	if err != nil {
+		proxyLog.Warn("Failed to encrypt cached responses", "error", err)
+		return
+	}
+	if err := writeFileAtomic(path, data); err != nil {
+		proxyLog.Warn("Failed to write cache file", "path", path, "error", err)
+		return
+	}
+	proxyLog.Info("Saved cached responses", "path", path, "entries", len(entries))
+}
@@ -0,0 +1,65 @@
+package main
+
+import (
+	"bytes"
+	"context"
+	"net/http"
+	"os"
+	"path/filepath"
+	"testing"
+)
+
+func TestCacheFileRoundTrip(t *testing.T) {
+	defer func() { responseCaches = nil }()
+	defer func() { currentTTLCache.cache = nil }()
+	path := filepath.Join(t.TempDir(), "cache.enc")
+	t.Setenv("BW_CACHE_FILE", path)
+	t.Setenv("BW_CACHE_TTL", "1m")
+	t.Setenv("BW_PASSWORD", "test-password")
+
+	cache := ttlCacheFromEnv()
+	cache.store("/object/item/1", http.Header{"Content-Type": {"application/json"}}, []byte(`{"password":"secret"}`))
+	cache.store("/object/totp/1", http.Header{}, []byte(`{"data":"123456"}`))
+	saveCacheFile(context.Background())
+
+	data, err := os.ReadFile(path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if bytes.Contains(data, []byte("secret")) {
+		t.Error("cache file is not encrypted")
+	}
+
+	// Drains a pending request left over by other tests.
+	select {
+	case <-syncRequests:
+	default:
+	}
+	restarted := ttlCacheFromEnv()
+	restoreCacheFile()
+	entry := restarted.load("/object/item/1")
+	if entry == nil || string(entry.body) != `{"password":"secret"}` || entry.header.Get("Content-Type") != "application/json" {
+		t.Fatalf("unexpected restored entry %+v", entry)
+	}
+	if restarted.load("/object/totp/1") != nil {
+		t.Error("expected TOTP codes not to be saved")
+	}
+	select {
+	case <-syncRequests:
+	default:
+		t.Error("expected a sync to be requested after restoring responses")
+	}
+
+	t.Setenv("BW_PASSWORD", "wrong-password")
+	empty := ttlCacheFromEnv()
+	restoreCacheFile()
+	if empty.load("/object/item/1") != nil {
+		t.Error("restored responses with the wrong key")
+	}
+
+	t.Setenv("BW_WIPE_ON_EXIT", "true")
+	saveCacheFile(context.Background())
+	if _, err := os.Stat(path); !os.IsNotExist(err) {
+		t.Errorf("expected the cache file to be removed with BW_WIPE_ON_EXIT, got %v", err)
+	}
+}
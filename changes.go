@@ -0,0 +1,130 @@
+package main
+
+import (
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"slices"
+	"sync"
+	"time"
+)
+
+// vaultChange is the payload posted to BW_SYNC_CHANGE_WEBHOOK. It only carries the ids
+// of the items, never their content.
+type vaultChange struct {
+	Event    string    `json:"event"`
+	Instance string    `json:"instance"`
+	Time     time.Time `json:"time"`
+	Added    []string  `json:"added"`
+	Modified []string  `json:"modified"`
+	Deleted  []string  `json:"deleted"`
+}
+
+// itemRevisions maps the id of every item to its revision date.
+type itemRevisions map[string]string
+
+// changeTracker keeps the item revisions seen after the previous sync, to tell which
+// items a sync added, modified or deleted.
+type changeTracker struct {
+	mu       sync.Mutex
+	previous itemRevisions
+}
+
+var vaultChanges = &changeTracker{}
+
+// update lists the items after a sync, records their number, invalidates the cached
+// responses of changed items and posts the changes since the previous sync to
+// BW_SYNC_CHANGE_WEBHOOK, so that automation can react to them. The first sync only
+// records the items.
+func (c *changeTracker) update(port string) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	current, err := listItemRevisions(port)
+	if err != nil {
+		syncLog.Error("Failed to list the items after the sync", "error", err)
+		// Without the items, there is no telling which cached responses are outdated.
+		flushResponseCaches()
+		return
+	}
+	vaultItems.Set(float64(len(current)))
+	previous := c.previous
+	c.previous = current
+	if previous == nil {
+		flushResponseCaches()
+		return
+	}
+
+	change := diffItemRevisions(previous, current)
+	if len(change.Added)+len(change.Modified)+len(change.Deleted) == 0 {
+		return
+	}
+	if n := invalidateChangedItems(change); n > 0 {
+		syncLog.Debug("Invalidated cached responses of changed items", "entries", n)
+	}
+	url, err := getSecret("BW_SYNC_CHANGE_WEBHOOK")
+	if err != nil || url == "" {
+		return
+	}
+	change.Event = "vault_changed"
+	change.Instance = instanceName()
+	change.Time = time.Now().UTC()
+	if err := postWebhook(url, change); err != nil {
+		syncLog.Error("Failed to send vault change notification", "error", err)
+		return
+	}
+	syncLog.Info("Sent vault change notification", "added", len(change.Added), "modified", len(change.Modified), "deleted", len(change.Deleted))
+}
+
+// listItemRevisions fetches the revision date of every item from 'bw serve'.
+func listItemRevisions(port string) (itemRevisions, error) {
+	client := &http.Client{Timeout: defaultCLITimeout}
+	resp, err := client.Get(bwServeURL(port, "/list/object/items"))
+	if err != nil {
+		return nil, err
+	}
+	defer resp.Body.Close()
+	if resp.StatusCode != http.StatusOK {
+		return nil, fmt.Errorf("listing items failed with status %d", resp.StatusCode)
+	}
+	var list struct {
+		Data struct {
+			Data []struct {
+				ID           string `json:"id"`
+				RevisionDate string `json:"revisionDate"`
+			} `json:"data"`
+		} `json:"data"`
+	}
+	if err := json.NewDecoder(resp.Body).Decode(&list); err != nil {
+		return nil, fmt.Errorf("invalid item list: %v", err)
+	}
+	revisions := make(itemRevisions, len(list.Data.Data))
+	for _, item := range list.Data.Data {
+		revisions[item.ID] = item.RevisionDate
+	}
+	return revisions, nil
+}
+
+// diffItemRevisions returns the ids of the items added, modified and deleted between
+// previous and current, sorted.
+func diffItemRevisions(previous, current itemRevisions) vaultChange {
+	change := vaultChange{Added: []string{}, Modified: []string{}, Deleted: []string{}}
+	for id, revision := range current {
+		before, ok := previous[id]
+		switch {
+		case !ok:
+			change.Added = append(change.Added, id)
+		case before != revision:
+			change.Modified = append(change.Modified, id)
+		}
+	}
+	for id := range previous {
+		if _, ok := current[id]; !ok {
+			change.Deleted = append(change.Deleted, id)
+		}
+	}
+	slices.Sort(change.Added)
+	slices.Sort(change.Modified)
+	slices.Sort(change.Deleted)
+	return change
+}
@@ -0,0 +1,79 @@
+package main
+
+import (
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"slices"
+	"sync/atomic"
+	"testing"
+
+	"github.com/prometheus/client_golang/prometheus/testutil"
+)
+
+func TestDiffItemRevisions(t *testing.T) {
+	previous := itemRevisions{"a": "1", "b": "1", "c": "1"}
+	current := itemRevisions{"a": "1", "b": "2", "d": "1", "e": "1"}
+	change := diffItemRevisions(previous, current)
+	if !slices.Equal(change.Added, []string{"d", "e"}) {
+		t.Errorf("added: got %v", change.Added)
+	}
+	if !slices.Equal(change.Modified, []string{"b"}) {
+		t.Errorf("modified: got %v", change.Modified)
+	}
+	if !slices.Equal(change.Deleted, []string{"c"}) {
+		t.Errorf("deleted: got %v", change.Deleted)
+	}
+}
+
+func TestChangeTrackerUpdate(t *testing.T) {
+	var items atomic.Value
+	items.Store(`[{"id":"a","revisionDate":"1","login":{"password":"secret"}},{"id":"b","revisionDate":"1"}]`)
+	bwServe := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.URL.Path != "/list/object/items" {
+			http.NotFound(w, r)
+			return
+		}
+		_, _ = w.Write([]byte(`{"success":true,"data":{"object":"list","data":` + items.Load().(string) + `}}`))
+	}))
+	defer bwServe.Close()
+	u, _ := url.Parse(bwServe.URL)
+
+	var payloads []vaultChange
+	webhook := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		var change vaultChange
+		if err := json.NewDecoder(r.Body).Decode(&change); err != nil {
+			t.Errorf("invalid payload: %v", err)
+		}
+		payloads = append(payloads, change)
+	}))
+	defer webhook.Close()
+	t.Setenv("BW_SYNC_CHANGE_WEBHOOK", webhook.URL)
+
+	tracker := &changeTracker{}
+	// The first sync only records the items.
+	tracker.update(u.Port())
+	if len(payloads) != 0 {
+		t.Fatalf("expected no notification for the first sync, got %v", payloads)
+	}
+	if got := testutil.ToFloat64(vaultItems); got != 2 {
+		t.Errorf("bw_vault_items = %v, want 2", got)
+	}
+
+	// Nothing changed.
+	tracker.update(u.Port())
+	if len(payloads) != 0 {
+		t.Fatalf("expected no notification without changes, got %v", payloads)
+	}
+
+	items.Store(`[{"id":"a","revisionDate":"2"},{"id":"c","revisionDate":"1"}]`)
+	tracker.update(u.Port())
+	if len(payloads) != 1 {
+		t.Fatalf("expected 1 notification, got %d", len(payloads))
+	}
+	got := payloads[0]
+	if got.Event != "vault_changed" || !slices.Equal(got.Added, []string{"c"}) || !slices.Equal(got.Modified, []string{"a"}) || !slices.Equal(got.Deleted, []string{"b"}) {
+		t.Errorf("unexpected notification: %+v", got)
+	}
+}
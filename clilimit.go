@@ -0,0 +1,118 @@
+package main
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"net/http"
+	"os"
+	"strconv"
+	"sync"
+	"time"
+)
+
+const (
+	defaultCLIMaxConcurrent = 4
+	defaultCLIQueueTimeout  = 1 * time.Minute
+)
+
+// errCLIBusy is returned for a CLI command that waited longer than the queue timeout
+// for another command to finish.
+var errCLIBusy = errors.New("too many CLI commands running")
+
+// cliLimiter bounds how many bw and bws commands run at once. Every bw command starts
+// a Node.js process of its own, so a burst of syncs, organization reads and status
+// checks can exhaust the memory of a small container. Commands beyond the limit wait
+// for a free slot, for at most the queue timeout. Only commands bounded by cliContext
+// are counted, not 'bw serve' or the interactive SSO login.
+type cliLimiter struct {
+	mu      sync.Mutex
+	slots   chan struct{}
+	timeout time.Duration
+}
+
+// cliSlots limits the CLI commands of the wrapper.
+var cliSlots = newCLILimiter(defaultCLIMaxConcurrent, defaultCLIQueueTimeout)
+
+// newCLILimiter returns a limiter of n concurrent commands, or of none if n is 0.
+func newCLILimiter(n int, timeout time.Duration) *cliLimiter {
+	l := &cliLimiter{timeout: timeout}
+	if n > 0 {
+		l.slots = make(chan struct{}, n)
+	}
+	return l
+}
+
+// configure sets the limits from BW_CLI_MAX_CONCURRENT and BW_CLI_QUEUE_TIMEOUT.
+// Commands already running when the limit changes keep their slot of the old limit.
+func (l *cliLimiter) configure() {
+	n := defaultCLIMaxConcurrent
+	if val := os.Getenv("BW_CLI_MAX_CONCURRENT"); val != "" {
+		v, err := strconv.Atoi(val)
+		if err != nil || v < 0 {
+			mainLog.Warn("Invalid format for BW_CLI_MAX_CONCURRENT, using default", "value", val, "default", defaultCLIMaxConcurrent, "error", err)
+		} else {
+			n = v
+		}
+	}
+	timeout := defaultCLIQueueTimeout
+	if val := os.Getenv("BW_CLI_QUEUE_TIMEOUT"); val != "" {
+		d, err := time.ParseDuration(val)
+		if err != nil || d <= 0 {
+			mainLog.Warn("Invalid format for BW_CLI_QUEUE_TIMEOUT, using default", "value", val, "default", defaultCLIQueueTimeout, "error", err)
+		} else {
+			timeout = d
+		}
+	}
+
+	l.mu.Lock()
+	defer l.mu.Unlock()
+	l.timeout = timeout
+	if n != cap(l.slots) {
+		l.slots = nil
+		if n > 0 {
+			l.slots = make(chan struct{}, n)
+		}
+	}
+}
+
+// acquire waits for a free slot and returns a function releasing it once the command
+// has finished. It fails with errCLIBusy after the queue timeout, or when ctx is done.
+func (l *cliLimiter) acquire(ctx context.Context) (func(), error) {
+	l.mu.Lock()
+	slots, timeout := l.slots, l.timeout
+	l.mu.Unlock()
+	if slots == nil {
+		return func() {}, nil
+	}
+	release := func() { <-slots }
+	select {
+	case slots <- struct{}{}:
+		return release, nil
+	default:
+	}
+
+	queuedCLICommands.Inc()
+	defer queuedCLICommands.Dec()
+	timer := time.NewTimer(timeout)
+	defer timer.Stop()
+	select {
+	case slots <- struct{}{}:
+		return release, nil
+	case <-timer.C:
+		return nil, errCLIBusy
+	case <-ctx.Done():
+		return nil, ctx.Err()
+	}
+}
+
+// cliUnavailable answers a request whose CLI command could not get a slot with
+// 503 Service Unavailable, asking the client to retry.
+func cliUnavailable(w http.ResponseWriter, r *http.Request, err error) {
+	if r.Context().Err() != nil {
+		return
+	}
+	proxyLog.Warn("CLI command could not be run", "request_id", requestID(r), "path", r.URL.Path, "error", err)
+	w.Header().Set("Retry-After", "5")
+	http.Error(w, fmt.Sprintf("Service unavailable: %v (request ID: %s)", err, requestID(r)), http.StatusServiceUnavailable)
+}
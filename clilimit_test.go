@@ -0,0 +1,110 @@
+package main
+
+import (
+	"context"
+	"errors"
+	"net/http"
+	"net/http/httptest"
+	"net/http/httputil"
+	"net/url"
+	"os/exec"
+	"testing"
+	"time"
+)
+
+func TestCLILimiter(t *testing.T) {
+	l := newCLILimiter(1, 50*time.Millisecond)
+	release, err := l.acquire(context.Background())
+	if err != nil {
+		t.Fatal(err)
+	}
+	if _, err := l.acquire(context.Background()); !errors.Is(err, errCLIBusy) {
+		t.Fatalf("got %v while the slot is taken, want errCLIBusy", err)
+	}
+
+	// A waiting command runs once the slot is released.
+	go func() {
+		time.Sleep(10 * time.Millisecond)
+		release()
+	}()
+	release, err = l.acquire(context.Background())
+	if err != nil {
+		t.Fatalf("got %v after the slot was released", err)
+	}
+	release()
+
+	unlimited := newCLILimiter(0, 0)
+	for range 10 {
+		if _, err := unlimited.acquire(context.Background()); err != nil {
+			t.Fatalf("got %v without a limit", err)
+		}
+	}
+}
+
+func TestCLILimiterConfigure(t *testing.T) {
+	l := newCLILimiter(0, 0)
+	t.Setenv("BW_CLI_MAX_CONCURRENT", "2")
+	t.Setenv("BW_CLI_QUEUE_TIMEOUT", "invalid")
+	l.configure()
+	if cap(l.slots) != 2 || l.timeout != defaultCLIQueueTimeout {
+		t.Errorf("got %d, %v", cap(l.slots), l.timeout)
+	}
+
+	t.Setenv("BW_CLI_MAX_CONCURRENT", "0")
+	l.configure()
+	if l.slots != nil {
+		t.Error("expected no limit with BW_CLI_MAX_CONCURRENT=0")
+	}
+}
+
+func TestCLIContextExcludesQueueTime(t *testing.T) {
+	defer func(l *cliLimiter) { cliSlots = l }(cliSlots)
+	cliSlots = newCLILimiter(1, time.Second)
+	t.Setenv("BW_CLI_TIMEOUT", "200ms")
+
+	_, cancel, err := cliContext(context.Background())
+	if err != nil {
+		t.Fatal(err)
+	}
+	go func() {
+		time.Sleep(300 * time.Millisecond)
+		cancel()
+	}()
+
+	// The timeout starts once the first command has released its slot.
+	ctx, cancel, err := cliContext(context.Background())
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer cancel()
+	if deadline, _ := ctx.Deadline(); time.Until(deadline) < 100*time.Millisecond {
+		t.Errorf("queue time counted towards the timeout, %s left", time.Until(deadline))
+	}
+}
+
+func TestCLIBusyResponse(t *testing.T) {
+	execCommand = mockExecCommand
+	defer func() { execCommand = exec.CommandContext }()
+	defer func(l *cliLimiter) { cliSlots = l }(cliSlots)
+	cliSlots = newCLILimiter(1, 10*time.Millisecond)
+	t.Setenv("BW_CLIENTID", "organization.test-org-id")
+
+	release, err := cliSlots.acquire(context.Background())
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer release()
+
+	u, _ := url.Parse("http://localhost:8080")
+	router := setupRouter(httputil.NewSingleHostReverseProxy(u))
+	rr := httptest.NewRecorder()
+	router.ServeHTTP(rr, httptest.NewRequest("GET", "/org/members", nil))
+	if rr.Code != http.StatusServiceUnavailable || rr.Header().Get("Retry-After") == "" {
+		t.Errorf("got %v %v, want 503 with Retry-After", rr.Code, rr.Header())
+	}
+
+	// The interactive SSO login does not wait for a slot.
+	if err := loginWithSSO("test-org"); err != nil {
+		t.Errorf("SSO login while all slots are taken: %v", err)
+	}
+}
@@ -0,0 +1,58 @@
+package main
+
+import (
+	"net/http"
+	"os"
+	"slices"
+	"strings"
+)
+
+// corsConfig allows browser based tools on other origins to call the proxy.
+type corsConfig struct {
+	origins []string
+	methods string
+	headers string
+}
+
+// corsConfigFromEnv returns the CORS configuration, or nil if BW_PROXY_CORS_ORIGINS
+// is not set. The origins may contain "*" to allow any origin.
+func corsConfigFromEnv() *corsConfig {
+	origins := splitList(os.Getenv("BW_PROXY_CORS_ORIGINS"))
+	if len(origins) == 0 {
+		return nil
+	}
+	return &corsConfig{
+		origins: origins,
+		methods: strings.Join(splitList(getEnv("BW_PROXY_CORS_METHODS", "GET,POST,PUT,DELETE")), ", "),
+		headers: strings.Join(splitList(getEnv("BW_PROXY_CORS_HEADERS", "Authorization,Content-Type")), ", "),
+	}
+}
+
+// allowsOrigin reports whether requests from origin are allowed.
+func (c *corsConfig) allowsOrigin(origin string) bool {
+	return slices.Contains(c.origins, "*") || slices.Contains(c.origins, origin)
+}
+
+// middleware adds the CORS headers for allowed origins and answers preflight requests.
+func (c *corsConfig) middleware(next http.Handler) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.Header().Add("Vary", "Origin")
+		origin := r.Header.Get("Origin")
+		if origin == "" || !c.allowsOrigin(origin) {
+			next.ServeHTTP(w, r)
+			return
+		}
+
+		w.Header().Set("Access-Control-Allow-Origin", origin)
+		if r.Method == http.MethodOptions && r.Header.Get("Access-Control-Request-Method") != "" {
+			w.Header().Add("Vary", "Access-Control-Request-Method")
+			w.Header().Add("Vary", "Access-Control-Request-Headers")
+			w.Header().Set("Access-Control-Allow-Methods", c.methods)
+			w.Header().Set("Access-Control-Allow-Headers", c.headers)
+			w.Header().Set("Access-Control-Max-Age", "600")
+			w.WriteHeader(http.StatusNoContent)
+			return
+		}
+		next.ServeHTTP(w, r)
+	})
+}
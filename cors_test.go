@@ -0,0 +1,50 @@
+package main
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"testing"
+)
+
+func TestCORS(t *testing.T) {
+	t.Setenv("BW_PROXY_CORS_ORIGINS", "https://tools.example.com")
+	t.Setenv("BW_PROXY_AUTH_TOKEN", "token-a")
+
+	handler, err := proxyMiddleware(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.WriteHeader(http.StatusOK)
+	}))
+	if err != nil {
+		t.Fatalf("expected nil, got %v", err)
+	}
+
+	// Preflight requests are answered without credentials.
+	req, _ := http.NewRequest("OPTIONS", "/list/object/items", nil)
+	req.Header.Set("Origin", "https://tools.example.com")
+	req.Header.Set("Access-Control-Request-Method", "GET")
+	rr := httptest.NewRecorder()
+	handler.ServeHTTP(rr, req)
+	if rr.Code != http.StatusNoContent {
+		t.Errorf("preflight: got status %v want %v", rr.Code, http.StatusNoContent)
+	}
+	if got := rr.Header().Get("Access-Control-Allow-Headers"); got != "Authorization, Content-Type" {
+		t.Errorf("Access-Control-Allow-Headers = %q", got)
+	}
+
+	req, _ = http.NewRequest("GET", "/list/object/items", nil)
+	req.Header.Set("Origin", "https://tools.example.com")
+	req.Header.Set("Authorization", "Bearer token-a")
+	rr = httptest.NewRecorder()
+	handler.ServeHTTP(rr, req)
+	if got := rr.Header().Get("Access-Control-Allow-Origin"); got != "https://tools.example.com" {
+		t.Errorf("Access-Control-Allow-Origin = %q, want the request origin", got)
+	}
+
+	req, _ = http.NewRequest("OPTIONS", "/list/object/items", nil)
+	req.Header.Set("Origin", "https://evil.example.com")
+	req.Header.Set("Access-Control-Request-Method", "GET")
+	rr = httptest.NewRecorder()
+	handler.ServeHTTP(rr, req)
+	if rr.Code != http.StatusUnauthorized || rr.Header().Get("Access-Control-Allow-Origin") != "" {
+		t.Errorf("other origin: got status %v and allowed origin %q", rr.Code, rr.Header().Get("Access-Control-Allow-Origin"))
+	}
+}
@@ -0,0 +1,166 @@
+package main
+
+import (
+	"fmt"
+	"strconv"
+	"strings"
+	"time"
+	// Time zones of cron schedules are resolved even if the image lacks tzdata.
+	_ "time/tzdata"
+)
+
+// cronSearchLimit bounds the search for the next time matching a schedule, so that
+// one that never matches, e.g. February 30th, does not loop forever.
+const cronSearchLimit = 5 * 366 * 24 * time.Hour
+
+// cronField is the set of values a field of a cron expression matches.
+type cronField uint64
+
+func (f cronField) has(v int) bool { return f&(1<<uint(v)) != 0 }
+
+// cronSchedule is a parsed standard 5-field cron expression: minute, hour, day of
+// month, month and day of week.
+type cronSchedule struct {
+	expr                          string
+	minute, hour, dom, month, dow cronField
+	domRestricted, dowRestricted  bool
+	location                      *time.Location
+}
+
+var (
+	cronMonthNames = map[string]int{"jan": 1, "feb": 2, "mar": 3, "apr": 4, "may": 5, "jun": 6, "jul": 7, "aug": 8, "sep": 9, "oct": 10, "nov": 11, "dec": 12}
+	cronDayNames   = map[string]int{"sun": 0, "mon": 1, "tue": 2, "wed": 3, "thu": 4, "fri": 5, "sat": 6}
+)
+
+// parseCron parses a cron expression such as "*/15 8-18 * * mon-fri". It may be
+// prefixed with CRON_TZ=<zone> to evaluate it in that time zone instead of the local one.
+func parseCron(expr string) (*cronSchedule, error) {
+	s := &cronSchedule{expr: expr, location: time.Local}
+	fields := strings.Fields(expr)
+	if len(fields) > 0 {
+		if zone, ok := strings.CutPrefix(fields[0], "CRON_TZ="); ok {
+			loc, err := time.LoadLocation(zone)
+			if err != nil {
+				return nil, fmt.Errorf("invalid time zone '%s': %v", zone, err)
+			}
+			s.location = loc
+			fields = fields[1:]
+		}
+	}
+	if len(fields) != 5 {
+		return nil, fmt.Errorf("expected 5 fields, got %d", len(fields))
+	}
+
+	var err error
+	for _, f := range []struct {
+		name     string
+		value    string
+		field    *cronField
+		min, max int
+		names    map[string]int
+	}{
+		{"minute", fields[0], &s.minute, 0, 59, nil},
+		{"hour", fields[1], &s.hour, 0, 23, nil},
+		{"day of month", fields[2], &s.dom, 1, 31, nil},
+		{"month", fields[3], &s.month, 1, 12, cronMonthNames},
+		// 7 is accepted for Sunday as well.
+		{"day of week", fields[4], &s.dow, 0, 7, cronDayNames},
+	} {
+		if *f.field, err = parseCronField(f.value, f.min, f.max, f.names); err != nil {
+			return nil, fmt.Errorf("invalid %s '%s': %v", f.name, f.value, err)
+		}
+	}
+	if s.dow.has(7) {
+		s.dow |= 1
+	}
+	s.domRestricted = !strings.HasPrefix(fields[2], "*")
+	s.dowRestricted = !strings.HasPrefix(fields[4], "*")
+	return s, nil
+}
+
+// parseCronField parses a comma separated list of values, ranges (a-b) and steps (*/n
+// or a-b/n) within min and max.
+func parseCronField(value string, min, max int, names map[string]int) (cronField, error) {
+	var field cronField
+	for part := range strings.SplitSeq(value, ",") {
+		rng, step, hasStep := strings.Cut(part, "/")
+		n := 1
+		if hasStep {
+			var err error
+			if n, err = strconv.Atoi(step); err != nil || n <= 0 {
+				return 0, fmt.Errorf("invalid step '%s'", step)
+			}
+		}
+
+		lo, hi := min, max
+		if rng != "*" {
+			from, to, isRange := strings.Cut(rng, "-")
+			var err error
+			if lo, err = parseCronValue(from, min, max, names); err != nil {
+				return 0, err
+			}
+			hi = lo
+			if isRange {
+				if hi, err = parseCronValue(to, min, max, names); err != nil {
+					return 0, err
+				}
+			} else if hasStep {
+				// "a/n" means every n-th value starting at a.
+				hi = max
+			}
+			if hi < lo {
+				return 0, fmt.Errorf("invalid range '%s'", rng)
+			}
+		}
+		for v := lo; v <= hi; v += n {
+			field |= 1 << uint(v)
+		}
+	}
+	return field, nil
+}
+
+// parseCronValue parses a number or, if names is set, a name such as "mon".
+func parseCronValue(value string, min, max int, names map[string]int) (int, error) {
+	if v, ok := names[strings.ToLower(value)]; ok {
+		return v, nil
+	}
+	v, err := strconv.Atoi(value)
+	if err != nil || v < min || v > max {
+		return 0, fmt.Errorf("value '%s' out of range %d-%d", value, min, max)
+	}
+	return v, nil
+}
+
+// next returns the first time after t matching the schedule, or the zero time if
+// there is none within cronSearchLimit.
+func (s *cronSchedule) next(t time.Time) time.Time {
+	t = t.In(s.location).Truncate(time.Minute).Add(time.Minute)
+	limit := t.Add(cronSearchLimit)
+	for t.Before(limit) {
+		switch {
+		case !s.month.has(int(t.Month())):
+			t = time.Date(t.Year(), t.Month()+1, 1, 0, 0, 0, 0, s.location)
+		case !s.matchesDay(t):
+			t = time.Date(t.Year(), t.Month(), t.Day()+1, 0, 0, 0, 0, s.location)
+		case !s.hour.has(t.Hour()):
+			t = time.Date(t.Year(), t.Month(), t.Day(), t.Hour()+1, 0, 0, 0, s.location)
+		case !s.minute.has(t.Minute()):
+			t = t.Add(time.Minute)
+		default:
+			return t
+		}
+	}
+	return time.Time{}
+}
+
+// matchesDay applies the cron rule that a day matches either the day of month or the
+// day of week if both are restricted.
+func (s *cronSchedule) matchesDay(t time.Time) bool {
+	dom, dow := s.dom.has(t.Day()), s.dow.has(int(t.Weekday()))
+	if s.domRestricted && s.dowRestricted {
+		return dom || dow
+	}
+	return dom && dow
+}
+
+func (s *cronSchedule) String() string { return s.expr }
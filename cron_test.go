@@ -0,0 +1,55 @@
+package main
+
+import (
+	"testing"
+	"time"
+)
+
+func TestParseCron(t *testing.T) {
+	for _, expr := range []string{"* * * *", "60 * * * *", "* 24 * * *", "* * 0 * *", "*/0 * * * *", "5-1 * * * *", "* * * foo *", "CRON_TZ=Nowhere/City * * * * *"} {
+		if _, err := parseCron(expr); err == nil {
+			t.Errorf("%q: expected an error", expr)
+		}
+	}
+}
+
+func TestCronScheduleNext(t *testing.T) {
+	berlin, err := time.LoadLocation("Europe/Berlin")
+	if err != nil {
+		t.Fatal(err)
+	}
+	// A Wednesday.
+	from := time.Date(2026, 6, 3, 17, 50, 30, 0, time.UTC)
+	tests := []struct {
+		expr string
+		want time.Time
+	}{
+		{"* * * * *", time.Date(2026, 6, 3, 17, 51, 0, 0, time.UTC)},
+		{"*/15 * * * *", time.Date(2026, 6, 3, 18, 0, 0, 0, time.UTC)},
+		{"0 9-17 * * mon-fri", time.Date(2026, 6, 4, 9, 0, 0, 0, time.UTC)},
+		{"30 8 * * 0", time.Date(2026, 6, 7, 8, 30, 0, 0, time.UTC)},
+		{"30 8 * * 7", time.Date(2026, 6, 7, 8, 30, 0, 0, time.UTC)},
+		{"0 0 1 jan,jul *", time.Date(2026, 7, 1, 0, 0, 0, 0, time.UTC)},
+		{"10/20 * * * *", time.Date(2026, 6, 3, 18, 10, 0, 0, time.UTC)},
+		// Day of month and day of week match either.
+		{"0 12 15 * fri", time.Date(2026, 6, 5, 12, 0, 0, 0, time.UTC)},
+		{"0 0 29 2 *", time.Date(2028, 2, 29, 0, 0, 0, 0, time.UTC)},
+		// 18:00 in Berlin is 16:00 UTC in summer, so the next one is tomorrow.
+		{"CRON_TZ=Europe/Berlin 0 18 * * *", time.Date(2026, 6, 4, 18, 0, 0, 0, berlin)},
+	}
+	for _, tt := range tests {
+		s, err := parseCron(tt.expr)
+		if err != nil {
+			t.Errorf("%q: %v", tt.expr, err)
+			continue
+		}
+		if got := s.next(from); !got.Equal(tt.want) {
+			t.Errorf("%q: got %v want %v", tt.expr, got, tt.want)
+		}
+	}
+
+	s, _ := parseCron("0 0 30 2 *")
+	if got := s.next(from); !got.IsZero() {
+		t.Errorf("February 30th: got %v", got)
+	}
+}
@@ -0,0 +1,27 @@
+package main
+
+import (
+	"net"
+	"net/http"
+	"net/http/pprof"
+)
+
+// debugRouter serves the net/http/pprof profiles.
+func debugRouter() *http.ServeMux {
+	mux := http.NewServeMux()
+	mux.HandleFunc("/debug/pprof/", pprof.Index)
+	mux.HandleFunc("/debug/pprof/cmdline", pprof.Cmdline)
+	mux.HandleFunc("/debug/pprof/profile", pprof.Profile)
+	mux.HandleFunc("/debug/pprof/symbol", pprof.Symbol)
+	mux.HandleFunc("/debug/pprof/trace", pprof.Trace)
+	return mux
+}
+
+// startDebugServer serves the profiles on BW_DEBUG_PORT. It only listens on loopback,
+// so profiles have to be fetched from within the container, e.g. with kubectl
+// port-forward, as they expose the memory of the process.
+func startDebugServer(port string) error {
+	addr := net.JoinHostPort("127.0.0.1", port)
+	mainLog.Info("Starting pprof debug server", "address", addr)
+	return http.ListenAndServe(addr, recoverPanics(debugRouter()))
+}
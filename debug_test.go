@@ -0,0 +1,20 @@
+package main
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+)
+
+func TestDebugRouter(t *testing.T) {
+	rr := httptest.NewRecorder()
+	debugRouter().ServeHTTP(rr, httptest.NewRequest("GET", "/debug/pprof/goroutine?debug=1", nil))
+
+	if rr.Code != http.StatusOK {
+		t.Fatalf("got status %v want %v", rr.Code, http.StatusOK)
+	}
+	if !strings.Contains(rr.Body.String(), "goroutine profile") {
+		t.Errorf("unexpected body %q", rr.Body.String())
+	}
+}
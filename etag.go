@@ -0,0 +1,115 @@
+package main
+
+import (
+	"crypto/sha256"
+	"encoding/base64"
+	"encoding/json"
+	"net/http"
+	"strings"
+	"time"
+)
+
+// etagsEnabled reports whether BW_PROXY_ETAGS is set.
+func etagsEnabled() bool {
+	return getEnv("BW_PROXY_ETAGS", "false") == "true"
+}
+
+// withConditionalRequests sets an ETag, and a Last-Modified date from the revision
+// date of the items, on successful reads of items and answers requests whose
+// If-None-Match or If-Modified-Since shows that the client already has the response
+// with 304 Not Modified, so polling clients don't transfer the same secrets over and
+// over. It wraps the security headers, which drop the validators of the upstream.
+func withConditionalRequests(next http.Handler) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.Method != http.MethodGet || !isItemRead(r.URL.Path) {
+			next.ServeHTTP(w, r)
+			return
+		}
+		// The ETag is computed over the uncompressed body.
+		r.Header.Del("Accept-Encoding")
+		capture := newResponseCapture()
+		next.ServeHTTP(capture, r)
+		if capture.status != http.StatusOK {
+			capture.writeTo(w, capture.body.Bytes())
+			return
+		}
+
+		body := capture.body.Bytes()
+		sum := sha256.Sum256(body)
+		etag := `"` + base64.RawURLEncoding.EncodeToString(sum[:16]) + `"`
+		capture.header.Set("ETag", etag)
+		modified, hasModified := lastRevisionDate(body)
+		if hasModified {
+			capture.header.Set("Last-Modified", modified.UTC().Format(http.TimeFormat))
+		}
+
+		if notModified(r, etag, modified, hasModified) {
+			for key, values := range capture.header {
+				w.Header()[key] = values
+			}
+			w.Header().Del("Content-Length")
+			w.WriteHeader(http.StatusNotModified)
+			return
+		}
+		capture.writeTo(w, body)
+	})
+}
+
+// notModified evaluates the conditional headers of a request against the validators of
+// the response. If-Modified-Since is only considered without If-None-Match.
+func notModified(r *http.Request, etag string, modified time.Time, hasModified bool) bool {
+	if match := r.Header.Get("If-None-Match"); match != "" {
+		for tag := range strings.SplitSeq(match, ",") {
+			tag = strings.TrimPrefix(strings.TrimSpace(tag), "W/")
+			if tag == "*" || tag == etag {
+				return true
+			}
+		}
+		return false
+	}
+	if since := r.Header.Get("If-Modified-Since"); since != "" && hasModified {
+		t, err := http.ParseTime(since)
+		return err == nil && !modified.Truncate(time.Second).After(t)
+	}
+	return false
+}
+
+// lastRevisionDate returns the latest revision date of the item, or the items of the
+// list, in a response of 'bw serve'.
+func lastRevisionDate(body []byte) (time.Time, bool) {
+	var resp struct {
+		Data json.RawMessage `json:"data"`
+	}
+	if err := json.Unmarshal(body, &resp); err != nil {
+		return time.Time{}, false
+	}
+	type revisioned struct {
+		RevisionDate time.Time `json:"revisionDate"`
+	}
+	var list struct {
+		Data []revisioned `json:"data"`
+	}
+	var items []revisioned
+	if err := json.Unmarshal(resp.Data, &list); err == nil && list.Data != nil {
+		items = list.Data
+	} else {
+		var item revisioned
+		if err := json.Unmarshal(resp.Data, &item); err != nil {
+			return time.Time{}, false
+		}
+		items = []revisioned{item}
+	}
+
+	var last time.Time
+	for _, item := range items {
+		if item.RevisionDate.After(last) {
+			last = item.RevisionDate
+		}
+	}
+	return last, !last.IsZero()
+}
+
+// isItemRead reports whether a path reads an item or the list of items.
+func isItemRead(path string) bool {
+	return path == "/list/object/items" || strings.HasPrefix(path, "/object/item/")
+}
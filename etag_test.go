@@ -0,0 +1,69 @@
+package main
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"testing"
+)
+
+func TestConditionalRequests(t *testing.T) {
+	body := `{"success":true,"data":{"id":"1","revisionDate":"2026-06-01T12:00:00.123Z"}}`
+	handler := withConditionalRequests(withSecurityHeaders(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.Header().Set("ETag", `"upstream"`)
+		_, _ = w.Write([]byte(body))
+	})))
+	send := func(path string, header http.Header) *httptest.ResponseRecorder {
+		req := httptest.NewRequest("GET", path, nil)
+		for key, values := range header {
+			req.Header[key] = values
+		}
+		rr := httptest.NewRecorder()
+		handler.ServeHTTP(rr, req)
+		return rr
+	}
+
+	rr := send("/object/item/1", nil)
+	etag := rr.Header().Get("ETag")
+	if rr.Code != http.StatusOK || etag == "" || etag == `"upstream"` || rr.Body.String() != body {
+		t.Fatalf("got %v %v %q", rr.Code, rr.Header(), rr.Body.String())
+	}
+	if got := rr.Header().Get("Last-Modified"); got != "Mon, 01 Jun 2026 12:00:00 GMT" {
+		t.Errorf("Last-Modified = %q", got)
+	}
+
+	tests := []struct {
+		name   string
+		header http.Header
+		want   int
+	}{
+		{"matching ETag", http.Header{"If-None-Match": {`"other", ` + etag}}, http.StatusNotModified},
+		{"weak ETag", http.Header{"If-None-Match": {"W/" + etag}}, http.StatusNotModified},
+		{"other ETag", http.Header{"If-None-Match": {`"other"`}}, http.StatusOK},
+		{"not modified since", http.Header{"If-Modified-Since": {"Mon, 01 Jun 2026 12:00:00 GMT"}}, http.StatusNotModified},
+		{"modified since", http.Header{"If-Modified-Since": {"Mon, 01 Jun 2026 11:59:59 GMT"}}, http.StatusOK},
+	}
+	for _, tt := range tests {
+		rr := send("/object/item/1", tt.header)
+		if rr.Code != tt.want {
+			t.Errorf("%s: got status %v want %v", tt.name, rr.Code, tt.want)
+		}
+		if rr.Code == http.StatusNotModified && (rr.Body.Len() != 0 || rr.Header().Get("ETag") != etag || rr.Header().Get("Cache-Control") != "no-store") {
+			t.Errorf("%s: got %v %q", tt.name, rr.Header(), rr.Body.String())
+		}
+	}
+
+	// Other reads keep the upstream validators dropped.
+	if rr := send("/object/password/1", http.Header{"If-None-Match": {"*"}}); rr.Code != http.StatusOK || rr.Header().Get("ETag") != "" {
+		t.Errorf("got %v %v", rr.Code, rr.Header())
+	}
+}
+
+func TestLastRevisionDate(t *testing.T) {
+	list := `{"success":true,"data":{"object":"list","data":[{"revisionDate":"2026-06-01T12:00:00Z"},{"revisionDate":"2026-06-02T08:30:00Z"}]}}`
+	if got, ok := lastRevisionDate([]byte(list)); !ok || got.Format("2006-01-02T15:04") != "2026-06-02T08:30" {
+		t.Errorf("list: got %v, %v", got, ok)
+	}
+	if _, ok := lastRevisionDate([]byte(`{"success":true,"data":{"object":"list","data":[]}}`)); ok {
+		t.Error("empty list: expected no revision date")
+	}
+}
@@ -0,0 +1,178 @@
+package main
+
+import (
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"os"
+	"strconv"
+	"sync"
+	"time"
+)
+
+const (
+	defaultEventBufferSize = 100
+	eventSubscriberBuffer  = 16
+	eventStreamKeepAlive   = 30 * time.Second
+)
+
+// Types of lifecycle events.
+const (
+	eventLogin           = "login"
+	eventUnlock          = "unlock"
+	eventUnlockFailed    = "unlock_failed"
+	eventVaultLocked     = "vault_locked"
+	eventSync            = "sync"
+	eventSyncFailed      = "sync_failed"
+	eventServeStarted    = "serve_started"
+	eventServeRestart    = "serve_restarted"
+	eventServeCrashed    = "serve_crashed"
+	eventServeRecycled   = "serve_recycled"
+	eventRelogin         = "relogin"
+	eventReloginFailed   = "relogin_failed"
+	eventPasswordRotated = "password_rotated"
+)
+
+// event is a lifecycle event of the wrapper, kept for /admin/events.
+type event struct {
+	Time    time.Time `json:"time"`
+	Type    string    `json:"type"`
+	Message string    `json:"message"`
+	Error   string    `json:"error,omitempty"`
+}
+
+// eventLog keeps the most recent events in a ring buffer and passes new events on
+// to subscribers.
+type eventLog struct {
+	mu          sync.Mutex
+	entries     []event
+	next        int
+	full        bool
+	subscribers map[chan event]struct{}
+}
+
+// newEventLog returns an event log keeping the last size events.
+func newEventLog(size int) *eventLog {
+	return &eventLog{entries: make([]event, size), subscribers: map[chan event]struct{}{}}
+}
+
+// events is the lifecycle history of the wrapper, sized by BW_EVENTS_BUFFER.
+var events = newEventLog(eventBufferSize())
+
+// eventBufferSize returns the number of events kept, from BW_EVENTS_BUFFER.
+func eventBufferSize() int {
+	val := os.Getenv("BW_EVENTS_BUFFER")
+	if val == "" {
+		return defaultEventBufferSize
+	}
+	n, err := strconv.Atoi(val)
+	if err != nil || n <= 0 {
+		adminLog.Warn("Invalid format for BW_EVENTS_BUFFER, using default", "value", val, "default", defaultEventBufferSize)
+		return defaultEventBufferSize
+	}
+	return n
+}
+
+// record adds an event, replacing the oldest one if the buffer is full.
+func (l *eventLog) record(typ, message string, err error) {
+	e := event{Time: time.Now().UTC(), Type: typ, Message: message}
+	if err != nil {
+		e.Error = scrubSecrets(err.Error())
+	}
+
+	l.mu.Lock()
+	defer l.mu.Unlock()
+	l.entries[l.next] = e
+	l.next = (l.next + 1) % len(l.entries)
+	if l.next == 0 {
+		l.full = true
+	}
+	for ch := range l.subscribers {
+		select {
+		case ch <- e:
+		default:
+			// A subscriber that doesn't keep up misses events rather than blocking the wrapper.
+		}
+	}
+}
+
+// subscribe returns a channel receiving all events recorded from now on, and a
+// function to end the subscription.
+func (l *eventLog) subscribe() (<-chan event, func()) {
+	ch := make(chan event, eventSubscriberBuffer)
+	l.mu.Lock()
+	defer l.mu.Unlock()
+	l.subscribers[ch] = struct{}{}
+	return ch, func() {
+		l.mu.Lock()
+		defer l.mu.Unlock()
+		delete(l.subscribers, ch)
+	}
+}
+
+// list returns the kept events, oldest first.
+func (l *eventLog) list() []event {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+	if !l.full {
+		return append([]event{}, l.entries[:l.next]...)
+	}
+	return append(append([]event{}, l.entries[l.next:]...), l.entries[:l.next]...)
+}
+
+// recordEvent adds a lifecycle event to the history served at /admin/events.
+func recordEvent(typ, message string, err error) {
+	events.record(typ, message, err)
+}
+
+// handleEvents returns the recent lifecycle events, oldest first.
+func handleEvents(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodGet {
+		http.Error(w, "Method not allowed", http.StatusMethodNotAllowed)
+		return
+	}
+	w.Header().Set("Content-Type", "application/json")
+	_ = json.NewEncoder(w).Encode(events.list())
+}
+
+// handleEventStream streams lifecycle events as Server-Sent Events, so that dependent
+// services can react to syncs, lock state changes and restarts without polling. Each
+// event is sent with its type as the SSE event name and the event as JSON data.
+func handleEventStream(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodGet {
+		http.Error(w, "Method not allowed", http.StatusMethodNotAllowed)
+		return
+	}
+
+	ch, unsubscribe := events.subscribe()
+	defer unsubscribe()
+
+	rc := http.NewResponseController(w)
+	w.Header().Set("Content-Type", "text/event-stream")
+	w.WriteHeader(http.StatusOK)
+	if err := rc.Flush(); err != nil {
+		proxyLog.Warn("Event stream is not supported by the connection", "request_id", requestID(r), "error", err)
+		return
+	}
+
+	keepAlive := time.NewTicker(eventStreamKeepAlive)
+	defer keepAlive.Stop()
+	for {
+		select {
+		case <-r.Context().Done():
+			return
+		case <-keepAlive.C:
+			// Comments keep idle connections from being closed by intermediaries.
+			_, _ = fmt.Fprint(w, ": keep-alive\n\n")
+		case e := <-ch:
+			data, err := json.Marshal(e)
+			if err != nil {
+				continue
+			}
+			_, _ = fmt.Fprintf(w, "event: %s\ndata: %s\n\n", e.Type, data)
+		}
+		if err := rc.Flush(); err != nil {
+			return
+		}
+	}
+}
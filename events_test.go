@@ -0,0 +1,103 @@
+package main
+
+import (
+	"bufio"
+	"encoding/json"
+	"errors"
+	"net/http"
+	"net/http/httptest"
+	"net/http/httputil"
+	"net/url"
+	"strings"
+	"testing"
+	"time"
+)
+
+func TestEventLog(t *testing.T) {
+	l := newEventLog(3)
+	if got := l.list(); len(got) != 0 {
+		t.Fatalf("expected no events, got %v", got)
+	}
+
+	for _, typ := range []string{eventLogin, eventServeStarted, eventSync, eventVaultLocked} {
+		l.record(typ, "", nil)
+	}
+	got := l.list()
+	if len(got) != 3 || got[0].Type != eventServeStarted || got[1].Type != eventSync || got[2].Type != eventVaultLocked {
+		t.Errorf("expected the last 3 events oldest first, got %+v", got)
+	}
+}
+
+func TestAdminEvents(t *testing.T) {
+	t.Setenv("BW_ADMIN_TOKEN", "admin-token")
+	t.Setenv("BW_PASSWORD", "test-password")
+	defer func(l *eventLog) { events = l }(events)
+	events = newEventLog(10)
+	recordEvent(eventUnlockFailed, "Failed to unlock the vault again", errors.New("invalid password test-password"))
+
+	u, _ := url.Parse("http://localhost:8080")
+	router := setupRouter(httputil.NewSingleHostReverseProxy(u))
+
+	rr := httptest.NewRecorder()
+	router.ServeHTTP(rr, httptest.NewRequest("GET", "/admin/events", nil))
+	if rr.Code != http.StatusUnauthorized {
+		t.Errorf("without token: got status %v want %v", rr.Code, http.StatusUnauthorized)
+	}
+
+	req := httptest.NewRequest("GET", "/admin/events", nil)
+	req.Header.Set("Authorization", "Bearer admin-token")
+	rr = httptest.NewRecorder()
+	router.ServeHTTP(rr, req)
+	var got []event
+	if err := json.Unmarshal(rr.Body.Bytes(), &got); err != nil {
+		t.Fatalf("expected JSON, got %q: %v", rr.Body.String(), err)
+	}
+	if len(got) != 1 || got[0].Type != eventUnlockFailed || got[0].Error != "invalid password [REDACTED]" {
+		t.Errorf("unexpected events: %s", rr.Body.String())
+	}
+}
+
+func TestEventStream(t *testing.T) {
+	t.Setenv("BW_ACCESS_LOG", "json")
+	defer func(l *eventLog) { events = l }(events)
+	events = newEventLog(10)
+
+	u, _ := url.Parse("http://localhost:8080")
+	handler, err := proxyMiddleware(setupRouter(httputil.NewSingleHostReverseProxy(u)))
+	if err != nil {
+		t.Fatal(err)
+	}
+	ts := httptest.NewServer(traceRequests(handler))
+	defer ts.Close()
+
+	resp, err := http.Get(ts.URL + "/events/stream")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer func() { _ = resp.Body.Close() }()
+	if ct := resp.Header.Get("Content-Type"); ct != "text/event-stream" {
+		t.Fatalf("Content-Type = %q, want text/event-stream", ct)
+	}
+
+	// The subscription is set up before the response headers are sent.
+	recordEvent(eventSync, "Sync successful", nil)
+
+	lines := make(chan string)
+	go func() {
+		scanner := bufio.NewScanner(resp.Body)
+		for scanner.Scan() {
+			lines <- scanner.Text()
+		}
+		close(lines)
+	}()
+	for _, want := range []string{"event: sync", `data: {"time":`} {
+		select {
+		case line := <-lines:
+			if !strings.HasPrefix(line, want) {
+				t.Errorf("got line %q, want prefix %q", line, want)
+			}
+		case <-time.After(5 * time.Second):
+			t.Fatalf("timed out waiting for %q", want)
+		}
+	}
+}
@@ -0,0 +1,147 @@
+package main
+
+import (
+	"context"
+	"errors"
+	"os"
+	"strconv"
+	"sync"
+	"time"
+)
+
+const (
+	defaultRequestQueueSize    = 100
+	defaultRequestQueueTimeout = 30 * time.Second
+)
+
+var (
+	// errQueueFull is returned by requestGate.enter if too many requests are queued.
+	errQueueFull = errors.New("too many requests queued")
+	// errQueueTimeout is returned by requestGate.enter if the gate stayed closed for
+	// longer than the queue timeout.
+	errQueueTimeout = errors.New("timed out in queue")
+)
+
+// requestGate lets proxied requests through to 'bw serve' unless it is closed for
+// maintenance, such as a re-unlock or a restart of 'bw serve'. Closing it waits for the
+// requests in flight to drain. While it is closed, new requests are held in a bounded
+// queue until it is opened again, so that brief maintenance is invisible to clients.
+type requestGate struct {
+	mu       sync.Mutex
+	drained  *sync.Cond
+	active   int
+	queued   int
+	closers  int
+	opened   chan struct{}
+	maxQueue int
+	timeout  time.Duration
+}
+
+// sessionGate guards the requests proxied to 'bw serve' while its session is swapped.
+var sessionGate = newRequestGate(defaultRequestQueueSize, defaultRequestQueueTimeout)
+
+func newRequestGate(maxQueue int, timeout time.Duration) *requestGate {
+	g := &requestGate{maxQueue: maxQueue, timeout: timeout}
+	g.drained = sync.NewCond(&g.mu)
+	return g
+}
+
+// configure sets the queue limits from BW_REQUEST_QUEUE_SIZE and BW_REQUEST_QUEUE_TIMEOUT.
+func (g *requestGate) configure() {
+	maxQueue := defaultRequestQueueSize
+	if val := os.Getenv("BW_REQUEST_QUEUE_SIZE"); val != "" {
+		n, err := strconv.Atoi(val)
+		if err != nil || n < 0 {
+			proxyLog.Warn("Invalid format for BW_REQUEST_QUEUE_SIZE, using default", "value", val, "default", defaultRequestQueueSize, "error", err)
+		} else {
+			maxQueue = n
+		}
+	}
+	timeout := defaultRequestQueueTimeout
+	if val := os.Getenv("BW_REQUEST_QUEUE_TIMEOUT"); val != "" {
+		d, err := time.ParseDuration(val)
+		if err != nil || d <= 0 {
+			proxyLog.Warn("Invalid format for BW_REQUEST_QUEUE_TIMEOUT, using default", "value", val, "default", defaultRequestQueueTimeout, "error", err)
+		} else {
+			timeout = d
+		}
+	}
+	g.mu.Lock()
+	defer g.mu.Unlock()
+	g.maxQueue, g.timeout = maxQueue, timeout
+}
+
+// enter admits a request, waiting in the queue while the gate is closed. It fails if
+// the queue is full, the request waited for longer than the queue timeout or ctx is
+// done. Admitted requests must call leave when they are done.
+func (g *requestGate) enter(ctx context.Context) error {
+	g.mu.Lock()
+	if g.closers > 0 {
+		if g.queued >= g.maxQueue {
+			g.mu.Unlock()
+			return errQueueFull
+		}
+		g.queued++
+		queuedRequests.Inc()
+		timer := time.NewTimer(g.timeout)
+		defer timer.Stop()
+		for g.closers > 0 {
+			opened := g.opened
+			g.mu.Unlock()
+			var err error
+			select {
+			case <-opened:
+			case <-timer.C:
+				err = errQueueTimeout
+			case <-ctx.Done():
+				err = ctx.Err()
+			}
+			g.mu.Lock()
+			if err != nil {
+				g.queued--
+				queuedRequests.Dec()
+				g.mu.Unlock()
+				return err
+			}
+		}
+		g.queued--
+		queuedRequests.Dec()
+	}
+	g.active++
+	g.mu.Unlock()
+	return nil
+}
+
+// leave marks an admitted request as done.
+func (g *requestGate) leave() {
+	g.mu.Lock()
+	defer g.mu.Unlock()
+	g.active--
+	if g.active == 0 {
+		g.drained.Broadcast()
+	}
+}
+
+// close holds back new requests and waits for those in flight to finish. The gate may
+// be closed by several callers at once; it opens once all of them called open.
+func (g *requestGate) close() {
+	g.mu.Lock()
+	defer g.mu.Unlock()
+	if g.closers == 0 {
+		g.opened = make(chan struct{})
+	}
+	g.closers++
+	for g.active > 0 {
+		g.drained.Wait()
+	}
+}
+
+// open lets the queued and new requests through again, once every close is undone.
+func (g *requestGate) open() {
+	g.mu.Lock()
+	defer g.mu.Unlock()
+	g.closers--
+	if g.closers == 0 {
+		close(g.opened)
+	}
+}
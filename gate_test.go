@@ -0,0 +1,96 @@
+package main
+
+import (
+	"context"
+	"errors"
+	"net/http"
+	"net/http/httptest"
+	"net/http/httputil"
+	"net/url"
+	"testing"
+	"time"
+)
+
+func TestRequestGate(t *testing.T) {
+	g := newRequestGate(1, time.Second)
+
+	// Closing waits for the requests in flight.
+	if err := g.enter(context.Background()); err != nil {
+		t.Fatal(err)
+	}
+	closed := make(chan struct{})
+	go func() {
+		g.close()
+		close(closed)
+	}()
+	select {
+	case <-closed:
+		t.Fatal("gate closed with a request in flight")
+	case <-time.After(50 * time.Millisecond):
+	}
+	g.leave()
+	<-closed
+
+	// Requests are queued until the gate opens, up to the queue size.
+	admitted := make(chan error)
+	go func() { admitted <- g.enter(context.Background()) }()
+	time.Sleep(50 * time.Millisecond)
+	if err := g.enter(context.Background()); !errors.Is(err, errQueueFull) {
+		t.Errorf("got %v want %v", err, errQueueFull)
+	}
+	g.open()
+	if err := <-admitted; err != nil {
+		t.Errorf("queued request: %v", err)
+	}
+	g.leave()
+
+	// Nested closes keep the gate closed until all are undone.
+	g.close()
+	g.close()
+	g.open()
+	g.timeout = 50 * time.Millisecond
+	if err := g.enter(context.Background()); !errors.Is(err, errQueueTimeout) {
+		t.Errorf("got %v want %v", err, errQueueTimeout)
+	}
+	g.open()
+	if err := g.enter(context.Background()); err != nil {
+		t.Errorf("got %v after opening", err)
+	}
+	g.leave()
+}
+
+func TestRequestGateConfigure(t *testing.T) {
+	g := newRequestGate(0, 0)
+	t.Setenv("BW_REQUEST_QUEUE_SIZE", "5")
+	t.Setenv("BW_REQUEST_QUEUE_TIMEOUT", "invalid")
+	g.configure()
+	if g.maxQueue != 5 || g.timeout != defaultRequestQueueTimeout {
+		t.Errorf("got %d, %v", g.maxQueue, g.timeout)
+	}
+}
+
+func TestServeBehindSessionGate_QueueFull(t *testing.T) {
+	defer func(g *requestGate) { sessionGate = g }(sessionGate)
+	sessionGate = newRequestGate(0, time.Second)
+
+	upstream := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		_, _ = w.Write([]byte("OK"))
+	}))
+	defer upstream.Close()
+	u, _ := url.Parse(upstream.URL)
+	proxy := httputil.NewSingleHostReverseProxy(u)
+
+	sessionGate.close()
+	rr := httptest.NewRecorder()
+	serveBehindSessionGate(proxy, rr, httptest.NewRequest("GET", "/list/object/items", nil))
+	if rr.Code != http.StatusServiceUnavailable || rr.Header().Get("Retry-After") == "" {
+		t.Errorf("got status %v want %v with Retry-After", rr.Code, http.StatusServiceUnavailable)
+	}
+	sessionGate.open()
+
+	rr = httptest.NewRecorder()
+	serveBehindSessionGate(proxy, rr, httptest.NewRequest("GET", "/list/object/items", nil))
+	if rr.Code != http.StatusOK {
+		t.Errorf("got status %v want %v", rr.Code, http.StatusOK)
+	}
+}
@@ -0,0 +1,84 @@
+package main
+
+import (
+	"context"
+	"encoding/base64"
+	"encoding/json"
+	"fmt"
+	"io"
+	"net/http"
+	"strings"
+
+	"golang.org/x/oauth2"
+	"golang.org/x/oauth2/google"
+)
+
+var gcpSecretManagerEndpoint = "https://secretmanager.googleapis.com/v1/"
+
+// gcpTokenSource provides the credentials for Secret Manager requests. By default
+// these are the Application Default Credentials, which cover workload identity on
+// GKE and the attached service account on Cloud Run or GCE.
+var gcpTokenSource = func(ctx context.Context) (oauth2.TokenSource, error) {
+	return google.DefaultTokenSource(ctx, "https://www.googleapis.com/auth/cloud-platform")
+}
+
+// fetchGCPSecret accesses a Secret Manager secret version, given by its full resource
+// name (projects/<project>/secrets/<secret>/versions/<version>). Transient failures are
+// retried like the login steps, while denied access fails immediately.
+func fetchGCPSecret(name string) (string, error) {
+	if !strings.HasPrefix(name, "projects/") || !strings.Contains(name, "/secrets/") {
+		return "", fmt.Errorf("invalid BW_PASSWORD_GCP_SECRET '%s', expected projects/<project>/secrets/<secret>/versions/<version>", name)
+	}
+	if !strings.Contains(name, "/versions/") {
+		name += "/versions/latest"
+	}
+
+	var secret string
+	err := withLoginRetry("GCP Secret Manager access", func() error {
+		ctx, cancel := context.WithTimeout(context.Background(), secretStoreTimeout)
+		defer cancel()
+
+		tokenSource, err := gcpTokenSource(ctx)
+		if err != nil {
+			return permanentError{fmt.Errorf("failed to find GCP credentials: %v", err)}
+		}
+		req, err := http.NewRequestWithContext(ctx, http.MethodGet, gcpSecretManagerEndpoint+name+":access", nil)
+		if err != nil {
+			return permanentError{err}
+		}
+		resp, err := oauth2.NewClient(ctx, tokenSource).Do(req)
+		if err != nil {
+			return fmt.Errorf("GCP Secret Manager request failed: %v", err)
+		}
+		defer func() { _ = resp.Body.Close() }()
+
+		body, err := io.ReadAll(resp.Body)
+		if err != nil {
+			return fmt.Errorf("failed to read GCP Secret Manager response: %v", err)
+		}
+		switch {
+		case resp.StatusCode == http.StatusForbidden || resp.StatusCode == http.StatusUnauthorized:
+			return permanentError{fmt.Errorf("access to GCP secret '%s' denied, make sure the workload identity has the roles/secretmanager.secretAccessor role: %s", name, string(body))}
+		case resp.StatusCode == http.StatusNotFound:
+			return permanentError{fmt.Errorf("GCP secret '%s' not found", name)}
+		case resp.StatusCode != http.StatusOK:
+			return fmt.Errorf("GCP Secret Manager returned status %d: %s", resp.StatusCode, string(body))
+		}
+
+		var v struct {
+			Payload struct {
+				Data string `json:"data"`
+			} `json:"payload"`
+		}
+		if err := json.Unmarshal(body, &v); err != nil {
+			return fmt.Errorf("failed to parse GCP Secret Manager response: %v", err)
+		}
+		data, err := base64.StdEncoding.DecodeString(v.Payload.Data)
+		if err != nil {
+			return fmt.Errorf("failed to decode GCP secret payload: %v", err)
+		}
+		secret = strings.TrimSpace(string(data))
+		return nil
+	})
+	return secret, err
+}
@@ -0,0 +1,96 @@
+package main
+
+import (
+	"context"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+
+	"golang.org/x/oauth2"
+)
+
+// fakeGCPSecretManager serves a single secret version and swaps in static credentials.
+func fakeGCPSecretManager(t *testing.T, handler http.HandlerFunc) {
+	t.Helper()
+	ts := httptest.NewServer(handler)
+	t.Cleanup(ts.Close)
+
+	endpoint, tokenSource := gcpSecretManagerEndpoint, gcpTokenSource
+	gcpSecretManagerEndpoint = ts.URL + "/v1/"
+	gcpTokenSource = func(ctx context.Context) (oauth2.TokenSource, error) {
+		return oauth2.StaticTokenSource(&oauth2.Token{AccessToken: "test-token"}), nil
+	}
+	t.Cleanup(func() { gcpSecretManagerEndpoint, gcpTokenSource = endpoint, tokenSource })
+}
+
+func TestGetPassword_GCPSecretManager(t *testing.T) {
+	fakeGCPSecretManager(t, func(w http.ResponseWriter, r *http.Request) {
+		if r.URL.Path != "/v1/projects/test/secrets/bw-password/versions/latest:access" {
+			http.NotFound(w, r)
+			return
+		}
+		if r.Header.Get("Authorization") != "Bearer test-token" {
+			w.WriteHeader(http.StatusUnauthorized)
+			return
+		}
+		// base64 of "gcp-password"
+		_, _ = w.Write([]byte(`{"name":"projects/test/secrets/bw-password/versions/1","payload":{"data":"Z2NwLXBhc3N3b3Jk"}}`))
+	})
+	t.Setenv("BW_PASSWORD_AWS_SECRET_ARN", "")
+	t.Setenv("BW_PASSWORD_AWS_SSM_PARAMETER", "")
+	t.Setenv("BW_PASSWORD_GCP_SECRET", "projects/test/secrets/bw-password/versions/latest")
+
+	got, err := getPassword()
+	if err != nil {
+		t.Fatalf("expected nil, got %v", err)
+	}
+	if got != "gcp-password" {
+		t.Errorf("getPassword() = %q, want %q", got, "gcp-password")
+	}
+}
+
+func TestFetchGCPSecret_AccessDeniedNotRetried(t *testing.T) {
+	t.Setenv("BW_LOGIN_RETRIES", "5")
+	t.Setenv("BW_LOGIN_BACKOFF", "1ms")
+	calls := 0
+	fakeGCPSecretManager(t, func(w http.ResponseWriter, r *http.Request) {
+		calls++
+		w.WriteHeader(http.StatusForbidden)
+		_, _ = w.Write([]byte(`{"error":{"code":403,"status":"PERMISSION_DENIED"}}`))
+	})
+
+	if _, err := fetchGCPSecret("projects/test/secrets/bw-password"); err == nil {
+		t.Fatal("expected error when access is denied")
+	}
+	if calls != 1 {
+		t.Errorf("secret accessed %d times, want 1", calls)
+	}
+}
+
+func TestFetchGCPSecret_RetriesServerErrors(t *testing.T) {
+	t.Setenv("BW_LOGIN_RETRIES", "3")
+	t.Setenv("BW_LOGIN_BACKOFF", "1ms")
+	calls := 0
+	fakeGCPSecretManager(t, func(w http.ResponseWriter, r *http.Request) {
+		calls++
+		if calls < 3 {
+			w.WriteHeader(http.StatusServiceUnavailable)
+			return
+		}
+		_, _ = w.Write([]byte(`{"payload":{"data":"Z2NwLXBhc3N3b3Jk"}}`))
+	})
+
+	got, err := fetchGCPSecret("projects/test/secrets/bw-password/versions/2")
+	if err != nil {
+		t.Fatalf("expected nil, got %v", err)
+	}
+	if got != "gcp-password" {
+		t.Errorf("fetchGCPSecret() = %q, want %q", got, "gcp-password")
+	}
+}
+
+func TestFetchGCPSecret_InvalidName(t *testing.T) {
+	if _, err := fetchGCPSecret("bw-password"); err == nil {
+		t.Fatal("expected error for invalid resource name")
+	}
+}
@@ -0,0 +1,54 @@
+package main
+
+import "net/http"
+
+// upstreamCacheHeaders are dropped from responses, so that no client or intermediate
+// cache is encouraged to store or revalidate secrets.
+var upstreamCacheHeaders = []string{"Age", "ETag", "Expires", "Last-Modified"}
+
+// securityHeadersEnabled reports whether BW_PROXY_SECURITY_HEADERS is enabled, which it
+// is by default.
+func securityHeadersEnabled() bool {
+	return getEnv("BW_PROXY_SECURITY_HEADERS", "true") != "false"
+}
+
+// withSecurityHeaders marks all responses as not cacheable and disables content type
+// sniffing, overriding whatever caching headers the upstream sent.
+func withSecurityHeaders(next http.Handler) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		next.ServeHTTP(&securityHeaderWriter{ResponseWriter: w}, r)
+	})
+}
+
+// securityHeaderWriter sets the security headers right before the response headers
+// are sent, after the wrapped handler and the upstream added their own.
+type securityHeaderWriter struct {
+	http.ResponseWriter
+	wroteHeader bool
+}
+
+func (s *securityHeaderWriter) WriteHeader(status int) {
+	if !s.wroteHeader {
+		s.wroteHeader = true
+		header := s.Header()
+		for _, key := range upstreamCacheHeaders {
+			header.Del(key)
+		}
+		header.Set("Cache-Control", "no-store")
+		header.Set("Pragma", "no-cache")
+		header.Set("X-Content-Type-Options", "nosniff")
+	}
+	s.ResponseWriter.WriteHeader(status)
+}
+
+func (s *securityHeaderWriter) Write(b []byte) (int, error) {
+	if !s.wroteHeader {
+		s.WriteHeader(http.StatusOK)
+	}
+	return s.ResponseWriter.Write(b)
+}
+
+// Unwrap allows http.ResponseController to reach the underlying writer, e.g. to flush.
+func (s *securityHeaderWriter) Unwrap() http.ResponseWriter {
+	return s.ResponseWriter
+}
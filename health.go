@@ -0,0 +1,318 @@
+package main
+
+import (
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"os"
+	"sync"
+	"sync/atomic"
+	"time"
+)
+
+// startTime is when the wrapper started, which counts as a sync for readiness, since
+// logging in fetches the vault.
+var startTime = time.Now()
+
+// Startup stages reported by /startup and /healthz/details.
+const (
+	stageStarting  = "starting"
+	stageConfigure = "configuring_host"
+	stageLogin     = "login"
+	stageUnlock    = "unlocking"
+	stageServe     = "starting_serve"
+	stageSync      = "syncing"
+	stageReady     = "ready"
+)
+
+// startupStep is a stage reached during startup, and when it was reached.
+type startupStep struct {
+	Stage   string    `json:"stage"`
+	Started time.Time `json:"started"`
+}
+
+// startupSteps are the stages the wrapper went through during startup, in order.
+var (
+	startupMu    sync.Mutex
+	startupSteps = []startupStep{{Stage: stageStarting, Started: startTime}}
+)
+
+// setStartupStage records the stage the wrapper has reached during startup. Once it
+// is stageReady, requests are no longer held off by startupGate.
+func setStartupStage(stage string) {
+	startupMu.Lock()
+	defer startupMu.Unlock()
+	if startupSteps[len(startupSteps)-1].Stage != stage {
+		startupSteps = append(startupSteps, startupStep{Stage: stage, Started: time.Now()})
+	}
+}
+
+// currentStartupStage returns the stage the wrapper has reached during startup.
+func currentStartupStage() string {
+	startupMu.Lock()
+	defer startupMu.Unlock()
+	return startupSteps[len(startupSteps)-1].Stage
+}
+
+// enterStartupStage records a stage reached while logging in, unless startup has
+// already completed, as logging in and unlocking again later on are not part of it.
+func enterStartupStage(stage string) {
+	if currentStartupStage() != stageReady {
+		setStartupStage(stage)
+	}
+}
+
+// sessionStart is when the current session was obtained, in Unix nanoseconds.
+var sessionStart atomic.Int64
+
+// recordSessionStart records that a new session was obtained.
+func recordSessionStart() {
+	sessionStart.Store(time.Now().UnixNano())
+}
+
+// loginTime is when the wrapper last logged in, in Unix nanoseconds. It is zero if a
+// supplied or persisted session was reused, in which case the login is older.
+var loginTime atomic.Int64
+
+// recordLogin records that the wrapper logged in.
+func recordLogin() {
+	loginTime.Store(time.Now().UnixNano())
+}
+
+// loginAge returns how long ago the wrapper logged in, counting from its start if it
+// reused an existing session.
+func loginAge() time.Duration {
+	if t := loginTime.Load(); t != 0 {
+		return time.Since(time.Unix(0, t))
+	}
+	return time.Since(startTime)
+}
+
+// Vault states reported by the deep health check.
+const (
+	vaultStateUnlocked    = "unlocked"
+	vaultStateLocked      = "locked"
+	vaultStateUnreachable = "unreachable"
+)
+
+// checkVault queries the status of 'bw serve' on port and reports its state, and
+// whether the vault is usable in that state.
+func checkVault(port string) (string, bool) {
+	client := &http.Client{Timeout: 2 * time.Second}
+	status, err := fetchBwServeStatus(client, bwServeURL(port, "/status"))
+	if err != nil {
+		serveLog.Debug("Health check could not reach 'bw serve'", "error", err)
+		return vaultStateUnreachable, false
+	}
+	if status.isUnlocked() {
+		return vaultStateUnlocked, true
+	}
+	// Organization API keys have no session and never unlock the vault.
+	return vaultStateLocked, os.Getenv("BW_SESSION") == ""
+}
+
+// handleHealthz reports whether the proxy is running. With ?deep=1, it also checks
+// that 'bw serve' is reachable and unlocked, and returns 503 otherwise, so that a
+// wedged instance gets restarted.
+func handleHealthz(w http.ResponseWriter, r *http.Request) {
+	if !r.URL.Query().Has("deep") {
+		w.WriteHeader(http.StatusOK)
+		_, _ = fmt.Fprint(w, "OK")
+		return
+	}
+
+	state, ok := checkVault(getEnv("BW_SERVE_PORT", "8088"))
+	if !ok {
+		http.Error(w, "Unavailable: vault is "+state, http.StatusServiceUnavailable)
+		return
+	}
+	w.WriteHeader(http.StatusOK)
+	_, _ = fmt.Fprint(w, "OK: vault is "+state)
+}
+
+// isHealthCheckPath reports whether a path is one of the health checks, which are
+// exempt from authentication and network restrictions.
+func isHealthCheckPath(path string) bool {
+	return path == "/healthz" || path == "/livez" || path == "/readyz" || path == "/startup"
+}
+
+// handleLivez reports that the wrapper process is running. It does not check 'bw serve',
+// which the wrapper recovers on its own, so a liveness probe doesn't kill-loop the pod.
+func handleLivez(w http.ResponseWriter, r *http.Request) {
+	w.WriteHeader(http.StatusOK)
+	_, _ = fmt.Fprint(w, "OK")
+}
+
+// handleReadyz reports whether requests can be served: 'bw serve' has to be up and
+// unlocked, and if BW_READY_MAX_SYNC_AGE is set, the vault must have been synced
+// successfully within that time.
+func handleReadyz(w http.ResponseWriter, r *http.Request) {
+	if stage := currentStartupStage(); stage != stageReady {
+		http.Error(w, "Not ready: starting ("+stage+")", http.StatusServiceUnavailable)
+		return
+	}
+	if inLameDuck() {
+		http.Error(w, "Not ready: draining in lame-duck mode", http.StatusServiceUnavailable)
+		return
+	}
+	if bwServeRecovering.Load() {
+		http.Error(w, "Not ready: 'bw serve' is restarting after a crash", http.StatusServiceUnavailable)
+		return
+	}
+	state, ok := checkVault(getEnv("BW_SERVE_PORT", "8088"))
+	if !ok {
+		http.Error(w, "Not ready: vault is "+state, http.StatusServiceUnavailable)
+		return
+	}
+	if age, stale := syncAge(); stale {
+		http.Error(w, fmt.Sprintf("Not ready: last successful sync was %s ago", age.Round(time.Second)), http.StatusServiceUnavailable)
+		return
+	}
+	w.WriteHeader(http.StatusOK)
+	_, _ = fmt.Fprint(w, "OK")
+}
+
+// syncAge returns the time since the last successful sync, and whether it exceeds
+// BW_READY_MAX_SYNC_AGE.
+func syncAge() (time.Duration, bool) {
+	val := os.Getenv("BW_READY_MAX_SYNC_AGE")
+	if val == "" {
+		return 0, false
+	}
+	maxAge, err := time.ParseDuration(val)
+	if err != nil || maxAge <= 0 {
+		serveLog.Warn("Invalid format for BW_READY_MAX_SYNC_AGE, not checking the sync age", "value", val)
+		return 0, false
+	}
+	age := sinceLastSync()
+	return age, age > maxAge
+}
+
+// healthDetails describes the state of the wrapper, served at /healthz/details.
+type healthDetails struct {
+	Status             string     `json:"status"`
+	Stage              string     `json:"stage"`
+	UptimeSeconds      int64      `json:"uptimeSeconds"`
+	Version            string     `json:"version"`
+	CLIVersion         string     `json:"cliVersion,omitempty"`
+	Vault              string     `json:"vault"`
+	SessionAgeSeconds  *int64     `json:"sessionAgeSeconds,omitempty"`
+	LoginAgeSeconds    int64      `json:"loginAgeSeconds"`
+	LastSync           *time.Time `json:"lastSync,omitempty"`
+	LastSyncAgeSeconds *int64     `json:"lastSyncAgeSeconds,omitempty"`
+	LastSyncError      string     `json:"lastSyncError,omitempty"`
+}
+
+// handleHealthDetails reports uptime, startup stage, versions, session age, sync
+// freshness and the state of 'bw serve' as JSON, for status pages and debugging. Like
+// the deep health check, it returns 503 if the vault is unusable.
+func handleHealthDetails(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodGet {
+		http.Error(w, "Method not allowed", http.StatusMethodNotAllowed)
+		return
+	}
+
+	state, ok := checkVault(getEnv("BW_SERVE_PORT", "8088"))
+	details := healthDetails{
+		Status:        "ok",
+		Stage:         currentStartupStage(),
+		UptimeSeconds: int64(time.Since(startTime).Seconds()),
+		Version:       currentVersion().Version,
+		CLIVersion:    cliVersion,
+		Vault:         state,
+	}
+	if !ok {
+		details.Status = "unavailable"
+	}
+	details.LoginAgeSeconds = int64(loginAge().Seconds())
+	if start := sessionStart.Load(); start != 0 {
+		details.SessionAgeSeconds = new(int64(time.Since(time.Unix(0, start)).Seconds()))
+	}
+	status := syncs.snapshot()
+	if status.LastSuccess != nil {
+		details.LastSync = status.LastSuccess
+		details.LastSyncAgeSeconds = new(int64(time.Since(*status.LastSuccess).Seconds()))
+	}
+	details.LastSyncError = status.LastError
+
+	w.Header().Set("Content-Type", "application/json")
+	if !ok {
+		w.WriteHeader(http.StatusServiceUnavailable)
+	}
+	_ = json.NewEncoder(w).Encode(details)
+}
+
+// startupResponse is returned by startupGate while the wrapper is starting.
+type startupResponse struct {
+	Status  string `json:"status"`
+	Stage   string `json:"stage"`
+	Message string `json:"message"`
+}
+
+// startupGate answers requests with 503 and a JSON body until startup is complete,
+// except for the health checks and other endpoints that don't need the vault.
+func startupGate(next http.Handler) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		stage := currentStartupStage()
+		if stage == stageReady || availableDuringStartup(r.URL.Path) {
+			next.ServeHTTP(w, r)
+			return
+		}
+		w.Header().Set("Content-Type", "application/json")
+		w.Header().Set("Retry-After", "5")
+		w.WriteHeader(http.StatusServiceUnavailable)
+		_ = json.NewEncoder(w).Encode(startupResponse{Status: "starting", Stage: stage, Message: "waiting for unlock"})
+	})
+}
+
+// availableDuringStartup reports whether a path is served before the vault is ready.
+func availableDuringStartup(path string) bool {
+	return isHealthCheckPath(path) || path == "/healthz/details" || path == "/version" || path == "/metrics"
+}
+
+// startupStageStatus is a stage in the /startup response, with the time spent in it.
+type startupStageStatus struct {
+	startupStep
+	DurationSeconds float64 `json:"durationSeconds"`
+}
+
+// startupStatus is the response of /startup.
+type startupStatus struct {
+	Stage          string               `json:"stage"`
+	Ready          bool                 `json:"ready"`
+	ElapsedSeconds float64              `json:"elapsedSeconds"`
+	Stages         []startupStageStatus `json:"stages"`
+}
+
+// handleStartup reports the current startup stage and when each stage was reached, so
+// that a slow or stuck startup can be diagnosed. The elapsed time stops once ready.
+func handleStartup(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodGet {
+		http.Error(w, "Method not allowed", http.StatusMethodNotAllowed)
+		return
+	}
+
+	startupMu.Lock()
+	steps := append([]startupStep{}, startupSteps...)
+	startupMu.Unlock()
+
+	now := time.Now()
+	current := steps[len(steps)-1]
+	status := startupStatus{Stage: current.Stage, Ready: current.Stage == stageReady}
+	for i, step := range steps {
+		end := now
+		if i+1 < len(steps) {
+			end = steps[i+1].Started
+		} else if status.Ready {
+			end = step.Started
+		}
+		status.Stages = append(status.Stages, startupStageStatus{startupStep: step, DurationSeconds: end.Sub(step.Started).Seconds()})
+	}
+	if status.Ready {
+		now = current.Started
+	}
+	status.ElapsedSeconds = now.Sub(startTime).Seconds()
+
+	w.Header().Set("Content-Type", "application/json")
+	_ = json.NewEncoder(w).Encode(status)
+}
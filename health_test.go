@@ -0,0 +1,199 @@
+package main
+
+import (
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"strings"
+	"testing"
+	"time"
+)
+
+func TestDeepHealthz(t *testing.T) {
+	status := `{"data": {"template": {"status": "unlocked"}}}`
+	ts := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		_, _ = w.Write([]byte(status))
+	}))
+	defer ts.Close()
+	u, _ := url.Parse(ts.URL)
+	t.Setenv("BW_SERVE_PORT", u.Port())
+	t.Setenv("BW_SESSION", "test-session-token")
+
+	check := func(want int, wantBody string) {
+		t.Helper()
+		rr := httptest.NewRecorder()
+		handleHealthz(rr, httptest.NewRequest("GET", "/healthz?deep=1", nil))
+		if rr.Code != want || rr.Body.String() != wantBody {
+			t.Errorf("got %v %q, want %v %q", rr.Code, rr.Body.String(), want, wantBody)
+		}
+	}
+
+	check(http.StatusOK, "OK: vault is unlocked")
+
+	status = `{"data": {"template": {"status": "locked"}}}`
+	check(http.StatusServiceUnavailable, "Unavailable: vault is locked\n")
+
+	// Without a session, as with organization API keys, a locked vault is expected.
+	t.Setenv("BW_SESSION", "")
+	check(http.StatusOK, "OK: vault is locked")
+
+	ts.Close()
+	check(http.StatusServiceUnavailable, "Unavailable: vault is unreachable\n")
+}
+
+func TestReadyz(t *testing.T) {
+	defer func() { syncs = &syncTracker{} }()
+	ts := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		_, _ = w.Write([]byte(`{"data": {"template": {"status": "unlocked"}}}`))
+	}))
+	defer ts.Close()
+	u, _ := url.Parse(ts.URL)
+	t.Setenv("BW_SERVE_PORT", u.Port())
+	t.Setenv("BW_READY_MAX_SYNC_AGE", "1m")
+
+	check := func(want int) {
+		t.Helper()
+		rr := httptest.NewRecorder()
+		handleReadyz(rr, httptest.NewRequest("GET", "/readyz", nil))
+		if rr.Code != want {
+			t.Errorf("got status %v want %v, body: %s", rr.Code, want, rr.Body.String())
+		}
+	}
+
+	syncs = &syncTracker{}
+	syncs.status.LastSuccess = new(time.Now().Add(-5 * time.Minute))
+	check(http.StatusServiceUnavailable)
+
+	syncs.record(time.Now(), nil)
+	check(http.StatusOK)
+
+	// The wrapper stays alive while 'bw serve' is unreachable.
+	ts.Close()
+	check(http.StatusServiceUnavailable)
+	rr := httptest.NewRecorder()
+	handleLivez(rr, httptest.NewRequest("GET", "/livez", nil))
+	if rr.Code != http.StatusOK {
+		t.Errorf("livez: got status %v want %v", rr.Code, http.StatusOK)
+	}
+}
+
+func TestHealthDetails(t *testing.T) {
+	defer func() { syncs = &syncTracker{} }()
+	defer sessionStart.Store(0)
+	ts := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		_, _ = w.Write([]byte(`{"data": {"template": {"status": "unlocked"}}}`))
+	}))
+	defer ts.Close()
+	u, _ := url.Parse(ts.URL)
+	t.Setenv("BW_SERVE_PORT", u.Port())
+
+	syncs = &syncTracker{}
+	syncs.record(time.Now(), nil)
+	recordSessionStart()
+
+	rr := httptest.NewRecorder()
+	handleHealthDetails(rr, httptest.NewRequest("GET", "/healthz/details", nil))
+	if rr.Code != http.StatusOK {
+		t.Fatalf("got status %v want %v", rr.Code, http.StatusOK)
+	}
+	var details healthDetails
+	if err := json.Unmarshal(rr.Body.Bytes(), &details); err != nil {
+		t.Fatalf("expected JSON, got %q: %v", rr.Body.String(), err)
+	}
+	if details.Status != "ok" || details.Vault != vaultStateUnlocked || details.Version == "" ||
+		details.SessionAgeSeconds == nil || details.LastSync == nil || details.LastSyncAgeSeconds == nil {
+		t.Errorf("unexpected details: %s", rr.Body.String())
+	}
+
+	ts.Close()
+	rr = httptest.NewRecorder()
+	handleHealthDetails(rr, httptest.NewRequest("GET", "/healthz/details", nil))
+	if rr.Code != http.StatusServiceUnavailable || !strings.Contains(rr.Body.String(), `"vault":"unreachable"`) {
+		t.Errorf("got %v %s, want 503 with an unreachable vault", rr.Code, rr.Body.String())
+	}
+}
+
+func TestStartupGate(t *testing.T) {
+	defer setStartupStage(stageReady)
+	setStartupStage(stageLogin)
+
+	handler := startupGate(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		_, _ = w.Write([]byte("OK"))
+	}))
+
+	rr := httptest.NewRecorder()
+	handler.ServeHTTP(rr, httptest.NewRequest("GET", "/list/object/items", nil))
+	if rr.Code != http.StatusServiceUnavailable || rr.Header().Get("Retry-After") == "" {
+		t.Fatalf("got status %v, Retry-After %q", rr.Code, rr.Header().Get("Retry-After"))
+	}
+	var resp startupResponse
+	if err := json.Unmarshal(rr.Body.Bytes(), &resp); err != nil {
+		t.Fatal(err)
+	}
+	if resp.Status != "starting" || resp.Stage != stageLogin || resp.Message != "waiting for unlock" {
+		t.Errorf("unexpected body %+v", resp)
+	}
+
+	// Health checks are answered during startup.
+	rr = httptest.NewRecorder()
+	handler.ServeHTTP(rr, httptest.NewRequest("GET", "/livez", nil))
+	if rr.Code != http.StatusOK {
+		t.Errorf("livez: got status %v want %v", rr.Code, http.StatusOK)
+	}
+	rr = httptest.NewRecorder()
+	handleReadyz(rr, httptest.NewRequest("GET", "/readyz", nil))
+	if rr.Code != http.StatusServiceUnavailable {
+		t.Errorf("readyz: got status %v want %v", rr.Code, http.StatusServiceUnavailable)
+	}
+
+	setStartupStage(stageReady)
+	rr = httptest.NewRecorder()
+	handler.ServeHTTP(rr, httptest.NewRequest("GET", "/list/object/items", nil))
+	if rr.Code != http.StatusOK {
+		t.Errorf("got status %v want %v", rr.Code, http.StatusOK)
+	}
+}
+
+func TestStartup(t *testing.T) {
+	defer func() { startupSteps = []startupStep{{Stage: stageReady, Started: time.Now()}} }()
+	startupSteps = []startupStep{{Stage: stageStarting, Started: startTime}}
+
+	get := func() startupStatus {
+		t.Helper()
+		rr := httptest.NewRecorder()
+		handleStartup(rr, httptest.NewRequest("GET", "/startup", nil))
+		if rr.Code != http.StatusOK {
+			t.Fatalf("got status %v want %v", rr.Code, http.StatusOK)
+		}
+		var status startupStatus
+		if err := json.Unmarshal(rr.Body.Bytes(), &status); err != nil {
+			t.Fatal(err)
+		}
+		return status
+	}
+
+	enterStartupStage(stageConfigure)
+	enterStartupStage(stageLogin)
+	enterStartupStage(stageLogin)
+	status := get()
+	if status.Stage != stageLogin || status.Ready || len(status.Stages) != 3 {
+		t.Fatalf("unexpected status %+v", status)
+	}
+	if status.Stages[1].Stage != stageConfigure || status.Stages[1].Started.After(status.Stages[2].Started) {
+		t.Errorf("unexpected stages %+v", status.Stages)
+	}
+
+	setStartupStage(stageServe)
+	setStartupStage(stageReady)
+	status = get()
+	if status.Stage != stageReady || !status.Ready || len(status.Stages) != 5 {
+		t.Fatalf("unexpected status %+v", status)
+	}
+
+	// Unlocking again after startup is not a startup stage.
+	enterStartupStage(stageUnlock)
+	if stage := currentStartupStage(); stage != stageReady {
+		t.Errorf("got stage %q want %q", stage, stageReady)
+	}
+}
@@ -0,0 +1,111 @@
+package main
+
+import (
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"os"
+	"sync"
+	"syscall"
+	"time"
+)
+
+const defaultLameDuckGrace = 30 * time.Second
+
+// lameDuckRequest is the body of POST /admin/lameduck.
+type lameDuckRequest struct {
+	Grace string `json:"grace"`
+}
+
+// lameDuckStatus is the response of /admin/lameduck.
+type lameDuckStatus struct {
+	LameDuck bool       `json:"lameDuck"`
+	Until    *time.Time `json:"until,omitempty"`
+}
+
+// lameDuck is set while the wrapper drains traffic ahead of a planned replacement.
+var lameDuck struct {
+	mu    sync.Mutex
+	until time.Time
+	timer *time.Timer
+}
+
+// inLameDuck reports whether the wrapper is in lame-duck mode, during which it reports
+// itself as not ready while still serving requests.
+func inLameDuck() bool {
+	lameDuck.mu.Lock()
+	defer lameDuck.mu.Unlock()
+	return lameDuck.timer != nil
+}
+
+// lameDuckStatusNow returns the current lame-duck state.
+func lameDuckStatusNow() lameDuckStatus {
+	lameDuck.mu.Lock()
+	defer lameDuck.mu.Unlock()
+	if lameDuck.timer == nil {
+		return lameDuckStatus{}
+	}
+	return lameDuckStatus{LameDuck: true, Until: new(lameDuck.until)}
+}
+
+// enterLameDuck fails /readyz, so that load balancers and orchestrators stop sending
+// new traffic, and shuts down gracefully once grace has passed. Entering it again
+// replaces the grace period.
+func enterLameDuck(grace time.Duration) {
+	lameDuck.mu.Lock()
+	defer lameDuck.mu.Unlock()
+	if lameDuck.timer != nil {
+		lameDuck.timer.Stop()
+	}
+	lameDuck.until = time.Now().Add(grace)
+	lameDuck.timer = time.AfterFunc(grace, func() {
+		adminLog.Info("Lame-duck grace period is over, shutting down")
+		// Shuts down like on a termination signal from the orchestrator.
+		_ = syscall.Kill(os.Getpid(), syscall.SIGTERM)
+	})
+}
+
+// leaveLameDuck cancels lame-duck mode and the pending shutdown.
+func leaveLameDuck() {
+	lameDuck.mu.Lock()
+	defer lameDuck.mu.Unlock()
+	if lameDuck.timer != nil {
+		lameDuck.timer.Stop()
+		lameDuck.timer = nil
+	}
+}
+
+// handleLameDuck reports (GET), enters (POST) or cancels (DELETE) lame-duck mode.
+func handleLameDuck(w http.ResponseWriter, r *http.Request) {
+	switch r.Method {
+	case http.MethodGet:
+	case http.MethodPost:
+		grace := defaultLameDuckGrace
+		var req lameDuckRequest
+		if r.ContentLength != 0 {
+			if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+				http.Error(w, fmt.Sprintf("Invalid request body: %v", err), http.StatusBadRequest)
+				return
+			}
+		}
+		if req.Grace != "" {
+			d, err := time.ParseDuration(req.Grace)
+			if err != nil || d <= 0 {
+				http.Error(w, fmt.Sprintf("Invalid grace period '%s'", req.Grace), http.StatusBadRequest)
+				return
+			}
+			grace = d
+		}
+		adminLog.Info("Entering lame-duck mode", "request_id", requestID(r), "grace", grace)
+		enterLameDuck(grace)
+	case http.MethodDelete:
+		adminLog.Info("Leaving lame-duck mode", "request_id", requestID(r))
+		leaveLameDuck()
+	default:
+		http.Error(w, "Method not allowed", http.StatusMethodNotAllowed)
+		return
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	_ = json.NewEncoder(w).Encode(lameDuckStatusNow())
+}
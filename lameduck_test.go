@@ -0,0 +1,50 @@
+package main
+
+import (
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"net/http/httputil"
+	"net/url"
+	"strings"
+	"testing"
+)
+
+func TestAdminLameDuck(t *testing.T) {
+	t.Setenv("BW_ADMIN_TOKEN", "admin-token")
+	defer leaveLameDuck()
+
+	u, _ := url.Parse("http://localhost:8080")
+	router := setupRouter(httputil.NewSingleHostReverseProxy(u))
+	send := func(method, path, body string) *httptest.ResponseRecorder {
+		req := httptest.NewRequest(method, path, strings.NewReader(body))
+		req.Header.Set("Authorization", "Bearer admin-token")
+		rr := httptest.NewRecorder()
+		router.ServeHTTP(rr, req)
+		return rr
+	}
+
+	if rr := send("POST", "/admin/lameduck", `{"grace":"soon"}`); rr.Code != http.StatusBadRequest {
+		t.Errorf("got status %v want %v", rr.Code, http.StatusBadRequest)
+	}
+
+	// The grace period is long enough not to shut down the test.
+	rr := send("POST", "/admin/lameduck", `{"grace":"1h"}`)
+	var status lameDuckStatus
+	if err := json.NewDecoder(rr.Body).Decode(&status); err != nil || !status.LameDuck || status.Until == nil {
+		t.Fatalf("got %v %+v: %v", rr.Code, status, err)
+	}
+	if rr := send("GET", "/readyz", ""); rr.Code != http.StatusServiceUnavailable || !strings.Contains(rr.Body.String(), "lame-duck") {
+		t.Errorf("readyz: got %v %q", rr.Code, rr.Body.String())
+	}
+	if rr := send("GET", "/livez", ""); rr.Code != http.StatusOK {
+		t.Errorf("livez: got status %v want %v", rr.Code, http.StatusOK)
+	}
+
+	if rr := send("DELETE", "/admin/lameduck", ""); strings.TrimSpace(rr.Body.String()) != `{"lameDuck":false}` {
+		t.Errorf("got body %q", rr.Body.String())
+	}
+	if inLameDuck() {
+		t.Error("expected lame-duck mode to be cancelled")
+	}
+}
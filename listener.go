@@ -0,0 +1,143 @@
+package main
+
+import (
+	"errors"
+	"fmt"
+	"net"
+	"net/http"
+	"os"
+	"strconv"
+	"strings"
+	"sync/atomic"
+)
+
+// defaultSocketMode allows the owner and group of the socket to connect.
+const defaultSocketMode = 0o660
+
+// listenAndServe serves handler on port of the address in BW_PROXY_BIND (all interfaces
+// by default), or on the unix socket in BW_PROXY_SOCKET if set, using TLS and the
+// access controls configured for the proxy. It returns nil once the server has been
+// stopped by shutdown.
+func listenAndServe(port string, handler http.Handler) error {
+	tlsConfig, err := proxyTLSConfig()
+	if err != nil {
+		return err
+	}
+	if tlsConfig != nil && tlsConfig.ClientCAs != nil {
+		handler = requireClientCertificate(handler)
+	}
+	if handler, err = reloadableMiddleware(handler); err != nil {
+		return err
+	}
+	handler = traceRequests(recoverPanics(handler))
+
+	var listener net.Listener
+	if socket := os.Getenv("BW_PROXY_SOCKET"); socket != "" {
+		listener, err = listenUnix(socket)
+	} else {
+		listener, err = net.Listen("tcp", net.JoinHostPort(proxyBindAddress(), port))
+	}
+	if err != nil {
+		return err
+	}
+
+	server := &http.Server{Handler: handler, TLSConfig: tlsConfig}
+	trackServer(server)
+	if tlsConfig == nil {
+		err = server.Serve(listener)
+	} else {
+		err = server.ServeTLS(listener, "", "")
+	}
+	if errors.Is(err, http.ErrServerClosed) {
+		return nil
+	}
+	return err
+}
+
+// reloadableMiddleware wraps handler in the access controls configured for the proxy,
+// which are rebuilt when the configuration is reloaded. If the new configuration is
+// invalid, the previous one stays in effect.
+func reloadableMiddleware(handler http.Handler) (http.Handler, error) {
+	current, err := proxyMiddleware(handler)
+	if err != nil {
+		return nil, err
+	}
+	var active atomic.Pointer[http.Handler]
+	active.Store(&current)
+	onReload(func() {
+		next, err := proxyMiddleware(handler)
+		if err != nil {
+			proxyLog.Warn("Failed to reload the proxy configuration, keeping the previous one", "error", err)
+			return
+		}
+		active.Store(&next)
+		proxyLog.Info("Proxy configuration reloaded")
+	})
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		(*active.Load()).ServeHTTP(w, r)
+	}), nil
+}
+
+// proxyBindAddress returns the address the proxy listens on, accepting IPv6
+// addresses with or without brackets.
+func proxyBindAddress() string {
+	return strings.Trim(getEnv("BW_PROXY_BIND", ""), "[]")
+}
+
+// listenUnix listens on a unix socket at path, replacing a stale socket left behind by
+// a previous run. Its permissions are set from BW_PROXY_SOCKET_MODE (octal) and its
+// owner from BW_PROXY_SOCKET_OWNER (uid:gid).
+func listenUnix(path string) (net.Listener, error) {
+	if err := os.Remove(path); err != nil && !os.IsNotExist(err) {
+		return nil, fmt.Errorf("failed to remove stale socket '%s': %v", path, err)
+	}
+	listener, err := net.Listen("unix", path)
+	if err != nil {
+		return nil, err
+	}
+
+	mode := os.FileMode(defaultSocketMode)
+	if val := os.Getenv("BW_PROXY_SOCKET_MODE"); val != "" {
+		if m, err := strconv.ParseUint(val, 8, 32); err == nil {
+			mode = os.FileMode(m)
+		} else {
+			proxyLog.Warn("Invalid format for BW_PROXY_SOCKET_MODE, using default", "value", val, "default", fmt.Sprintf("%o", mode), "error", err)
+		}
+	}
+	if err := os.Chmod(path, mode); err != nil {
+		_ = listener.Close()
+		return nil, fmt.Errorf("failed to set the mode of socket '%s': %v", path, err)
+	}
+
+	if val := os.Getenv("BW_PROXY_SOCKET_OWNER"); val != "" {
+		uid, gid, err := parseOwner(val)
+		if err != nil {
+			_ = listener.Close()
+			return nil, fmt.Errorf("invalid BW_PROXY_SOCKET_OWNER '%s': %v", val, err)
+		}
+		if err := os.Chown(path, uid, gid); err != nil {
+			_ = listener.Close()
+			return nil, fmt.Errorf("failed to set the owner of socket '%s': %v", path, err)
+		}
+	}
+
+	proxyLog.Info("Listening on unix socket", "path", path)
+	return listener, nil
+}
+
+// parseOwner parses a numeric "uid:gid" or "uid". A missing gid is returned as -1,
+// which leaves the group unchanged.
+func parseOwner(value string) (int, int, error) {
+	uidStr, gidStr, hasGID := strings.Cut(value, ":")
+	uid, err := strconv.Atoi(uidStr)
+	if err != nil {
+		return 0, 0, fmt.Errorf("expected a numeric uid: %v", err)
+	}
+	gid := -1
+	if hasGID {
+		if gid, err = strconv.Atoi(gidStr); err != nil {
+			return 0, 0, fmt.Errorf("expected a numeric gid: %v", err)
+		}
+	}
+	return uid, gid, nil
+}
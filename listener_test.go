@@ -0,0 +1,94 @@
+package main
+
+import (
+	"context"
+	"io"
+	"net"
+	"net/http"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+)
+
+func TestListenAndServe_UnixSocket(t *testing.T) {
+	socket := filepath.Join(t.TempDir(), "bw.sock")
+	// A stale socket from a previous run must not prevent listening.
+	if err := os.WriteFile(socket, nil, 0o600); err != nil {
+		t.Fatal(err)
+	}
+	t.Setenv("BW_PROXY_SOCKET", socket)
+	t.Setenv("BW_PROXY_SOCKET_MODE", "600")
+
+	go func() {
+		_ = listenAndServe("0", http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			_, _ = w.Write([]byte("OK"))
+		}))
+	}()
+
+	client := &http.Client{Transport: &http.Transport{
+		DialContext: func(ctx context.Context, _, _ string) (net.Conn, error) {
+			return (&net.Dialer{}).DialContext(ctx, "unix", socket)
+		},
+	}}
+	var resp *http.Response
+	var err error
+	for i := 0; i < 50; i++ {
+		if resp, err = client.Get("http://localhost/healthz"); err == nil {
+			break
+		}
+		time.Sleep(20 * time.Millisecond)
+	}
+	if err != nil {
+		t.Fatalf("request over unix socket failed: %v", err)
+	}
+	defer func() { _ = resp.Body.Close() }()
+	if body, _ := io.ReadAll(resp.Body); string(body) != "OK" {
+		t.Errorf("unexpected body %q", body)
+	}
+
+	info, err := os.Stat(socket)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if info.Mode().Perm() != 0o600 {
+		t.Errorf("socket mode = %o, want %o", info.Mode().Perm(), 0o600)
+	}
+}
+
+func TestParseOwner(t *testing.T) {
+	tests := []struct {
+		value    string
+		uid, gid int
+		wantErr  bool
+	}{
+		{"1000:1000", 1000, 1000, false},
+		{"65532", 65532, -1, false},
+		{"nonroot", 0, 0, true},
+		{"1000:group", 0, 0, true},
+	}
+	for _, tt := range tests {
+		uid, gid, err := parseOwner(tt.value)
+		if (err != nil) != tt.wantErr || uid != tt.uid || gid != tt.gid {
+			t.Errorf("parseOwner(%q) = %d, %d, %v", tt.value, uid, gid, err)
+		}
+	}
+}
+
+func TestProxyBindAddress(t *testing.T) {
+	tests := []struct {
+		bind, want string
+	}{
+		{"", ""},
+		{"0.0.0.0", "0.0.0.0"},
+		{"[::]", "::"},
+		{"[::1]", "::1"},
+		{"::1", "::1"},
+	}
+	for _, tt := range tests {
+		t.Setenv("BW_PROXY_BIND", tt.bind)
+		if got := proxyBindAddress(); got != tt.want {
+			t.Errorf("proxyBindAddress() with BW_PROXY_BIND=%q = %q, want %q", tt.bind, got, tt.want)
+		}
+	}
+}
@@ -0,0 +1,98 @@
+package main
+
+import (
+	"io"
+	"log/slog"
+	"os"
+	"strings"
+)
+
+// logLevel is the minimum level of messages that are logged.
+var logLevel = new(slog.LevelVar)
+
+// logger is the root logger, writing text or JSON lines depending on BW_LOG_FORMAT to
+// stderr and BW_LOG_FILE, with secrets redacted.
+var logger = newLogger(consoleWriter(os.Stderr))
+
+// Loggers of the different components, tagging their messages with the component.
+var (
+	mainLog     = logger.With("component", "main")
+	authLog     = logger.With("component", "auth")
+	serveLog    = logger.With("component", "serve")
+	proxyLog    = logger.With("component", "proxy")
+	syncLog     = logger.With("component", "sync")
+	adminLog    = logger.With("component", "admin")
+	accountsLog = logger.With("component", "accounts")
+	bwsLog      = logger.With("component", "bws")
+	sessionLog  = logger.With("component", "session")
+	tlsLog      = logger.With("component", "tls")
+	auditLog    = logger.With("component", "audit")
+	metricsLog  = logger.With("component", "metrics")
+)
+
+// newLogger creates the root logger from BW_LOG_FORMAT and BW_LOG_LEVEL, also sending
+// messages to the syslog server in BW_LOG_SYSLOG_ADDR if set. Accounts started by
+// BW_ACCOUNTS additionally tag their messages with the account name.
+func newLogger(w io.Writer) *slog.Logger {
+	opts := &slog.HandlerOptions{Level: logLevel}
+	var handler slog.Handler
+	if logFormatJSON() {
+		handler = slog.NewJSONHandler(w, opts)
+	} else {
+		handler = slog.NewTextHandler(w, opts)
+	}
+	l := slog.New(handler)
+	if _, err := logFile(); err != nil {
+		l.Warn("Failed to set up BW_LOG_FILE, logging to the console only", "error", err)
+	}
+	if addr := os.Getenv("BW_LOG_SYSLOG_ADDR"); addr != "" {
+		if syslog, err := newSyslogHandler(addr, opts); err != nil {
+			l.Warn("Failed to connect to syslog server, logging to the console only", "address", addr, "error", err)
+		} else {
+			l = slog.New(slog.NewMultiHandler(handler, syslog))
+		}
+	}
+	if account := os.Getenv("BW_LOG_ACCOUNT"); account != "" {
+		l = l.With("account", account)
+	}
+
+	applyLogLevel(l)
+	if val := os.Getenv("BW_LOG_FORMAT"); val != "" && val != "text" && val != "json" {
+		l.Warn("Invalid format for BW_LOG_FORMAT, using default", "value", val, "default", "text")
+	}
+	return l
+}
+
+// applyLogLevel sets the log level from BW_LOG_LEVEL, if set.
+func applyLogLevel(l *slog.Logger) {
+	if val := os.Getenv("BW_LOG_LEVEL"); val != "" {
+		level, err := parseLogLevel(val)
+		if err != nil {
+			l.Warn("Invalid format for BW_LOG_LEVEL, using default", "value", val, "default", "info")
+		}
+		logLevel.Set(level)
+	}
+}
+
+// logFormatJSON reports whether BW_LOG_FORMAT selects JSON output.
+func logFormatJSON() bool {
+	return os.Getenv("BW_LOG_FORMAT") == "json"
+}
+
+// parseLogLevel parses a level name such as "debug" or "warn", returning the info
+// level along with the error if it is unknown.
+func parseLogLevel(val string) (slog.Level, error) {
+	var level slog.Level
+	if err := level.UnmarshalText([]byte(strings.TrimSpace(val))); err != nil {
+		return slog.LevelInfo, err
+	}
+	return level, nil
+}
+
+// fatal logs an error the wrapper cannot recover from, reports it if error reporting
+// is configured, and exits.
+func fatal(l *slog.Logger, msg string, args ...any) {
+	l.Error(msg, args...)
+	reportError("fatal", formatLogArgs(msg, args...), "")
+	os.Exit(1)
+}
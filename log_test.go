@@ -0,0 +1,88 @@
+package main
+
+import (
+	"bytes"
+	"encoding/json"
+	"log/slog"
+	"net"
+	"regexp"
+	"strings"
+	"testing"
+	"time"
+)
+
+func TestNewLogger(t *testing.T) {
+	defer logLevel.Set(slog.LevelInfo)
+	t.Setenv("BW_LOG_FORMAT", "json")
+	t.Setenv("BW_LOG_LEVEL", "warn")
+	t.Setenv("BW_LOG_ACCOUNT", "work")
+
+	var out bytes.Buffer
+	l := newLogger(&out).With("component", "sync")
+	l.Info("Sync successful")
+	l.Warn("Sync failed", "request_id", "abc")
+
+	var entry map[string]any
+	if err := json.Unmarshal(out.Bytes(), &entry); err != nil {
+		t.Fatalf("expected a single JSON line, got %q: %v", out.String(), err)
+	}
+	for key, want := range map[string]string{
+		"level":      "WARN",
+		"msg":        "Sync failed",
+		"component":  "sync",
+		"account":    "work",
+		"request_id": "abc",
+	} {
+		if entry[key] != want {
+			t.Errorf("%s = %v, want %q", key, entry[key], want)
+		}
+	}
+}
+
+func TestParseLogLevel(t *testing.T) {
+	tests := []struct {
+		val     string
+		want    slog.Level
+		wantErr bool
+	}{
+		{"debug", slog.LevelDebug, false},
+		{"INFO", slog.LevelInfo, false},
+		{"warn", slog.LevelWarn, false},
+		{"error", slog.LevelError, false},
+		{"verbose", slog.LevelInfo, true},
+	}
+	for _, tt := range tests {
+		got, err := parseLogLevel(tt.val)
+		if got != tt.want || (err != nil) != tt.wantErr {
+			t.Errorf("parseLogLevel(%q) = %v, %v, want %v (error: %v)", tt.val, got, err, tt.want, tt.wantErr)
+		}
+	}
+}
+
+func TestSyslog(t *testing.T) {
+	conn, err := net.ListenPacket("udp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer func() { _ = conn.Close() }()
+	t.Setenv("BW_LOG_SYSLOG_ADDR", "udp://"+conn.LocalAddr().String())
+
+	var out bytes.Buffer
+	l := newLogger(&out).With("component", "sync")
+	l.Warn("Sync failed", "error", "exit status 1")
+
+	buf := make([]byte, 1024)
+	_ = conn.SetReadDeadline(time.Now().Add(5 * time.Second))
+	n, _, err := conn.ReadFrom(buf)
+	if err != nil {
+		t.Fatalf("expected a syslog message: %v", err)
+	}
+	msg := string(buf[:n])
+	re := regexp.MustCompile(`^<28>1 \d{4}-\d\d-\d\dT\d\d:\d\d:\d\d\.\d{6}\S+ \S+ bw-cli-docker \d+ - - msg="Sync failed" component=sync error="exit status 1"$`)
+	if !re.MatchString(msg) {
+		t.Errorf("unexpected syslog message %q", msg)
+	}
+	if !strings.Contains(out.String(), `level=WARN msg="Sync failed"`) {
+		t.Errorf("expected the message on the console as well, got %q", out.String())
+	}
+}
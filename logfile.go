@@ -0,0 +1,133 @@
+package main
+
+import (
+	"fmt"
+	"io"
+	"os"
+	"strconv"
+	"sync"
+	"time"
+)
+
+const (
+	defaultLogMaxSizeMB  = 100
+	defaultLogMaxBackups = 5
+)
+
+// rotatingFile is a log file that is rotated once it exceeds maxSize bytes or, if
+// maxAge is set, once it is older than maxAge. Up to maxBackups rotated files are
+// kept as <path>.1 (the most recent) to <path>.<maxBackups>.
+type rotatingFile struct {
+	mu         sync.Mutex
+	path       string
+	maxSize    int64
+	maxAge     time.Duration
+	maxBackups int
+	file       *os.File
+	size       int64
+	opened     time.Time
+}
+
+// openRotatingFile opens or creates the log file at path, appending to it.
+func openRotatingFile(path string, maxSize int64, maxAge time.Duration, maxBackups int) (*rotatingFile, error) {
+	f := &rotatingFile{path: path, maxSize: maxSize, maxAge: maxAge, maxBackups: maxBackups}
+	if err := f.open(); err != nil {
+		return nil, err
+	}
+	return f, nil
+}
+
+func (f *rotatingFile) open() error {
+	file, err := os.OpenFile(f.path, os.O_WRONLY|os.O_APPEND|os.O_CREATE, 0o600)
+	if err != nil {
+		return err
+	}
+	info, err := file.Stat()
+	if err != nil {
+		_ = file.Close()
+		return err
+	}
+	f.file, f.size, f.opened = file, info.Size(), time.Now()
+	return nil
+}
+
+func (f *rotatingFile) Write(p []byte) (int, error) {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	if f.size > 0 && (f.size+int64(len(p)) > f.maxSize || (f.maxAge > 0 && time.Since(f.opened) > f.maxAge)) {
+		if err := f.rotate(); err != nil {
+			return 0, err
+		}
+	}
+	n, err := f.file.Write(p)
+	f.size += int64(n)
+	return n, err
+}
+
+// rotate shifts the existing backups by one, dropping the oldest, and starts a new file.
+func (f *rotatingFile) rotate() error {
+	if err := f.file.Close(); err != nil {
+		return err
+	}
+	_ = os.Remove(fmt.Sprintf("%s.%d", f.path, f.maxBackups))
+	for i := f.maxBackups - 1; i >= 1; i-- {
+		_ = os.Rename(fmt.Sprintf("%s.%d", f.path, i), fmt.Sprintf("%s.%d", f.path, i+1))
+	}
+	if f.maxBackups > 0 {
+		if err := os.Rename(f.path, f.path+".1"); err != nil {
+			return err
+		}
+	} else if err := os.Remove(f.path); err != nil {
+		return err
+	}
+	return f.open()
+}
+
+// logFile returns the file configured by BW_LOG_FILE, which receives a copy of the
+// logs, audit and access log written to the console. It is opened once and shared,
+// and is nil if file logging is disabled.
+var logFile = sync.OnceValues(func() (*rotatingFile, error) {
+	path := os.Getenv("BW_LOG_FILE")
+	if path == "" {
+		return nil, nil
+	}
+
+	maxSize := int64(defaultLogMaxSizeMB)
+	if val := os.Getenv("BW_LOG_MAX_SIZE"); val != "" {
+		n, err := strconv.ParseInt(val, 10, 64)
+		if err != nil || n <= 0 {
+			return nil, fmt.Errorf("invalid BW_LOG_MAX_SIZE '%s', expected a size in megabytes", val)
+		}
+		maxSize = n
+	}
+	var maxAge time.Duration
+	if val := os.Getenv("BW_LOG_MAX_AGE"); val != "" {
+		d, err := time.ParseDuration(val)
+		if err != nil || d < 0 {
+			return nil, fmt.Errorf("invalid BW_LOG_MAX_AGE '%s', expected a duration such as '24h'", val)
+		}
+		maxAge = d
+	}
+	maxBackups := defaultLogMaxBackups
+	if val := os.Getenv("BW_LOG_MAX_BACKUPS"); val != "" {
+		n, err := strconv.Atoi(val)
+		if err != nil || n < 0 {
+			return nil, fmt.Errorf("invalid BW_LOG_MAX_BACKUPS '%s', expected a number", val)
+		}
+		maxBackups = n
+	}
+
+	f, err := openRotatingFile(path, maxSize<<20, maxAge, maxBackups)
+	if err != nil {
+		return nil, fmt.Errorf("failed to open log file '%s': %v", path, err)
+	}
+	return f, nil
+})
+
+// withLogFile returns w, also writing to the BW_LOG_FILE if configured.
+func withLogFile(w io.Writer) io.Writer {
+	if f, err := logFile(); err == nil && f != nil {
+		return io.MultiWriter(w, f)
+	}
+	return w
+}
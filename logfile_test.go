@@ -0,0 +1,53 @@
+package main
+
+import (
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+)
+
+func TestRotatingFile(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "bw.log")
+	f, err := openRotatingFile(path, 10, 0, 2)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	for _, line := range []string{"first\n", "second\n", "third\n", "fourth\n"} {
+		if _, err := f.Write([]byte(line)); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	for name, want := range map[string]string{
+		path:        "fourth\n",
+		path + ".1": "third\n",
+		path + ".2": "second\n",
+	} {
+		if got, _ := os.ReadFile(name); string(got) != want {
+			t.Errorf("%s = %q, want %q", filepath.Base(name), got, want)
+		}
+	}
+	if _, err := os.Stat(path + ".3"); !os.IsNotExist(err) {
+		t.Errorf("expected only 2 backups to be kept, got %v", err)
+	}
+}
+
+func TestRotatingFile_MaxAge(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "bw.log")
+	f, err := openRotatingFile(path, 1<<20, time.Hour, 1)
+	if err != nil {
+		t.Fatal(err)
+	}
+	_, _ = f.Write([]byte("old\n"))
+	f.opened = time.Now().Add(-2 * time.Hour)
+	_, _ = f.Write([]byte("new\n"))
+
+	if got, _ := os.ReadFile(path); string(got) != "new\n" {
+		t.Errorf("current file = %q, want %q", got, "new\n")
+	}
+	if got, _ := os.ReadFile(path + ".1"); string(got) != "old\n" {
+		t.Errorf("rotated file = %q, want %q", got, "old\n")
+	}
+}
@@ -0,0 +1,98 @@
+package main
+
+import (
+	"bytes"
+	"encoding/json"
+	"io"
+	"os"
+	"slices"
+	"strconv"
+	"sync"
+)
+
+// minRedactedLength is the length below which values are not redacted, as replacing
+// them would mangle unrelated output without protecting much.
+const minRedactedLength = 4
+
+// redactedSecrets holds credentials obtained at runtime that are not kept in the
+// environment, e.g. master passwords fetched from an external secret store.
+var (
+	redactedSecretsMu sync.RWMutex
+	redactedSecrets   = map[string]struct{}{}
+)
+
+// registerSecret marks value as a secret to be redacted from all output.
+func registerSecret(value string) {
+	if len(value) < minRedactedLength {
+		return
+	}
+	redactedSecretsMu.Lock()
+	defer redactedSecretsMu.Unlock()
+	redactedSecrets[value] = struct{}{}
+}
+
+// knownSecrets returns the current session token, the credentials in the environment
+// or removed from it by scrubCredentials, and all registered secrets.
+func knownSecrets() []string {
+	secrets := []string{os.Getenv("BW_SESSION")}
+	for _, key := range scrubbedVariables {
+		secrets = append(secrets, os.Getenv(key), lookupScrubbedSecret(key))
+	}
+	redactedSecretsMu.RLock()
+	for secret := range redactedSecrets {
+		secrets = append(secrets, secret)
+	}
+	redactedSecretsMu.RUnlock()
+
+	return slices.DeleteFunc(secrets, func(s string) bool { return len(s) < minRedactedLength })
+}
+
+// scrubSecrets replaces all known secrets in s with [REDACTED], also where they are
+// escaped, as in JSON or quoted log values.
+func scrubSecrets(s string) string {
+	if s == "" {
+		return s
+	}
+	return string(redactSecrets([]byte(s)))
+}
+
+func redactSecrets(p []byte) []byte {
+	for _, secret := range knownSecrets() {
+		for _, form := range secretForms(secret) {
+			p = bytes.ReplaceAll(p, []byte(form), []byte("[REDACTED]"))
+		}
+	}
+	return p
+}
+
+// secretForms returns secret as is and escaped as a JSON string and a Go quoted
+// string, as used by the JSON and text log formats.
+func secretForms(secret string) []string {
+	forms := []string{secret}
+	if b, err := json.Marshal(secret); err == nil {
+		forms = append(forms, string(b[1:len(b)-1]))
+	}
+	quoted := strconv.Quote(secret)
+	forms = append(forms, quoted[1:len(quoted)-1])
+	slices.Sort(forms)
+	return slices.Compact(forms)
+}
+
+// redactingWriter removes known secrets from everything written to the console, be it
+// log messages of the wrapper or output of the CLI.
+type redactingWriter struct {
+	w io.Writer
+}
+
+func (r redactingWriter) Write(p []byte) (int, error) {
+	if _, err := r.w.Write(redactSecrets(p)); err != nil {
+		return 0, err
+	}
+	return len(p), nil
+}
+
+// consoleWriter returns w, which is stdout or stderr, with secrets redacted and a copy
+// written to BW_LOG_FILE if configured.
+func consoleWriter(w io.Writer) io.Writer {
+	return redactingWriter{w: withLogFile(w)}
+}
@@ -0,0 +1,41 @@
+package main
+
+import (
+	"bytes"
+	"strings"
+	"testing"
+)
+
+func TestRedactingWriter(t *testing.T) {
+	t.Setenv("BW_SESSION", "test-session-token")
+	t.Setenv("BW_CLIENTSECRET", `client"secret<x>`)
+	registerSecret("fetched-from-secrets-manager")
+
+	for _, format := range []string{"text", "json"} {
+		t.Run(format, func(t *testing.T) {
+			t.Setenv("BW_LOG_FORMAT", format)
+			var out bytes.Buffer
+			l := newLogger(redactingWriter{w: &out})
+			l.Error("Unlock failed", "output", "Invalid master password fetched-from-secrets-manager, session test-session-token", "secret", `client"secret<x>`)
+
+			for _, secret := range []string{"fetched-from-secrets-manager", "test-session-token", "client", "secret<", `<x`} {
+				if strings.Contains(out.String(), secret) {
+					t.Errorf("output contains %q: %s", secret, out.String())
+				}
+			}
+			if strings.Count(out.String(), "[REDACTED]") != 3 {
+				t.Errorf("expected 3 redactions, got %s", out.String())
+			}
+		})
+	}
+}
+
+func TestRedactingWriter_ShortValues(t *testing.T) {
+	t.Setenv("BW_PASSWORD", "abc")
+
+	var out bytes.Buffer
+	_, _ = redactingWriter{w: &out}.Write([]byte("abc is too short to be redacted"))
+	if out.String() != "abc is too short to be redacted" {
+		t.Errorf("got %q", out.String())
+	}
+}
@@ -1,18 +1,25 @@
 package main
 
 import (
-	"bytes"
+	"context"
 	"encoding/json"
+	"errors"
 	"fmt"
 	"io"
+	"log/slog"
+	"net"
 	"net/http"
 	"net/http/httputil"
 	"net/url"
 	"os"
 	"os/exec"
+	"slices"
 	"strconv"
 	"strings"
+	"sync"
 	"time"
+
+	"github.com/prometheus/client_golang/prometheus/promhttp"
 )
 
 // getEnv retrieves the value of the environment variable named by the key.
@@ -27,168 +34,360 @@ func getEnv(key, fallback string) string {
 	return fallback
 }
 
-var execCommand = exec.Command
+// getSecret resolves a credential from the environment. If KEY_FILE is set, the
+// trimmed contents of that file take precedence over KEY, which allows secrets
+// to be mounted as Docker or Kubernetes secret files instead of plain env vars.
+// Credentials already scrubbed from the environment are served from memory.
+func getSecret(key string) (string, error) {
+	if path := os.Getenv(key + "_FILE"); path != "" {
+		content, err := os.ReadFile(path)
+		if err != nil {
+			return "", fmt.Errorf("failed to read %s_FILE '%s': %v", key, path, err)
+		}
+		value := strings.TrimSpace(string(content))
+		if slices.Contains(scrubbedVariables, key) {
+			registerSecret(value)
+		}
+		return value, nil
+	}
+	if value := os.Getenv(key); value != "" {
+		return value, nil
+	}
+	return lookupScrubbedSecret(key), nil
+}
+
+// withEnv appends the given KEY=VALUE pairs to the environment of cmd,
+// starting from the current process environment if none was set explicitly.
+func withEnv(cmd *exec.Cmd, env ...string) *exec.Cmd {
+	if cmd.Env == nil {
+		cmd.Env = os.Environ()
+	}
+	cmd.Env = append(cmd.Env, env...)
+	return cmd
+}
+
+var execCommand = exec.CommandContext
 
 const (
 	defaultBwServeWaitRetries  = 30
-	defaultBwServeWaitInterval = 1 * time.Second
+	maxBwServeWaitRetries      = 1000
+	defaultBwServeWaitInterval = 250 * time.Millisecond
+	minBwServeWaitInterval     = 10 * time.Millisecond
+	maxBwServeWaitInterval     = 5 * time.Second
+	defaultBwServeWaitTimeout  = 1 * time.Minute
+	minBwServeWaitTimeout      = 1 * time.Second
+	maxBwServeWaitTimeout      = 1 * time.Hour
+	defaultCLITimeout          = 2 * time.Minute
 )
 
-func main() {
-	// 1. Login, Unlock, and get Session Token
-	sessionToken, err := loginAndGetSession()
+// cliContext bounds a CLI command by BW_CLI_TIMEOUT, so that a command hanging, e.g.
+// on an unreachable server, is killed instead of blocking its caller forever. A
+// timeout of 0 disables the limit. It first waits for a slot of cliSlots, which is
+// not counted towards the timeout and is released by cancel, so cancel must be
+// called before the next command is run.
+func cliContext(parent context.Context) (context.Context, context.CancelFunc, error) {
+	release, err := cliSlots.acquire(parent)
 	if err != nil {
-		fmt.Fprintf(os.Stderr, "FATAL: Bitwarden login failed: %v\n", err)
-		os.Exit(1)
+		return nil, nil, err
 	}
+	timeout := defaultCLITimeout
+	if val := os.Getenv("BW_CLI_TIMEOUT"); val != "" {
+		if d, err := time.ParseDuration(val); err == nil && d >= 0 {
+			timeout = d
+		} else {
+			mainLog.Warn("Invalid format for BW_CLI_TIMEOUT, using default", "value", val, "default", timeout, "error", err)
+		}
+	}
+	var ctx context.Context
+	var cancel context.CancelFunc
+	if timeout == 0 {
+		ctx, cancel = context.WithCancel(parent)
+	} else {
+		ctx, cancel = context.WithTimeout(parent, timeout)
+	}
+	return ctx, sync.OnceFunc(func() {
+		cancel()
+		release()
+	}), nil
+}
 
-	// Set the session token as an environment variable for all child processes
-	if err := os.Setenv("BW_SESSION", sessionToken); err != nil {
-		fmt.Fprintf(os.Stderr, "FATAL: Failed to set BW_SESSION environment variable: %v\n", err)
-		os.Exit(1)
+func main() {
+	slog.SetDefault(logger)
+	if err := loadConfigFile(); err != nil {
+		fatal(mainLog, "Failed to load the configuration", "error", err)
 	}
+	applyLogLevel(mainLog)
+	watchReloadSignal()
+	startReaper()
+	if err := setupTracing(); err != nil {
+		mainLog.Warn("Failed to set up tracing, spans will not be exported", "error", err)
+	}
+	cliSlots.configure()
+	onReload(cliSlots.configure)
 
-	// 2. Start the actual 'bw serve' process in the background
-	bwServePort := getEnv("BW_SERVE_PORT", "8088")
-	go startBwServe(bwServePort, sessionToken)
+	// Multiple accounts are each handled by a child instance of this wrapper
+	if accounts := os.Getenv("BW_ACCOUNTS"); accounts != "" {
+		runAccounts(accounts)
+		return
+	}
 
-	// Wait for the API to be unlocked before routing traffic
-	if err := waitForBwServe(bwServePort); err != nil {
-		fmt.Fprintf(os.Stderr, "FATAL: Bitwarden serve API failed to initialize: %v\n", err)
-		os.Exit(1)
+	// Machine secrets are served from Bitwarden Secrets Manager instead of a user vault
+	switch backend := getEnv("BW_BACKEND", "bw"); backend {
+	case "bw":
+	case "bws":
+		runSecretsManager()
+		return
+	default:
+		fatal(mainLog, "Unknown BW_BACKEND, expected 'bw' or 'bws'", "backend", backend)
 	}
 
-	fmt.Println("Bitwarden serve API is ready and unlocked. Authentication successful.")
+	detectCLIVersion("bw")
+
+	ctx, stop := shutdownSignals()
+	defer stop()
 
-	// 3. Start the proxy server on the main port
+	// Listen right away, answering with 503 until the vault is ready rather than
+	// refusing the connections of dependent containers starting alongside
 	bwProxyPort := getEnv("BW_PROXY_PORT", "8087")
-	go startProxyServer(bwProxyPort, bwServePort)
+	bwServePort := getEnv("BW_SERVE_PORT", "8088")
+	sessionGate.configure()
+	onReload(sessionGate.configure)
+	watchOperatorSignals(func(sig os.Signal) { handleOperatorSignal(bwServePort, sig) })
+	supervise("proxy server", func() error { return startProxyServer(bwProxyPort, bwServePort) })
+
+	// 1. and 2. Log in, unlock and start 'bw serve'. Startup is abandoned if the proxy
+	// fails or a termination signal is received in the meantime.
+	var requireUnlock bool
+	started := make(chan struct{})
+	supervise("startup", func() (err error) {
+		if requireUnlock, err = startVault(bwServePort); err == nil {
+			syncOnStart(ctx)
+			close(started)
+		}
+		return err
+	})
+	select {
+	case <-started:
+	case <-ctx.Done():
+		shutdown(stopBwServe, shutdownTracing)
+		return
+	case err := <-taskFailures:
+		exitAfterFailure(err, stopBwServe, wipeDataDir, shutdownTracing)
+	}
+
+	restoreCacheFile()
+	prefetchItems(bwServePort)
+	setStartupStage(stageReady)
+
+	// 3. Start the metrics and debug servers
+	if port := os.Getenv("BW_METRICS_PORT"); port != "" {
+		supervise("metrics server", func() error { return startMetricsServer(port) })
+	}
+	if port := os.Getenv("BW_DEBUG_PORT"); port != "" {
+		supervise("debug server", func() error { return startDebugServer(port) })
+	}
 
 	// 4. Start the periodic sync
-	if getEnv("BW_DISABLE_SYNC", "false") != "true" {
-		bwProxyHost := getEnv("BW_PROXY_HOST", "localhost")
-		go startPeriodicSync(bwProxyHost, bwProxyPort)
+	if syncEnabled() {
+		go startPeriodicSync(ctx)
+		if notificationsEnabled() {
+			go watchNotifications(ctx)
+		}
 	} else {
-		fmt.Println("Automatic sync is disabled.")
+		syncLog.Info("Automatic sync is disabled")
 	}
 
-	// Keep the main goroutine alive
-	select {}
-}
-
-// loginAndGetSession handles the full Bitwarden authentication and returns the session token.
-func loginAndGetSession() (string, error) {
-	fmt.Println("Executing Bitwarden login...")
-	host := os.Getenv("BW_HOST")
-	clientID := os.Getenv("BW_CLIENTID")
-	clientSecret := os.Getenv("BW_CLIENTSECRET")
-	password := os.Getenv("BW_PASSWORD")
+	// 5. Watch for the vault getting locked and unlock it again
+	if requireUnlock && getEnv("BW_DISABLE_AUTO_UNLOCK", "false") != "true" {
+		go watchVaultLock(bwServePort)
+	}
 
-	if clientID == "" || clientSecret == "" || password == "" {
-		return "", fmt.Errorf("missing one or more required environment variables (BW_CLIENTID, BW_CLIENTSECRET, BW_PASSWORD)")
+	// Renew the session before it goes stale, if configured
+	if requireUnlock {
+		go startSessionRefresh(ctx, bwServePort)
 	}
 
-	// if custom host is specified, configure bw-cli to use it
-	if host != "" {
-		fmt.Println("Configuring bw-cli to use the supplied host", host)
-		cmdConfig := execCommand("bw", "config", "server", host)
-		configResult, err := cmdConfig.CombinedOutput()
-		if err != nil {
-			return "", fmt.Errorf("bw config server failed: %s - %v", string(configResult), err)
+	// Replace 'bw serve' with a fresh process periodically, if configured
+	go startRecycling(ctx)
+
+	// 6. Unlock again with the new password when a mounted password file is rotated
+	if path := os.Getenv("BW_PASSWORD_FILE"); requireUnlock && path != "" {
+		if err := watchFile(path, func() { rotatePassword(bwServePort) }); err != nil {
+			authLog.Warn("Password rotation will not be detected", "error", err)
 		}
 	}
 
-	// Login using API Key
-	cmdLogin := execCommand("bw", "login", "--apikey")
-	loginOutput, err := cmdLogin.CombinedOutput()
+	// Tell systemd the service is up, if running under it
+	sdNotify("READY=1\nSTATUS=Vault unlocked, serving on port " + bwProxyPort)
+	go startWatchdog(bwServePort)
+
+	// Run until terminated or a server fails, then drain the proxy and stop 'bw serve'
+	awaitShutdown(ctx, saveCacheFile, stopBwServe, wipeDataDir, shutdownTracing)
+}
+
+// startVault logs in, unlocks the vault and starts 'bw serve' on port, returning once
+// its API is ready. It reports whether the vault has to be unlocked, which is not the
+// case for organization API keys.
+func startVault(port string) (bool, error) {
+	// 1. Login, Unlock, and get Session Token
+	setStartupStage(stageLogin)
+	sessionToken, err := loginAndGetSession()
 	if err != nil {
-		return "", fmt.Errorf("bw login failed: %s - %v", string(loginOutput), err)
-	} else {
-		fmt.Println("Logged in successfully")
+		return false, fmt.Errorf("bitwarden login failed: %w", err)
 	}
+	recordEvent(eventLogin, "Logged in", nil)
 
-	fmt.Println("Unlocking vault...")
-	// Unlock the vault and get the session key
-	cmdUnlock := execCommand("bw", "unlock", "--passwordenv", "BW_PASSWORD", "--raw")
-	unlockOutput, err := cmdUnlock.CombinedOutput()
-	if err != nil {
-		return "", fmt.Errorf("bw unlock failed: %s - %v", string(unlockOutput), err)
+	// Remove credentials from the environment before starting long-lived children
+	scrubCredentials()
+
+	// Organization API keys cannot unlock a vault, so there is no session token
+	requireUnlock := sessionToken != ""
+
+	// Set the session token as an environment variable for all child processes
+	if requireUnlock {
+		if err := os.Setenv("BW_SESSION", sessionToken); err != nil {
+			return false, fmt.Errorf("failed to set BW_SESSION environment variable: %w", err)
+		}
+		recordSessionStart()
 	}
 
-	return strings.TrimSpace(string(unlockOutput)), nil
-}
+	// 2. Start the actual 'bw serve' process in the background
+	setStartupStage(stageServe)
+	if err := bwServe.start(port, sessionToken); err != nil {
+		return false, fmt.Errorf("failed to start 'bw serve': %w", err)
+	}
 
-// startBwServe starts the 'bw serve' process.
-func startBwServe(port, sessionToken string) {
-	fmt.Printf("Starting 'bw serve' on internal port %s\n", port)
-	cmd := execCommand("bw", "serve", "--hostname", "0.0.0.0", "--port", port, "--session", sessionToken)
-	cmd.Stdout = os.Stdout
-	cmd.Stderr = os.Stderr
-	if err := cmd.Run(); err != nil {
-		fmt.Fprintf(os.Stderr, "FATAL: 'bw serve' process failed: %v\n", err)
-		os.Exit(1)
+	// Wait for the API to be unlocked before routing traffic
+	if err := waitForBwServe(port, requireUnlock); err != nil {
+		return false, fmt.Errorf("bitwarden serve API failed to initialize: %w", err)
 	}
+
+	if requireUnlock {
+		mainLog.Info("Bitwarden serve API is ready and unlocked, authentication successful")
+		recordVaultLockState(true)
+	} else {
+		mainLog.Info("Bitwarden serve API is ready, authenticated with an organization API key, vault endpoints are unavailable")
+	}
+	return requireUnlock, nil
 }
 
-// waitForBwServe blocks until 'bw serve' returns an unlocked status, or errors out.
-func waitForBwServe(port string) error {
-	statusURL := fmt.Sprintf("http://127.0.0.1:%s/status", port)
-	client := &http.Client{Timeout: 2 * time.Second}
+// bwServeWaitConfig controls how long waitForBwServe waits for 'bw serve'.
+type bwServeWaitConfig struct {
+	retries  int
+	interval time.Duration
+	timeout  time.Duration
+}
 
-	retries := defaultBwServeWaitRetries
+// bwServeWaitConfigFromEnv reads BW_SERVE_WAIT_RETRIES, BW_SERVE_WAIT_INTERVAL and
+// BW_SERVE_WAIT_TIMEOUT. Invalid values fall back to the defaults, and values out of
+// bounds are clamped, so that a typo neither fails startup instantly nor hangs it.
+func bwServeWaitConfigFromEnv() bwServeWaitConfig {
+	config := bwServeWaitConfig{
+		retries:  defaultBwServeWaitRetries,
+		interval: defaultBwServeWaitInterval,
+		timeout:  defaultBwServeWaitTimeout,
+	}
 	if val := os.Getenv("BW_SERVE_WAIT_RETRIES"); val != "" {
-		if r, err := strconv.Atoi(val); err == nil {
-			retries = r
+		if r, err := strconv.Atoi(val); err != nil {
+			serveLog.Warn("Invalid format for BW_SERVE_WAIT_RETRIES, using default", "value", val, "default", config.retries, "error", err)
 		} else {
-			fmt.Fprintf(os.Stderr, "WARN: Invalid format for BW_SERVE_WAIT_RETRIES '%s', using default of %d: %v\n", val, retries, err)
+			config.retries = clampSetting("BW_SERVE_WAIT_RETRIES", r, 1, maxBwServeWaitRetries)
 		}
 	}
-	interval := defaultBwServeWaitInterval
-	if val := os.Getenv("BW_SERVE_WAIT_INTERVAL"); val != "" {
-		if d, err := time.ParseDuration(val); err == nil {
-			interval = d
+	for _, setting := range []struct {
+		key      string
+		value    *time.Duration
+		min, max time.Duration
+	}{
+		{"BW_SERVE_WAIT_INTERVAL", &config.interval, minBwServeWaitInterval, maxBwServeWaitInterval},
+		{"BW_SERVE_WAIT_TIMEOUT", &config.timeout, minBwServeWaitTimeout, maxBwServeWaitTimeout},
+	} {
+		val := os.Getenv(setting.key)
+		if val == "" {
+			continue
+		}
+		if d, err := time.ParseDuration(val); err != nil {
+			serveLog.Warn("Invalid format for "+setting.key+", using default", "value", val, "default", *setting.value, "error", err)
 		} else {
-			fmt.Fprintf(os.Stderr, "WARN: Invalid format for BW_SERVE_WAIT_INTERVAL '%s', using default of %s: %v\n", val, interval, err)
+			*setting.value = clampSetting(setting.key, d, setting.min, setting.max)
 		}
 	}
+	return config
+}
+
+// clampSetting limits the value of a setting to [lo, hi], warning if it is out of bounds.
+func clampSetting[T int | time.Duration](key string, value, lo, hi T) T {
+	if value < lo || value > hi {
+		clamped := min(max(value, lo), hi)
+		serveLog.Warn(key+" is out of bounds, using the nearest bound", "value", value, "min", lo, "max", hi, "using", clamped)
+		return clamped
+	}
+	return value
+}
 
-	fmt.Println("Waiting for 'bw serve' to become ready and unlocked...")
+// waitForBwServe blocks until 'bw serve' returns an unlocked status, or errors out.
+// If requireUnlock is false, any successful status response is sufficient. The status
+// is polled with exponential backoff, starting at BW_SERVE_WAIT_INTERVAL, for at most
+// BW_SERVE_WAIT_RETRIES attempts and BW_SERVE_WAIT_TIMEOUT in total.
+func waitForBwServe(port string, requireUnlock bool) error {
+	statusURL := fmt.Sprintf("http://127.0.0.1:%s/status", port)
+	client := &http.Client{Timeout: 2 * time.Second}
+	config := bwServeWaitConfigFromEnv()
+	interval := config.interval
+
+	serveLog.Info("Waiting for 'bw serve' to become ready and unlocked", "timeout", config.timeout)
 
-	for i := 0; i < retries; i++ {
-		if checkBwServeStatus(client, statusURL) {
+	deadline := time.Now().Add(config.timeout)
+	var err error
+	for attempt := 1; ; attempt++ {
+		if err = checkBwServeStatus(client, statusURL, requireUnlock); err == nil {
 			return nil
 		}
+		if attempt >= config.retries || time.Now().Add(interval).After(deadline) {
+			break
+		}
 		time.Sleep(interval)
+		interval = min(interval*2, maxBwServeWaitInterval)
+	}
+	return fmt.Errorf("timeout waiting for bw serve to become unlocked: %v", err)
+}
+
+// checkBwServeStatus returns nil if 'bw serve' is reachable and, if requireUnlock is
+// set, unlocked, and otherwise why it is not.
+func checkBwServeStatus(client *http.Client, statusURL string, requireUnlock bool) error {
+	status, err := fetchBwServeStatus(client, statusURL)
+	if err != nil {
+		serveLog.Debug("Checking the 'bw serve' status failed", "error", err)
+		return err
 	}
-	return fmt.Errorf("timeout waiting for bw serve to become unlocked")
+	if requireUnlock && !status.isUnlocked() {
+		return errors.New("vault is locked")
+	}
+	return nil
 }
 
-func checkBwServeStatus(client *http.Client, statusURL string) bool {
+// fetchBwServeStatus queries the /status endpoint of 'bw serve'.
+func fetchBwServeStatus(client *http.Client, statusURL string) (*BwStatusResponse, error) {
 	resp, err := client.Get(statusURL)
 	if err != nil {
-		fmt.Fprintf(os.Stderr, "DEBUG: checkBwServeStatus client.Get failed: %v\n", err)
-		return false
+		return nil, fmt.Errorf("client.Get failed: %v", err)
 	}
 	defer func() { _ = resp.Body.Close() }()
 
 	if resp.StatusCode != http.StatusOK {
-		fmt.Fprintf(os.Stderr, "DEBUG: checkBwServeStatus non-OK status code received: %d\n", resp.StatusCode)
-		return false
+		return nil, fmt.Errorf("non-OK status code received: %d", resp.StatusCode)
 	}
 
 	body, ioErr := io.ReadAll(resp.Body)
 	if ioErr != nil {
-		fmt.Fprintf(os.Stderr, "DEBUG: checkBwServeStatus failed to read response body: %v\n", ioErr)
-		return false
+		return nil, fmt.Errorf("failed to read response body: %v", ioErr)
 	}
 
 	var v BwStatusResponse
 	if err := json.Unmarshal(body, &v); err != nil {
-		fmt.Fprintf(os.Stderr, "DEBUG: checkBwServeStatus failed to unmarshal JSON: %v, body: %s\n", err, string(body))
-		return false
+		return nil, fmt.Errorf("failed to unmarshal JSON: %v, body: %s", err, string(body))
 	}
-
-	return v.isUnlocked()
+	return &v, nil
 }
 
 // BwStatusResponse defines the structure for the /status endpoint response.
@@ -218,95 +417,118 @@ func (s *BwStatusResponse) isUnlocked() bool {
 	return false
 }
 
-// startProxyServer starts the proxy and health check server.
-func startProxyServer(proxyPort, targetPort string) {
-	targetURL, err := url.Parse(fmt.Sprintf("http://localhost:%s", targetPort))
-	if err != nil {
-		fmt.Fprintf(os.Stderr, "FATAL: Invalid target URL: %v\n", err)
-		os.Exit(1)
-	}
-
+// startProxyServer runs the proxy and health check server until it is shut down.
+func startProxyServer(proxyPort, targetPort string) error {
 	proxy := &httputil.ReverseProxy{
 		Rewrite: func(pr *httputil.ProxyRequest) {
-			pr.SetURL(targetURL)
+			// Resolved per request, as 'bw serve' moves to another port when recycled.
+			pr.SetURL(&url.URL{Scheme: "http", Host: net.JoinHostPort("127.0.0.1", activeServePort(targetPort))})
 		},
+		Transport:      tracingTransport(proxyTransportFromEnv()),
+		ModifyResponse: detectLockedVault,
+		ErrorHandler:   proxyErrorHandler,
 	}
 	mux := setupRouter(proxy)
 
-	fmt.Printf("Starting proxy server on port %s\n", proxyPort)
-	if err := http.ListenAndServe(":"+proxyPort, mux); err != nil {
-		fmt.Fprintf(os.Stderr, "FATAL: Proxy server failed: %v\n", err)
-		os.Exit(1)
-	}
+	proxyLog.Info("Starting proxy server", "port", proxyPort)
+	return listenAndServe(proxyPort, mux)
 }
 
 // setupRouter configures the proxy and handlers
-func setupRouter(proxy *httputil.ReverseProxy) *http.ServeMux {
+func setupRouter(proxy *httputil.ReverseProxy) http.Handler {
 	mux := http.NewServeMux()
 
 	// Health check endpoint
-	mux.HandleFunc("/healthz", func(w http.ResponseWriter, r *http.Request) {
-		w.WriteHeader(http.StatusOK)
-		_, _ = fmt.Fprint(w, "OK")
-	})
+	mux.HandleFunc("/healthz", handleHealthz)
+	mux.HandleFunc("/livez", handleLivez)
+	mux.HandleFunc("/readyz", handleReadyz)
+	mux.HandleFunc("/startup", handleStartup)
+	mux.HandleFunc("/healthz/details", handleHealthDetails)
+	mux.HandleFunc("/events/stream", handleEventStream)
+
+	// Version of the wrapper and the CLI
+	mux.HandleFunc("/version", handleVersion)
 
 	// Sync endpoint
-	mux.HandleFunc("/sync", func(w http.ResponseWriter, r *http.Request) {
-		if r.Method != http.MethodPost {
-			http.Error(w, "Method not allowed", http.StatusMethodNotAllowed)
-			return
-		}
-		fmt.Println("Executing 'bw sync'...")
-		cmd := execCommand("bw", "sync")
-		var out bytes.Buffer
-		cmd.Stdout = &out
-		cmd.Stderr = &out
-		if err := cmd.Run(); err != nil {
-			fmt.Fprintf(os.Stderr, "Sync failed: %s\n", out.String())
-			http.Error(w, fmt.Sprintf("Sync failed: %s", out.String()), http.StatusInternalServerError)
-			return
-		}
-		fmt.Println("Sync successful.")
-		w.WriteHeader(http.StatusOK)
-		_, _ = fmt.Fprint(w, "Sync successful")
-	})
+	mux.HandleFunc("/sync", handleSync)
+	mux.HandleFunc("/sync/status", handleSyncStatus)
+	mux.HandleFunc("/sync/jobs/{id}", handleSyncJob)
 
-	// Proxy all other requests to the 'bw serve' process
-	mux.HandleFunc("/", proxy.ServeHTTP)
+	// Organization management endpoints
+	registerOrgRoutes(mux)
 
-	return mux
-}
+	// Administrative endpoints
+	registerAdminRoutes(mux)
 
-func startPeriodicSync(host, port string) {
-	syncIntervalStr := getEnv("BW_SYNC_INTERVAL", "2m")
+	// Prometheus metrics, unless they are served on a dedicated port
+	if metricsOnProxyPort() {
+		mux.Handle("/metrics", promhttp.Handler())
+	}
 
-	syncInterval, err := time.ParseDuration(syncIntervalStr)
+	// Proxy all other requests to the 'bw serve' process
+	mux.Handle("/", vaultProxyHandler(proxy))
+
+	policies, err := loadTokenPolicies()
 	if err != nil {
-		fmt.Fprintf(os.Stderr, "WARN: Invalid format for BW_SYNC_INTERVAL '%s', using default of 2 minutes: %v", syncIntervalStr, err)
-		syncInterval = 2 * time.Minute
+		return rejectAll("Invalid token policies", err)
+	}
+	var handler http.Handler = mux
+	if len(policies) > 0 {
+		handler = tokenPolicyMiddleware(mux, policies)
 	}
+	return instrumentRoutes(mux, startupGate(handler))
+}
 
-	syncURL := fmt.Sprintf("http://%s:%s/sync", host, port)
-	fmt.Printf("Starting periodic sync every %s targeting %s\n", syncInterval, syncURL)
-	ticker := time.NewTicker(syncInterval)
-	defer ticker.Stop()
+// startPeriodicSync runs a sync every BW_SYNC_INTERVAL, or at the times of
+// BW_SYNC_CRON, until ctx is done.
+func startPeriodicSync(ctx context.Context) {
+	schedule, err := syncScheduleFromEnv()
+	if err != nil {
+		syncLog.Warn("Invalid sync schedule, using default", "default", schedule, "error", err)
+	}
+	syncLog.Info("Starting periodic sync", "schedule", schedule)
+	timer := time.NewTimer(time.Hour)
+	defer timer.Stop()
 
-	for range ticker.C {
-		fmt.Println("Periodic sync triggered...")
-		resp, err := http.Post(syncURL, "application/json", nil)
+	schedules := make(chan syncSchedule, 1)
+	onReload(func() {
+		schedule, err := syncScheduleFromEnv()
 		if err != nil {
-			fmt.Fprintf(os.Stderr, "Periodic sync failed: %v", err)
-			continue
+			syncLog.Warn("Invalid sync schedule, keeping the current one", "error", err)
+			return
+		}
+		select {
+		case schedules <- schedule:
+		default:
 		}
+	})
 
-		if resp.StatusCode != http.StatusOK {
-			body, err := io.ReadAll(resp.Body)
-			if err != nil {
-				fmt.Fprintf(os.Stderr, "Periodic sync failed with status code: %d and could not read body: %v\n", resp.StatusCode, err)
-			} else {
-				fmt.Fprintf(os.Stderr, "Periodic sync failed with status code: %d, body: %s\n", resp.StatusCode, string(body))
-			}
+	for {
+		failures := syncs.consecutiveFailures()
+		next := nextSyncTime(schedule, time.Now(), failures, syncMaxBackoff())
+		if failures > 0 {
+			syncLog.Info("Backing off after failed syncs", "failures", failures, "next", next)
+		}
+		syncs.setNextSync(next)
+		timer.Reset(time.Until(next))
+		select {
+		case <-ctx.Done():
+			return
+		case schedule = <-schedules:
+			syncLog.Info("Sync schedule changed", "schedule", schedule)
+			continue
+		case <-syncRequests:
+		case <-timer.C:
+		}
+		if syncs.paused() {
+			syncLog.Info("Periodic sync is paused, skipping it")
+			continue
+		}
+		syncLog.Info("Periodic sync triggered")
+		if err := runSync(ctx); err != nil {
+			syncLog.Error("Periodic sync failed", "error", err)
+			continue
 		}
-		_ = resp.Body.Close()
+		syncLog.Info("Periodic sync successful")
 	}
 }
@@ -0,0 +1,185 @@
+package main
+
+import (
+	"errors"
+	"net"
+	"net/http"
+	"os"
+	"os/exec"
+	"strconv"
+	"time"
+
+	"github.com/prometheus/client_golang/prometheus"
+	"github.com/prometheus/client_golang/prometheus/promauto"
+	"github.com/prometheus/client_golang/prometheus/promhttp"
+)
+
+var (
+	requestsTotal = promauto.NewCounterVec(prometheus.CounterOpts{
+		Name: "bw_proxy_requests_total",
+		Help: "Requests handled by the proxy, by route, method and status code.",
+	}, []string{"route", "method", "code"})
+	requestDuration = promauto.NewHistogramVec(prometheus.HistogramOpts{
+		Name:    "bw_proxy_request_duration_seconds",
+		Help:    "Latency of requests handled by the proxy, by route and method.",
+		Buckets: prometheus.DefBuckets,
+	}, []string{"route", "method"})
+	proxyErrorsTotal = promauto.NewCounter(prometheus.CounterOpts{
+		Name: "bw_proxy_upstream_errors_total",
+		Help: "Requests that could not be proxied to 'bw serve'.",
+	})
+	syncsTotal = promauto.NewCounterVec(prometheus.CounterOpts{
+		Name: "bw_sync_total",
+		Help: "Vault syncs, by result.",
+	}, []string{"result"})
+	syncDuration = promauto.NewHistogramVec(prometheus.HistogramOpts{
+		Name:    "bw_sync_duration_seconds",
+		Help:    "Duration of vault syncs, by result.",
+		Buckets: prometheus.ExponentialBuckets(0.1, 2, 10),
+	}, []string{"result"})
+	lastSyncTimestamp = promauto.NewGauge(prometheus.GaugeOpts{
+		Name: "bw_sync_last_success_timestamp_seconds",
+		Help: "Unix time of the last successful vault sync.",
+	})
+	_ = promauto.NewGaugeFunc(prometheus.GaugeOpts{
+		Name: "bw_sync_last_success_age_seconds",
+		Help: "Seconds since the last successful vault sync, or since startup if none succeeded yet.",
+	}, func() float64 { return sinceLastSync().Seconds() })
+	vaultItems = promauto.NewGauge(prometheus.GaugeOpts{
+		Name: "bw_vault_items",
+		Help: "Items in the vault after the last successful sync.",
+	})
+	bwServeRestartsTotal = promauto.NewCounter(prometheus.CounterOpts{
+		Name: "bw_serve_restarts_total",
+		Help: "Restarts of the 'bw serve' process, e.g. after the vault was unlocked again.",
+	})
+	cliCommandDuration = promauto.NewHistogramVec(prometheus.HistogramOpts{
+		Name:    "bw_cli_command_duration_seconds",
+		Help:    "Duration of bw and bws CLI commands, by command and exit code.",
+		Buckets: prometheus.ExponentialBuckets(0.1, 2, 10),
+	}, []string{"command", "exit_code"})
+	vaultUnlocked = promauto.NewGauge(prometheus.GaugeOpts{
+		Name: "bw_vault_unlocked",
+		Help: "Whether 'bw serve' was unlocked when last checked (1) or locked (0).",
+	})
+	queuedRequests = promauto.NewGauge(prometheus.GaugeOpts{
+		Name: "bw_proxy_queued_requests",
+		Help: "Requests held back while 'bw serve' is unlocked again or restarted.",
+	})
+	queuedCLICommands = promauto.NewGauge(prometheus.GaugeOpts{
+		Name: "bw_cli_queued_commands",
+		Help: "CLI commands waiting for others to finish, see BW_CLI_MAX_CONCURRENT.",
+	})
+)
+
+// recordSync updates the sync metrics with the result of a sync.
+func recordSync(duration time.Duration, err error) {
+	if err != nil {
+		syncsTotal.WithLabelValues("failure").Inc()
+		syncDuration.WithLabelValues("failure").Observe(duration.Seconds())
+		return
+	}
+	syncsTotal.WithLabelValues("success").Inc()
+	syncDuration.WithLabelValues("success").Observe(duration.Seconds())
+	lastSyncTimestamp.SetToCurrentTime()
+}
+
+// observeCLI runs a CLI command through run, e.g. cmd.Run, and records its duration
+// and exit code.
+func observeCLI(command string, run func() error) error {
+	_, err := observeCLIOutput(command, func() ([]byte, error) { return nil, run() })
+	return err
+}
+
+// observeCLIOutput is observeCLI for commands returning their output, e.g. cmd.Output.
+func observeCLIOutput(command string, run func() ([]byte, error)) ([]byte, error) {
+	start := time.Now()
+	output, err := run()
+	cliCommandDuration.WithLabelValues(command, exitCode(err)).Observe(time.Since(start).Seconds())
+	return output, err
+}
+
+// exitCode returns the exit code of a finished command as a label value, or "error"
+// if it could not be run at all.
+func exitCode(err error) string {
+	var exitErr *exec.ExitError
+	switch {
+	case err == nil:
+		return "0"
+	case errors.As(err, &exitErr):
+		return strconv.Itoa(exitErr.ExitCode())
+	default:
+		return "error"
+	}
+}
+
+// recordVaultLockState updates the lock state gauge.
+func recordVaultLockState(unlocked bool) {
+	if unlocked {
+		vaultUnlocked.Set(1)
+	} else {
+		vaultUnlocked.Set(0)
+	}
+}
+
+// vaultRouteMux matches requests passed through to 'bw serve' against the routes of
+// its API, so they are labelled by the endpoint rather than lumped together under the
+// catch-all route of the proxy.
+var vaultRouteMux = func() *http.ServeMux {
+	mux := http.NewServeMux()
+	routes := []string{
+		"/status", "/sync", "/lock", "/unlock", "/generate",
+		"/list/object/{type}",
+		"/object/item", "/object/attachment", "/object/folder", "/object/org-collection", "/object/send",
+		"/object/attachment/{id}", "/object/folder/{id}", "/object/org-collection/{id}", "/object/send/{id}",
+		"/object/template/{type}", "/object/fingerprint/me",
+		"/restore/item/{id}", "/move/{id}/{organizationId}", "/confirm/org-member/{id}",
+		"/send/list", "/send/{id}/remove-password",
+	}
+	for _, kind := range itemObjectKinds {
+		routes = append(routes, "/object/"+kind+"/{id}")
+	}
+	for _, route := range routes {
+		mux.Handle(route, http.NotFoundHandler())
+	}
+	return mux
+}()
+
+// instrumentRoutes records the request metrics, labelled with the pattern of the
+// mux route a request matches rather than its path, which would contain item IDs.
+// Requests to 'bw serve' are labelled with its API route, or "other" if unknown.
+func instrumentRoutes(mux *http.ServeMux, next http.Handler) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		_, route := mux.Handler(r)
+		if route == "/" {
+			if _, route = vaultRouteMux.Handler(r); route == "" {
+				route = "other"
+			}
+		}
+		if route == "" {
+			route = "unmatched"
+		}
+		nameRequestSpan(r, route)
+		start := time.Now()
+		rec := &statusRecorder{ResponseWriter: w, status: http.StatusOK}
+		next.ServeHTTP(rec, r)
+		requestsTotal.WithLabelValues(route, r.Method, strconv.Itoa(rec.status)).Inc()
+		requestDuration.WithLabelValues(route, r.Method).Observe(time.Since(start).Seconds())
+	})
+}
+
+// metricsOnProxyPort reports whether /metrics is served by the proxy, which is the
+// case unless BW_METRICS_PORT moves it to a dedicated port.
+func metricsOnProxyPort() bool {
+	return os.Getenv("BW_METRICS_PORT") == ""
+}
+
+// startMetricsServer serves /metrics without authentication on BW_METRICS_PORT, so
+// it can be scraped without a proxy token and kept off the proxy's network path.
+func startMetricsServer(port string) error {
+	mux := http.NewServeMux()
+	mux.Handle("/metrics", promhttp.Handler())
+
+	metricsLog.Info("Starting metrics server", "port", port)
+	return http.ListenAndServe(net.JoinHostPort(proxyBindAddress(), port), recoverPanics(mux))
+}
@@ -0,0 +1,108 @@
+package main
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"net/http/httputil"
+	"net/url"
+	"os/exec"
+	"strings"
+	"testing"
+
+	"github.com/prometheus/client_golang/prometheus"
+	"github.com/prometheus/client_golang/prometheus/testutil"
+	dto "github.com/prometheus/client_model/go"
+)
+
+func TestMetrics(t *testing.T) {
+	execCommand = mockExecCommand
+	defer func() { execCommand = exec.CommandContext }()
+
+	target, _ := url.Parse("http://localhost:8080")
+	router := setupRouter(httputil.NewSingleHostReverseProxy(target))
+
+	healthz := testutil.ToFloat64(requestsTotal.WithLabelValues("/healthz", "GET", "200"))
+	syncs := testutil.ToFloat64(syncsTotal.WithLabelValues("success"))
+
+	for _, req := range []*http.Request{
+		httptest.NewRequest("GET", "/healthz", nil),
+		httptest.NewRequest("POST", "/sync", nil),
+	} {
+		router.ServeHTTP(httptest.NewRecorder(), req)
+	}
+
+	if got := testutil.ToFloat64(requestsTotal.WithLabelValues("/healthz", "GET", "200")); got != healthz+1 {
+		t.Errorf("bw_proxy_requests_total{route=\"/healthz\"} = %v, want %v", got, healthz+1)
+	}
+	if got := testutil.ToFloat64(syncsTotal.WithLabelValues("success")); got != syncs+1 {
+		t.Errorf("bw_sync_total{result=\"success\"} = %v, want %v", got, syncs+1)
+	}
+
+	rr := httptest.NewRecorder()
+	router.ServeHTTP(rr, httptest.NewRequest("GET", "/metrics", nil))
+	if rr.Code != http.StatusOK {
+		t.Fatalf("GET /metrics: got status %v want %v", rr.Code, http.StatusOK)
+	}
+	for _, name := range []string{"bw_proxy_requests_total", "bw_sync_last_success_timestamp_seconds", "bw_sync_last_success_age_seconds", "bw_sync_duration_seconds", "bw_vault_unlocked"} {
+		if !strings.Contains(rr.Body.String(), name) {
+			t.Errorf("GET /metrics does not contain %s", name)
+		}
+	}
+
+	// With a dedicated metrics port, /metrics is not served on the proxy port.
+	t.Setenv("BW_METRICS_PORT", "9090")
+	if metricsOnProxyPort() {
+		t.Error("metricsOnProxyPort() = true with BW_METRICS_PORT set")
+	}
+}
+
+func TestObserveCLI(t *testing.T) {
+	execCommand = mockExecCommand
+	defer func() { execCommand = exec.CommandContext }()
+
+	count := func(exitCode string) uint64 {
+		metric := &dto.Metric{}
+		_ = cliCommandDuration.WithLabelValues("bw unlock", exitCode).(prometheus.Histogram).Write(metric)
+		return metric.GetHistogram().GetSampleCount()
+	}
+	ok, failed := count("0"), count("1")
+
+	t.Setenv("BW_PASSWORD", "test-password")
+	if _, err := unlockVault("test-password"); err != nil {
+		t.Fatalf("expected nil, got %v", err)
+	}
+	t.Setenv("BW_LOGIN_RETRIES", "1")
+	if _, err := unlockVault("wrong-password"); err == nil {
+		t.Fatal("expected unlock with wrong password to fail")
+	}
+
+	if got := count("0"); got != ok+1 {
+		t.Errorf("successful 'bw unlock' count = %v, want %v", got, ok+1)
+	}
+	if got := count("1"); got != failed+1 {
+		t.Errorf("failed 'bw unlock' count = %v, want %v", got, failed+1)
+	}
+}
+
+func TestMetricsVaultRoutes(t *testing.T) {
+	upstream := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {}))
+	defer upstream.Close()
+	target, _ := url.Parse(upstream.URL)
+	router := setupRouter(httputil.NewSingleHostReverseProxy(target))
+
+	tests := []struct {
+		path, route string
+	}{
+		{"/object/password/4e5c4e8c-2f5a-4f0e-9d8a-1c2b3a4d5e6f", "/object/password/{id}"},
+		{"/list/object/items?search=db", "/list/object/{type}"},
+		{"/status", "/status"},
+		{"/wp-login.php", "other"},
+	}
+	for _, tt := range tests {
+		before := testutil.ToFloat64(requestsTotal.WithLabelValues(tt.route, "GET", "200"))
+		router.ServeHTTP(httptest.NewRecorder(), httptest.NewRequest("GET", tt.path, nil))
+		if got := testutil.ToFloat64(requestsTotal.WithLabelValues(tt.route, "GET", "200")); got != before+1 {
+			t.Errorf("GET %s: bw_proxy_requests_total{route=%q} = %v, want %v", tt.path, tt.route, got, before+1)
+		}
+	}
+}
@@ -0,0 +1,373 @@
+package main
+
+import (
+	"context"
+	"crypto/sha256"
+	"crypto/subtle"
+	"encoding/hex"
+	"fmt"
+	"net/http"
+	"net/netip"
+	"os"
+	"strconv"
+	"strings"
+
+	"github.com/coreos/go-oidc/v3/oidc"
+)
+
+// authenticator checks the credentials of a request for one authentication scheme.
+type authenticator struct {
+	// challenge is sent in the WWW-Authenticate header when authentication fails.
+	challenge string
+	// authenticate returns a description of the authenticated client, e.g. for the
+	// audit log, and whether the credentials are valid.
+	authenticate func(r *http.Request) (string, bool)
+}
+
+type identityKey struct{}
+
+// requestIdentity returns the client identity established by authentication, or "" if
+// the request was not authenticated.
+func requestIdentity(r *http.Request) string {
+	identity, _ := r.Context().Value(identityKey{}).(string)
+	return identity
+}
+
+// proxyMiddleware wraps the handler of a proxy listener with the configured
+// access controls, and assigns every request an id.
+func proxyMiddleware(handler http.Handler) (http.Handler, error) {
+	trustedProxies, err := parseCIDRs(os.Getenv("BW_PROXY_TRUSTED_PROXIES"))
+	if err != nil {
+		return nil, fmt.Errorf("invalid BW_PROXY_TRUSTED_PROXIES: %v", err)
+	}
+	allowed, err := parseCIDRs(os.Getenv("BW_PROXY_ALLOW_CIDRS"))
+	if err != nil {
+		return nil, fmt.Errorf("invalid BW_PROXY_ALLOW_CIDRS: %v", err)
+	}
+
+	var authenticators []authenticator
+
+	tokens, err := proxyAuthTokens()
+	if err != nil {
+		return nil, err
+	}
+	if len(tokens) > 0 {
+		authenticators = append(authenticators, bearerTokenAuthenticator(tokens))
+	}
+
+	policies, err := loadTokenPolicies()
+	if err != nil {
+		return nil, err
+	}
+	if len(policies) > 0 {
+		authenticators = append(authenticators, tokenPolicyAuthenticator(policies))
+	}
+
+	basicUser, err := getSecret("BW_PROXY_BASIC_USER")
+	if err != nil {
+		return nil, err
+	}
+	basicPassword, err := getSecret("BW_PROXY_BASIC_PASS")
+	if err != nil {
+		return nil, err
+	}
+	if (basicUser == "") != (basicPassword == "") {
+		return nil, fmt.Errorf("BW_PROXY_BASIC_USER and BW_PROXY_BASIC_PASS must be set together")
+	}
+	if basicUser != "" {
+		authenticators = append(authenticators, basicAuthenticator(basicUser, basicPassword))
+	}
+
+	if issuer := os.Getenv("BW_PROXY_OIDC_ISSUER"); issuer != "" {
+		a, err := oidcAuthenticator(issuer, os.Getenv("BW_PROXY_OIDC_JWKS_URL"), os.Getenv("BW_PROXY_OIDC_AUDIENCE"))
+		if err != nil {
+			return nil, err
+		}
+		authenticators = append(authenticators, a)
+	}
+
+	if len(authenticators) > 0 {
+		handler = requireAuthentication(handler, authenticators)
+	}
+	if maxBodySize := maxBodySizeFromEnv(); maxBodySize > 0 {
+		handler = limitBodySize(handler, maxBodySize)
+	}
+	if cors := corsConfigFromEnv(); cors != nil {
+		// Preflight requests carry no credentials, so they are answered before authentication.
+		handler = cors.middleware(handler)
+	}
+	if limiter := newRateLimiterFromEnv(trustedProxies); limiter != nil {
+		handler = sharedRateLimiter(limiter).middleware(handler)
+	}
+	if len(allowed) > 0 {
+		handler = requireAllowedClient(handler, allowed, trustedProxies)
+	}
+	if securityHeadersEnabled() {
+		handler = withSecurityHeaders(handler)
+	}
+	if etagsEnabled() {
+		handler = withConditionalRequests(handler)
+	}
+	accessLog, err := accessLoggerFromEnv(trustedProxies)
+	if err != nil {
+		return nil, err
+	}
+	if accessLog != nil {
+		handler = accessLog.middleware(handler)
+	}
+	return withRequestID(handler), nil
+}
+
+// parseCIDRs parses a comma separated list of CIDRs. Single addresses are accepted
+// as well and match only themselves.
+func parseCIDRs(value string) ([]netip.Prefix, error) {
+	var prefixes []netip.Prefix
+	for _, entry := range strings.Split(value, ",") {
+		entry = strings.TrimSpace(entry)
+		if entry == "" {
+			continue
+		}
+		if !strings.Contains(entry, "/") {
+			addr, err := netip.ParseAddr(entry)
+			if err != nil {
+				return nil, err
+			}
+			prefixes = append(prefixes, netip.PrefixFrom(addr.Unmap(), addr.Unmap().BitLen()))
+			continue
+		}
+		prefix, err := netip.ParsePrefix(entry)
+		if err != nil {
+			return nil, err
+		}
+		prefixes = append(prefixes, prefix.Masked())
+	}
+	return prefixes, nil
+}
+
+// containsAddr reports whether addr is within any of the prefixes.
+func containsAddr(prefixes []netip.Prefix, addr netip.Addr) bool {
+	for _, prefix := range prefixes {
+		if prefix.Contains(addr) {
+			return true
+		}
+	}
+	return false
+}
+
+// clientIP returns the address of the client that sent the request. X-Forwarded-For
+// can be set by anyone, so it is only honored when the connection comes from one of
+// the trusted proxies. The rightmost address not belonging to a trusted proxy is the
+// client, as everything to the left of it may have been forged.
+func clientIP(r *http.Request, trustedProxies []netip.Prefix) netip.Addr {
+	addrPort, err := netip.ParseAddrPort(r.RemoteAddr)
+	if err != nil {
+		return netip.Addr{}
+	}
+	addr := addrPort.Addr().Unmap()
+	if !containsAddr(trustedProxies, addr) {
+		return addr
+	}
+
+	forwarded := strings.Split(strings.Join(r.Header.Values("X-Forwarded-For"), ","), ",")
+	for i := len(forwarded) - 1; i >= 0; i-- {
+		hop, err := netip.ParseAddr(strings.TrimSpace(forwarded[i]))
+		if err != nil {
+			break
+		}
+		addr = hop.Unmap()
+		if !containsAddr(trustedProxies, addr) {
+			break
+		}
+	}
+	return addr
+}
+
+// requireAllowedClient rejects requests from clients outside the allowed networks,
+// except for health checks.
+func requireAllowedClient(next http.Handler, allowed, trustedProxies []netip.Prefix) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if !isHealthCheckPath(r.URL.Path) {
+			if addr := clientIP(r, trustedProxies); !addr.IsValid() || !containsAddr(allowed, addr) {
+				proxyLog.Warn("Rejected request, not in BW_PROXY_ALLOW_CIDRS", "request_id", requestID(r), "client", addr)
+				http.Error(w, "Forbidden", http.StatusForbidden)
+				return
+			}
+		}
+		next.ServeHTTP(w, r)
+	})
+}
+
+// isUnauthenticatedPath reports whether a path is exempt from proxy authentication:
+// health checks, and the admin endpoints, which require their own token.
+func isUnauthenticatedPath(path string) bool {
+	return isHealthCheckPath(path) || strings.HasPrefix(path, "/admin/")
+}
+
+// requireAuthentication rejects requests that are not accepted by any of the
+// authenticators, so that clients can use whichever scheme is configured for them.
+func requireAuthentication(next http.Handler, authenticators []authenticator) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if isUnauthenticatedPath(r.URL.Path) {
+			next.ServeHTTP(w, r)
+			return
+		}
+		for _, a := range authenticators {
+			if identity, ok := a.authenticate(r); ok {
+				next.ServeHTTP(w, r.WithContext(context.WithValue(r.Context(), identityKey{}, identity)))
+				return
+			}
+		}
+		for _, a := range authenticators {
+			w.Header().Add("WWW-Authenticate", a.challenge)
+		}
+		http.Error(w, "Unauthorized", http.StatusUnauthorized)
+	})
+}
+
+// proxyAuthTokens returns the accepted bearer tokens, from BW_PROXY_AUTH_TOKEN and
+// the comma or newline separated BW_PROXY_AUTH_TOKENS. Several tokens allow them
+// to be rotated without downtime.
+func proxyAuthTokens() ([]string, error) {
+	var tokens []string
+	for _, key := range []string{"BW_PROXY_AUTH_TOKEN", "BW_PROXY_AUTH_TOKENS"} {
+		value, err := getSecret(key)
+		if err != nil {
+			return nil, err
+		}
+		for _, token := range strings.FieldsFunc(value, func(r rune) bool { return r == ',' || r == '\n' }) {
+			if token = strings.TrimSpace(token); token != "" {
+				tokens = append(tokens, token)
+			}
+		}
+	}
+	return tokens, nil
+}
+
+// bearerTokenAuthenticator accepts an Authorization header carrying one of the given tokens.
+func bearerTokenAuthenticator(tokens []string) authenticator {
+	return authenticator{
+		challenge: `Bearer realm="bw-cli-docker"`,
+		authenticate: func(r *http.Request) (string, bool) {
+			token, ok := strings.CutPrefix(r.Header.Get("Authorization"), "Bearer ")
+			if !ok || !matchesAnyToken(token, tokens) {
+				return "", false
+			}
+			// Identify the token without revealing it.
+			sum := sha256.Sum256([]byte(token))
+			return "token:" + hex.EncodeToString(sum[:4]), true
+		},
+	}
+}
+
+// basicAuthenticator accepts HTTP Basic credentials matching user and password.
+func basicAuthenticator(user, password string) authenticator {
+	return authenticator{
+		challenge: `Basic realm="bw-cli-docker", charset="UTF-8"`,
+		authenticate: func(r *http.Request) (string, bool) {
+			u, p, ok := r.BasicAuth()
+			if !ok {
+				return "", false
+			}
+			// Compare both, so the response time does not reveal which one was wrong.
+			userMatch := subtle.ConstantTimeCompare([]byte(u), []byte(user))
+			passwordMatch := subtle.ConstantTimeCompare([]byte(p), []byte(password))
+			return "user:" + u, userMatch&passwordMatch == 1
+		},
+	}
+}
+
+// oidcAuthenticator accepts bearer JWTs signed by the issuer and issued for the audience,
+// e.g. projected service account tokens or tokens issued by a service mesh. The signing
+// keys are fetched from jwksURL, or discovered from the issuer if it is empty.
+func oidcAuthenticator(issuer, jwksURL, audience string) (authenticator, error) {
+	if audience == "" {
+		return authenticator{}, fmt.Errorf("BW_PROXY_OIDC_AUDIENCE is required with BW_PROXY_OIDC_ISSUER")
+	}
+	config := &oidc.Config{ClientID: audience}
+
+	var verifier *oidc.IDTokenVerifier
+	if jwksURL != "" {
+		verifier = oidc.NewVerifier(issuer, oidc.NewRemoteKeySet(context.Background(), jwksURL), config)
+	} else {
+		ctx, cancel := context.WithTimeout(context.Background(), secretStoreTimeout)
+		defer cancel()
+		provider, err := oidc.NewProvider(ctx, issuer)
+		if err != nil {
+			return authenticator{}, fmt.Errorf("failed to discover OIDC issuer '%s': %v", issuer, err)
+		}
+		verifier = provider.Verifier(config)
+	}
+
+	return authenticator{
+		challenge: `Bearer realm="bw-cli-docker"`,
+		authenticate: func(r *http.Request) (string, bool) {
+			token, ok := strings.CutPrefix(r.Header.Get("Authorization"), "Bearer ")
+			if !ok {
+				return "", false
+			}
+			idToken, err := verifier.Verify(r.Context(), token)
+			if err != nil {
+				proxyLog.Debug("Rejected JWT", "request_id", requestID(r), "error", err)
+				return "", false
+			}
+			return "jwt:" + idToken.Subject, true
+		},
+	}, nil
+}
+
+// matchesAnyToken compares token against all accepted tokens in constant time.
+func matchesAnyToken(token string, tokens []string) bool {
+	match := 0
+	for _, t := range tokens {
+		match |= subtle.ConstantTimeCompare([]byte(token), []byte(t))
+	}
+	return match == 1
+}
+
+// defaultMaxBodySize limits request bodies, which are only large for attachment uploads.
+const defaultMaxBodySize = 10 << 20
+
+// maxBodySizeFromEnv returns the request body limit from BW_PROXY_MAX_BODY_SIZE,
+// where 0 disables the limit.
+func maxBodySizeFromEnv() int64 {
+	val := os.Getenv("BW_PROXY_MAX_BODY_SIZE")
+	if val == "" {
+		return defaultMaxBodySize
+	}
+	size, err := parseByteSize(val)
+	if err != nil {
+		proxyLog.Warn("Invalid format for BW_PROXY_MAX_BODY_SIZE, using default", "value", val, "default", int64(defaultMaxBodySize), "error", err)
+		return defaultMaxBodySize
+	}
+	return size
+}
+
+// parseByteSize parses a number of bytes with an optional binary suffix K, M or G.
+func parseByteSize(value string) (int64, error) {
+	value = strings.ToUpper(strings.TrimSpace(value))
+	multiplier := int64(1)
+	for suffix, m := range map[string]int64{"K": 1 << 10, "M": 1 << 20, "G": 1 << 30} {
+		if rest, ok := strings.CutSuffix(value, suffix); ok {
+			value, multiplier = rest, m
+			break
+		}
+	}
+	n, err := strconv.ParseInt(value, 10, 64)
+	if err != nil || n < 0 {
+		return 0, fmt.Errorf("expected a non-negative size like 1048576, 512K or 10M")
+	}
+	return n * multiplier, nil
+}
+
+// limitBodySize rejects request bodies larger than maxBodySize with 413 Request Entity
+// Too Large. Bodies without a known length are cut off while they are read.
+func limitBodySize(next http.Handler, maxBodySize int64) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.ContentLength > maxBodySize {
+			http.Error(w, "Request body too large", http.StatusRequestEntityTooLarge)
+			return
+		}
+		r.Body = http.MaxBytesReader(w, r.Body, maxBodySize)
+		next.ServeHTTP(w, r)
+	})
+}
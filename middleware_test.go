@@ -0,0 +1,362 @@
+package main
+
+import (
+	"crypto/rand"
+	"crypto/rsa"
+	"encoding/json"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"net/http/httputil"
+	"net/url"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/go-jose/go-jose/v4"
+)
+
+func TestRequireBearerToken(t *testing.T) {
+	t.Setenv("BW_PROXY_AUTH_TOKEN", "token-a")
+	t.Setenv("BW_PROXY_AUTH_TOKENS", "token-b, token-c")
+
+	handler, err := proxyMiddleware(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.WriteHeader(http.StatusOK)
+	}))
+	if err != nil {
+		t.Fatalf("expected nil, got %v", err)
+	}
+
+	tests := []struct {
+		path   string
+		header string
+		want   int
+	}{
+		{"/list/object/items", "", http.StatusUnauthorized},
+		{"/list/object/items", "Bearer wrong", http.StatusUnauthorized},
+		{"/list/object/items", "token-a", http.StatusUnauthorized},
+		{"/list/object/items", "Bearer token-a", http.StatusOK},
+		{"/list/object/items", "Bearer token-c", http.StatusOK},
+		{"/healthz", "", http.StatusOK},
+	}
+	for _, tt := range tests {
+		req, _ := http.NewRequest("GET", tt.path, nil)
+		if tt.header != "" {
+			req.Header.Set("Authorization", tt.header)
+		}
+		rr := httptest.NewRecorder()
+		handler.ServeHTTP(rr, req)
+		if rr.Code != tt.want {
+			t.Errorf("%s with %q: got status %v want %v", tt.path, tt.header, rr.Code, tt.want)
+		}
+	}
+}
+
+func TestProxyMiddleware_NoTokens(t *testing.T) {
+	t.Setenv("BW_PROXY_AUTH_TOKEN", "")
+	t.Setenv("BW_PROXY_AUTH_TOKENS", "")
+
+	handler, err := proxyMiddleware(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.WriteHeader(http.StatusOK)
+	}))
+	if err != nil {
+		t.Fatalf("expected nil, got %v", err)
+	}
+
+	req, _ := http.NewRequest("GET", "/list/object/items", nil)
+	rr := httptest.NewRecorder()
+	handler.ServeHTTP(rr, req)
+	if rr.Code != http.StatusOK {
+		t.Errorf("got status %v want %v", rr.Code, http.StatusOK)
+	}
+}
+
+func TestRequireBasicAuth(t *testing.T) {
+	t.Setenv("BW_PROXY_AUTH_TOKEN", "token-a")
+	t.Setenv("BW_PROXY_AUTH_TOKENS", "")
+	t.Setenv("BW_PROXY_BASIC_USER", "admin")
+	t.Setenv("BW_PROXY_BASIC_PASS", "secret")
+
+	handler, err := proxyMiddleware(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.WriteHeader(http.StatusOK)
+	}))
+	if err != nil {
+		t.Fatalf("expected nil, got %v", err)
+	}
+
+	tests := []struct {
+		user, password string
+		want           int
+	}{
+		{"admin", "secret", http.StatusOK},
+		{"admin", "wrong", http.StatusUnauthorized},
+		{"other", "secret", http.StatusUnauthorized},
+	}
+	for _, tt := range tests {
+		req, _ := http.NewRequest("GET", "/list/object/items", nil)
+		req.SetBasicAuth(tt.user, tt.password)
+		rr := httptest.NewRecorder()
+		handler.ServeHTTP(rr, req)
+		if rr.Code != tt.want {
+			t.Errorf("%s:%s: got status %v want %v", tt.user, tt.password, rr.Code, tt.want)
+		}
+	}
+
+	// Bearer tokens remain accepted alongside Basic auth.
+	req, _ := http.NewRequest("GET", "/list/object/items", nil)
+	req.Header.Set("Authorization", "Bearer token-a")
+	rr := httptest.NewRecorder()
+	handler.ServeHTTP(rr, req)
+	if rr.Code != http.StatusOK {
+		t.Errorf("bearer token: got status %v want %v", rr.Code, http.StatusOK)
+	}
+
+	req, _ = http.NewRequest("GET", "/list/object/items", nil)
+	rr = httptest.NewRecorder()
+	handler.ServeHTTP(rr, req)
+	if got := rr.Header().Values("WWW-Authenticate"); len(got) != 2 {
+		t.Errorf("expected a challenge for each scheme, got %v", got)
+	}
+}
+
+func TestRequireBasicAuth_Incomplete(t *testing.T) {
+	t.Setenv("BW_PROXY_AUTH_TOKEN", "")
+	t.Setenv("BW_PROXY_AUTH_TOKENS", "")
+	next := http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {})
+
+	t.Setenv("BW_PROXY_BASIC_USER", "admin")
+	t.Setenv("BW_PROXY_BASIC_PASS", "")
+	if _, err := proxyMiddleware(next); err == nil {
+		t.Error("expected an error with BW_PROXY_BASIC_USER but no password")
+	}
+
+	t.Setenv("BW_PROXY_BASIC_USER", "")
+	t.Setenv("BW_PROXY_BASIC_PASS", "secret")
+	if _, err := proxyMiddleware(next); err == nil {
+		t.Error("expected an error with BW_PROXY_BASIC_PASS but no user")
+	}
+}
+
+func TestOIDCAuthenticator(t *testing.T) {
+	key, err := rsa.GenerateKey(rand.Reader, 2048)
+	if err != nil {
+		t.Fatal(err)
+	}
+	jwks := jose.JSONWebKeySet{Keys: []jose.JSONWebKey{{Key: &key.PublicKey, KeyID: "test-key", Algorithm: "RS256", Use: "sig"}}}
+	ts := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		_ = json.NewEncoder(w).Encode(jwks)
+	}))
+	defer ts.Close()
+
+	signer, err := jose.NewSigner(jose.SigningKey{Algorithm: jose.RS256, Key: key}, (&jose.SignerOptions{}).WithHeader("kid", "test-key"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	sign := func(claims map[string]any) string {
+		payload, _ := json.Marshal(claims)
+		jws, err := signer.Sign(payload)
+		if err != nil {
+			t.Fatal(err)
+		}
+		token, _ := jws.CompactSerialize()
+		return token
+	}
+	exp := time.Now().Add(time.Hour).Unix()
+
+	a, err := oidcAuthenticator("https://issuer.example.com", ts.URL, "bw-cli-docker")
+	if err != nil {
+		t.Fatalf("expected nil, got %v", err)
+	}
+
+	tests := []struct {
+		name  string
+		token string
+		want  bool
+	}{
+		{"valid", sign(map[string]any{"iss": "https://issuer.example.com", "aud": "bw-cli-docker", "sub": "app", "exp": exp}), true},
+		{"wrong audience", sign(map[string]any{"iss": "https://issuer.example.com", "aud": "other", "sub": "app", "exp": exp}), false},
+		{"wrong issuer", sign(map[string]any{"iss": "https://other.example.com", "aud": "bw-cli-docker", "sub": "app", "exp": exp}), false},
+		{"expired", sign(map[string]any{"iss": "https://issuer.example.com", "aud": "bw-cli-docker", "sub": "app", "exp": time.Now().Add(-time.Hour).Unix()}), false},
+		{"not a JWT", "token-a", false},
+	}
+	for _, tt := range tests {
+		req, _ := http.NewRequest("GET", "/list/object/items", nil)
+		req.Header.Set("Authorization", "Bearer "+tt.token)
+		if _, got := a.authenticate(req); got != tt.want {
+			t.Errorf("%s: authenticate() = %v, want %v", tt.name, got, tt.want)
+		}
+	}
+}
+
+func TestOIDCAuthenticator_MissingAudience(t *testing.T) {
+	if _, err := oidcAuthenticator("https://issuer.example.com", "https://issuer.example.com/keys", ""); err == nil {
+		t.Fatal("expected error without an audience")
+	}
+}
+
+func TestClientIP(t *testing.T) {
+	trusted, err := parseCIDRs("10.0.0.0/8, 192.168.1.1")
+	if err != nil {
+		t.Fatalf("expected nil, got %v", err)
+	}
+
+	tests := []struct {
+		remoteAddr string
+		forwarded  string
+		want       string
+	}{
+		{"172.16.0.5:1234", "", "172.16.0.5"},
+		{"172.16.0.5:1234", "1.2.3.4", "172.16.0.5"},
+		{"10.1.2.3:1234", "", "10.1.2.3"},
+		{"10.1.2.3:1234", "1.2.3.4", "1.2.3.4"},
+		{"10.1.2.3:1234", "6.6.6.6, 1.2.3.4, 192.168.1.1", "1.2.3.4"},
+		{"[::ffff:10.1.2.3]:1234", "1.2.3.4", "1.2.3.4"},
+	}
+	for _, tt := range tests {
+		req, _ := http.NewRequest("GET", "/list/object/items", nil)
+		req.RemoteAddr = tt.remoteAddr
+		if tt.forwarded != "" {
+			req.Header.Set("X-Forwarded-For", tt.forwarded)
+		}
+		if got := clientIP(req, trusted); got.String() != tt.want {
+			t.Errorf("clientIP(%s, %q) = %s, want %s", tt.remoteAddr, tt.forwarded, got, tt.want)
+		}
+	}
+}
+
+func TestRequireAllowedClient(t *testing.T) {
+	t.Setenv("BW_PROXY_ALLOW_CIDRS", "10.244.0.0/16")
+	t.Setenv("BW_PROXY_TRUSTED_PROXIES", "")
+
+	handler, err := proxyMiddleware(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.WriteHeader(http.StatusOK)
+	}))
+	if err != nil {
+		t.Fatalf("expected nil, got %v", err)
+	}
+
+	tests := []struct {
+		path       string
+		remoteAddr string
+		want       int
+	}{
+		{"/list/object/items", "10.244.3.7:5000", http.StatusOK},
+		{"/list/object/items", "10.1.3.7:5000", http.StatusForbidden},
+		{"/healthz", "10.1.3.7:5000", http.StatusOK},
+	}
+	for _, tt := range tests {
+		req, _ := http.NewRequest("GET", tt.path, nil)
+		req.RemoteAddr = tt.remoteAddr
+		// Without trusted proxies, X-Forwarded-For must be ignored.
+		req.Header.Set("X-Forwarded-For", "10.244.0.1")
+		rr := httptest.NewRecorder()
+		handler.ServeHTTP(rr, req)
+		if rr.Code != tt.want {
+			t.Errorf("%s from %s: got status %v want %v", tt.path, tt.remoteAddr, rr.Code, tt.want)
+		}
+	}
+}
+
+func TestParseCIDRs_Invalid(t *testing.T) {
+	if _, err := parseCIDRs("10.0.0.0/8,not-a-cidr"); err == nil {
+		t.Fatal("expected error for an invalid CIDR")
+	}
+}
+
+func TestParseByteSize(t *testing.T) {
+	tests := []struct {
+		value string
+		want  int64
+	}{
+		{"1024", 1024},
+		{"512K", 512 << 10},
+		{"10m", 10 << 20},
+		{"1G", 1 << 30},
+		{"0", 0},
+	}
+	for _, tt := range tests {
+		got, err := parseByteSize(tt.value)
+		if err != nil || got != tt.want {
+			t.Errorf("parseByteSize(%q) = %d, %v, want %d", tt.value, got, err, tt.want)
+		}
+	}
+	for _, value := range []string{"", "ten", "-1", "1T"} {
+		if _, err := parseByteSize(value); err == nil {
+			t.Errorf("parseByteSize(%q): expected error", value)
+		}
+	}
+}
+
+func TestLimitBodySize(t *testing.T) {
+	upstream := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		_, _ = io.Copy(io.Discard, r.Body)
+		w.WriteHeader(http.StatusOK)
+	}))
+	defer upstream.Close()
+	u, _ := url.Parse(upstream.URL)
+	proxy := httputil.NewSingleHostReverseProxy(u)
+	proxy.ErrorHandler = proxyErrorHandler
+	handler := limitBodySize(proxy, 16)
+
+	tests := []struct {
+		name string
+		body io.Reader
+		want int
+	}{
+		{"small", strings.NewReader("small body"), http.StatusOK},
+		{"known length", strings.NewReader(strings.Repeat("x", 17)), http.StatusRequestEntityTooLarge},
+		// Hide the length, so the body is only cut off while it is read.
+		{"unknown length", io.MultiReader(strings.NewReader(strings.Repeat("x", 17))), http.StatusRequestEntityTooLarge},
+	}
+	for _, tt := range tests {
+		req := httptest.NewRequest("POST", "/object/item", tt.body)
+		if tt.name == "unknown length" {
+			req.ContentLength = -1
+		}
+		rr := httptest.NewRecorder()
+		handler.ServeHTTP(rr, req)
+		if rr.Code != tt.want {
+			t.Errorf("%s: got status %v want %v", tt.name, rr.Code, tt.want)
+		}
+	}
+}
+
+func TestSecurityHeaders(t *testing.T) {
+	upstream := http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.Header().Set("Cache-Control", "max-age=3600")
+		w.Header().Set("ETag", `"abc"`)
+		w.Header().Set("Last-Modified", "Wed, 01 Jan 2025 00:00:00 GMT")
+		_, _ = w.Write([]byte(`{"success":true}`))
+	})
+
+	handler, err := proxyMiddleware(upstream)
+	if err != nil {
+		t.Fatalf("expected nil, got %v", err)
+	}
+	req, _ := http.NewRequest("GET", "/object/item/item-1", nil)
+	rr := httptest.NewRecorder()
+	handler.ServeHTTP(rr, req)
+
+	for key, want := range map[string]string{
+		"Cache-Control":          "no-store",
+		"Pragma":                 "no-cache",
+		"X-Content-Type-Options": "nosniff",
+		"ETag":                   "",
+		"Last-Modified":          "",
+	} {
+		if got := rr.Header().Get(key); got != want {
+			t.Errorf("%s = %q, want %q", key, got, want)
+		}
+	}
+
+	t.Setenv("BW_PROXY_SECURITY_HEADERS", "false")
+	handler, err = proxyMiddleware(upstream)
+	if err != nil {
+		t.Fatalf("expected nil, got %v", err)
+	}
+	rr = httptest.NewRecorder()
+	handler.ServeHTTP(rr, req)
+	if got := rr.Header().Get("Cache-Control"); got != "max-age=3600" {
+		t.Errorf("Cache-Control = %q with BW_PROXY_SECURITY_HEADERS=false, want the upstream value", got)
+	}
+}
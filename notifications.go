@@ -0,0 +1,187 @@
+package main
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"net/url"
+	"strings"
+	"time"
+
+	"golang.org/x/net/websocket"
+)
+
+const (
+	// notificationsPingInterval is how often the hub is pinged, which it requires at
+	// least every 30 seconds to keep the connection.
+	notificationsPingInterval = 15 * time.Second
+	// notificationsReadTimeout gives up on a connection the hub no longer pings.
+	notificationsReadTimeout = time.Minute
+	notificationsMinBackoff  = 5 * time.Second
+	notificationsMaxBackoff  = 5 * time.Minute
+)
+
+// signalRSeparator ends every message of the SignalR protocol.
+const signalRSeparator = "\x1e"
+
+// SignalR message types.
+const (
+	signalRInvocation = 1
+	signalRClose      = 7
+)
+
+// vaultChangeNotifications are the types of push notifications announcing a change to
+// the items, folders or sends of the vault: SyncCipherUpdate, SyncCipherCreate,
+// SyncLoginDelete, SyncFolderDelete, SyncCiphers, SyncVault, SyncOrgKeys,
+// SyncFolderCreate, SyncFolderUpdate, SyncCipherDelete, SyncSendCreate, SyncSendUpdate
+// and SyncSendDelete.
+var vaultChangeNotifications = map[int]bool{
+	0: true, 1: true, 2: true, 3: true, 4: true, 5: true, 6: true, 7: true, 8: true, 9: true,
+	12: true, 13: true, 14: true,
+}
+
+// notificationsEnabled reports whether BW_SYNC_NOTIFICATIONS is set.
+func notificationsEnabled() bool {
+	return getEnv("BW_SYNC_NOTIFICATIONS", "false") == "true"
+}
+
+// notificationsURL returns the WebSocket URL of the notifications hub of the server in
+// BW_HOST.
+func notificationsURL() string {
+	host := strings.TrimSuffix(getEnv("BW_HOST", "https://vault.bitwarden.com"), "/")
+	switch host {
+	case "https://vault.bitwarden.com", "https://bitwarden.com":
+		return "wss://notifications.bitwarden.com/hub"
+	case "https://vault.bitwarden.eu", "https://bitwarden.eu":
+		return "wss://notifications.bitwarden.eu/hub"
+	}
+	if rest, ok := strings.CutPrefix(host, "https://"); ok {
+		return "wss://" + rest + "/notifications/hub"
+	}
+	return "ws://" + strings.TrimPrefix(host, "http://") + "/notifications/hub"
+}
+
+// watchNotifications listens to the push notifications of the server and requests a
+// sync as soon as the vault changes, until ctx is done. The connection is established
+// again after it is lost; the periodic sync keeps running in the meantime.
+func watchNotifications(ctx context.Context) {
+	syncLog.Info("Listening for vault changes on the notifications hub")
+	backoff := notificationsMinBackoff
+	for {
+		connected := time.Now()
+		err := listenNotifications(ctx)
+		if ctx.Err() != nil {
+			return
+		}
+		// A connection that lasted is not a failure to back off from.
+		if time.Since(connected) > notificationsMaxBackoff {
+			backoff = notificationsMinBackoff
+		}
+		syncLog.Warn("Lost the connection to the notifications hub, reconnecting", "error", err, "retry_in", backoff)
+		select {
+		case <-ctx.Done():
+			return
+		case <-time.After(backoff):
+		}
+		backoff = min(backoff*2, notificationsMaxBackoff)
+	}
+}
+
+// signalRMessage is a message of the SignalR JSON protocol.
+type signalRMessage struct {
+	Type      int               `json:"type"`
+	Target    string            `json:"target"`
+	Arguments []json.RawMessage `json:"arguments"`
+	Error     string            `json:"error"`
+}
+
+// pushNotification is the argument of a ReceiveMessage invocation.
+type pushNotification struct {
+	ContextID string `json:"contextId"`
+	Type      int    `json:"type"`
+}
+
+// listenNotifications connects to the notifications hub with the access token of the
+// API key and requests a sync on every vault change, until the connection fails or ctx
+// is done.
+func listenNotifications(ctx context.Context) error {
+	token, err := revisions.accessToken(ctx)
+	if err != nil {
+		return err
+	}
+	origin := getEnv("BW_HOST", "https://vault.bitwarden.com")
+	config, err := websocket.NewConfig(notificationsURL()+"?access_token="+url.QueryEscape(token), origin)
+	if err != nil {
+		return err
+	}
+	dialCtx, cancel := context.WithTimeout(ctx, revisionTimeout)
+	defer cancel()
+	ws, err := config.DialContext(dialCtx)
+	if err != nil {
+		// The error of the dial includes the URL, and thereby the access token.
+		var dialErr *websocket.DialError
+		if errors.As(err, &dialErr) {
+			return dialErr.Err
+		}
+		return err
+	}
+	defer ws.Close()
+
+	done := make(chan struct{})
+	defer close(done)
+	go func() {
+		ticker := time.NewTicker(notificationsPingInterval)
+		defer ticker.Stop()
+		for {
+			select {
+			case <-ctx.Done():
+				// Unblocks the read below.
+				_ = ws.Close()
+				return
+			case <-done:
+				return
+			case <-ticker.C:
+				// A ping message.
+				_ = websocket.Message.Send(ws, `{"type":6}`+signalRSeparator)
+			}
+		}
+	}()
+
+	if err := websocket.Message.Send(ws, `{"protocol":"json","version":1}`+signalRSeparator); err != nil {
+		return err
+	}
+	for {
+		_ = ws.SetReadDeadline(time.Now().Add(notificationsReadTimeout))
+		var frame string
+		if err := websocket.Message.Receive(ws, &frame); err != nil {
+			return err
+		}
+		for record := range strings.SplitSeq(frame, signalRSeparator) {
+			if record == "" {
+				continue
+			}
+			var msg signalRMessage
+			if err := json.Unmarshal([]byte(record), &msg); err != nil {
+				return fmt.Errorf("invalid message from the notifications hub: %v", err)
+			}
+			if msg.Error != "" {
+				return fmt.Errorf("notifications hub: %s", msg.Error)
+			}
+			if msg.Type == signalRClose {
+				return errors.New("closed by the notifications hub")
+			}
+			if msg.Type != signalRInvocation || msg.Target != "ReceiveMessage" || len(msg.Arguments) == 0 {
+				continue
+			}
+			var notification pushNotification
+			if err := json.Unmarshal(msg.Arguments[0], &notification); err != nil {
+				continue
+			}
+			if vaultChangeNotifications[notification.Type] {
+				syncLog.Info("Vault changed on the server, syncing", "notification", notification.Type)
+				requestSync()
+			}
+		}
+	}
+}
@@ -0,0 +1,84 @@
+package main
+
+import (
+	"context"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+
+	"golang.org/x/net/websocket"
+)
+
+func TestNotificationsURL(t *testing.T) {
+	tests := []struct {
+		host, want string
+	}{
+		{"", "wss://notifications.bitwarden.com/hub"},
+		{"https://vault.bitwarden.eu", "wss://notifications.bitwarden.eu/hub"},
+		{"https://vault.example.com/", "wss://vault.example.com/notifications/hub"},
+		{"http://bitwarden.local:8080", "ws://bitwarden.local:8080/notifications/hub"},
+	}
+	for _, tt := range tests {
+		t.Setenv("BW_HOST", tt.host)
+		if got := notificationsURL(); got != tt.want {
+			t.Errorf("%q: got %s want %s", tt.host, got, tt.want)
+		}
+	}
+}
+
+func TestListenNotifications(t *testing.T) {
+	defer func(c *revisionChecker) { revisions = c }(revisions)
+	revisions = &revisionChecker{client: http.DefaultClient}
+
+	mux := http.NewServeMux()
+	mux.HandleFunc("/identity/connect/token", func(w http.ResponseWriter, r *http.Request) {
+		_, _ = w.Write([]byte(`{"access_token":"api-token","expires_in":3600}`))
+	})
+	mux.Handle("/notifications/hub", websocket.Handler(func(ws *websocket.Conn) {
+		if ws.Request().URL.Query().Get("access_token") != "api-token" {
+			return
+		}
+		var handshake string
+		if err := websocket.Message.Receive(ws, &handshake); err != nil || !strings.Contains(handshake, `"protocol":"json"`) {
+			t.Errorf("unexpected handshake %q: %v", handshake, err)
+			return
+		}
+		// The handshake response, a logout, which is no vault change, and a cipher update.
+		_ = websocket.Message.Send(ws, "{}\x1e")
+		_ = websocket.Message.Send(ws, `{"type":1,"target":"ReceiveMessage","arguments":[{"contextId":"other","type":11}]}`+"\x1e")
+		_ = websocket.Message.Send(ws, `{"type":1,"target":"ReceiveMessage","arguments":[{"contextId":"other","type":0,"payload":{}}]}`+"\x1e")
+		var msg string
+		_ = websocket.Message.Receive(ws, &msg)
+	}))
+	server := httptest.NewServer(mux)
+	defer server.Close()
+	t.Setenv("BW_HOST", server.URL)
+	t.Setenv("BW_CLIENTID", "user.test")
+	t.Setenv("BW_CLIENTSECRET", "secret")
+
+	// Drains a pending request left over by other tests.
+	select {
+	case <-syncRequests:
+	default:
+	}
+
+	ctx, cancel := context.WithCancel(context.Background())
+	done := make(chan error, 1)
+	go func() { done <- listenNotifications(ctx) }()
+
+	select {
+	case <-syncRequests:
+	case err := <-done:
+		t.Fatalf("listener stopped without requesting a sync: %v", err)
+	case <-time.After(5 * time.Second):
+		t.Fatal("no sync requested after a vault change")
+	}
+	cancel()
+	select {
+	case <-done:
+	case <-time.After(5 * time.Second):
+		t.Fatal("listener did not stop")
+	}
+}
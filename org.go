@@ -0,0 +1,96 @@
+package main
+
+import (
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"regexp"
+	"strings"
+)
+
+// guidPattern matches the ids Bitwarden uses for organizations and their members. Ids
+// from requests are passed to the CLI as arguments, so anything else, e.g. a value
+// starting with "-" that would be taken for a flag, is rejected.
+var guidPattern = regexp.MustCompile(`^[0-9a-fA-F]{8}-[0-9a-fA-F]{4}-[0-9a-fA-F]{4}-[0-9a-fA-F]{4}-[0-9a-fA-F]{12}$`)
+
+// registerOrgRoutes adds the organization management endpoints. They wrap the
+// bw CLI organization commands, which are available both to users with admin
+// rights and to organization API keys, neither of which are exposed by 'bw serve'
+// in a way that works without an unlocked vault.
+func registerOrgRoutes(mux *http.ServeMux) {
+	mux.HandleFunc("/org/members", func(w http.ResponseWriter, r *http.Request) {
+		if r.Method != http.MethodGet {
+			http.Error(w, "Method not allowed", http.StatusMethodNotAllowed)
+			return
+		}
+		runOrgCommand(w, r, "list", "org-members")
+	})
+
+	mux.HandleFunc("/org/members/{id}/confirm", func(w http.ResponseWriter, r *http.Request) {
+		if r.Method != http.MethodPost {
+			http.Error(w, "Method not allowed", http.StatusMethodNotAllowed)
+			return
+		}
+		if isReadOnly() {
+			http.Error(w, "Forbidden: the vault is read-only (BW_READONLY)", http.StatusForbidden)
+			return
+		}
+		id := r.PathValue("id")
+		if !guidPattern.MatchString(id) {
+			http.Error(w, fmt.Sprintf("Invalid member id '%s'", id), http.StatusBadRequest)
+			return
+		}
+		runOrgCommand(w, r, "confirm", "org-member", id)
+	})
+
+	mux.HandleFunc("/org/collections", func(w http.ResponseWriter, r *http.Request) {
+		if r.Method != http.MethodGet {
+			http.Error(w, "Method not allowed", http.StatusMethodNotAllowed)
+			return
+		}
+		runOrgCommand(w, r, "list", "org-collections")
+	})
+}
+
+// runOrgCommand executes a bw organization command and writes its output as the response.
+// The organization defaults to the one of the configured organization API key and can be
+// overridden with the organizationid query parameter.
+func runOrgCommand(w http.ResponseWriter, r *http.Request, args ...string) {
+	organizationID := r.URL.Query().Get("organizationid")
+	if organizationID != "" && !guidPattern.MatchString(organizationID) {
+		http.Error(w, fmt.Sprintf("Invalid organizationid '%s'", organizationID), http.StatusBadRequest)
+		return
+	}
+	if organizationID == "" {
+		clientID, _ := getSecret("BW_CLIENTID")
+		organizationID = organizationIDFromClientID(clientID)
+	}
+	if organizationID == "" {
+		http.Error(w, "Missing organizationid query parameter", http.StatusBadRequest)
+		return
+	}
+
+	args = append(args, "--organizationid", organizationID)
+	ctx, cancel, err := cliContext(r.Context())
+	if err != nil {
+		cliUnavailable(w, r, err)
+		return
+	}
+	defer cancel()
+	cmd := execCommand(ctx, "bw", args...)
+	var out, errOut bytes.Buffer
+	cmd.Stdout = &out
+	cmd.Stderr = &errOut
+	if err := runTraced(r.Context(), "bw "+args[0]+" "+args[1], cmd.Run); err != nil {
+		proxyLog.Error("bw command failed", "command", args[0]+" "+args[1], "output", strings.TrimSpace(errOut.String()))
+		http.Error(w, fmt.Sprintf("Command failed: %s", errOut.String()), http.StatusInternalServerError)
+		return
+	}
+
+	if json.Valid(out.Bytes()) {
+		w.Header().Set("Content-Type", "application/json")
+	}
+	w.WriteHeader(http.StatusOK)
+	_, _ = w.Write(out.Bytes())
+}
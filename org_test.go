@@ -0,0 +1,90 @@
+package main
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"net/http/httputil"
+	"net/url"
+	"os/exec"
+	"testing"
+)
+
+func TestOrgMembersEndpoint(t *testing.T) {
+	execCommand = mockExecCommand
+	defer func() { execCommand = exec.CommandContext }()
+	t.Setenv("BW_CLIENTID", "organization.test-org-id")
+
+	url, _ := url.Parse("http://localhost:8080")
+	proxy := httputil.NewSingleHostReverseProxy(url)
+	router := setupRouter(proxy)
+
+	req, _ := http.NewRequest("GET", "/org/members", nil)
+	rr := httptest.NewRecorder()
+
+	router.ServeHTTP(rr, req)
+
+	if status := rr.Code; status != http.StatusOK {
+		t.Fatalf("handler returned wrong status code: got %v want %v: %s",
+			status, http.StatusOK, rr.Body.String())
+	}
+	if ct := rr.Header().Get("Content-Type"); ct != "application/json" {
+		t.Errorf("handler returned wrong content type: got %v want application/json", ct)
+	}
+}
+
+func TestOrgMembersEndpointMissingOrganization(t *testing.T) {
+	t.Setenv("BW_CLIENTID", "user.test-id")
+
+	url, _ := url.Parse("http://localhost:8080")
+	proxy := httputil.NewSingleHostReverseProxy(url)
+	router := setupRouter(proxy)
+
+	req, _ := http.NewRequest("GET", "/org/members", nil)
+	rr := httptest.NewRecorder()
+
+	router.ServeHTTP(rr, req)
+
+	if status := rr.Code; status != http.StatusBadRequest {
+		t.Errorf("handler returned wrong status code: got %v want %v",
+			status, http.StatusBadRequest)
+	}
+}
+
+func TestOrgConfirmMethodNotAllowed(t *testing.T) {
+	url, _ := url.Parse("http://localhost:8080")
+	proxy := httputil.NewSingleHostReverseProxy(url)
+	router := setupRouter(proxy)
+
+	req, _ := http.NewRequest("GET", "/org/members/member-1/confirm", nil)
+	rr := httptest.NewRecorder()
+
+	router.ServeHTTP(rr, req)
+
+	if status := rr.Code; status != http.StatusMethodNotAllowed {
+		t.Errorf("handler returned wrong status code: got %v want %v",
+			status, http.StatusMethodNotAllowed)
+	}
+}
+
+func TestOrgInvalidIDs(t *testing.T) {
+	execCommand = mockExecCommand
+	defer func() { execCommand = exec.CommandContext }()
+	t.Setenv("BW_CLIENTID", "organization.test-org-id")
+
+	url, _ := url.Parse("http://localhost:8080")
+	router := setupRouter(httputil.NewSingleHostReverseProxy(url))
+
+	for _, tt := range []struct{ method, path string }{
+		{"GET", "/org/members?organizationid=--help"},
+		{"GET", "/org/collections?organizationid=not-a-guid"},
+		{"POST", "/org/members/--raw/confirm"},
+		{"POST", "/org/members/member-1/confirm"},
+	} {
+		req, _ := http.NewRequest(tt.method, tt.path, nil)
+		rr := httptest.NewRecorder()
+		router.ServeHTTP(rr, req)
+		if rr.Code != http.StatusBadRequest {
+			t.Errorf("%s %s: got status %v want %v", tt.method, tt.path, rr.Code, http.StatusBadRequest)
+		}
+	}
+}
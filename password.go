@@ -0,0 +1,63 @@
+package main
+
+import (
+	"os"
+	"time"
+)
+
+// secretStoreTimeout bounds each request to an external secret store.
+const secretStoreTimeout = 30 * time.Second
+
+// getPassword resolves the master password from the first configured source.
+// External secret stores take precedence over BW_PASSWORD and BW_PASSWORD_FILE.
+// The password is resolved again on every call, so rotated secrets are picked up
+// the next time the vault has to be unlocked. It is redacted from all output.
+func getPassword() (string, error) {
+	password, err := resolvePassword()
+	if err == nil {
+		registerSecret(password)
+	}
+	return password, err
+}
+
+// externalPasswordSource returns the variable configuring the external source the
+// master password is read from instead of BW_PASSWORD, if any.
+func externalPasswordSource() string {
+	for _, key := range []string{
+		"BW_PASSWORD_AWS_SECRET_ARN",
+		"BW_PASSWORD_AWS_SSM_PARAMETER",
+		"BW_PASSWORD_GCP_SECRET",
+		"BW_PASSWORD_AZURE_KEYVAULT_URI",
+	} {
+		if os.Getenv(key) != "" {
+			return key
+		}
+	}
+	if os.Getenv("BW_PASSWORD_ENCRYPTED") != "" || os.Getenv("BW_PASSWORD_ENCRYPTED_FILE") != "" {
+		return "BW_PASSWORD_ENCRYPTED"
+	}
+	return ""
+}
+
+func resolvePassword() (string, error) {
+	if secretID := os.Getenv("BW_PASSWORD_AWS_SECRET_ARN"); secretID != "" {
+		return fetchAWSSecret(secretID)
+	}
+	if name := os.Getenv("BW_PASSWORD_AWS_SSM_PARAMETER"); name != "" {
+		return fetchAWSParameter(name)
+	}
+	if name := os.Getenv("BW_PASSWORD_GCP_SECRET"); name != "" {
+		return fetchGCPSecret(name)
+	}
+	if uri := os.Getenv("BW_PASSWORD_AZURE_KEYVAULT_URI"); uri != "" {
+		return fetchAzureKeyVaultSecret(uri)
+	}
+	encrypted, err := getSecret("BW_PASSWORD_ENCRYPTED")
+	if err != nil {
+		return "", err
+	}
+	if encrypted != "" {
+		return decryptAWSKMS(encrypted, os.Getenv("BW_PASSWORD_KMS_KEY_ID"))
+	}
+	return getSecret("BW_PASSWORD")
+}
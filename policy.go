@@ -0,0 +1,107 @@
+package main
+
+import (
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"path"
+	"strings"
+)
+
+// tokenPolicy grants the client holding a token least-privilege access to the proxy.
+type tokenPolicy struct {
+	Name  string `json:"name"`
+	Token string `json:"token"`
+	// ReadOnly rejects requests that would modify the vault.
+	ReadOnly bool `json:"readOnly"`
+	// Organizations and Collections restrict the items visible to the token.
+	Organizations []string `json:"organizations"`
+	Collections   []string `json:"collections"`
+	// Paths are the path patterns the token may request. All paths if empty.
+	Paths []string `json:"paths"`
+}
+
+// loadTokenPolicies parses the JSON list of token policies in BW_PROXY_TOKEN_POLICIES
+// (or the file in BW_PROXY_TOKEN_POLICIES_FILE).
+func loadTokenPolicies() ([]tokenPolicy, error) {
+	value, err := getSecret("BW_PROXY_TOKEN_POLICIES")
+	if err != nil || value == "" {
+		return nil, err
+	}
+
+	var policies []tokenPolicy
+	if err := json.Unmarshal([]byte(value), &policies); err != nil {
+		return nil, fmt.Errorf("invalid BW_PROXY_TOKEN_POLICIES: %v", err)
+	}
+	seen := map[string]bool{}
+	for _, p := range policies {
+		if p.Name == "" || p.Token == "" {
+			return nil, fmt.Errorf("invalid BW_PROXY_TOKEN_POLICIES: every policy needs a name and a token")
+		}
+		if seen[p.Name] {
+			return nil, fmt.Errorf("invalid BW_PROXY_TOKEN_POLICIES: duplicate policy name '%s'", p.Name)
+		}
+		seen[p.Name] = true
+		for _, pattern := range p.Paths {
+			if _, err := path.Match(pattern, ""); err != nil {
+				return nil, fmt.Errorf("invalid path pattern '%s' in policy '%s': %v", pattern, p.Name, err)
+			}
+		}
+	}
+	return policies, nil
+}
+
+// tokenPolicyAuthenticator accepts the tokens of the policies, identifying the client
+// by the name of its policy.
+func tokenPolicyAuthenticator(policies []tokenPolicy) authenticator {
+	return authenticator{
+		challenge: `Bearer realm="bw-cli-docker"`,
+		authenticate: func(r *http.Request) (string, bool) {
+			token, ok := strings.CutPrefix(r.Header.Get("Authorization"), "Bearer ")
+			if !ok {
+				return "", false
+			}
+			// Check every policy, so the response time does not reveal which one matched.
+			var name string
+			for _, p := range policies {
+				if matchesAnyToken(token, []string{p.Token}) {
+					name = p.Name
+				}
+			}
+			return tokenPolicyIdentityPrefix + name, name != ""
+		},
+	}
+}
+
+// tokenPolicyIdentityPrefix marks the identity of clients authenticated by a policy token.
+const tokenPolicyIdentityPrefix = "policy:"
+
+// restrict applies the restrictions of the policy to next.
+func (p tokenPolicy) restrict(next http.Handler) http.Handler {
+	if len(p.Organizations) > 0 || len(p.Collections) > 0 {
+		next = (&vaultScope{organizations: p.Organizations, collections: p.Collections}).middleware(next)
+	}
+	if p.ReadOnly {
+		next = rejectWrites(next)
+	}
+	if len(p.Paths) > 0 {
+		next = (&pathRules{allow: p.Paths}).middleware(next)
+	}
+	return next
+}
+
+// tokenPolicyMiddleware enforces the policy of the token a request was authenticated
+// with. Requests authenticated by other means are passed on unrestricted.
+func tokenPolicyMiddleware(next http.Handler, policies []tokenPolicy) http.Handler {
+	restricted := make(map[string]http.Handler, len(policies))
+	for _, p := range policies {
+		restricted[p.Name] = p.restrict(next)
+	}
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if name, ok := strings.CutPrefix(requestIdentity(r), tokenPolicyIdentityPrefix); ok {
+			restricted[name].ServeHTTP(w, r)
+			return
+		}
+		next.ServeHTTP(w, r)
+	})
+}
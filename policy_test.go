@@ -0,0 +1,57 @@
+package main
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"testing"
+)
+
+func TestTokenPolicies(t *testing.T) {
+	t.Setenv("BW_PROXY_TOKEN_POLICIES", `[
+		{"name": "reader", "token": "reader-token", "readOnly": true, "organizations": ["org-a"]},
+		{"name": "paths", "token": "paths-token", "paths": ["/object/item/*"]},
+		{"name": "admin", "token": "admin-token"}
+	]`)
+
+	handler, err := proxyMiddleware(newScopeTestRouter(t))
+	if err != nil {
+		t.Fatalf("expected nil, got %v", err)
+	}
+
+	tests := []struct {
+		token, method, path string
+		want                int
+	}{
+		{"reader-token", "GET", "/object/item/item-a", http.StatusOK},
+		{"reader-token", "GET", "/object/item/item-b", http.StatusForbidden},
+		{"reader-token", "DELETE", "/object/item/item-a", http.StatusForbidden},
+		{"reader-token", "POST", "/org/members/member-1/confirm", http.StatusForbidden},
+		{"paths-token", "GET", "/object/item/item-b", http.StatusOK},
+		{"paths-token", "GET", "/list/object/items", http.StatusForbidden},
+		{"admin-token", "DELETE", "/object/item/item-b", http.StatusOK},
+		{"unknown-token", "GET", "/object/item/item-a", http.StatusUnauthorized},
+	}
+	for _, tt := range tests {
+		req, _ := http.NewRequest(tt.method, tt.path, nil)
+		req.Header.Set("Authorization", "Bearer "+tt.token)
+		rr := httptest.NewRecorder()
+		handler.ServeHTTP(rr, req)
+		if rr.Code != tt.want {
+			t.Errorf("%s %s with %s: got status %v want %v", tt.method, tt.path, tt.token, rr.Code, tt.want)
+		}
+	}
+}
+
+func TestLoadTokenPolicies_Invalid(t *testing.T) {
+	for _, value := range []string{
+		`not json`,
+		`[{"name": "missing-token"}]`,
+		`[{"name": "a", "token": "x"}, {"name": "a", "token": "y"}]`,
+		`[{"name": "a", "token": "x", "paths": ["/object/["]}]`,
+	} {
+		t.Setenv("BW_PROXY_TOKEN_POLICIES", value)
+		if _, err := loadTokenPolicies(); err == nil {
+			t.Errorf("expected error for %s", value)
+		}
+	}
+}
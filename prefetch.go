@@ -0,0 +1,49 @@
+package main
+
+import (
+	"io"
+	"net/http"
+	"net/url"
+	"os"
+	"strings"
+)
+
+// prefetchItems reads the items in BW_PREFETCH_ITEMS, by ID or name, into the response
+// cache once the vault is unlocked, so the first reads of applications starting
+// alongside are answered from memory rather than by a cold 'bw serve'. They are cached
+// under /object/item/<ID or name>, as requested by applications.
+func prefetchItems(port string) {
+	val := os.Getenv("BW_PREFETCH_ITEMS")
+	if val == "" {
+		return
+	}
+	c := activeTTLCache()
+	if c == nil {
+		proxyLog.Warn("BW_PREFETCH_ITEMS requires the response cache (BW_CACHE_TTL), not prefetching")
+		return
+	}
+
+	client := &http.Client{Timeout: defaultCLITimeout}
+	fetched := 0
+	for item := range strings.SplitSeq(val, ",") {
+		item = strings.TrimSpace(item)
+		if item == "" {
+			continue
+		}
+		key := "/object/item/" + url.PathEscape(item)
+		resp, err := client.Get(bwServeURL(port, key))
+		if err != nil {
+			proxyLog.Warn("Failed to prefetch item", "item", item, "error", err)
+			continue
+		}
+		body, err := io.ReadAll(resp.Body)
+		_ = resp.Body.Close()
+		if err != nil || resp.StatusCode != http.StatusOK {
+			proxyLog.Warn("Failed to prefetch item", "item", item, "status", resp.StatusCode, "error", err)
+			continue
+		}
+		c.store(key, resp.Header, body)
+		fetched++
+	}
+	proxyLog.Info("Prefetched items", "items", fetched)
+}
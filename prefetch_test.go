@@ -0,0 +1,40 @@
+package main
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"testing"
+)
+
+func TestPrefetchItems(t *testing.T) {
+	defer func() { responseCaches = nil }()
+	defer func() { currentTTLCache.cache = nil }()
+	bwServe := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		switch r.URL.EscapedPath() {
+		case "/object/item/1", "/object/item/my%20database":
+			w.Header().Set("Content-Type", "application/json")
+			_, _ = w.Write([]byte(`{"success":true}`))
+		default:
+			w.WriteHeader(http.StatusNotFound)
+		}
+	}))
+	defer bwServe.Close()
+	u, _ := url.Parse(bwServe.URL)
+
+	t.Setenv("BW_PREFETCH_ITEMS", "1, my database,missing")
+	// Without the response cache, there is nothing to prefetch into.
+	prefetchItems(u.Port())
+
+	t.Setenv("BW_CACHE_TTL", "1h")
+	cache := ttlCacheFromEnv()
+	prefetchItems(u.Port())
+	for _, key := range []string{"/object/item/1", "/object/item/my%20database"} {
+		if entry := cache.load(key); entry == nil || string(entry.body) != `{"success":true}` {
+			t.Errorf("%s: got %+v", key, entry)
+		}
+	}
+	if cache.load("/object/item/missing") != nil {
+		t.Error("expected a failed read not to be cached")
+	}
+}
@@ -0,0 +1,201 @@
+package main
+
+import (
+	"errors"
+	"fmt"
+	"net/http"
+	"net/http/httputil"
+	"os"
+	"path"
+	"slices"
+	"strings"
+)
+
+// vaultProxyHandler returns the handler for requests proxied to 'bw serve', with the
+// configured restrictions on what may be forwarded.
+func vaultProxyHandler(proxy *httputil.ReverseProxy) http.Handler {
+	var handler http.Handler = http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		serveWithUnlockRetry(proxy, w, r)
+	})
+	if cache := staleCacheFromEnv(); cache != nil {
+		handler = cache.middleware(handler)
+	}
+	if cache := ttlCacheFromEnv(); cache != nil {
+		handler = cache.middleware(handler)
+	}
+
+	redactor, err := responseRedactorFromEnv()
+	if err != nil {
+		return rejectAll("Invalid redaction configuration", err)
+	}
+	if redactor != nil {
+		handler = redactor.middleware(handler)
+	}
+	if scope := vaultScopeFromEnv(); scope != nil {
+		handler = scope.middleware(handler)
+	}
+	if isReadOnly() {
+		handler = rejectWrites(handler)
+	}
+	if getEnv("BW_ALLOW_DESTRUCTIVE", "false") != "true" {
+		handler = rejectDestructive(handler)
+	}
+
+	rules, err := pathRulesFromEnv()
+	if err != nil {
+		// Fail closed rather than proxying paths that were meant to be denied.
+		return rejectAll("Invalid path rules", err)
+	}
+	audit, err := auditLoggerFromEnv()
+	if err != nil {
+		// Fail closed rather than serving secrets without an audit trail.
+		return rejectAll("Audit log unavailable", err)
+	}
+	if rules != nil {
+		handler = rules.middleware(handler)
+	}
+	if audit != nil {
+		handler = audit.middleware(handler)
+	}
+	return handler
+}
+
+// rejectAll returns a handler rejecting every request, for restrictions that are
+// configured but cannot be enforced.
+func rejectAll(reason string, err error) http.Handler {
+	proxyLog.Error(reason+", rejecting all requests", "error", err)
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		http.Error(w, reason, http.StatusInternalServerError)
+	})
+}
+
+// destructivePaths are 'bw serve' endpoints that would break the long-running session.
+var destructivePaths = []string{"/lock", "/logout"}
+
+// isDestructive reports whether a request would break the session of the wrapper or
+// irrecoverably delete vault data.
+func isDestructive(r *http.Request) bool {
+	if slices.Contains(destructivePaths, path.Clean(r.URL.Path)) {
+		return true
+	}
+	// Permanently deleted items cannot be restored from the trash.
+	return r.Method == http.MethodDelete && r.URL.Query().Has("permanent")
+}
+
+// rejectDestructive rejects destructive requests unless BW_ALLOW_DESTRUCTIVE is set.
+func rejectDestructive(next http.Handler) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if isDestructive(r) {
+			http.Error(w, "Forbidden: this endpoint would lock the vault, log out or permanently delete data, "+
+				"breaking the proxy for all clients. Set BW_ALLOW_DESTRUCTIVE=true to allow it.", http.StatusForbidden)
+			return
+		}
+		next.ServeHTTP(w, r)
+	})
+}
+
+// pathRules decide which paths may be proxied to 'bw serve'. Patterns use the
+// syntax of path.Match, so "*" matches a single path segment.
+type pathRules struct {
+	allow, deny []string
+}
+
+// pathRulesFromEnv parses the comma separated patterns of BW_PROXY_ALLOW_PATHS and
+// BW_PROXY_DENY_PATHS, returning nil if neither is set.
+func pathRulesFromEnv() (*pathRules, error) {
+	rules := &pathRules{}
+	for _, list := range []struct {
+		key      string
+		patterns *[]string
+	}{
+		{"BW_PROXY_ALLOW_PATHS", &rules.allow},
+		{"BW_PROXY_DENY_PATHS", &rules.deny},
+	} {
+		for _, pattern := range strings.Split(os.Getenv(list.key), ",") {
+			pattern = strings.TrimSpace(pattern)
+			if pattern == "" {
+				continue
+			}
+			if _, err := path.Match(pattern, ""); err != nil {
+				return nil, fmt.Errorf("invalid pattern '%s' in %s: %v", pattern, list.key, err)
+			}
+			*list.patterns = append(*list.patterns, pattern)
+		}
+	}
+	if len(rules.allow) == 0 && len(rules.deny) == 0 {
+		return nil, nil
+	}
+	return rules, nil
+}
+
+// allows reports whether a path may be proxied. Deny patterns take precedence, and
+// if allow patterns are configured, the path has to match one of them.
+func (p *pathRules) allows(urlPath string) bool {
+	urlPath = path.Clean(urlPath)
+	if matchesAnyPattern(p.deny, urlPath) {
+		return false
+	}
+	return len(p.allow) == 0 || matchesAnyPattern(p.allow, urlPath)
+}
+
+func (p *pathRules) middleware(next http.Handler) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if !p.allows(r.URL.Path) {
+			http.Error(w, "Forbidden: path is not allowed", http.StatusForbidden)
+			return
+		}
+		next.ServeHTTP(w, r)
+	})
+}
+
+// matchesAnyPattern reports whether the path matches any of the patterns.
+func matchesAnyPattern(patterns []string, urlPath string) bool {
+	for _, pattern := range patterns {
+		if ok, _ := path.Match(pattern, urlPath); ok {
+			return true
+		}
+	}
+	return false
+}
+
+// proxyErrorHandler reports requests that could not be proxied to 'bw serve'.
+func proxyErrorHandler(w http.ResponseWriter, r *http.Request, err error) {
+	if errors.Is(err, errVaultLocked) {
+		// Answered by serveWithUnlockRetry once the vault is unlocked again.
+		return
+	}
+	var maxBytesErr *http.MaxBytesError
+	if errors.As(err, &maxBytesErr) {
+		http.Error(w, "Request body too large", http.StatusRequestEntityTooLarge)
+		return
+	}
+	proxyErrorsTotal.Inc()
+	proxyLog.Error("Proxying to 'bw serve' failed", "request_id", requestID(r), "method", r.Method, "path", r.URL.Path, "error", err)
+	http.Error(w, fmt.Sprintf("Bad gateway (request ID: %s)", requestID(r)), http.StatusBadGateway)
+}
+
+// isReadOnly reports whether BW_READONLY is set, in which case the vault may only be read.
+func isReadOnly() bool {
+	return getEnv("BW_READONLY", "false") == "true"
+}
+
+// isWriteMethod reports whether a request with the given method may modify data.
+func isWriteMethod(method string) bool {
+	switch method {
+	case http.MethodGet, http.MethodHead, http.MethodOptions:
+		return false
+	}
+	return true
+}
+
+// rejectWrites rejects requests that would modify the vault. Syncing and unlocking
+// only refresh local state and stay available.
+func rejectWrites(next http.Handler) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if isWriteMethod(r.Method) && r.URL.Path != "/sync" && r.URL.Path != "/unlock" {
+			http.Error(w, "Forbidden: the vault is read-only (BW_READONLY)", http.StatusForbidden)
+			return
+		}
+		next.ServeHTTP(w, r)
+	})
+}
@@ -0,0 +1,128 @@
+package main
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"net/http/httputil"
+	"net/url"
+	"testing"
+)
+
+// newTestUpstream starts a fake 'bw serve' that answers every request with 200 OK,
+// and returns a router proxying to it.
+func newTestUpstream(t *testing.T) http.Handler {
+	t.Helper()
+	ts := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.WriteHeader(http.StatusOK)
+	}))
+	t.Cleanup(ts.Close)
+	u, _ := url.Parse(ts.URL)
+	return setupRouter(httputil.NewSingleHostReverseProxy(u))
+}
+
+func TestReadOnly(t *testing.T) {
+	t.Setenv("BW_READONLY", "true")
+	router := newTestUpstream(t)
+
+	tests := []struct {
+		method, path string
+		want         int
+	}{
+		{"GET", "/list/object/items", http.StatusOK},
+		{"POST", "/object/item", http.StatusForbidden},
+		{"PUT", "/object/item/item-1", http.StatusForbidden},
+		{"DELETE", "/object/item/item-1", http.StatusForbidden},
+		{"POST", "/unlock", http.StatusOK},
+		{"POST", "/org/members/member-1/confirm", http.StatusForbidden},
+	}
+	for _, tt := range tests {
+		req, _ := http.NewRequest(tt.method, tt.path, nil)
+		rr := httptest.NewRecorder()
+		router.ServeHTTP(rr, req)
+		if rr.Code != tt.want {
+			t.Errorf("%s %s: got status %v want %v", tt.method, tt.path, rr.Code, tt.want)
+		}
+	}
+}
+
+func TestReadOnlyDisabled(t *testing.T) {
+	t.Setenv("BW_READONLY", "")
+	router := newTestUpstream(t)
+
+	req, _ := http.NewRequest("POST", "/object/item", nil)
+	rr := httptest.NewRecorder()
+	router.ServeHTTP(rr, req)
+	if rr.Code != http.StatusOK {
+		t.Errorf("got status %v want %v", rr.Code, http.StatusOK)
+	}
+}
+
+func TestPathRules(t *testing.T) {
+	t.Setenv("BW_PROXY_ALLOW_PATHS", "/object/item/*, /list/object/items")
+	t.Setenv("BW_PROXY_DENY_PATHS", "/object/item/secret-*")
+	router := newTestUpstream(t)
+
+	tests := []struct {
+		path string
+		want int
+	}{
+		{"/list/object/items", http.StatusOK},
+		{"/object/item/item-1", http.StatusOK},
+		{"/object/item/secret-1", http.StatusForbidden},
+		{"/object/attachment/att-1", http.StatusForbidden},
+		{"/list/object/folders", http.StatusForbidden},
+		{"/healthz", http.StatusOK},
+	}
+	for _, tt := range tests {
+		req := httptest.NewRequest("GET", tt.path, nil)
+		rr := httptest.NewRecorder()
+		router.ServeHTTP(rr, req)
+		if rr.Code != tt.want {
+			t.Errorf("GET %s: got status %v want %v", tt.path, rr.Code, tt.want)
+		}
+	}
+}
+
+func TestPathRulesInvalidPattern(t *testing.T) {
+	t.Setenv("BW_PROXY_DENY_PATHS", "/object/[")
+	router := newTestUpstream(t)
+
+	req, _ := http.NewRequest("GET", "/list/object/items", nil)
+	rr := httptest.NewRecorder()
+	router.ServeHTTP(rr, req)
+	if rr.Code != http.StatusInternalServerError {
+		t.Errorf("got status %v want %v", rr.Code, http.StatusInternalServerError)
+	}
+}
+
+func TestRejectDestructive(t *testing.T) {
+	router := newTestUpstream(t)
+
+	tests := []struct {
+		method, path string
+		want         int
+	}{
+		{"POST", "/lock", http.StatusForbidden},
+		{"POST", "/logout", http.StatusForbidden},
+		{"DELETE", "/object/item/item-1?permanent=true", http.StatusForbidden},
+		{"DELETE", "/object/item/item-1", http.StatusOK},
+		{"POST", "/unlock", http.StatusOK},
+	}
+	for _, tt := range tests {
+		req, _ := http.NewRequest(tt.method, tt.path, nil)
+		rr := httptest.NewRecorder()
+		router.ServeHTTP(rr, req)
+		if rr.Code != tt.want {
+			t.Errorf("%s %s: got status %v want %v", tt.method, tt.path, rr.Code, tt.want)
+		}
+	}
+
+	t.Setenv("BW_ALLOW_DESTRUCTIVE", "true")
+	router = newTestUpstream(t)
+	req, _ := http.NewRequest("POST", "/lock", nil)
+	rr := httptest.NewRecorder()
+	router.ServeHTTP(rr, req)
+	if rr.Code != http.StatusOK {
+		t.Errorf("POST /lock with BW_ALLOW_DESTRUCTIVE: got status %v want %v", rr.Code, http.StatusOK)
+	}
+}
@@ -0,0 +1,161 @@
+package main
+
+import (
+	"crypto/sha256"
+	"math"
+	"net/http"
+	"net/netip"
+	"os"
+	"strconv"
+	"sync"
+	"time"
+
+	"golang.org/x/time/rate"
+)
+
+// rateLimiterIdleTimeout is how long the bucket of a client is kept after its last request.
+const rateLimiterIdleTimeout = 10 * time.Minute
+
+// rateLimiter is a token bucket rate limiter per client. Clients are identified by
+// their Authorization header if present, so that several workloads behind the same
+// address are limited separately, and by their address otherwise.
+type rateLimiter struct {
+	limit          rate.Limit
+	burst          int
+	trustedProxies []netip.Prefix
+
+	mu      sync.Mutex
+	clients map[string]*clientLimiter
+}
+
+type clientLimiter struct {
+	limiter  *rate.Limiter
+	lastSeen time.Time
+}
+
+// newRateLimiterFromEnv returns the rate limiter configured by BW_PROXY_RATE_LIMIT
+// (requests per second) and BW_PROXY_RATE_BURST, or nil if rate limiting is disabled.
+func newRateLimiterFromEnv(trustedProxies []netip.Prefix) *rateLimiter {
+	val := os.Getenv("BW_PROXY_RATE_LIMIT")
+	if val == "" {
+		return nil
+	}
+	rps, err := strconv.ParseFloat(val, 64)
+	if err != nil || rps <= 0 {
+		proxyLog.Warn("Invalid format for BW_PROXY_RATE_LIMIT, rate limiting is disabled", "value", val)
+		return nil
+	}
+
+	burst := max(1, int(math.Ceil(rps)))
+	if val := os.Getenv("BW_PROXY_RATE_BURST"); val != "" {
+		if b, err := strconv.Atoi(val); err == nil && b > 0 {
+			burst = b
+		} else {
+			proxyLog.Warn("Invalid format for BW_PROXY_RATE_BURST, using default", "value", val, "default", burst)
+		}
+	}
+
+	return &rateLimiter{
+		limit:          rate.Limit(rps),
+		burst:          burst,
+		trustedProxies: trustedProxies,
+		clients:        map[string]*clientLimiter{},
+	}
+}
+
+// proxyRateLimiter is the rate limiter of the proxy. It is kept across reloads of the
+// configuration, which only change its settings, so that clients keep their buckets
+// and a single eviction loop runs.
+var proxyRateLimiter struct {
+	sync.Mutex
+	limiter *rateLimiter
+}
+
+// sharedRateLimiter returns the rate limiter of the proxy with the settings of l. The
+// first call starts evicting idle clients; later ones update the limiter in place.
+func sharedRateLimiter(l *rateLimiter) *rateLimiter {
+	proxyRateLimiter.Lock()
+	defer proxyRateLimiter.Unlock()
+	if proxyRateLimiter.limiter == nil {
+		proxyRateLimiter.limiter = l
+		go func() {
+			for now := range time.Tick(rateLimiterIdleTimeout) {
+				l.evictIdle(now)
+			}
+		}()
+		return l
+	}
+	proxyRateLimiter.limiter.update(l)
+	return proxyRateLimiter.limiter
+}
+
+// update applies the settings of other, including to the buckets of known clients.
+func (l *rateLimiter) update(other *rateLimiter) {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+	l.limit, l.burst, l.trustedProxies = other.limit, other.burst, other.trustedProxies
+	for _, c := range l.clients {
+		c.limiter.SetLimit(l.limit)
+		c.limiter.SetBurst(l.burst)
+	}
+}
+
+// clientKey identifies the client of a request. Credentials are hashed, so that
+// they are not kept around in memory any longer than necessary.
+func (l *rateLimiter) clientKey(r *http.Request) string {
+	if auth := r.Header.Get("Authorization"); auth != "" {
+		sum := sha256.Sum256([]byte(auth))
+		return "auth:" + string(sum[:])
+	}
+	l.mu.Lock()
+	trustedProxies := l.trustedProxies
+	l.mu.Unlock()
+	return "ip:" + clientIP(r, trustedProxies).String()
+}
+
+// reserve takes a token from the bucket of the client, returning how long the
+// client has to wait if there is none left.
+func (l *rateLimiter) reserve(key string, now time.Time) time.Duration {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+
+	c, ok := l.clients[key]
+	if !ok {
+		c = &clientLimiter{limiter: rate.NewLimiter(l.limit, l.burst)}
+		l.clients[key] = c
+	}
+	c.lastSeen = now
+
+	reservation := c.limiter.ReserveN(now, 1)
+	if delay := reservation.DelayFrom(now); delay > 0 {
+		reservation.CancelAt(now)
+		return delay
+	}
+	return 0
+}
+
+// evictIdle forgets clients that have not sent a request for a while.
+func (l *rateLimiter) evictIdle(now time.Time) {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+	for key, c := range l.clients {
+		if now.Sub(c.lastSeen) > rateLimiterIdleTimeout {
+			delete(l.clients, key)
+		}
+	}
+}
+
+// middleware rejects requests of clients exceeding their rate with 429 Too Many
+// Requests, except for the health check.
+func (l *rateLimiter) middleware(next http.Handler) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if !isHealthCheckPath(r.URL.Path) {
+			if delay := l.reserve(l.clientKey(r), time.Now()); delay > 0 {
+				w.Header().Set("Retry-After", strconv.Itoa(int(math.Ceil(delay.Seconds()))))
+				http.Error(w, "Too many requests", http.StatusTooManyRequests)
+				return
+			}
+		}
+		next.ServeHTTP(w, r)
+	})
+}
@@ -0,0 +1,101 @@
+package main
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+)
+
+func TestRateLimiterReserve(t *testing.T) {
+	t.Setenv("BW_PROXY_RATE_LIMIT", "1")
+	t.Setenv("BW_PROXY_RATE_BURST", "2")
+
+	l := newRateLimiterFromEnv(nil)
+	if l == nil {
+		t.Fatal("expected a rate limiter")
+	}
+	now := time.Now()
+
+	for i := 0; i < 2; i++ {
+		if delay := l.reserve("client-a", now); delay != 0 {
+			t.Fatalf("request %d within burst delayed by %s", i, delay)
+		}
+	}
+	if delay := l.reserve("client-a", now); delay <= 0 || delay > time.Second {
+		t.Errorf("expected a delay of up to 1s after the burst, got %s", delay)
+	}
+	if delay := l.reserve("client-b", now); delay != 0 {
+		t.Errorf("other clients must not be limited, got %s", delay)
+	}
+	if delay := l.reserve("client-a", now.Add(time.Second)); delay != 0 {
+		t.Errorf("expected a token after 1s, got delay %s", delay)
+	}
+
+	l.evictIdle(now.Add(rateLimiterIdleTimeout + 2*time.Second))
+	if len(l.clients) != 0 {
+		t.Errorf("expected idle clients to be evicted, got %d", len(l.clients))
+	}
+}
+
+func TestRateLimiterMiddleware(t *testing.T) {
+	t.Setenv("BW_PROXY_RATE_LIMIT", "0.5")
+	t.Setenv("BW_PROXY_RATE_BURST", "")
+
+	handler := newRateLimiterFromEnv(nil).middleware(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.WriteHeader(http.StatusOK)
+	}))
+
+	codes := make([]int, 2)
+	for i := range codes {
+		req, _ := http.NewRequest("GET", "/list/object/items", nil)
+		req.RemoteAddr = "10.0.0.1:1234"
+		rr := httptest.NewRecorder()
+		handler.ServeHTTP(rr, req)
+		codes[i] = rr.Code
+		if rr.Code == http.StatusTooManyRequests && rr.Header().Get("Retry-After") != "2" {
+			t.Errorf("Retry-After = %q, want %q", rr.Header().Get("Retry-After"), "2")
+		}
+	}
+	if codes[0] != http.StatusOK || codes[1] != http.StatusTooManyRequests {
+		t.Errorf("got status codes %v, want [200 429]", codes)
+	}
+
+	req, _ := http.NewRequest("GET", "/healthz", nil)
+	req.RemoteAddr = "10.0.0.1:1234"
+	rr := httptest.NewRecorder()
+	handler.ServeHTTP(rr, req)
+	if rr.Code != http.StatusOK {
+		t.Errorf("health check must not be rate limited, got %v", rr.Code)
+	}
+}
+
+func TestRateLimiterDisabled(t *testing.T) {
+	t.Setenv("BW_PROXY_RATE_LIMIT", "")
+	if newRateLimiterFromEnv(nil) != nil {
+		t.Error("expected rate limiting to be disabled")
+	}
+	t.Setenv("BW_PROXY_RATE_LIMIT", "fast")
+	if newRateLimiterFromEnv(nil) != nil {
+		t.Error("expected rate limiting to be disabled for an invalid rate")
+	}
+}
+
+func TestSharedRateLimiter(t *testing.T) {
+	defer func() { proxyRateLimiter.limiter = nil }()
+	t.Setenv("BW_PROXY_RATE_LIMIT", "1")
+	t.Setenv("BW_PROXY_RATE_BURST", "1")
+	l := sharedRateLimiter(newRateLimiterFromEnv(nil))
+	now := time.Now()
+	l.reserve("client-a", now)
+
+	// A reload keeps the limiter and the bucket of the client, with the new rate.
+	t.Setenv("BW_PROXY_RATE_LIMIT", "2")
+	t.Setenv("BW_PROXY_RATE_BURST", "1")
+	if reloaded := sharedRateLimiter(newRateLimiterFromEnv(nil)); reloaded != l {
+		t.Fatal("expected the limiter to be kept across reloads")
+	}
+	if delay := l.reserve("client-a", now); delay <= 0 || delay > 500*time.Millisecond {
+		t.Errorf("expected the client to stay throttled at the new rate, got delay %s", delay)
+	}
+}
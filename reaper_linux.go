@@ -0,0 +1,96 @@
+package main
+
+import (
+	"os"
+	"os/signal"
+	"path/filepath"
+	"strconv"
+	"strings"
+	"syscall"
+	"time"
+
+	"golang.org/x/sys/unix"
+)
+
+// reapGracePeriod is how long a zombie child has to be left alone before it is reaped.
+// Processes started by the wrapper itself are waited for right away, so only orphans
+// re-parented to the wrapper remain zombies for longer.
+const reapGracePeriod = 10 * time.Second
+
+// startReaper reaps orphaned processes when the wrapper runs as PID 1 of a container,
+// where it inherits every process whose parent exited, e.g. helpers spawned by the bw
+// CLI. Without it, they would accumulate as zombies over weeks of uptime. It can be
+// disabled with BW_REAP_ZOMBIES=false, e.g. when running under an init such as tini.
+func startReaper() {
+	if os.Getpid() != 1 || getEnv("BW_REAP_ZOMBIES", "true") == "false" {
+		return
+	}
+	sigchld := make(chan os.Signal, 1)
+	signal.Notify(sigchld, syscall.SIGCHLD)
+	go func() {
+		ticker := time.NewTicker(reapGracePeriod)
+		defer ticker.Stop()
+		seen := map[int]time.Time{}
+		for {
+			select {
+			case <-sigchld:
+			case <-ticker.C:
+			}
+			reapOrphans(seen)
+		}
+	}()
+}
+
+// reapOrphans reaps the zombie children that have been zombies for longer than
+// reapGracePeriod, leaving children the wrapper is about to wait for to os/exec.
+func reapOrphans(seen map[int]time.Time) {
+	zombies := zombieChildren("/proc", os.Getpid())
+	for pid, since := range seen {
+		if !zombies[pid] {
+			delete(seen, pid)
+		} else if time.Since(since) >= reapGracePeriod {
+			var status unix.WaitStatus
+			if _, err := unix.Wait4(pid, &status, unix.WNOHANG, nil); err == nil {
+				mainLog.Debug("Reaped orphaned process", "pid", pid)
+			}
+			delete(seen, pid)
+		}
+	}
+	for pid := range zombies {
+		if _, ok := seen[pid]; !ok {
+			seen[pid] = time.Now()
+		}
+	}
+}
+
+// zombieChildren returns the processes in procDir that are zombies and children of parent.
+func zombieChildren(procDir string, parent int) map[int]bool {
+	zombies := map[int]bool{}
+	entries, err := os.ReadDir(procDir)
+	if err != nil {
+		return zombies
+	}
+	for _, entry := range entries {
+		pid, err := strconv.Atoi(entry.Name())
+		if err != nil {
+			continue
+		}
+		stat, err := os.ReadFile(filepath.Join(procDir, entry.Name(), "stat"))
+		if err != nil {
+			continue
+		}
+		// The command name may contain spaces and parentheses, the fields after it don't.
+		i := strings.LastIndexByte(string(stat), ')')
+		if i < 0 {
+			continue
+		}
+		fields := strings.Fields(string(stat[i+1:]))
+		if len(fields) < 2 || fields[0] != "Z" {
+			continue
+		}
+		if ppid, err := strconv.Atoi(fields[1]); err == nil && ppid == parent {
+			zombies[pid] = true
+		}
+	}
+	return zombies
+}
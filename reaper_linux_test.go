@@ -0,0 +1,30 @@
+package main
+
+import (
+	"os"
+	"path/filepath"
+	"testing"
+)
+
+func TestZombieChildren(t *testing.T) {
+	proc := t.TempDir()
+	for pid, stat := range map[string]string{
+		"10":   "10 (bw) S 1 10 10 0 -1",
+		"11":   "11 (node) Z 1 11 11 0 -1",
+		"12":   "12 (my (odd) name) Z 1 12 12 0 -1",
+		"13":   "13 (sh) Z 10 13 13 0 -1",
+		"self": "1 (entrypoint) S 0 1 1 0 -1",
+	} {
+		if err := os.MkdirAll(filepath.Join(proc, pid), 0o700); err != nil {
+			t.Fatal(err)
+		}
+		if err := os.WriteFile(filepath.Join(proc, pid, "stat"), []byte(stat), 0o600); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	got := zombieChildren(proc, 1)
+	if len(got) != 2 || !got[11] || !got[12] {
+		t.Errorf("zombieChildren() = %v, want 11 and 12", got)
+	}
+}
@@ -0,0 +1,6 @@
+//go:build !linux
+
+package main
+
+// startReaper is only implemented on Linux.
+func startReaper() {}
@@ -0,0 +1,121 @@
+package main
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"net"
+	"os"
+	"strconv"
+	"time"
+)
+
+// minBwServeRecycleInterval keeps a misconfigured BW_SERVE_RECYCLE_INTERVAL from
+// recycling 'bw serve' before the previous process could even start.
+const minBwServeRecycleInterval = 1 * time.Minute
+
+// bwServeRecycleIntervalFromEnv reads BW_SERVE_RECYCLE_INTERVAL. Zero disables recycling.
+func bwServeRecycleIntervalFromEnv() time.Duration {
+	val := os.Getenv("BW_SERVE_RECYCLE_INTERVAL")
+	if val == "" {
+		return 0
+	}
+	d, err := time.ParseDuration(val)
+	if err != nil || d < 0 {
+		serveLog.Warn("Invalid format for BW_SERVE_RECYCLE_INTERVAL, recycling is disabled", "value", val, "error", err)
+		return 0
+	}
+	if d > 0 && d < minBwServeRecycleInterval {
+		serveLog.Warn("BW_SERVE_RECYCLE_INTERVAL is too short, using the minimum", "value", val, "minimum", minBwServeRecycleInterval)
+		return minBwServeRecycleInterval
+	}
+	return d
+}
+
+// startRecycling replaces 'bw serve' with a fresh process every
+// BW_SERVE_RECYCLE_INTERVAL, to reclaim the memory it leaks over long uptimes. It
+// runs until ctx is done.
+func startRecycling(ctx context.Context) {
+	interval := bwServeRecycleIntervalFromEnv()
+	if interval == 0 {
+		return
+	}
+	serveLog.Info("Recycling 'bw serve' periodically", "interval", interval)
+	ticker := time.NewTicker(interval)
+	defer ticker.Stop()
+	for {
+		select {
+		case <-ctx.Done():
+			return
+		case <-ticker.C:
+			if err := bwServe.recycle(); err != nil {
+				serveLog.Error("Failed to recycle 'bw serve', keeping the running process", "error", err)
+			}
+		}
+	}
+}
+
+// recycle starts a new 'bw serve' on a free port next to the running one, switches
+// the proxy over once it is ready, and then terminates the old process after the
+// requests still in flight to it have completed. Clients see no failed requests.
+func (p *bwServeProcess) recycle() error {
+	// Keeps re-unlocks and relogins from restarting the process at the same time.
+	reunlockMu.Lock()
+	defer reunlockMu.Unlock()
+	if bwServeRecovering.Load() {
+		return errors.New("'bw serve' is recovering from a crash")
+	}
+
+	port, err := freeLoopbackPort()
+	if err != nil {
+		return fmt.Errorf("failed to find a free port: %w", err)
+	}
+	session := os.Getenv("BW_SESSION")
+
+	p.mu.Lock()
+	if p.cmd == nil || shuttingDown.Load() {
+		p.mu.Unlock()
+		return errors.New("'bw serve' is not running")
+	}
+	oldCmd, oldDone, oldPort := p.cmd, p.done, p.port
+	cmd, done, err := p.spawn(port, session)
+	p.mu.Unlock()
+	if err != nil {
+		return err
+	}
+
+	if err := waitForBwServe(port, session != ""); err != nil {
+		terminate(cmd, done)
+		return err
+	}
+
+	p.mu.Lock()
+	if p.cmd != oldCmd || shuttingDown.Load() {
+		// Stopped or restarted after a crash in the meantime.
+		p.mu.Unlock()
+		terminate(cmd, done)
+		return errors.New("'bw serve' changed while recycling")
+	}
+	p.cmd, p.done, p.port = cmd, done, port
+	p.mu.Unlock()
+
+	// New requests are proxied to the new process. Closing the gate waits for those
+	// still running against the old one.
+	sessionGate.close()
+	sessionGate.open()
+	terminate(oldCmd, oldDone)
+
+	serveLog.Info("Recycled 'bw serve'", "old_port", oldPort, "port", port)
+	recordEvent(eventServeRecycled, "Recycled 'bw serve'", nil)
+	return nil
+}
+
+// freeLoopbackPort returns a port on the loopback interface that is currently free.
+func freeLoopbackPort() (string, error) {
+	l, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		return "", err
+	}
+	defer l.Close()
+	return strconv.Itoa(l.Addr().(*net.TCPAddr).Port), nil
+}
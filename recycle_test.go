@@ -0,0 +1,94 @@
+package main
+
+import (
+	"net/http"
+	"os/exec"
+	"testing"
+	"time"
+)
+
+func TestBwServeRecycleIntervalFromEnv(t *testing.T) {
+	for val, want := range map[string]time.Duration{
+		"":        0,
+		"24h":     24 * time.Hour,
+		"1s":      minBwServeRecycleInterval,
+		"invalid": 0,
+		"-1h":     0,
+	} {
+		t.Setenv("BW_SERVE_RECYCLE_INTERVAL", val)
+		if got := bwServeRecycleIntervalFromEnv(); got != want {
+			t.Errorf("%q: got %v want %v", val, got, want)
+		}
+	}
+}
+
+func TestRecycle(t *testing.T) {
+	execCommand = mockExecCommandEnv("MOCK_BW_SERVE_LISTEN=1")
+	defer func() { execCommand = exec.CommandContext }()
+	t.Setenv("BW_SESSION", "test-session")
+	t.Setenv("BW_SERVE_WAIT_INTERVAL", "10ms")
+
+	port, err := freeLoopbackPort()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err := bwServe.start(port, "test-session"); err != nil {
+		t.Fatalf("start failed: %v", err)
+	}
+	defer bwServe.stop()
+	if err := waitForBwServe(port, true); err != nil {
+		t.Fatal(err)
+	}
+	oldCmd, oldDone := bwServe.cmd, bwServe.done
+
+	if err := bwServe.recycle(); err != nil {
+		t.Fatalf("recycle failed: %v", err)
+	}
+	newPort := bwServe.currentPort()
+	if newPort == port {
+		t.Fatal("'bw serve' was not moved to another port")
+	}
+	if got := activeServePort(port); got != newPort {
+		t.Errorf("proxy target port = %s want %s", got, newPort)
+	}
+	select {
+	case <-oldDone:
+	default:
+		t.Error("old 'bw serve' is still running")
+	}
+	if bwServe.cmd == oldCmd || !containsArgs(bwServe.cmd.Args, "--session", "test-session") {
+		t.Errorf("'bw serve' args = %v, want a new process with the session", bwServe.cmd.Args)
+	}
+	resp, err := http.Get(bwServeURL(port, "/status"))
+	if err != nil {
+		t.Fatalf("new 'bw serve' is not reachable: %v", err)
+	}
+	_ = resp.Body.Close()
+
+	// The lock watcher follows 'bw serve' to its new port.
+	if err := checkVaultLock(&http.Client{Timeout: time.Second}, port); err != nil {
+		t.Errorf("lock check after recycle failed: %v", err)
+	}
+}
+
+func TestRecycle_NotReady(t *testing.T) {
+	// The new process never answers, so the running one is kept.
+	execCommand = mockExecCommand
+	defer func() { execCommand = exec.CommandContext }()
+	t.Setenv("BW_SESSION", "")
+	t.Setenv("BW_SERVE_WAIT_RETRIES", "2")
+	t.Setenv("BW_SERVE_WAIT_INTERVAL", "10ms")
+
+	if err := bwServe.start("18099", ""); err != nil {
+		t.Fatalf("start failed: %v", err)
+	}
+	defer bwServe.stop()
+	oldCmd := bwServe.cmd
+
+	if err := bwServe.recycle(); err == nil {
+		t.Fatal("expected recycle to fail")
+	}
+	if bwServe.cmd != oldCmd || bwServe.currentPort() != "18099" {
+		t.Error("the running 'bw serve' was replaced")
+	}
+}
@@ -0,0 +1,92 @@
+package main
+
+import (
+	"encoding/json"
+	"net/http"
+	"strings"
+)
+
+// redactedLoginFields are the secrets removed from the login of an item.
+var redactedLoginFields = []string{"password", "totp"}
+
+// redactedItemFields are the item members removed entirely, as they may hold secrets.
+var redactedItemFields = []string{"notes", "fields"}
+
+// responseRedactor strips secrets from item responses, so that dashboards and
+// discovery tools listing the vault don't expose them by accident.
+type responseRedactor struct {
+	revealTokens []string
+}
+
+// responseRedactorFromEnv returns the redactor if BW_REDACT is set. Requests with
+// one of the bearer tokens in BW_REDACT_REVEAL_TOKENS are never redacted.
+func responseRedactorFromEnv() (*responseRedactor, error) {
+	if getEnv("BW_REDACT", "false") != "true" {
+		return nil, nil
+	}
+	tokens, err := getSecret("BW_REDACT_REVEAL_TOKENS")
+	if err != nil {
+		return nil, err
+	}
+	return &responseRedactor{revealTokens: splitList(strings.ReplaceAll(tokens, "\n", ","))}, nil
+}
+
+// reveals reports whether a request asked for, and may see, the secrets.
+func (d *responseRedactor) reveals(r *http.Request) bool {
+	if r.URL.Query().Get("reveal") == "true" {
+		return true
+	}
+	token, ok := strings.CutPrefix(r.Header.Get("Authorization"), "Bearer ")
+	return ok && len(d.revealTokens) > 0 && matchesAnyToken(token, d.revealTokens)
+}
+
+// middleware redacts item lists and individual items unless the request reveals them.
+func (d *responseRedactor) middleware(next http.Handler) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.Method != http.MethodGet || d.reveals(r) {
+			next.ServeHTTP(w, r)
+			return
+		}
+		switch {
+		case r.URL.Path == "/list/object/items":
+			rewriteResponseData(w, r, next, func(data json.RawMessage) (json.RawMessage, error) {
+				return rewriteListEntries(data, func(entry json.RawMessage) (json.RawMessage, bool) {
+					redacted, err := redactItem(entry)
+					// Drop entries that cannot be redacted rather than exposing them.
+					return redacted, err == nil
+				})
+			})
+		case strings.HasPrefix(r.URL.Path, "/object/item/"):
+			rewriteResponseData(w, r, next, redactItem)
+		default:
+			next.ServeHTTP(w, r)
+		}
+	})
+}
+
+// redactItem removes the secrets from an item.
+func redactItem(raw json.RawMessage) (json.RawMessage, error) {
+	var item map[string]json.RawMessage
+	if err := json.Unmarshal(raw, &item); err != nil {
+		return nil, err
+	}
+	for _, field := range redactedItemFields {
+		if _, ok := item[field]; ok {
+			item[field] = json.RawMessage("null")
+		}
+	}
+
+	if login, ok := item["login"]; ok && string(login) != "null" {
+		var fields map[string]json.RawMessage
+		if err := json.Unmarshal(login, &fields); err != nil {
+			return nil, err
+		}
+		for _, field := range redactedLoginFields {
+			if _, ok := fields[field]; ok {
+				fields[field] = json.RawMessage("null")
+			}
+		}
+		item["login"], _ = json.Marshal(fields)
+	}
+	return json.Marshal(item)
+}
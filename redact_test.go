@@ -0,0 +1,60 @@
+package main
+
+import (
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+)
+
+func TestRedactItem(t *testing.T) {
+	raw := json.RawMessage(`{"id":"item-1","name":"db","notes":"secret notes","fields":[{"name":"api","value":"key"}],"login":{"username":"admin","password":"hunter2","totp":"JBSWY3DPEHPK3PXP"}}`)
+
+	redacted, err := redactItem(raw)
+	if err != nil {
+		t.Fatalf("expected nil, got %v", err)
+	}
+	for _, secret := range []string{"secret notes", "key", "hunter2", "JBSWY3DPEHPK3PXP"} {
+		if strings.Contains(string(redacted), secret) {
+			t.Errorf("redacted item still contains %q: %s", secret, redacted)
+		}
+	}
+	for _, kept := range []string{"item-1", "db", "admin"} {
+		if !strings.Contains(string(redacted), kept) {
+			t.Errorf("redacted item lost %q: %s", kept, redacted)
+		}
+	}
+}
+
+func TestRedaction(t *testing.T) {
+	t.Setenv("BW_REDACT", "true")
+	t.Setenv("BW_REDACT_REVEAL_TOKENS", "reveal-token")
+	router := newScopeTestRouter(t)
+
+	tests := []struct {
+		path   string
+		token  string
+		reveal bool
+	}{
+		{"/list/object/items", "", false},
+		{"/object/item/item-a", "", false},
+		{"/list/object/items?reveal=true", "", true},
+		{"/object/item/item-a", "reveal-token", true},
+		{"/object/item/item-a", "other-token", false},
+	}
+	for _, tt := range tests {
+		req, _ := http.NewRequest("GET", tt.path, nil)
+		if tt.token != "" {
+			req.Header.Set("Authorization", "Bearer "+tt.token)
+		}
+		rr := httptest.NewRecorder()
+		router.ServeHTTP(rr, req)
+		if rr.Code != http.StatusOK {
+			t.Fatalf("%s: got status %v want %v", tt.path, rr.Code, http.StatusOK)
+		}
+		if got := strings.Contains(rr.Body.String(), `"password":"a"`); got != tt.reveal {
+			t.Errorf("%s with token %q: password revealed = %v, want %v: %s", tt.path, tt.token, got, tt.reveal, rr.Body.String())
+		}
+	}
+}
@@ -0,0 +1,113 @@
+package main
+
+import (
+	"bufio"
+	"bytes"
+	"fmt"
+	"os"
+	"os/signal"
+	"slices"
+	"strings"
+	"sync"
+	"syscall"
+)
+
+// reloadHooks are run on SIGHUP to apply the settings that can change at runtime.
+var (
+	reloadMu    sync.Mutex
+	reloadHooks []func()
+)
+
+// onReload registers a hook applying settings when the configuration is reloaded.
+func onReload(hook func()) {
+	reloadMu.Lock()
+	defer reloadMu.Unlock()
+	reloadHooks = append(reloadHooks, hook)
+}
+
+// watchReloadSignal reloads the configuration whenever SIGHUP is received, which
+// would otherwise terminate the process.
+func watchReloadSignal() {
+	ch := make(chan os.Signal, 1)
+	signal.Notify(ch, syscall.SIGHUP)
+	go func() {
+		for range ch {
+			reloadConfig()
+		}
+	}()
+}
+
+// reloadConfig reads BW_CONFIG_FILE again and applies the reloadable settings: the
+// log level, the sync interval, the access controls and credentials of the proxy,
+// and the TLS certificate. 'bw serve' and the session are left untouched.
+func reloadConfig() {
+	mainLog.Info("Reloading configuration")
+	if err := loadConfigFile(); err != nil {
+		mainLog.Warn("Failed to reload BW_CONFIG_FILE, keeping the current configuration", "error", err)
+		return
+	}
+	applyLogLevel(mainLog)
+
+	reloadMu.Lock()
+	hooks := slices.Clone(reloadHooks)
+	reloadMu.Unlock()
+	for _, hook := range hooks {
+		hook()
+	}
+	mainLog.Info("Configuration reloaded")
+}
+
+// loadConfigFile reads the settings in BW_CONFIG_FILE, if set, overriding those in the
+// environment. Credentials are kept in memory rather than in the environment.
+func loadConfigFile() error {
+	path := os.Getenv("BW_CONFIG_FILE")
+	if path == "" {
+		return nil
+	}
+	content, err := os.ReadFile(path)
+	if err != nil {
+		return fmt.Errorf("failed to read BW_CONFIG_FILE '%s': %v", path, err)
+	}
+	settings, err := parseConfigFile(content)
+	if err != nil {
+		return fmt.Errorf("invalid BW_CONFIG_FILE '%s': %v", path, err)
+	}
+	for key, value := range settings {
+		if slices.Contains(scrubbedVariables, key) {
+			storeSecret(key, value)
+			registerSecret(value)
+			continue
+		}
+		if err := os.Setenv(key, value); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// parseConfigFile parses KEY=VALUE lines, as in a Docker env file. Empty lines and
+// lines starting with '#' are ignored, and values may be quoted.
+func parseConfigFile(content []byte) (map[string]string, error) {
+	settings := map[string]string{}
+	scanner := bufio.NewScanner(bytes.NewReader(content))
+	for n := 1; scanner.Scan(); n++ {
+		line := strings.TrimSpace(scanner.Text())
+		if line == "" || strings.HasPrefix(line, "#") {
+			continue
+		}
+		key, value, ok := strings.Cut(strings.TrimPrefix(line, "export "), "=")
+		key = strings.TrimSpace(key)
+		if !ok || key == "" || strings.ContainsAny(key, " \t") {
+			return nil, fmt.Errorf("line %d: expected KEY=VALUE", n)
+		}
+		value = strings.TrimSpace(value)
+		if len(value) >= 2 && (value[0] == '"' || value[0] == '\'') && value[len(value)-1] == value[0] {
+			value = value[1 : len(value)-1]
+		}
+		if key == "BW_CONFIG_FILE" {
+			return nil, fmt.Errorf("line %d: BW_CONFIG_FILE cannot be set in the file itself", n)
+		}
+		settings[key] = value
+	}
+	return settings, scanner.Err()
+}
@@ -0,0 +1,107 @@
+package main
+
+import (
+	"log/slog"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"testing"
+)
+
+func TestParseConfigFile(t *testing.T) {
+	settings, err := parseConfigFile([]byte(`
+# Proxy settings
+BW_PROXY_ALLOW_CIDRS=10.0.0.0/8, 192.168.0.0/16
+export BW_LOG_LEVEL=debug
+BW_SYNC_INTERVAL="5m"
+BW_PROXY_BASIC_USER='admin'
+EMPTY=
+`))
+	if err != nil {
+		t.Fatal(err)
+	}
+	want := map[string]string{
+		"BW_PROXY_ALLOW_CIDRS": "10.0.0.0/8, 192.168.0.0/16",
+		"BW_LOG_LEVEL":         "debug",
+		"BW_SYNC_INTERVAL":     "5m",
+		"BW_PROXY_BASIC_USER":  "admin",
+		"EMPTY":                "",
+	}
+	if len(settings) != len(want) {
+		t.Fatalf("got %v want %v", settings, want)
+	}
+	for k, v := range want {
+		if settings[k] != v {
+			t.Errorf("%s: got %q want %q", k, settings[k], v)
+		}
+	}
+
+	for _, content := range []string{"NOVALUE", "=value", "BAD KEY=1", "BW_CONFIG_FILE=/other"} {
+		if _, err := parseConfigFile([]byte(content)); err == nil {
+			t.Errorf("%q: expected an error", content)
+		}
+	}
+}
+
+func TestReloadConfig(t *testing.T) {
+	defer logLevel.Set(slog.LevelInfo)
+	defer func() { reloadHooks = nil }()
+	path := filepath.Join(t.TempDir(), "config.env")
+	t.Setenv("BW_CONFIG_FILE", path)
+	t.Setenv("BW_LOG_LEVEL", "")
+	t.Setenv("BW_PROXY_ALLOW_CIDRS", "")
+	t.Setenv("BW_PROXY_AUTH_TOKEN", "")
+	t.Setenv("BW_PROXY_AUTH_TOKEN_FILE", "")
+	defer storeSecret("BW_PROXY_AUTH_TOKEN", "")
+
+	write := func(content string) {
+		t.Helper()
+		if err := os.WriteFile(path, []byte(content), 0o600); err != nil {
+			t.Fatal(err)
+		}
+	}
+	write("BW_PROXY_ALLOW_CIDRS=10.0.0.0/8\n")
+	if err := loadConfigFile(); err != nil {
+		t.Fatal(err)
+	}
+
+	handler, err := reloadableMiddleware(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		_, _ = w.Write([]byte("OK"))
+	}))
+	if err != nil {
+		t.Fatal(err)
+	}
+	check := func(header string, want int) {
+		t.Helper()
+		req := httptest.NewRequest("GET", "/list/object/items", nil)
+		req.RemoteAddr = "192.168.1.1:1234"
+		if header != "" {
+			req.Header.Set("Authorization", header)
+		}
+		rr := httptest.NewRecorder()
+		handler.ServeHTTP(rr, req)
+		if rr.Code != want {
+			t.Errorf("got status %v want %v", rr.Code, want)
+		}
+	}
+	check("", http.StatusForbidden)
+
+	// The new allowlist, token and log level take effect on reload.
+	write("BW_PROXY_ALLOW_CIDRS=192.168.0.0/16\nBW_PROXY_AUTH_TOKEN=reloaded-token\nBW_LOG_LEVEL=debug\n")
+	reloadConfig()
+	check("", http.StatusUnauthorized)
+	check("Bearer reloaded-token", http.StatusOK)
+	if logLevel.Level() != slog.LevelDebug {
+		t.Errorf("got log level %v want debug", logLevel.Level())
+	}
+	// Credentials are not put into the environment inherited by 'bw serve'.
+	if os.Getenv("BW_PROXY_AUTH_TOKEN") != "" {
+		t.Error("BW_PROXY_AUTH_TOKEN was added to the environment")
+	}
+
+	// An invalid configuration keeps the previous one.
+	write("BW_PROXY_ALLOW_CIDRS=invalid\n")
+	reloadConfig()
+	check("Bearer reloaded-token", http.StatusOK)
+}
@@ -0,0 +1,153 @@
+package main
+
+import (
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"net/url"
+	"runtime/debug"
+	"strings"
+	"time"
+)
+
+// errorReport is the payload posted to BW_ERROR_WEBHOOK for errors the wrapper
+// cannot recover from on its own.
+type errorReport struct {
+	Event    string    `json:"event"`
+	Instance string    `json:"instance"`
+	Version  string    `json:"version"`
+	Time     time.Time `json:"time"`
+	Message  string    `json:"message"`
+	Stack    string    `json:"stack,omitempty"`
+}
+
+// errorReportingEnabled reports whether errors are sent to Sentry or a webhook.
+func errorReportingEnabled() bool {
+	dsn, _ := getSecret("SENTRY_DSN")
+	webhook, _ := getSecret("BW_ERROR_WEBHOOK")
+	return dsn != "" || webhook != ""
+}
+
+// reportError sends an error to SENTRY_DSN and BW_ERROR_WEBHOOK, if configured. Known
+// secrets are removed from the message and stack first, as reports leave the container.
+// It blocks until the report is sent, so it can be called right before exiting.
+func reportError(event, message, stack string) {
+	if !errorReportingEnabled() {
+		return
+	}
+	report := errorReport{
+		Event:    event,
+		Instance: instanceName(),
+		Version:  currentVersion().Version,
+		Time:     time.Now().UTC(),
+		Message:  scrubSecrets(message),
+		Stack:    scrubSecrets(stack),
+	}
+	if dsn, _ := getSecret("SENTRY_DSN"); dsn != "" {
+		if err := sendSentryEvent(dsn, report); err != nil {
+			mainLog.Warn("Failed to report error to Sentry", "error", err)
+		}
+	}
+	if webhook, _ := getSecret("BW_ERROR_WEBHOOK"); webhook != "" {
+		if err := postWebhook(webhook, report); err != nil {
+			mainLog.Warn("Failed to report error to BW_ERROR_WEBHOOK", "error", err)
+		}
+	}
+}
+
+// sendSentryEvent sends report to the store endpoint of the project in a Sentry DSN
+// of the form https://<key>@<host>/<project>.
+func sendSentryEvent(dsn string, report errorReport) error {
+	u, err := url.Parse(dsn)
+	if err != nil || u.User == nil || u.Host == "" {
+		return fmt.Errorf("invalid SENTRY_DSN")
+	}
+	project := strings.Trim(u.Path, "/")
+	if project == "" {
+		return fmt.Errorf("invalid SENTRY_DSN: missing project id")
+	}
+	endpoint := url.URL{Scheme: u.Scheme, Host: u.Host, Path: "/api/" + project + "/store/"}
+
+	event := map[string]any{
+		"event_id":    newRequestID(),
+		"timestamp":   report.Time.Format(time.RFC3339),
+		"level":       "fatal",
+		"logger":      "bw-cli-docker",
+		"platform":    "go",
+		"server_name": report.Instance,
+		"release":     report.Version,
+		"message":     map[string]string{"formatted": report.Message},
+		"tags":        map[string]string{"event": report.Event},
+	}
+	if report.Stack != "" {
+		event["extra"] = map[string]string{"stack": report.Stack}
+	}
+	body, err := json.Marshal(event)
+	if err != nil {
+		return err
+	}
+
+	req, err := http.NewRequest(http.MethodPost, endpoint.String(), bytes.NewReader(body))
+	if err != nil {
+		return err
+	}
+	req.Header.Set("Content-Type", "application/json")
+	req.Header.Set("X-Sentry-Auth", "Sentry sentry_version=7, sentry_client=bw-cli-docker/"+report.Version+", sentry_key="+u.User.Username())
+	client := &http.Client{Timeout: webhookTimeout}
+	resp, err := client.Do(req)
+	if err != nil {
+		return err
+	}
+	defer func() { _ = resp.Body.Close() }()
+	if resp.StatusCode < 200 || resp.StatusCode > 299 {
+		return fmt.Errorf("sentry returned status %d", resp.StatusCode)
+	}
+	return nil
+}
+
+// panicResponse is the body of the response to a request whose handler panicked, in
+// the format of the errors of 'bw serve'.
+type panicResponse struct {
+	Success bool   `json:"success"`
+	Message string `json:"message"`
+}
+
+// recoverPanics recovers from panics in handlers, logs and reports them with their
+// stack, and answers the request with a 500 JSON error. If the response was already
+// started, the connection is aborted instead, so that the client does not mistake a
+// truncated response for a complete one.
+func recoverPanics(next http.Handler) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		rec := &statusRecorder{ResponseWriter: w}
+		defer func() {
+			p := recover()
+			if p == nil {
+				return
+			}
+			if p == http.ErrAbortHandler {
+				panic(p)
+			}
+			stack := string(debug.Stack())
+			proxyLog.Error("Panic serving request", "request_id", requestID(r), "method", r.Method, "path", r.URL.Path, "panic", p, "stack", stack)
+			reportError("panic", fmt.Sprintf("panic serving %s %s: %v", r.Method, r.URL.Path, p), stack)
+			if rec.status != 0 || rec.bytes != 0 {
+				panic(http.ErrAbortHandler)
+			}
+			w.Header().Set("Content-Type", "application/json")
+			w.WriteHeader(http.StatusInternalServerError)
+			_ = json.NewEncoder(w).Encode(panicResponse{Message: fmt.Sprintf("Internal server error (request ID: %s)", requestID(r))})
+		}()
+		next.ServeHTTP(rec, r)
+	})
+}
+
+// formatLogArgs renders slog key-value pairs as "key=value" for an error report.
+func formatLogArgs(msg string, args ...any) string {
+	var b strings.Builder
+	b.WriteString(msg)
+	for i := 0; i+1 < len(args); i += 2 {
+		fmt.Fprintf(&b, " %v=%v", args[i], args[i+1])
+	}
+	return b.String()
+}
@@ -0,0 +1,91 @@
+package main
+
+import (
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+)
+
+func TestReportError(t *testing.T) {
+	var report errorReport
+	webhook := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if err := json.NewDecoder(r.Body).Decode(&report); err != nil {
+			t.Errorf("expected JSON report: %v", err)
+		}
+	}))
+	defer webhook.Close()
+
+	var sentryAuth string
+	var event map[string]any
+	sentry := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.URL.Path != "/api/42/store/" {
+			t.Errorf("unexpected Sentry path %q", r.URL.Path)
+		}
+		sentryAuth = r.Header.Get("X-Sentry-Auth")
+		if err := json.NewDecoder(r.Body).Decode(&event); err != nil {
+			t.Errorf("expected JSON event: %v", err)
+		}
+	}))
+	defer sentry.Close()
+
+	t.Setenv("BW_ERROR_WEBHOOK", webhook.URL)
+	t.Setenv("SENTRY_DSN", strings.Replace(sentry.URL, "http://", "http://public-key@", 1)+"/42")
+	t.Setenv("BW_PASSWORD", "test-password")
+	t.Setenv("BW_SESSION", "test-session-token")
+
+	reportError("fatal", formatLogArgs("Failed to unlock", "error", "bad password test-password", "session", "test-session-token"), "")
+
+	want := "Failed to unlock error=bad password [REDACTED] session=[REDACTED]"
+	if report.Event != "fatal" || report.Message != want {
+		t.Errorf("webhook report = %+v, want message %q", report, want)
+	}
+	if !strings.Contains(sentryAuth, "sentry_key=public-key") {
+		t.Errorf("X-Sentry-Auth = %q, want the key of the DSN", sentryAuth)
+	}
+	if msg, _ := event["message"].(map[string]any); msg["formatted"] != want {
+		t.Errorf("Sentry message = %v, want %q", event["message"], want)
+	}
+}
+
+func TestRecoverPanics(t *testing.T) {
+	reports := make(chan errorReport, 1)
+	webhook := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		var report errorReport
+		_ = json.NewDecoder(r.Body).Decode(&report)
+		reports <- report
+	}))
+	defer webhook.Close()
+	t.Setenv("BW_ERROR_WEBHOOK", webhook.URL)
+
+	handler := recoverPanics(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		panic("boom")
+	}))
+	rr := httptest.NewRecorder()
+	handler.ServeHTTP(rr, httptest.NewRequest("GET", "/list/object/items", nil))
+	var resp panicResponse
+	if err := json.NewDecoder(rr.Body).Decode(&resp); err != nil || rr.Code != http.StatusInternalServerError || resp.Success {
+		t.Errorf("got %v %+v, want a 500 JSON error: %v", rr.Code, resp, err)
+	}
+
+	report := <-reports
+	if report.Event != "panic" || !strings.Contains(report.Message, "GET /list/object/items: boom") || report.Stack == "" {
+		t.Errorf("unexpected report: %+v", report)
+	}
+
+	// A response that was already started is aborted.
+	handler = recoverPanics(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		_, _ = w.Write([]byte("partial"))
+		panic("boom")
+	}))
+	func() {
+		defer func() {
+			if p := recover(); p != http.ErrAbortHandler {
+				t.Errorf("expected the handler to be aborted, got %v", p)
+			}
+		}()
+		handler.ServeHTTP(httptest.NewRecorder(), httptest.NewRequest("GET", "/list/object/items", nil))
+	}()
+	<-reports
+}
@@ -0,0 +1,54 @@
+package main
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"testing"
+)
+
+func TestWithRequestID(t *testing.T) {
+	var forwarded, fromContext string
+	handler := withRequestID(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		forwarded = r.Header.Get(requestIDHeader)
+		fromContext = requestID(r)
+	}))
+
+	req, _ := http.NewRequest("GET", "/list/object/items", nil)
+	rr := httptest.NewRecorder()
+	handler.ServeHTTP(rr, req)
+	id := rr.Header().Get(requestIDHeader)
+	if len(id) != 32 || forwarded != id || fromContext != id {
+		t.Errorf("expected a generated id in the response, request and context, got %q, %q, %q", id, forwarded, fromContext)
+	}
+
+	req, _ = http.NewRequest("GET", "/list/object/items", nil)
+	req.Header.Set(requestIDHeader, "client-id-1")
+	rr = httptest.NewRecorder()
+	handler.ServeHTTP(rr, req)
+	if got := rr.Header().Get(requestIDHeader); got != "client-id-1" || forwarded != "client-id-1" {
+		t.Errorf("expected the client id to be kept, got %q, forwarded %q", got, forwarded)
+	}
+
+	req, _ = http.NewRequest("GET", "/list/object/items", nil)
+	req.Header.Set(requestIDHeader, "bad id\x00")
+	rr = httptest.NewRecorder()
+	handler.ServeHTTP(rr, req)
+	if got := rr.Header().Get(requestIDHeader); got == "bad id\x00" || len(got) != 32 {
+		t.Errorf("expected an invalid client id to be replaced, got %q", got)
+	}
+}
+
+func TestRequestIDOnRejectedRequests(t *testing.T) {
+	t.Setenv("BW_PROXY_AUTH_TOKEN", "token-a")
+
+	handler, err := proxyMiddleware(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {}))
+	if err != nil {
+		t.Fatalf("expected nil, got %v", err)
+	}
+	req, _ := http.NewRequest("GET", "/list/object/items", nil)
+	rr := httptest.NewRecorder()
+	handler.ServeHTTP(rr, req)
+	if rr.Code != http.StatusUnauthorized || rr.Header().Get(requestIDHeader) == "" {
+		t.Errorf("expected a request id on the 401 response, got %v %q", rr.Code, rr.Header().Get(requestIDHeader))
+	}
+}
@@ -0,0 +1,178 @@
+package main
+
+import (
+	"bytes"
+	"net/http"
+	"os"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/prometheus/client_golang/prometheus"
+	"github.com/prometheus/client_golang/prometheus/promauto"
+)
+
+const defaultCacheMaxEntries = 1000
+
+var cacheRequestsTotal = promauto.NewCounterVec(prometheus.CounterOpts{
+	Name: "bw_proxy_cache_requests_total",
+	Help: "Reads answered from the response cache (hit) or by 'bw serve' (miss).",
+}, []string{"result"})
+
+// cacheEntry is a cached response and when it expires.
+type cacheEntry struct {
+	header  http.Header
+	body    []byte
+	stored  time.Time
+	expires time.Time
+}
+
+// ttlCache answers repeated reads of items, lists of items and TOTP codes from memory
+// for a short time, sparing a round trip through 'bw serve', which is slow for
+// applications fetching the same secret on every request. The responses hold secrets,
+// so they are only kept in memory.
+type ttlCache struct {
+	mu         sync.Mutex
+	entries    map[string]*cacheEntry
+	ttl        time.Duration
+	maxEntries int
+}
+
+// ttlCacheFromEnv returns the cache if BW_CACHE_TTL is set.
+func ttlCacheFromEnv() *ttlCache {
+	val := os.Getenv("BW_CACHE_TTL")
+	if val == "" {
+		return nil
+	}
+	ttl, err := time.ParseDuration(val)
+	if err != nil || ttl <= 0 {
+		proxyLog.Warn("Invalid format for BW_CACHE_TTL, not caching responses", "value", val, "error", err)
+		return nil
+	}
+	c := &ttlCache{entries: make(map[string]*cacheEntry), ttl: ttl, maxEntries: defaultCacheMaxEntries}
+	if val := os.Getenv("BW_CACHE_MAX_ENTRIES"); val != "" {
+		n, err := strconv.Atoi(val)
+		if err != nil || n <= 0 {
+			proxyLog.Warn("Invalid format for BW_CACHE_MAX_ENTRIES, using default", "value", val, "default", defaultCacheMaxEntries, "error", err)
+		} else {
+			c.maxEntries = n
+		}
+	}
+	registerResponseCache(c)
+	currentTTLCache.Lock()
+	currentTTLCache.cache = c
+	currentTTLCache.Unlock()
+	return c
+}
+
+// currentTTLCache is the cache of the proxy, which is saved to BW_CACHE_FILE and
+// prefetched into.
+var currentTTLCache struct {
+	sync.Mutex
+	cache *ttlCache
+}
+
+// activeTTLCache returns the cache of the proxy, or nil if BW_CACHE_TTL is not set.
+func activeTTLCache() *ttlCache {
+	currentTTLCache.Lock()
+	defer currentTTLCache.Unlock()
+	return currentTTLCache.cache
+}
+
+// middleware answers cacheable reads from the cache, marked with an X-BW-Cache header,
+// and empties it after every request that may have changed the vault.
+func (c *ttlCache) middleware(next http.Handler) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if isWriteMethod(r.Method) {
+			next.ServeHTTP(w, r)
+			c.invalidate(func(string) bool { return true })
+			return
+		}
+		if r.Method != http.MethodGet || !isTTLCacheable(r.URL.Path) {
+			next.ServeHTTP(w, r)
+			return
+		}
+		key := r.URL.RequestURI()
+		if entry := c.load(key); entry != nil {
+			cacheRequestsTotal.WithLabelValues("hit").Inc()
+			hit := &responseCapture{header: entry.header.Clone(), status: http.StatusOK}
+			hit.header.Set("X-BW-Cache", "HIT")
+			hit.header.Set("Age", strconv.Itoa(int(time.Since(entry.stored).Seconds())))
+			hit.writeTo(w, entry.body)
+			return
+		}
+		cacheRequestsTotal.WithLabelValues("miss").Inc()
+
+		// The cached response must be readable by every client.
+		r.Header.Del("Accept-Encoding")
+		capture := newResponseCapture()
+		next.ServeHTTP(capture, r)
+		if capture.status == http.StatusOK {
+			c.store(key, capture.header, capture.body.Bytes())
+		}
+		capture.header.Set("X-BW-Cache", "MISS")
+		capture.writeTo(w, capture.body.Bytes())
+	})
+}
+
+// store caches a response, evicting the oldest one if the cache is full. A TOTP code
+// expires with its period at the latest.
+func (c *ttlCache) store(key string, header http.Header, body []byte) {
+	now := time.Now()
+	expires := now.Add(c.ttl)
+	if strings.HasPrefix(key, "/object/totp/") {
+		period := totpPeriod * time.Second
+		if end := now.Truncate(period).Add(period); end.Before(expires) {
+			expires = end
+		}
+	}
+
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	if _, ok := c.entries[key]; !ok && len(c.entries) >= c.maxEntries {
+		var oldest string
+		for k, e := range c.entries {
+			if oldest == "" || e.stored.Before(c.entries[oldest].stored) {
+				oldest = k
+			}
+		}
+		delete(c.entries, oldest)
+	}
+	c.entries[key] = &cacheEntry{header: header.Clone(), body: bytes.Clone(body), stored: now, expires: expires}
+}
+
+// load returns the cached response for key, unless it has expired.
+func (c *ttlCache) load(key string) *cacheEntry {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	entry, ok := c.entries[key]
+	if !ok {
+		return nil
+	}
+	if !time.Now().Before(entry.expires) {
+		delete(c.entries, key)
+		return nil
+	}
+	return entry
+}
+
+// invalidate removes the matching responses.
+func (c *ttlCache) invalidate(match func(key string) bool) int {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	n := 0
+	for key := range c.entries {
+		if match(key) {
+			delete(c.entries, key)
+			n++
+		}
+	}
+	return n
+}
+
+// isTTLCacheable reports whether a path may be answered from the cache: a single item,
+// the list of items or a TOTP code.
+func isTTLCacheable(path string) bool {
+	return isItemRead(path) || strings.HasPrefix(path, "/object/totp/")
+}
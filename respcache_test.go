@@ -0,0 +1,63 @@
+package main
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+)
+
+func TestTTLCache(t *testing.T) {
+	defer func() { responseCaches = nil }()
+	defer func() { currentTTLCache.cache = nil }()
+	t.Setenv("BW_CACHE_TTL", "1h")
+	t.Setenv("BW_CACHE_MAX_ENTRIES", "2")
+	cache := ttlCacheFromEnv()
+	if cache == nil || cache.ttl != time.Hour || cache.maxEntries != 2 {
+		t.Fatalf("unexpected cache %+v", cache)
+	}
+
+	calls := 0
+	handler := cache.middleware(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		calls++
+		w.Header().Set("Content-Type", "application/json")
+		_, _ = w.Write([]byte(`{"success":true}`))
+	}))
+	send := func(method, path string) *httptest.ResponseRecorder {
+		rr := httptest.NewRecorder()
+		handler.ServeHTTP(rr, httptest.NewRequest(method, path, nil))
+		return rr
+	}
+
+	if rr := send("GET", "/object/item/1"); rr.Header().Get("X-BW-Cache") != "MISS" || calls != 1 {
+		t.Fatalf("first read: got %v, %d calls", rr.Header(), calls)
+	}
+	if rr := send("GET", "/object/item/1"); rr.Header().Get("X-BW-Cache") != "HIT" || rr.Body.String() != `{"success":true}` || calls != 1 {
+		t.Fatalf("repeated read: got %v %q, %d calls", rr.Header(), rr.Body.String(), calls)
+	}
+
+	// Other reads are not cached.
+	send("GET", "/object/password/1")
+	send("GET", "/object/password/1")
+	if calls != 3 {
+		t.Errorf("got %d calls, want 3", calls)
+	}
+
+	// A write empties the cache.
+	send("PUT", "/object/item/1")
+	if rr := send("GET", "/object/item/1"); rr.Header().Get("X-BW-Cache") != "MISS" {
+		t.Errorf("read after write: got %v", rr.Header())
+	}
+
+	// The oldest entry is evicted once the cache is full.
+	send("GET", "/list/object/items")
+	send("GET", "/object/totp/1")
+	if cache.load("/object/item/1") != nil || cache.load("/list/object/items") == nil {
+		t.Error("expected the oldest entry to be evicted")
+	}
+
+	// A TOTP code expires with its period.
+	if entry := cache.load("/object/totp/1"); entry == nil || entry.expires.Sub(entry.stored) > totpPeriod*time.Second {
+		t.Errorf("unexpected TOTP entry %+v", entry)
+	}
+}
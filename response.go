@@ -0,0 +1,86 @@
+package main
+
+import (
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"strconv"
+)
+
+// responseCapture buffers a response, so it can be inspected or modified before
+// it is sent to the client.
+type responseCapture struct {
+	header http.Header
+	status int
+	body   bytes.Buffer
+}
+
+func newResponseCapture() *responseCapture {
+	return &responseCapture{header: http.Header{}, status: http.StatusOK}
+}
+
+func (c *responseCapture) Header() http.Header { return c.header }
+
+func (c *responseCapture) Write(b []byte) (int, error) { return c.body.Write(b) }
+
+func (c *responseCapture) WriteHeader(status int) { c.status = status }
+
+// writeTo sends the captured status and headers with the given body to w.
+func (c *responseCapture) writeTo(w http.ResponseWriter, body []byte) {
+	for key, values := range c.header {
+		w.Header()[key] = values
+	}
+	w.Header().Set("Content-Length", strconv.Itoa(len(body)))
+	w.WriteHeader(c.status)
+	_, _ = w.Write(body)
+}
+
+// rewriteResponseData proxies a request and passes the "data" member of a successful
+// 'bw serve' response through rewrite before sending it to the client.
+func rewriteResponseData(w http.ResponseWriter, r *http.Request, next http.Handler, rewrite func(json.RawMessage) (json.RawMessage, error)) {
+	// Request an uncompressed response, so it can be parsed.
+	r.Header.Del("Accept-Encoding")
+	capture := newResponseCapture()
+	next.ServeHTTP(capture, r)
+	if capture.status != http.StatusOK {
+		capture.writeTo(w, capture.body.Bytes())
+		return
+	}
+
+	var resp map[string]json.RawMessage
+	if err := json.Unmarshal(capture.body.Bytes(), &resp); err != nil {
+		http.Error(w, fmt.Sprintf("Failed to parse response: %v", err), http.StatusBadGateway)
+		return
+	}
+	data, err := rewrite(resp["data"])
+	if err != nil {
+		http.Error(w, fmt.Sprintf("Failed to parse response: %v", err), http.StatusBadGateway)
+		return
+	}
+	resp["data"] = data
+	body, _ := json.Marshal(resp)
+	capture.writeTo(w, body)
+}
+
+// rewriteListEntries passes every entry of a 'bw serve' list object through rewrite,
+// dropping those it does not keep.
+func rewriteListEntries(data json.RawMessage, rewrite func(json.RawMessage) (json.RawMessage, bool)) (json.RawMessage, error) {
+	var list map[string]json.RawMessage
+	if err := json.Unmarshal(data, &list); err != nil {
+		return nil, err
+	}
+	var entries []json.RawMessage
+	if err := json.Unmarshal(list["data"], &entries); err != nil {
+		return nil, err
+	}
+
+	rewritten := make([]json.RawMessage, 0, len(entries))
+	for _, entry := range entries {
+		if entry, keep := rewrite(entry); keep {
+			rewritten = append(rewritten, entry)
+		}
+	}
+	list["data"], _ = json.Marshal(rewritten)
+	return json.Marshal(list)
+}
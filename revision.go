@@ -0,0 +1,177 @@
+package main
+
+import (
+	"context"
+	"crypto/rand"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"net/http"
+	"net/url"
+	"strings"
+	"sync"
+	"time"
+)
+
+// revisionTimeout bounds each request of the revision check, which should be much
+// quicker than the sync it may save.
+const revisionTimeout = 10 * time.Second
+
+// deviceTypeLinuxCLI identifies the revision check to the server as the Linux CLI.
+const deviceTypeLinuxCLI = "25"
+
+// skipUnchangedSyncEnabled reports whether BW_SYNC_SKIP_UNCHANGED is set.
+func skipUnchangedSyncEnabled() bool {
+	return getEnv("BW_SYNC_SKIP_UNCHANGED", "false") == "true"
+}
+
+// serverURLs returns the identity and API URLs of the server in BW_HOST, the US cloud
+// by default.
+func serverURLs() (identity, api string) {
+	host := strings.TrimSuffix(getEnv("BW_HOST", "https://vault.bitwarden.com"), "/")
+	switch host {
+	case "https://vault.bitwarden.com", "https://bitwarden.com":
+		return "https://identity.bitwarden.com", "https://api.bitwarden.com"
+	case "https://vault.bitwarden.eu", "https://bitwarden.eu":
+		return "https://identity.bitwarden.eu", "https://api.bitwarden.eu"
+	}
+	return host + "/identity", host + "/api"
+}
+
+// revisionChecker asks the server when the vault was last changed, authenticating with
+// the personal API key. The access token is kept until shortly before it expires.
+type revisionChecker struct {
+	mu       sync.Mutex
+	token    string
+	expires  time.Time
+	deviceID string
+	client   *http.Client
+}
+
+var revisions = &revisionChecker{client: &http.Client{Timeout: revisionTimeout}}
+
+// revisionDate returns the time of the last change of the vault on the server.
+func (c *revisionChecker) revisionDate(ctx context.Context) (time.Time, error) {
+	token, err := c.accessToken(ctx)
+	if err != nil {
+		return time.Time{}, err
+	}
+	_, api := serverURLs()
+	req, err := http.NewRequestWithContext(ctx, http.MethodGet, api+"/accounts/revision-date", nil)
+	if err != nil {
+		return time.Time{}, err
+	}
+	req.Header.Set("Authorization", "Bearer "+token)
+	resp, err := c.client.Do(req)
+	if err != nil {
+		return time.Time{}, err
+	}
+	defer resp.Body.Close()
+	if resp.StatusCode != http.StatusOK {
+		if resp.StatusCode == http.StatusUnauthorized {
+			c.mu.Lock()
+			c.token = ""
+			c.mu.Unlock()
+		}
+		return time.Time{}, fmt.Errorf("revision date request failed with status %d", resp.StatusCode)
+	}
+	var millis int64
+	if err := json.NewDecoder(resp.Body).Decode(&millis); err != nil {
+		return time.Time{}, fmt.Errorf("invalid revision date: %v", err)
+	}
+	return time.UnixMilli(millis), nil
+}
+
+// accessToken returns a token for the API, requesting a new one with the API key if the
+// current one is about to expire.
+func (c *revisionChecker) accessToken(ctx context.Context) (string, error) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	if c.token != "" && time.Now().Before(c.expires) {
+		return c.token, nil
+	}
+
+	clientID, err := getSecret("BW_CLIENTID")
+	if err != nil {
+		return "", err
+	}
+	clientSecret, err := getSecret("BW_CLIENTSECRET")
+	if err != nil {
+		return "", err
+	}
+	if clientID == "" || clientSecret == "" {
+		return "", errors.New("the revision check requires an API key (BW_CLIENTID and BW_CLIENTSECRET)")
+	}
+	if c.deviceID == "" {
+		c.deviceID = rand.Text()
+	}
+
+	identity, _ := serverURLs()
+	form := url.Values{
+		"grant_type":       {"client_credentials"},
+		"scope":            {"api"},
+		"client_id":        {clientID},
+		"client_secret":    {clientSecret},
+		"deviceType":       {deviceTypeLinuxCLI},
+		"deviceIdentifier": {c.deviceID},
+		"deviceName":       {"bw-cli-docker"},
+	}
+	req, err := http.NewRequestWithContext(ctx, http.MethodPost, identity+"/connect/token", strings.NewReader(form.Encode()))
+	if err != nil {
+		return "", err
+	}
+	req.Header.Set("Content-Type", "application/x-www-form-urlencoded")
+	resp, err := c.client.Do(req)
+	if err != nil {
+		return "", err
+	}
+	defer resp.Body.Close()
+	if resp.StatusCode != http.StatusOK {
+		return "", fmt.Errorf("token request failed with status %d", resp.StatusCode)
+	}
+	var token struct {
+		AccessToken string `json:"access_token"`
+		ExpiresIn   int    `json:"expires_in"`
+	}
+	if err := json.NewDecoder(resp.Body).Decode(&token); err != nil || token.AccessToken == "" {
+		return "", fmt.Errorf("invalid token response: %v", err)
+	}
+	registerSecret(token.AccessToken)
+	c.token = token.AccessToken
+	// Renewed a minute early, so it does not expire in flight.
+	c.expires = time.Now().Add(time.Duration(token.ExpiresIn)*time.Second - time.Minute)
+	return c.token, nil
+}
+
+// lastSyncTime returns when the CLI last synced, from 'bw sync --last'.
+func lastSyncTime(ctx context.Context) (time.Time, error) {
+	cliCtx, cancel, err := cliContext(ctx)
+	if err != nil {
+		return time.Time{}, err
+	}
+	defer cancel()
+	output, err := observeCLIOutput("bw sync --last", execCommand(cliCtx, "bw", "sync", "--last").Output)
+	if err != nil {
+		return time.Time{}, err
+	}
+	last := strings.TrimSpace(string(output))
+	if last == "" {
+		return time.Time{}, errors.New("never synced")
+	}
+	return time.Parse(time.RFC3339, last)
+}
+
+// vaultUnchanged reports whether the vault on the server has not changed since the last
+// sync. Any failure to tell is returned as an error, in which case a sync should run.
+func vaultUnchanged(ctx context.Context) (bool, error) {
+	last, err := lastSyncTime(ctx)
+	if err != nil {
+		return false, fmt.Errorf("failed to get the last sync time: %w", err)
+	}
+	revision, err := revisions.revisionDate(ctx)
+	if err != nil {
+		return false, fmt.Errorf("failed to get the revision date: %w", err)
+	}
+	syncLog.Debug("Checked the vault revision", "revision", revision, "last_sync", last)
+	return !revision.After(last), nil
+}
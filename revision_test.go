@@ -0,0 +1,109 @@
+package main
+
+import (
+	"context"
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"os/exec"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	"github.com/prometheus/client_golang/prometheus"
+	dto "github.com/prometheus/client_model/go"
+)
+
+func TestServerURLs(t *testing.T) {
+	tests := []struct {
+		host, identity, api string
+	}{
+		{"", "https://identity.bitwarden.com", "https://api.bitwarden.com"},
+		{"https://vault.bitwarden.eu", "https://identity.bitwarden.eu", "https://api.bitwarden.eu"},
+		{"https://vault.example.com/", "https://vault.example.com/identity", "https://vault.example.com/api"},
+	}
+	for _, tt := range tests {
+		t.Setenv("BW_HOST", tt.host)
+		if identity, api := serverURLs(); identity != tt.identity || api != tt.api {
+			t.Errorf("%q: got %s, %s", tt.host, identity, api)
+		}
+	}
+}
+
+func TestSkipUnchangedSync(t *testing.T) {
+	defer func() { syncs = &syncTracker{} }()
+	defer func(c *revisionChecker) { revisions = c }(revisions)
+	revisions = &revisionChecker{client: http.DefaultClient}
+
+	lastSync := time.Date(2026, 6, 1, 12, 0, 0, 0, time.UTC)
+	var revision atomic.Int64
+	var tokens atomic.Int32
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		switch r.URL.Path {
+		case "/identity/connect/token":
+			if r.FormValue("grant_type") != "client_credentials" || r.FormValue("client_id") != "user.test" {
+				w.WriteHeader(http.StatusBadRequest)
+				return
+			}
+			tokens.Add(1)
+			_, _ = w.Write([]byte(`{"access_token":"api-token","expires_in":3600}`))
+		case "/api/accounts/revision-date":
+			if r.Header.Get("Authorization") != "Bearer api-token" {
+				w.WriteHeader(http.StatusUnauthorized)
+				return
+			}
+			_, _ = fmt.Fprint(w, revision.Load())
+		default:
+			http.NotFound(w, r)
+		}
+	}))
+	defer server.Close()
+	t.Setenv("BW_HOST", server.URL)
+	t.Setenv("BW_CLIENTID", "user.test")
+	t.Setenv("BW_CLIENTSECRET", "secret")
+	t.Setenv("BW_SYNC_SKIP_UNCHANGED", "true")
+	execCommand = mockExecCommandEnv("MOCK_BW_SYNC_LAST=" + lastSync.Format(time.RFC3339))
+	defer func() { execCommand = exec.CommandContext }()
+
+	syncCount := func() uint64 {
+		metric := &dto.Metric{}
+		_ = cliCommandDuration.WithLabelValues("bw sync", "0").(prometheus.Histogram).Write(metric)
+		return metric.GetHistogram().GetSampleCount()
+	}
+
+	// Unchanged since the last sync.
+	revision.Store(lastSync.Add(-time.Hour).UnixMilli())
+	before := syncCount()
+	if err := runSync(context.Background()); err != nil {
+		t.Fatal(err)
+	}
+	if got := syncCount() - before; got != 0 {
+		t.Errorf("got %d syncs want the sync to be skipped", got)
+	}
+	if syncs.snapshot().LastSuccess == nil {
+		t.Error("expected a skipped sync to count as successful")
+	}
+
+	// Changed since the last sync.
+	revision.Store(lastSync.Add(time.Minute).UnixMilli())
+	if err := runSync(context.Background()); err != nil {
+		t.Fatal(err)
+	}
+	if got := syncCount() - before; got != 1 {
+		t.Errorf("got %d syncs want 1", got)
+	}
+	if tokens.Load() != 1 {
+		t.Errorf("got %d token requests want the token to be reused", tokens.Load())
+	}
+
+	// Without an API key, the vault is synced.
+	t.Setenv("BW_CLIENTID", "")
+	revisions = &revisionChecker{client: http.DefaultClient}
+	revision.Store(lastSync.Add(-time.Hour).UnixMilli())
+	if err := runSync(context.Background()); err != nil {
+		t.Fatal(err)
+	}
+	if got := syncCount() - before; got != 2 {
+		t.Errorf("got %d syncs want 2", got)
+	}
+}
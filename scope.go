@@ -0,0 +1,212 @@
+package main
+
+import (
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"io"
+	"net/http"
+	"os"
+	"slices"
+	"strings"
+)
+
+// itemObjectKinds are the 'bw serve' object endpoints that return an item or one
+// of its fields by item id, e.g. /object/password/{id}.
+var itemObjectKinds = []string{"item", "username", "password", "uri", "totp", "notes", "exposed"}
+
+// vaultScope restricts the items available through the proxy to organizations and
+// collections, so a shared organization vault can be exposed to a single application.
+type vaultScope struct {
+	organizations []string
+	collections   []string
+}
+
+// vaultScopeFromEnv parses the comma separated ids of BW_SCOPE_ORGANIZATIONS and
+// BW_SCOPE_COLLECTIONS, returning nil if neither is set.
+func vaultScopeFromEnv() *vaultScope {
+	s := &vaultScope{
+		organizations: splitList(os.Getenv("BW_SCOPE_ORGANIZATIONS")),
+		collections:   splitList(os.Getenv("BW_SCOPE_COLLECTIONS")),
+	}
+	if len(s.organizations) == 0 && len(s.collections) == 0 {
+		return nil
+	}
+	return s
+}
+
+// splitList splits a comma separated list, dropping empty entries.
+func splitList(value string) []string {
+	var list []string
+	for _, entry := range strings.Split(value, ",") {
+		if entry = strings.TrimSpace(entry); entry != "" {
+			list = append(list, entry)
+		}
+	}
+	return list
+}
+
+// scopedItem holds the fields of a vault item that determine its scope.
+type scopedItem struct {
+	OrganizationID *string  `json:"organizationId"`
+	CollectionIDs  []string `json:"collectionIds"`
+}
+
+// scopedCollection holds the fields of a collection that determine its scope.
+type scopedCollection struct {
+	ID             string  `json:"id"`
+	OrganizationID *string `json:"organizationId"`
+}
+
+// scopedOrganization holds the id of an organization.
+type scopedOrganization struct {
+	ID string `json:"id"`
+}
+
+// allowsItem reports whether an item belongs to the allowed organizations and collections.
+func (s *vaultScope) allowsItem(item scopedItem) bool {
+	if len(s.organizations) > 0 && (item.OrganizationID == nil || !slices.Contains(s.organizations, *item.OrganizationID)) {
+		return false
+	}
+	if len(s.collections) > 0 && !slices.ContainsFunc(item.CollectionIDs, func(id string) bool { return slices.Contains(s.collections, id) }) {
+		return false
+	}
+	return true
+}
+
+// allowsCollection reports whether a collection is within the scope.
+func (s *vaultScope) allowsCollection(c scopedCollection) bool {
+	if len(s.organizations) > 0 && (c.OrganizationID == nil || !slices.Contains(s.organizations, *c.OrganizationID)) {
+		return false
+	}
+	return len(s.collections) == 0 || slices.Contains(s.collections, c.ID)
+}
+
+// allowsOrganization reports whether an organization is within the scope.
+func (s *vaultScope) allowsOrganization(o scopedOrganization) bool {
+	return len(s.organizations) == 0 || slices.Contains(s.organizations, o.ID)
+}
+
+// middleware filters list responses down to the scope and rejects requests for
+// individual items outside of it with 403 Forbidden.
+func (s *vaultScope) middleware(next http.Handler) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		switch r.URL.Path {
+		case "/list/object/items":
+			filterListResponse(w, r, next, s.allowsItem)
+			return
+		case "/list/object/collections", "/list/object/org-collections":
+			filterListResponse(w, r, next, s.allowsCollection)
+			return
+		case "/list/object/organizations":
+			filterListResponse(w, r, next, s.allowsOrganization)
+			return
+		}
+
+		if orgID, ok := moveTarget(r); ok && !s.allowsOrganization(scopedOrganization{ID: orgID}) {
+			http.Error(w, "Forbidden: organization is outside of the configured scope", http.StatusForbidden)
+			return
+		}
+		if isItemWrite(r) {
+			// The item as created or edited must stay within the scope as well.
+			body, err := io.ReadAll(r.Body)
+			if err != nil {
+				proxyErrorHandler(w, r, err)
+				return
+			}
+			_ = r.Body.Close()
+			r.Body = io.NopCloser(bytes.NewReader(body))
+			var item scopedItem
+			if err := json.Unmarshal(body, &item); err != nil || !s.allowsItem(item) {
+				http.Error(w, "Forbidden: item is outside of the configured scope", http.StatusForbidden)
+				return
+			}
+		}
+		if itemID := scopedItemID(r); itemID != "" {
+			allowed, err := s.checkItem(r, next, itemID)
+			if err != nil {
+				http.Error(w, err.Error(), http.StatusBadGateway)
+				return
+			}
+			if !allowed {
+				http.Error(w, "Forbidden: item is outside of the configured scope", http.StatusForbidden)
+				return
+			}
+		}
+		next.ServeHTTP(w, r)
+	})
+}
+
+// scopedItemID returns the id of the item a request refers to, if any.
+func scopedItemID(r *http.Request) string {
+	parts := strings.Split(strings.Trim(r.URL.Path, "/"), "/")
+	switch {
+	case len(parts) == 3 && parts[0] == "object" && slices.Contains(itemObjectKinds, parts[1]):
+		return parts[2]
+	case len(parts) == 3 && parts[0] == "object" && parts[1] == "attachment":
+		return r.URL.Query().Get("itemid")
+	case len(parts) == 3 && parts[0] == "restore" && parts[1] == "item":
+		return parts[2]
+	case len(parts) == 3 && parts[0] == "move":
+		return parts[1]
+	}
+	return ""
+}
+
+// moveTarget returns the organization an item is moved to by /move/{itemid}/{organizationid}.
+func moveTarget(r *http.Request) (string, bool) {
+	parts := strings.Split(strings.Trim(r.URL.Path, "/"), "/")
+	if len(parts) == 3 && parts[0] == "move" {
+		return parts[2], true
+	}
+	return "", false
+}
+
+// isItemWrite reports whether a request creates or edits an item, carrying it as body.
+func isItemWrite(r *http.Request) bool {
+	switch {
+	case r.Method == http.MethodPost && r.URL.Path == "/object/item":
+		return true
+	case r.Method == http.MethodPut && strings.HasPrefix(r.URL.Path, "/object/item/"):
+		return true
+	}
+	return false
+}
+
+// checkItem fetches an item from 'bw serve' to check whether it is within the scope.
+// Items that cannot be fetched are treated as outside of the scope.
+func (s *vaultScope) checkItem(r *http.Request, next http.Handler, itemID string) (bool, error) {
+	itemReq := r.Clone(r.Context())
+	itemReq.Method = http.MethodGet
+	itemReq.URL.Path = "/object/item/" + itemID
+	itemReq.URL.RawPath = ""
+	itemReq.URL.RawQuery = ""
+	itemReq.Body = http.NoBody
+	itemReq.ContentLength = 0
+	itemReq.Header.Del("Accept-Encoding")
+
+	capture := newResponseCapture()
+	next.ServeHTTP(capture, itemReq)
+	if capture.status != http.StatusOK {
+		return false, nil
+	}
+
+	var resp struct {
+		Data scopedItem `json:"data"`
+	}
+	if err := json.Unmarshal(capture.body.Bytes(), &resp); err != nil {
+		return false, fmt.Errorf("failed to parse item response: %v", err)
+	}
+	return s.allowsItem(resp.Data), nil
+}
+
+// filterListResponse proxies a list request and removes all entries of the response
+// not accepted by allow.
+func filterListResponse[T any](w http.ResponseWriter, r *http.Request, next http.Handler, allow func(T) bool) {
+	rewriteResponseData(w, r, next, func(data json.RawMessage) (json.RawMessage, error) {
+		return rewriteListEntries(data, func(entry json.RawMessage) (json.RawMessage, bool) {
+			var v T
+			return entry, json.Unmarshal(entry, &v) == nil && allow(v)
+		})
+	})
+}
@@ -0,0 +1,127 @@
+package main
+
+import (
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"net/http/httputil"
+	"net/url"
+	"strings"
+	"testing"
+)
+
+// newScopeTestRouter proxies to a fake 'bw serve' holding an item in org-a/coll-a,
+// one in org-b and a personal item.
+func newScopeTestRouter(t *testing.T) http.Handler {
+	t.Helper()
+	items := map[string]string{
+		"item-a":        `{"id":"item-a","organizationId":"org-a","collectionIds":["coll-a"],"login":{"password":"a"}}`,
+		"item-b":        `{"id":"item-b","organizationId":"org-b","collectionIds":["coll-b"],"login":{"password":"b"}}`,
+		"item-personal": `{"id":"item-personal","organizationId":null,"collectionIds":[],"login":{"password":"p"}}`,
+	}
+	ts := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.Header().Set("Content-Type", "application/json")
+		if r.URL.Path == "/list/object/items" {
+			_, _ = w.Write([]byte(`{"success":true,"data":{"object":"list","data":[` +
+				items["item-a"] + `,` + items["item-b"] + `,` + items["item-personal"] + `]}}`))
+			return
+		}
+		parts := strings.Split(strings.Trim(r.URL.Path, "/"), "/")
+		item, ok := items[parts[len(parts)-1]]
+		if !ok {
+			w.WriteHeader(http.StatusNotFound)
+			_, _ = w.Write([]byte(`{"success":false,"message":"Not found."}`))
+			return
+		}
+		if parts[1] == "password" {
+			_, _ = w.Write([]byte(`{"success":true,"data":{"object":"string","data":"secret"}}`))
+			return
+		}
+		_, _ = w.Write([]byte(`{"success":true,"data":` + item + `}`))
+	}))
+	t.Cleanup(ts.Close)
+	u, _ := url.Parse(ts.URL)
+	return setupRouter(httputil.NewSingleHostReverseProxy(u))
+}
+
+func TestVaultScopeList(t *testing.T) {
+	t.Setenv("BW_SCOPE_ORGANIZATIONS", "org-a")
+	router := newScopeTestRouter(t)
+
+	req, _ := http.NewRequest("GET", "/list/object/items", nil)
+	rr := httptest.NewRecorder()
+	router.ServeHTTP(rr, req)
+	if rr.Code != http.StatusOK {
+		t.Fatalf("got status %v want %v: %s", rr.Code, http.StatusOK, rr.Body.String())
+	}
+
+	var resp struct {
+		Success bool `json:"success"`
+		Data    struct {
+			Data []struct {
+				ID string `json:"id"`
+			} `json:"data"`
+		} `json:"data"`
+	}
+	if err := json.Unmarshal(rr.Body.Bytes(), &resp); err != nil {
+		t.Fatalf("invalid JSON response: %v", err)
+	}
+	if !resp.Success || len(resp.Data.Data) != 1 || resp.Data.Data[0].ID != "item-a" {
+		t.Errorf("expected only item-a, got %s", rr.Body.String())
+	}
+}
+
+func TestVaultScopeItems(t *testing.T) {
+	t.Setenv("BW_SCOPE_ORGANIZATIONS", "org-a,org-b")
+	t.Setenv("BW_SCOPE_COLLECTIONS", "coll-a")
+	router := newScopeTestRouter(t)
+
+	tests := []struct {
+		path string
+		want int
+	}{
+		{"/object/item/item-a", http.StatusOK},
+		{"/object/password/item-a", http.StatusOK},
+		{"/object/item/item-b", http.StatusForbidden},
+		{"/object/password/item-b", http.StatusForbidden},
+		{"/object/item/item-personal", http.StatusForbidden},
+		{"/object/attachment/att-1?itemid=item-b", http.StatusForbidden},
+		{"/object/item/missing", http.StatusForbidden},
+	}
+	for _, tt := range tests {
+		req, _ := http.NewRequest("GET", tt.path, nil)
+		rr := httptest.NewRecorder()
+		router.ServeHTTP(rr, req)
+		if rr.Code != tt.want {
+			t.Errorf("GET %s: got status %v want %v", tt.path, rr.Code, tt.want)
+		}
+	}
+}
+
+func TestVaultScopeWrites(t *testing.T) {
+	t.Setenv("BW_SCOPE_ORGANIZATIONS", "org-a")
+	router := newScopeTestRouter(t)
+
+	tests := []struct {
+		method, path, body string
+		forbidden          bool
+	}{
+		{"POST", "/move/item-a/org-a", "", false},
+		{"POST", "/move/item-b/org-a", "", true},
+		{"POST", "/move/item-personal/org-a", "", true},
+		{"POST", "/move/item-a/org-b", "", true},
+		{"POST", "/object/item", `{"name":"new","organizationId":"org-a","collectionIds":["coll-a"]}`, false},
+		{"POST", "/object/item", `{"name":"new","organizationId":"org-b","collectionIds":["coll-b"]}`, true},
+		{"POST", "/object/item", `{"name":"new"}`, true},
+		{"PUT", "/object/item/item-a", `{"name":"a","organizationId":"org-a"}`, false},
+		{"PUT", "/object/item/item-a", `{"name":"a","organizationId":"org-b"}`, true},
+	}
+	for _, tt := range tests {
+		req, _ := http.NewRequest(tt.method, tt.path, strings.NewReader(tt.body))
+		rr := httptest.NewRecorder()
+		router.ServeHTTP(rr, req)
+		if forbidden := rr.Code == http.StatusForbidden; forbidden != tt.forbidden {
+			t.Errorf("%s %s %s: got status %v, want forbidden %v", tt.method, tt.path, tt.body, rr.Code, tt.forbidden)
+		}
+	}
+}
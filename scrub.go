@@ -0,0 +1,109 @@
+package main
+
+import (
+	"os"
+	"sync"
+)
+
+// scrubbedVariables are the credentials removed from the environment once the
+// session has been obtained.
+var scrubbedVariables = []string{
+	"BW_PASSWORD",
+	"BW_CLIENTSECRET",
+	"BW_TOTP_SECRET",
+	"BW_SESSION_STATE_KEY",
+	"BWS_ACCESS_TOKEN",
+	"BW_PROXY_AUTH_TOKEN",
+	"BW_PROXY_AUTH_TOKENS",
+	"BW_PROXY_BASIC_PASS",
+	"BW_ADMIN_TOKEN",
+	"BW_REDACT_REVEAL_TOKENS",
+	"BW_PROXY_TOKEN_POLICIES",
+	"BW_SYNC_ALERT_WEBHOOK",
+	"BW_SYNC_CHANGE_WEBHOOK",
+	"BW_ERROR_WEBHOOK",
+	"SENTRY_DSN",
+}
+
+// scrubbedSecrets holds the values removed by scrubCredentials, so they remain
+// available to getSecret for unlocking the vault again later.
+var (
+	scrubbedSecretsMu sync.RWMutex
+	scrubbedSecrets   = map[string]string{}
+)
+
+// scrubCredentials removes credentials from the environment, so they are no longer
+// inherited by child processes such as 'bw serve', and protects the wrapper process
+// itself from having its environment or memory inspected.
+func scrubCredentials() {
+	scrubbedSecretsMu.Lock()
+	defer scrubbedSecretsMu.Unlock()
+	for _, key := range scrubbedVariables {
+		if value, ok := os.LookupEnv(key); ok {
+			scrubbedSecrets[key] = value
+			_ = os.Unsetenv(key)
+		}
+	}
+
+	if err := protectProcess(); err != nil {
+		mainLog.Warn("Failed to protect the process from inspection", "error", err)
+	}
+}
+
+// lookupScrubbedSecret returns a value removed from the environment by scrubCredentials.
+func lookupScrubbedSecret(key string) string {
+	scrubbedSecretsMu.RLock()
+	defer scrubbedSecretsMu.RUnlock()
+	return scrubbedSecrets[key]
+}
+
+// savedSecret is how a credential was configured before storeSecret replaced it: its
+// variable, its _FILE variant and its value in memory.
+type savedSecret struct {
+	key                       string
+	value, file, stored       string
+	hasValue, hasFile, hasMem bool
+}
+
+// saveSecret records how a credential is configured, so it can be put back.
+func saveSecret(key string) savedSecret {
+	scrubbedSecretsMu.RLock()
+	defer scrubbedSecretsMu.RUnlock()
+	s := savedSecret{key: key}
+	s.value, s.hasValue = os.LookupEnv(key)
+	s.file, s.hasFile = os.LookupEnv(key + "_FILE")
+	s.stored, s.hasMem = scrubbedSecrets[key]
+	return s
+}
+
+// restore configures the credential as it was saved.
+func (s savedSecret) restore() {
+	scrubbedSecretsMu.Lock()
+	defer scrubbedSecretsMu.Unlock()
+	if s.hasMem {
+		scrubbedSecrets[s.key] = s.stored
+	} else {
+		delete(scrubbedSecrets, s.key)
+	}
+	setOrUnsetenv(s.key, s.value, s.hasValue)
+	setOrUnsetenv(s.key+"_FILE", s.file, s.hasFile)
+}
+
+// setOrUnsetenv sets key to value if ok, and removes it from the environment otherwise.
+func setOrUnsetenv(key, value string, ok bool) {
+	if ok {
+		_ = os.Setenv(key, value)
+	} else {
+		_ = os.Unsetenv(key)
+	}
+}
+
+// storeSecret replaces a credential at runtime. The value is kept in memory only and
+// takes effect over the environment and any _FILE variant, which are removed.
+func storeSecret(key, value string) {
+	scrubbedSecretsMu.Lock()
+	defer scrubbedSecretsMu.Unlock()
+	scrubbedSecrets[key] = value
+	_ = os.Unsetenv(key)
+	_ = os.Unsetenv(key + "_FILE")
+}
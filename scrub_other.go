@@ -0,0 +1,8 @@
+//go:build !linux
+
+package main
+
+// protectProcess is only implemented on Linux.
+func protectProcess() error {
+	return nil
+}
@@ -0,0 +1,60 @@
+package main
+
+import (
+	"os"
+	"strings"
+	"testing"
+)
+
+func TestScrubCredentials(t *testing.T) {
+	t.Setenv("BW_PASSWORD", "test-password")
+	t.Setenv("BW_CLIENTSECRET", "test-secret")
+	t.Setenv("BW_CLIENTID", "user.test-id")
+	t.Cleanup(func() {
+		scrubbedSecretsMu.Lock()
+		scrubbedSecrets = map[string]string{}
+		scrubbedSecretsMu.Unlock()
+	})
+
+	scrubCredentials()
+
+	for _, key := range []string{"BW_PASSWORD", "BW_CLIENTSECRET"} {
+		if _, ok := os.LookupEnv(key); ok {
+			t.Errorf("%s is still set in the environment", key)
+		}
+	}
+	if os.Getenv("BW_CLIENTID") != "user.test-id" {
+		t.Error("BW_CLIENTID should not be scrubbed")
+	}
+
+	// The wrapper itself can still unlock the vault again.
+	if got, _ := getSecret("BW_PASSWORD"); got != "test-password" {
+		t.Errorf("getSecret(BW_PASSWORD) = %q after scrubbing, want %q", got, "test-password")
+	}
+	if got, _ := getPassword(); got != "test-password" {
+		t.Errorf("getPassword() = %q after scrubbing, want %q", got, "test-password")
+	}
+}
+
+func TestScrubAdminToken(t *testing.T) {
+	t.Setenv("BW_ADMIN_TOKEN", "admin-token")
+	t.Cleanup(func() {
+		scrubbedSecretsMu.Lock()
+		scrubbedSecrets = map[string]string{}
+		scrubbedSecretsMu.Unlock()
+	})
+
+	scrubCredentials()
+
+	for _, kv := range os.Environ() {
+		if strings.HasPrefix(kv, "BW_ADMIN_TOKEN=") {
+			t.Error("BW_ADMIN_TOKEN is still inherited by child processes")
+		}
+	}
+	if got, _ := getSecret("BW_ADMIN_TOKEN"); got != "admin-token" {
+		t.Errorf("getSecret(BW_ADMIN_TOKEN) = %q after scrubbing, want %q", got, "admin-token")
+	}
+	if got := scrubSecrets("token admin-token"); strings.Contains(got, "admin-token") {
+		t.Errorf("admin token is not redacted from logs: %q", got)
+	}
+}
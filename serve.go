@@ -0,0 +1,325 @@
+package main
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"net"
+	"net/http"
+	"os"
+	"os/exec"
+	"sync"
+	"sync/atomic"
+	"syscall"
+	"time"
+)
+
+const (
+	defaultLockCheckInterval = 30 * time.Second
+	bwServeStopTimeout       = 10 * time.Second
+
+	// bwServeRestartBackoff is the delay before restarting a crashed 'bw serve', doubled
+	// on every crash up to bwServeMaxRestartBackoff. Once a process has been running for
+	// bwServeStableUptime, the backoff starts over.
+	bwServeRestartBackoff    = 1 * time.Second
+	bwServeMaxRestartBackoff = 1 * time.Minute
+	bwServeStableUptime      = 5 * time.Minute
+)
+
+// bwServeProcess manages the 'bw serve' child process, so that it can be
+// restarted with a new session token while the wrapper keeps running.
+type bwServeProcess struct {
+	mu      sync.Mutex
+	cmd     *exec.Cmd
+	done    chan struct{}
+	port    string
+	crashes int
+}
+
+var bwServe = &bwServeProcess{}
+
+// bwServeRecovering is set while a crashed 'bw serve' is being restarted, during
+// which the proxy reports itself as not ready.
+var bwServeRecovering atomic.Bool
+
+// start launches 'bw serve' on the given port. If the process exits without
+// being stopped or restarted by the wrapper, it is restarted by recoverCrash.
+func (p *bwServeProcess) start(port, sessionToken string) error {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	if shuttingDown.Load() {
+		// Startup was abandoned, the process would outlive the wrapper.
+		return errors.New("shutting down")
+	}
+	return p.startLocked(port, sessionToken)
+}
+
+func (p *bwServeProcess) startLocked(port, sessionToken string) error {
+	cmd, done, err := p.spawn(port, sessionToken)
+	if err != nil {
+		return err
+	}
+	p.cmd, p.done, p.port = cmd, done, port
+	return nil
+}
+
+// spawn launches a 'bw serve' process on port. Its exit is only treated as a crash if
+// it is the current process of p by then.
+func (p *bwServeProcess) spawn(port, sessionToken string) (*exec.Cmd, chan struct{}, error) {
+	serveLog.Info("Starting 'bw serve'", "port", port)
+	// Only the proxy talks to 'bw serve', it must not be reachable from outside.
+	args := []string{"serve", "--hostname", "127.0.0.1", "--port", port}
+	if sessionToken != "" {
+		args = append(args, "--session", sessionToken)
+	}
+	// 'bw serve' runs until stopped, so it is not bound by BW_CLI_TIMEOUT.
+	cmd := execCommand(context.Background(), "bw", args...)
+	cmd.Stdout = consoleWriter(os.Stdout)
+	cmd.Stderr = consoleWriter(os.Stderr)
+	if err := cmd.Start(); err != nil {
+		return nil, nil, err
+	}
+	recordEvent(eventServeStarted, "Started 'bw serve'", nil)
+
+	done := make(chan struct{})
+	started := time.Now()
+	go func() {
+		err := cmd.Wait()
+		close(done)
+
+		p.mu.Lock()
+		expected := p.cmd != cmd
+		p.mu.Unlock()
+		if expected || shuttingDown.Load() {
+			return
+		}
+		serveLog.Error("'bw serve' process exited unexpectedly", "error", err)
+		recordEvent(eventServeCrashed, "'bw serve' process exited unexpectedly", err)
+		go reportError("serve_crashed", formatLogArgs("'bw serve' process exited unexpectedly", "error", err), "")
+		p.recoverCrash(cmd, time.Since(started))
+	}()
+	return cmd, done, nil
+}
+
+// recoverCrash restarts 'bw serve' after the process cmd crashed, backing off on
+// repeated crashes, and makes sure the vault is unlocked again. The proxy is not
+// ready until then.
+func (p *bwServeProcess) recoverCrash(cmd *exec.Cmd, uptime time.Duration) {
+	bwServeRecovering.Store(true)
+	defer bwServeRecovering.Store(false)
+	// Requests are queued until 'bw serve' is back.
+	sessionGate.close()
+	defer sessionGate.open()
+
+	p.mu.Lock()
+	if uptime >= bwServeStableUptime {
+		p.crashes = 0
+	}
+	for {
+		backoff := min(bwServeRestartBackoff<<min(p.crashes, 16), bwServeMaxRestartBackoff)
+		p.crashes++
+		crashes := p.crashes
+		p.mu.Unlock()
+		serveLog.Info("Restarting 'bw serve' after crash", "backoff", backoff, "crashes", crashes)
+		time.Sleep(backoff)
+
+		p.mu.Lock()
+		if p.cmd != cmd || shuttingDown.Load() {
+			// Restarted or stopped by the wrapper in the meantime.
+			p.mu.Unlock()
+			return
+		}
+		bwServeRestartsTotal.Inc()
+		// The session may have been renewed since the process was started.
+		err := p.startLocked(p.port, os.Getenv("BW_SESSION"))
+		if err == nil {
+			break
+		}
+		serveLog.Error("Failed to restart 'bw serve'", "error", err)
+	}
+	port := p.port
+	p.mu.Unlock()
+
+	requireUnlock := os.Getenv("BW_SESSION") != ""
+	if err := waitForBwServe(port, requireUnlock); err != nil {
+		if !requireUnlock {
+			serveLog.Error("'bw serve' did not become ready after restart", "error", err)
+			return
+		}
+		serveLog.Warn("'bw serve' is locked after restart, unlocking the vault again", "error", err)
+		if err := reunlockVault(port, true); err != nil {
+			serveLog.Error("Failed to unlock the vault again", "error", err)
+			recordEvent(eventUnlockFailed, "Failed to unlock the vault again", err)
+			return
+		}
+	}
+	serveLog.Info("'bw serve' recovered")
+}
+
+// stopLocked terminates the running process, if any, and waits for it to exit.
+func (p *bwServeProcess) stopLocked() {
+	cmd, done := p.cmd, p.done
+	if cmd == nil {
+		return
+	}
+	// Clearing cmd first marks the upcoming exit as expected.
+	p.cmd = nil
+	terminate(cmd, done)
+}
+
+// terminate stops a 'bw serve' process that is no longer the current one, killing it
+// if it does not exit within bwServeStopTimeout, and waits for it to exit.
+func terminate(cmd *exec.Cmd, done <-chan struct{}) {
+	_ = cmd.Process.Signal(syscall.SIGTERM)
+	select {
+	case <-done:
+	case <-time.After(bwServeStopTimeout):
+		serveLog.Warn("'bw serve' did not stop in time, killing it")
+		_ = cmd.Process.Kill()
+		<-done
+	}
+}
+
+// currentPort returns the port of the running 'bw serve', or an empty string if it
+// has not been started.
+func (p *bwServeProcess) currentPort() string {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	if p.cmd == nil {
+		return ""
+	}
+	return p.port
+}
+
+// activeServePort returns the port 'bw serve' listens on. It is the configured port,
+// unless the process has been recycled onto another one.
+func activeServePort(port string) string {
+	if current := bwServe.currentPort(); current != "" {
+		return current
+	}
+	return port
+}
+
+// bwServeURL returns the URL of path on 'bw serve', configured to listen on port.
+func bwServeURL(port, path string) string {
+	return "http://" + net.JoinHostPort("127.0.0.1", activeServePort(port)) + path
+}
+
+// stop terminates the running 'bw serve' process.
+func (p *bwServeProcess) stop() {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	p.stopLocked()
+}
+
+// restart replaces the running 'bw serve' process with one using the given session token.
+func (p *bwServeProcess) restart(sessionToken string) error {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	serveLog.Info("Restarting 'bw serve'")
+	bwServeRestartsTotal.Inc()
+	recordEvent(eventServeRestart, "Restarting 'bw serve'", nil)
+	p.stopLocked()
+	return p.startLocked(p.port, sessionToken)
+}
+
+// watchVaultLock periodically checks whether 'bw serve' is still unlocked and
+// unlocks the vault again if it got locked, e.g. by a vault timeout policy.
+func watchVaultLock(port string) {
+	interval := defaultLockCheckInterval
+	if val := os.Getenv("BW_LOCK_CHECK_INTERVAL"); val != "" {
+		if d, err := time.ParseDuration(val); err == nil && d > 0 {
+			interval = d
+		} else {
+			serveLog.Warn("Invalid format for BW_LOCK_CHECK_INTERVAL, using default", "value", val, "default", interval)
+		}
+	}
+
+	client := &http.Client{Timeout: 2 * time.Second}
+	ticker := time.NewTicker(interval)
+	defer ticker.Stop()
+
+	for range ticker.C {
+		_ = checkVaultLock(client, port)
+	}
+}
+
+// checkVaultLock unlocks the vault again if 'bw serve' reports it locked. The status is
+// read from the process currently serving, which moves to another port when recycled.
+func checkVaultLock(client *http.Client, port string) error {
+	status, err := fetchBwServeStatus(client, bwServeURL(port, "/status"))
+	if err != nil {
+		serveLog.Warn("Could not check the vault lock state", "error", err)
+		return err
+	}
+	recordVaultLockState(status.isUnlocked())
+	if status.isUnlocked() {
+		return nil
+	}
+
+	serveLog.Info("Vault has been locked, unlocking it again")
+	recordEvent(eventVaultLocked, "Vault has been locked", nil)
+	if err := reunlockVault(port, false); err != nil {
+		serveLog.Error("Failed to unlock the vault again", "error", err)
+		recordEvent(eventUnlockFailed, "Failed to unlock the vault again", err)
+		return err
+	}
+	return nil
+}
+
+// reunlockMu serializes re-unlocks triggered by different watchers.
+var reunlockMu sync.Mutex
+
+// reunlockVault obtains a new session with the master password (or Key Connector) and makes it
+// available to child processes. If 'bw serve' stays locked with its old
+// session, or forceRestart is set, it is restarted with the new one.
+func reunlockVault(port string, forceRestart bool) error {
+	reunlockMu.Lock()
+	defer reunlockMu.Unlock()
+
+	password, err := getPassword()
+	if err != nil {
+		return err
+	}
+	if password == "" && !usesKeyConnector() {
+		return fmt.Errorf("no master password available (BW_PASSWORD or BW_PASSWORD_FILE)")
+	}
+
+	session, err := unlock(password)
+	if err != nil {
+		return err
+	}
+	if err := os.Setenv("BW_SESSION", session); err != nil {
+		return fmt.Errorf("failed to set BW_SESSION environment variable: %v", err)
+	}
+	recordSessionStart()
+	persistSession(session)
+
+	statusURL := bwServeURL(port, "/status")
+	client := &http.Client{Timeout: 2 * time.Second}
+	if !forceRestart && checkBwServeStatus(client, statusURL, true) == nil {
+		serveLog.Info("Vault unlocked again")
+		recordVaultLockState(true)
+		recordEvent(eventUnlock, "Vault unlocked again", nil)
+		return nil
+	}
+
+	if err := restartWithSession(port, session); err != nil {
+		return err
+	}
+	serveLog.Info("Vault unlocked again, 'bw serve' restarted with the new session")
+	recordVaultLockState(true)
+	recordEvent(eventUnlock, "Vault unlocked again, 'bw serve' restarted with the new session", nil)
+	return nil
+}
+
+// restartWithSession restarts 'bw serve' with a new session behind the session gate.
+func restartWithSession(port, session string) error {
+	sessionGate.close()
+	defer sessionGate.open()
+
+	if err := bwServe.restart(session); err != nil {
+		return fmt.Errorf("failed to restart 'bw serve': %v", err)
+	}
+	return waitForBwServe(activeServePort(port), true)
+}
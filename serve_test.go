@@ -0,0 +1,117 @@
+package main
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"os"
+	"os/exec"
+	"path/filepath"
+	"testing"
+	"time"
+)
+
+func TestBwServeProcessRestart(t *testing.T) {
+	execCommand = mockExecCommand
+	defer func() { execCommand = exec.CommandContext }()
+
+	p := &bwServeProcess{}
+	if err := p.start("8088", "old-session"); err != nil {
+		t.Fatalf("start failed: %v", err)
+	}
+	defer p.stop()
+	first, firstDone := p.cmd, p.done
+
+	if err := p.restart("new-session"); err != nil {
+		t.Fatalf("restart failed: %v", err)
+	}
+
+	select {
+	case <-firstDone:
+	default:
+		t.Error("expected the old 'bw serve' process to be stopped")
+	}
+	if p.cmd == first {
+		t.Fatal("expected a new 'bw serve' process after restart")
+	}
+	if !containsArgs(p.cmd.Args, "--session", "new-session") {
+		t.Errorf("restarted process args = %v, want new session", p.cmd.Args)
+	}
+}
+
+func TestReunlockVault(t *testing.T) {
+	execCommand = mockExecCommand
+	defer func() { execCommand = exec.CommandContext }()
+
+	t.Setenv("BW_PASSWORD", "test-password")
+	t.Setenv("BW_SESSION", "expired-session")
+	t.Setenv("BW_SESSION_STATE_FILE", "")
+
+	ts := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.WriteHeader(http.StatusOK)
+		_, _ = w.Write([]byte(`{"data": {"template": {"status": "unlocked"}}}`))
+	}))
+	defer ts.Close()
+
+	u, _ := url.Parse(ts.URL)
+	if err := reunlockVault(u.Port(), false); err != nil {
+		t.Fatalf("expected nil, got %v", err)
+	}
+	if got := os.Getenv("BW_SESSION"); got != "test-session-token" {
+		t.Errorf("BW_SESSION = %q, want %q", got, "test-session-token")
+	}
+}
+
+func TestReunlockVault_NoPassword(t *testing.T) {
+	t.Setenv("BW_PASSWORD", "")
+	t.Setenv("BW_PASSWORD_FILE", "")
+
+	if err := reunlockVault("8088", false); err == nil {
+		t.Fatal("expected error without a master password")
+	}
+}
+
+func TestBwServeProcessCrash(t *testing.T) {
+	crashFile := filepath.Join(t.TempDir(), "crash")
+	if err := os.WriteFile(crashFile, nil, 0o600); err != nil {
+		t.Fatal(err)
+	}
+	execCommand = mockExecCommandEnv("MOCK_BW_SERVE_CRASH_FILE=" + crashFile)
+	defer func() { execCommand = exec.CommandContext }()
+
+	ts := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		_, _ = w.Write([]byte(`{"data": {"template": {"status": "unlocked"}}}`))
+	}))
+	defer ts.Close()
+	u, _ := url.Parse(ts.URL)
+	t.Setenv("BW_SESSION", "test-session-token")
+	t.Setenv("BW_SERVE_WAIT_INTERVAL", "10ms")
+
+	p := &bwServeProcess{}
+	if err := p.start(u.Port(), "test-session-token"); err != nil {
+		t.Fatalf("start failed: %v", err)
+	}
+	defer p.stop()
+	p.mu.Lock()
+	first := p.cmd
+	p.mu.Unlock()
+
+	rr := httptest.NewRecorder()
+	for i := 0; i < 50 && !bwServeRecovering.Load(); i++ {
+		time.Sleep(10 * time.Millisecond)
+	}
+	handleReadyz(rr, httptest.NewRequest("GET", "/readyz", nil))
+	if rr.Code != http.StatusServiceUnavailable {
+		t.Errorf("readyz during recovery: got status %v want %v", rr.Code, http.StatusServiceUnavailable)
+	}
+
+	for i := 0; i < 500 && bwServeRecovering.Load(); i++ {
+		time.Sleep(10 * time.Millisecond)
+	}
+	p.mu.Lock()
+	restarted := p.cmd != first && p.crashes == 1
+	p.mu.Unlock()
+	if bwServeRecovering.Load() || !restarted {
+		t.Fatal("expected 'bw serve' to be restarted after the crash")
+	}
+}
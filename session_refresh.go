@@ -0,0 +1,95 @@
+package main
+
+import (
+	"context"
+	"os"
+	"time"
+)
+
+// sessionRefreshCheckInterval is how often the age of the session and login is checked.
+const sessionRefreshCheckInterval = 1 * time.Minute
+
+// sessionRefreshConfig holds the maximum ages after which the session is renewed
+// proactively. A zero age disables the respective refresh.
+type sessionRefreshConfig struct {
+	sessionMaxAge time.Duration
+	loginMaxAge   time.Duration
+}
+
+// sessionRefreshConfigFromEnv reads BW_SESSION_MAX_AGE and BW_LOGIN_MAX_AGE.
+func sessionRefreshConfigFromEnv() sessionRefreshConfig {
+	var config sessionRefreshConfig
+	for _, setting := range []struct {
+		key   string
+		value *time.Duration
+	}{
+		{"BW_SESSION_MAX_AGE", &config.sessionMaxAge},
+		{"BW_LOGIN_MAX_AGE", &config.loginMaxAge},
+	} {
+		val := os.Getenv(setting.key)
+		if val == "" {
+			continue
+		}
+		d, err := time.ParseDuration(val)
+		if err != nil || d < 0 {
+			sessionLog.Warn("Invalid format for "+setting.key+", proactive refresh is disabled", "value", val, "error", err)
+			continue
+		}
+		*setting.value = d
+	}
+	return config
+}
+
+// enabled reports whether any proactive refresh is configured.
+func (c sessionRefreshConfig) enabled() bool {
+	return c.sessionMaxAge > 0 || c.loginMaxAge > 0
+}
+
+// startSessionRefresh renews the session before it goes stale, instead of waiting for
+// a request to fail: the vault is unlocked again once the session is older than
+// BW_SESSION_MAX_AGE, and the wrapper logs in again once its login is older than
+// BW_LOGIN_MAX_AGE, e.g. ahead of the expiry of the API access token. It runs until
+// ctx is done.
+func startSessionRefresh(ctx context.Context, port string) {
+	config := sessionRefreshConfigFromEnv()
+	if !config.enabled() {
+		return
+	}
+	sessionLog.Info("Refreshing the session proactively", "session_max_age", config.sessionMaxAge, "login_max_age", config.loginMaxAge)
+	ticker := time.NewTicker(sessionRefreshCheckInterval)
+	defer ticker.Stop()
+	for {
+		select {
+		case <-ctx.Done():
+			return
+		case <-ticker.C:
+			refreshSession(port, config)
+		}
+	}
+}
+
+// refreshSession logs in again or unlocks the vault again if the login or session
+// exceeds its maximum age. A failed refresh is retried on the next check, while the
+// current session stays in use.
+func refreshSession(port string, config sessionRefreshConfig) {
+	if config.loginMaxAge > 0 && loginAge() >= config.loginMaxAge {
+		sessionLog.Info("Login reached its maximum age, logging in again", "age", loginAge().Round(time.Second))
+		if err := relogin(port, reloginRequest{}); err != nil {
+			sessionLog.Error("Proactive relogin failed", "error", err)
+			recordEvent(eventReloginFailed, "Proactive relogin failed", err)
+		}
+		return
+	}
+
+	start := sessionStart.Load()
+	if config.sessionMaxAge == 0 || start == 0 {
+		return
+	}
+	if age := time.Since(time.Unix(0, start)); age >= config.sessionMaxAge {
+		sessionLog.Info("Session reached its maximum age, unlocking the vault again", "age", age.Round(time.Second))
+		if err := reunlockVault(port, true); err != nil {
+			sessionLog.Error("Proactive session refresh failed", "error", err)
+			recordEvent(eventUnlockFailed, "Proactive session refresh failed", err)
+		}
+	}
+}
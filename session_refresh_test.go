@@ -0,0 +1,68 @@
+package main
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"os"
+	"os/exec"
+	"testing"
+	"time"
+)
+
+func TestSessionRefreshConfigFromEnv(t *testing.T) {
+	t.Setenv("BW_SESSION_MAX_AGE", "12h")
+	t.Setenv("BW_LOGIN_MAX_AGE", "invalid")
+	config := sessionRefreshConfigFromEnv()
+	if config.sessionMaxAge != 12*time.Hour || config.loginMaxAge != 0 || !config.enabled() {
+		t.Errorf("unexpected config %+v", config)
+	}
+
+	t.Setenv("BW_SESSION_MAX_AGE", "")
+	t.Setenv("BW_LOGIN_MAX_AGE", "")
+	if sessionRefreshConfigFromEnv().enabled() {
+		t.Error("expected the refresh to be disabled by default")
+	}
+}
+
+func TestRefreshSession(t *testing.T) {
+	execCommand = mockExecCommand
+	defer func() { execCommand = exec.CommandContext }()
+	defer sessionStart.Store(0)
+
+	ts := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		_, _ = w.Write([]byte(`{"data": {"template": {"status": "unlocked"}}}`))
+	}))
+	defer ts.Close()
+	u, _ := url.Parse(ts.URL)
+	t.Setenv("BW_SERVE_WAIT_INTERVAL", "10ms")
+	t.Setenv("BW_PASSWORD", "test-password")
+	t.Setenv("BW_SESSION", "old-session")
+	t.Setenv("BW_SESSION_STATE_FILE", "")
+
+	if err := bwServe.start(u.Port(), "old-session"); err != nil {
+		t.Fatalf("start failed: %v", err)
+	}
+	defer bwServe.stop()
+
+	config := sessionRefreshConfig{sessionMaxAge: time.Hour}
+
+	// A session younger than the maximum age is kept.
+	sessionStart.Store(time.Now().Add(-time.Minute).UnixNano())
+	refreshSession(u.Port(), config)
+	if got := os.Getenv("BW_SESSION"); got != "old-session" {
+		t.Errorf("BW_SESSION = %q, want the session to be kept", got)
+	}
+
+	sessionStart.Store(time.Now().Add(-2 * time.Hour).UnixNano())
+	refreshSession(u.Port(), config)
+	if got := os.Getenv("BW_SESSION"); got != "test-session-token" {
+		t.Errorf("BW_SESSION = %q, want %q", got, "test-session-token")
+	}
+	if age := time.Since(time.Unix(0, sessionStart.Load())); age > time.Minute {
+		t.Errorf("session age is %v after the refresh", age)
+	}
+	if !containsArgs(bwServe.cmd.Args, "--session", "test-session-token") {
+		t.Errorf("'bw serve' args = %v, want the new session", bwServe.cmd.Args)
+	}
+}
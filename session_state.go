@@ -0,0 +1,168 @@
+package main
+
+import (
+	"crypto/aes"
+	"crypto/cipher"
+	"crypto/pbkdf2"
+	"crypto/rand"
+	"crypto/sha256"
+	"errors"
+	"fmt"
+	"os"
+	"path/filepath"
+)
+
+const (
+	sessionStateSaltSize   = 16
+	sessionStateIterations = 600000
+)
+
+// sessionStatePassphrase returns the passphrase used to encrypt the persisted
+// session. BW_SESSION_STATE_KEY takes precedence over the master password.
+func sessionStatePassphrase() (string, error) {
+	key, err := getSecret("BW_SESSION_STATE_KEY")
+	if err != nil || key != "" {
+		return key, err
+	}
+	return getPassword()
+}
+
+// loadPersistedSession reads and decrypts the session stored in
+// BW_SESSION_STATE_FILE. It returns an empty string if persistence is disabled,
+// no state exists yet, or the state cannot be decrypted.
+func loadPersistedSession() string {
+	path := os.Getenv("BW_SESSION_STATE_FILE")
+	if path == "" {
+		return ""
+	}
+
+	data, err := os.ReadFile(path)
+	if err != nil {
+		if !errors.Is(err, os.ErrNotExist) {
+			sessionLog.Warn("Failed to read session state file", "path", path, "error", err)
+		}
+		return ""
+	}
+	passphrase, err := sessionStatePassphrase()
+	if err != nil || passphrase == "" {
+		sessionLog.Warn("No key available to decrypt session state file", "path", path)
+		return ""
+	}
+	session, err := decryptSessionState(data, passphrase)
+	if err != nil {
+		sessionLog.Warn("Failed to decrypt session state file", "path", path, "error", err)
+		return ""
+	}
+	return session
+}
+
+// persistSession encrypts the session and writes it to BW_SESSION_STATE_FILE, if set.
+// Failures are logged but not fatal, as they only affect the next restart.
+func persistSession(session string) {
+	path := os.Getenv("BW_SESSION_STATE_FILE")
+	if path == "" {
+		return
+	}
+
+	passphrase, err := sessionStatePassphrase()
+	if err != nil || passphrase == "" {
+		sessionLog.Warn("No key available to encrypt session state, not persisting session")
+		return
+	}
+	data, err := encryptSessionState(session, passphrase)
+	if err != nil {
+		sessionLog.Warn("Failed to encrypt session state", "error", err)
+		return
+	}
+
+	if err := writeFileAtomic(path, data); err != nil {
+		sessionLog.Warn("Failed to write session state file", "path", path, "error", err)
+		return
+	}
+	sessionLog.Info("Persisted encrypted session state", "path", path)
+}
+
+// writeFileAtomic writes data to a temporary file first and renames it to path, so a
+// crash never leaves a truncated file behind.
+func writeFileAtomic(path string, data []byte) error {
+	tmp, err := os.CreateTemp(filepath.Dir(path), "."+filepath.Base(path)+"-*")
+	if err != nil {
+		return err
+	}
+	defer func() { _ = os.Remove(tmp.Name()) }()
+	if _, err := tmp.Write(data); err != nil {
+		_ = tmp.Close()
+		return err
+	}
+	if err := tmp.Close(); err != nil {
+		return err
+	}
+	return os.Rename(tmp.Name(), path)
+}
+
+// encryptSessionState encrypts the session with encryptState.
+func encryptSessionState(session, passphrase string) ([]byte, error) {
+	return encryptState([]byte(session), passphrase)
+}
+
+// decryptSessionState reverses encryptSessionState.
+func decryptSessionState(data []byte, passphrase string) (string, error) {
+	plaintext, err := decryptState(data, passphrase)
+	if err != nil {
+		return "", err
+	}
+	return string(plaintext), nil
+}
+
+// encryptState encrypts state persisted across restarts with AES-256-GCM using a key
+// derived from the passphrase with PBKDF2. The output is salt || nonce || ciphertext.
+func encryptState(plaintext []byte, passphrase string) ([]byte, error) {
+	salt := make([]byte, sessionStateSaltSize)
+	if _, err := rand.Read(salt); err != nil {
+		return nil, err
+	}
+	gcm, err := sessionStateCipher(passphrase, salt)
+	if err != nil {
+		return nil, err
+	}
+	nonce := make([]byte, gcm.NonceSize())
+	if _, err := rand.Read(nonce); err != nil {
+		return nil, err
+	}
+
+	out := append(salt, nonce...)
+	return gcm.Seal(out, nonce, plaintext, nil), nil
+}
+
+// decryptState reverses encryptState.
+func decryptState(data []byte, passphrase string) ([]byte, error) {
+	if len(data) < sessionStateSaltSize {
+		return nil, errors.New("state is truncated")
+	}
+	salt, data := data[:sessionStateSaltSize], data[sessionStateSaltSize:]
+	gcm, err := sessionStateCipher(passphrase, salt)
+	if err != nil {
+		return nil, err
+	}
+	if len(data) < gcm.NonceSize() {
+		return nil, errors.New("state is truncated")
+	}
+	nonce, ciphertext := data[:gcm.NonceSize()], data[gcm.NonceSize():]
+	plaintext, err := gcm.Open(nil, nonce, ciphertext, nil)
+	if err != nil {
+		return nil, fmt.Errorf("wrong key or corrupted state: %v", err)
+	}
+	return plaintext, nil
+}
+
+func sessionStateCipher(passphrase string, salt []byte) (cipher.AEAD, error) {
+	key, err := pbkdf2.Key(sha256.New, passphrase, salt, sessionStateIterations, 32)
+	if err != nil {
+		return nil, err
+	}
+	block, err := aes.NewCipher(key)
+	if err != nil {
+		return nil, err
+	}
+	return cipher.NewGCM(block)
+}
@@ -0,0 +1,61 @@
+package main
+
+import (
+	"os"
+	"os/exec"
+	"path/filepath"
+	"testing"
+)
+
+func TestSessionStateRoundTrip(t *testing.T) {
+	data, err := encryptSessionState("test-session-token", "test-password")
+	if err != nil {
+		t.Fatalf("encrypt failed: %v", err)
+	}
+
+	got, err := decryptSessionState(data, "test-password")
+	if err != nil {
+		t.Fatalf("decrypt failed: %v", err)
+	}
+	if got != "test-session-token" {
+		t.Errorf("decrypted session = %q, want %q", got, "test-session-token")
+	}
+
+	if _, err := decryptSessionState(data, "wrong-password"); err == nil {
+		t.Error("expected error when decrypting with the wrong passphrase")
+	}
+	if _, err := decryptSessionState(data[:10], "test-password"); err == nil {
+		t.Error("expected error when decrypting truncated state")
+	}
+}
+
+func TestLoginAndGetSession_PersistsAndResumesSession(t *testing.T) {
+	execCommand = mockExecCommand
+	defer func() { execCommand = exec.CommandContext }()
+
+	statePath := filepath.Join(t.TempDir(), "session.enc")
+	t.Setenv("BW_SESSION_STATE_FILE", statePath)
+	t.Setenv("BW_SESSION", "")
+	t.Setenv("BW_LOGIN_METHOD", "")
+	t.Setenv("BW_CLIENTID", "user.test-id")
+	t.Setenv("BW_CLIENTSECRET", "test-secret")
+	t.Setenv("BW_PASSWORD", "test-password")
+	t.Setenv("BW_HOST", "")
+
+	if _, err := loginAndGetSession(); err != nil {
+		t.Fatalf("expected nil, got %v", err)
+	}
+	if _, err := os.Stat(statePath); err != nil {
+		t.Fatalf("expected session state file to be written: %v", err)
+	}
+
+	// Without credentials the next start can only succeed from the persisted state.
+	t.Setenv("BW_CLIENTID", "")
+	session, err := loginAndGetSession()
+	if err != nil {
+		t.Fatalf("expected persisted session to be resumed, got %v", err)
+	}
+	if session != "test-session-token" {
+		t.Errorf("session = %q, want %q", session, "test-session-token")
+	}
+}
@@ -0,0 +1,137 @@
+package main
+
+import (
+	"context"
+	"fmt"
+	"net/http"
+	"os"
+	"os/signal"
+	"sync"
+	"sync/atomic"
+	"syscall"
+	"time"
+)
+
+const defaultShutdownTimeout = 20 * time.Second
+
+// shuttingDown is set once a termination signal was received, so that children
+// exiting as a result are not treated as crashes.
+var shuttingDown atomic.Bool
+
+// servers are the proxy servers started by listenAndServe, drained on shutdown.
+var (
+	serversMu sync.Mutex
+	servers   []*http.Server
+)
+
+// trackServer registers a server to be drained on shutdown.
+func trackServer(s *http.Server) {
+	serversMu.Lock()
+	defer serversMu.Unlock()
+	servers = append(servers, s)
+}
+
+// taskFailures receives the error of a supervised background task that failed.
+var taskFailures = make(chan error, 1)
+
+// supervise runs task, such as a server, in the background. If it fails, the error is
+// handed to main, which shuts down in an orderly way instead of exiting on the spot.
+func supervise(name string, task func() error) {
+	go func() {
+		if err := task(); err != nil {
+			failTask(fmt.Errorf("%s failed: %w", name, err))
+		}
+	}()
+}
+
+// failTask hands the failure of a background task to main. Only the first failure is
+// kept, as the wrapper is already shutting down after it.
+func failTask(err error) {
+	select {
+	case taskFailures <- err:
+	default:
+	}
+}
+
+// awaitShutdown blocks until a termination signal is received or a supervised task
+// fails, and then shuts down with the cleanup steps.
+func awaitShutdown(ctx context.Context, steps ...func(ctx context.Context)) {
+	select {
+	case <-ctx.Done():
+		shutdown(steps...)
+	case err := <-taskFailures:
+		exitAfterFailure(err, steps...)
+	}
+}
+
+// exitAfterFailure shuts down with the cleanup steps after a supervised task failed,
+// reporting the failure, and exits with a non-zero status.
+func exitAfterFailure(err error, steps ...func(ctx context.Context)) {
+	mainLog.Error("Shutting down after a failure", "error", err)
+	reportError("fatal", err.Error(), "")
+	shutdown(steps...)
+	os.Exit(1)
+}
+
+// shutdownSignals returns a context that is cancelled on SIGTERM or SIGINT. Background
+// tasks such as the periodic sync stop when it is done.
+func shutdownSignals() (context.Context, context.CancelFunc) {
+	return signal.NotifyContext(context.Background(), syscall.SIGTERM, os.Interrupt)
+}
+
+// shutdownTimeout returns how long shutting down may take, from BW_SHUTDOWN_TIMEOUT.
+func shutdownTimeout() time.Duration {
+	val := os.Getenv("BW_SHUTDOWN_TIMEOUT")
+	if val == "" {
+		return defaultShutdownTimeout
+	}
+	d, err := time.ParseDuration(val)
+	if err != nil || d <= 0 {
+		mainLog.Warn("Invalid format for BW_SHUTDOWN_TIMEOUT, using default", "value", val, "default", defaultShutdownTimeout, "error", err)
+		return defaultShutdownTimeout
+	}
+	return d
+}
+
+// shutdown stops accepting connections, waits for in-flight requests to finish and
+// then runs the cleanup steps in order, all within BW_SHUTDOWN_TIMEOUT.
+func shutdown(steps ...func(ctx context.Context)) {
+	shuttingDown.Store(true)
+	sdNotify("STOPPING=1")
+	timeout := shutdownTimeout()
+	mainLog.Info("Shutting down", "timeout", timeout)
+	ctx, cancel := context.WithTimeout(context.Background(), timeout)
+	defer cancel()
+
+	serversMu.Lock()
+	drain := servers
+	servers = nil
+	serversMu.Unlock()
+	for _, s := range drain {
+		if err := s.Shutdown(ctx); err != nil {
+			proxyLog.Warn("In-flight requests did not finish in time", "error", err)
+		}
+	}
+
+	for _, step := range steps {
+		step(ctx)
+	}
+	mainLog.Info("Shutdown complete")
+}
+
+// stopBwServe terminates 'bw serve' and, depending on BW_SHUTDOWN_ACTION, locks the
+// vault or logs out, so no usable session is left behind in the CLI data directory.
+func stopBwServe(ctx context.Context) {
+	bwServe.stop()
+
+	switch action := os.Getenv("BW_SHUTDOWN_ACTION"); action {
+	case "", "none":
+	case "lock", "logout":
+		cmd := execCommand(ctx, "bw", action)
+		if output, err := observeCLIOutput("bw "+action, cmd.CombinedOutput); err != nil {
+			authLog.Warn("bw "+action+" failed on shutdown", "output", string(output), "error", err)
+		}
+	default:
+		mainLog.Warn("Invalid format for BW_SHUTDOWN_ACTION, expected 'none', 'lock' or 'logout'", "value", action)
+	}
+}
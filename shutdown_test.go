@@ -0,0 +1,141 @@
+package main
+
+import (
+	"context"
+	"errors"
+	"io"
+	"net"
+	"net/http"
+	"os/exec"
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/prometheus/client_golang/prometheus"
+	dto "github.com/prometheus/client_model/go"
+)
+
+func TestShutdown(t *testing.T) {
+	defer shuttingDown.Store(false)
+	socket := filepath.Join(t.TempDir(), "bw.sock")
+	t.Setenv("BW_PROXY_SOCKET", socket)
+	t.Setenv("BW_SHUTDOWN_TIMEOUT", "5s")
+
+	started := make(chan struct{})
+	served := make(chan error, 1)
+	go func() {
+		served <- listenAndServe("0", http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			close(started)
+			time.Sleep(200 * time.Millisecond)
+			_, _ = w.Write([]byte("OK"))
+		}))
+	}()
+
+	client := &http.Client{Transport: &http.Transport{
+		DialContext: func(ctx context.Context, _, _ string) (net.Conn, error) {
+			return (&net.Dialer{}).DialContext(ctx, "unix", socket)
+		},
+	}}
+	type result struct {
+		body string
+		err  error
+	}
+	results := make(chan result, 1)
+	go func() {
+		var resp *http.Response
+		var err error
+		for i := 0; i < 50; i++ {
+			if resp, err = client.Get("http://localhost/list/object/items"); err == nil {
+				break
+			}
+			time.Sleep(20 * time.Millisecond)
+		}
+		if err != nil {
+			results <- result{err: err}
+			return
+		}
+		defer func() { _ = resp.Body.Close() }()
+		body, err := io.ReadAll(resp.Body)
+		results <- result{string(body), err}
+	}()
+	<-started
+
+	var steps []string
+	shutdown(func(context.Context) { steps = append(steps, "stop") })
+
+	// The in-flight request is completed before shutdown returns.
+	select {
+	case r := <-results:
+		if r.err != nil || r.body != "OK" {
+			t.Errorf("in-flight request: got %q, %v", r.body, r.err)
+		}
+	default:
+		t.Error("shutdown returned before the in-flight request finished")
+	}
+	if err := <-served; err != nil {
+		t.Errorf("listenAndServe returned %v after shutdown, want nil", err)
+	}
+	if len(steps) != 1 || !shuttingDown.Load() {
+		t.Errorf("expected the cleanup steps to run, got %v", steps)
+	}
+	if _, err := client.Get("http://localhost/list/object/items"); err == nil {
+		t.Error("expected new connections to be refused after shutdown")
+	}
+}
+
+func TestStopBwServe(t *testing.T) {
+	execCommand = mockExecCommand
+	defer func() { execCommand = exec.CommandContext }()
+	defer func(p *bwServeProcess) { bwServe = p }(bwServe)
+	bwServe = &bwServeProcess{}
+	t.Setenv("BW_SHUTDOWN_ACTION", "lock")
+
+	if err := bwServe.start("0", "test-session-token"); err != nil {
+		t.Fatal(err)
+	}
+	done := bwServe.done
+	locks := func() uint64 {
+		metric := &dto.Metric{}
+		_ = cliCommandDuration.WithLabelValues("bw lock", "0").(prometheus.Histogram).Write(metric)
+		return metric.GetHistogram().GetSampleCount()
+	}
+	before := locks()
+	stopBwServe(context.Background())
+
+	select {
+	case <-done:
+	default:
+		t.Error("expected 'bw serve' to be stopped")
+	}
+	if got := locks(); got != before+1 {
+		t.Errorf("expected 'bw lock' to be run once, got %v", got-before)
+	}
+}
+
+func TestSupervise(t *testing.T) {
+	listener, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer func() { _ = listener.Close() }()
+	_, port, _ := net.SplitHostPort(listener.Addr().String())
+
+	// A server failing in the background is handed to main instead of exiting.
+	supervise("metrics server", func() error { return startMetricsServer(port) })
+	select {
+	case err := <-taskFailures:
+		if !strings.Contains(err.Error(), "metrics server failed") {
+			t.Errorf("unexpected error %v", err)
+		}
+	case <-time.After(5 * time.Second):
+		t.Fatal("failure was not reported")
+	}
+
+	// Only the first failure is kept.
+	failTask(errors.New("first"))
+	failTask(errors.New("second"))
+	if err := <-taskFailures; err.Error() != "first" {
+		t.Errorf("got %v want first", err)
+	}
+}
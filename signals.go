@@ -0,0 +1,50 @@
+package main
+
+import (
+	"context"
+	"os"
+	"os/signal"
+	"syscall"
+)
+
+// watchOperatorSignals passes SIGUSR1 and SIGUSR2 to handle, so that operators can
+// trigger operations with `docker kill -s` without exposing the admin endpoints.
+// Without it, either signal would terminate the process.
+func watchOperatorSignals(handle func(sig os.Signal)) {
+	ch := make(chan os.Signal, 1)
+	signal.Notify(ch, syscall.SIGUSR1, syscall.SIGUSR2)
+	go func() {
+		for sig := range ch {
+			handle(sig)
+		}
+	}()
+}
+
+// handleOperatorSignal syncs on SIGUSR1, like POST /sync, even if the periodic sync
+// is paused or disabled, and logs in and unlocks again on SIGUSR2, restarting
+// 'bw serve' with the new session.
+func handleOperatorSignal(port string, sig os.Signal) {
+	switch sig {
+	case syscall.SIGUSR1:
+		if currentStartupStage() != stageReady {
+			syncLog.Warn("Received SIGUSR1 during startup, ignoring it")
+			return
+		}
+		syncLog.Info("Received SIGUSR1, syncing now")
+		if err := runSync(context.Background()); err != nil {
+			syncLog.Error("Sync failed", "error", err)
+			return
+		}
+		syncLog.Info("Sync successful")
+	case syscall.SIGUSR2:
+		if currentStartupStage() != stageReady {
+			authLog.Warn("Received SIGUSR2 during startup, ignoring it")
+			return
+		}
+		authLog.Info("Received SIGUSR2, logging in again")
+		if err := relogin(port, reloginRequest{}); err != nil {
+			authLog.Error("Relogin failed", "error", err)
+			recordEvent(eventReloginFailed, "Relogin failed", err)
+		}
+	}
+}
@@ -0,0 +1,50 @@
+package main
+
+import (
+	"os"
+	"os/exec"
+	"syscall"
+	"testing"
+	"time"
+)
+
+func TestWatchOperatorSignals(t *testing.T) {
+	received := make(chan os.Signal, 1)
+	watchOperatorSignals(func(sig os.Signal) { received <- sig })
+	if err := syscall.Kill(os.Getpid(), syscall.SIGUSR2); err != nil {
+		t.Fatal(err)
+	}
+	select {
+	case sig := <-received:
+		if sig != syscall.SIGUSR2 {
+			t.Errorf("got %v want %v", sig, syscall.SIGUSR2)
+		}
+	case <-time.After(5 * time.Second):
+		t.Fatal("signal was not handled")
+	}
+}
+
+func TestHandleOperatorSignal_Sync(t *testing.T) {
+	execCommand = mockExecCommand
+	defer func() { execCommand = exec.CommandContext }()
+	defer func() { syncs = &syncTracker{} }()
+
+	// SIGUSR1 syncs right away, also when the periodic sync is disabled or paused.
+	for _, tc := range []struct {
+		name     string
+		disabled string
+		paused   bool
+	}{
+		{"enabled", "false", false},
+		{"disabled", "true", false},
+		{"paused", "false", true},
+	} {
+		syncs = &syncTracker{}
+		syncs.pause(tc.paused)
+		t.Setenv("BW_DISABLE_SYNC", tc.disabled)
+		handleOperatorSignal("8088", syscall.SIGUSR1)
+		if s := syncs.snapshot(); s.LastSuccess == nil {
+			t.Errorf("%s: expected a sync, got %+v", tc.name, s)
+		}
+	}
+}
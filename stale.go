@@ -0,0 +1,161 @@
+package main
+
+import (
+	"bytes"
+	"net/http"
+	"os"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+)
+
+const (
+	defaultStaleCacheMaxAge     = 24 * time.Hour
+	defaultStaleCacheMaxEntries = 1000
+)
+
+// staleEntry is a successful response kept to be served while the vault is unavailable.
+type staleEntry struct {
+	header http.Header
+	body   []byte
+	stored time.Time
+}
+
+// staleCache keeps the most recent successful GET response for every URL, to serve
+// it in place of an error while 'bw serve' is locked or unreachable, e.g. during a
+// Bitwarden outage. The responses hold secrets, so they are only kept in memory.
+type staleCache struct {
+	mu         sync.Mutex
+	entries    map[string]*staleEntry
+	maxAge     time.Duration
+	maxEntries int
+}
+
+// staleCacheFromEnv returns the cache if BW_STALE_CACHE is set.
+func staleCacheFromEnv() *staleCache {
+	if getEnv("BW_STALE_CACHE", "false") != "true" {
+		return nil
+	}
+	c := &staleCache{
+		entries:    make(map[string]*staleEntry),
+		maxAge:     defaultStaleCacheMaxAge,
+		maxEntries: defaultStaleCacheMaxEntries,
+	}
+	if val := os.Getenv("BW_STALE_CACHE_MAX_AGE"); val != "" {
+		d, err := time.ParseDuration(val)
+		if err != nil || d <= 0 {
+			proxyLog.Warn("Invalid format for BW_STALE_CACHE_MAX_AGE, using default", "value", val, "default", defaultStaleCacheMaxAge, "error", err)
+		} else {
+			c.maxAge = d
+		}
+	}
+	if val := os.Getenv("BW_STALE_CACHE_MAX_ENTRIES"); val != "" {
+		n, err := strconv.Atoi(val)
+		if err != nil || n <= 0 {
+			proxyLog.Warn("Invalid format for BW_STALE_CACHE_MAX_ENTRIES, using default", "value", val, "default", defaultStaleCacheMaxEntries, "error", err)
+		} else {
+			c.maxEntries = n
+		}
+	}
+	registerResponseCache(c)
+	return c
+}
+
+// middleware keeps successful GET responses and serves the kept response, marked
+// with an X-BW-Stale header, if 'bw serve' fails a later request because the vault is
+// locked or unreachable.
+func (c *staleCache) middleware(next http.Handler) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.Method != http.MethodGet || !isStaleCacheable(r.URL.Path) {
+			next.ServeHTTP(w, r)
+			return
+		}
+		// The kept response must be readable by every client.
+		r.Header.Del("Accept-Encoding")
+		key := r.URL.RequestURI()
+		capture := newResponseCapture()
+		next.ServeHTTP(capture, r)
+
+		switch {
+		case capture.status == http.StatusOK:
+			c.store(key, capture.header, capture.body.Bytes())
+		case vaultUnavailable(capture.status, capture.body.Bytes()):
+			if entry := c.load(key); entry != nil {
+				age := time.Since(entry.stored)
+				proxyLog.Warn("Vault is unavailable, serving a stale response", "request_id", requestID(r), "path", r.URL.Path, "status", capture.status, "age", age.Round(time.Second))
+				stale := &responseCapture{header: entry.header.Clone(), status: http.StatusOK}
+				stale.header.Set("X-BW-Stale", "true")
+				stale.header.Set("X-BW-Stale-Age", strconv.Itoa(int(age.Seconds())))
+				stale.writeTo(w, entry.body)
+				return
+			}
+		}
+		capture.writeTo(w, capture.body.Bytes())
+	})
+}
+
+// vaultUnavailable reports whether a failed response means that 'bw serve' is locked or
+// could not be reached, rather than that the request itself was bad.
+func vaultUnavailable(status int, body []byte) bool {
+	switch status {
+	case http.StatusBadGateway, http.StatusServiceUnavailable, http.StatusGatewayTimeout:
+		return true
+	}
+	return status >= 400 && status < 500 && bytes.Contains(bytes.ToLower(body), []byte("vault is locked"))
+}
+
+// store keeps a response, evicting the oldest one if the cache is full.
+func (c *staleCache) store(key string, header http.Header, body []byte) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	if _, ok := c.entries[key]; !ok && len(c.entries) >= c.maxEntries {
+		var oldest string
+		for k, e := range c.entries {
+			if oldest == "" || e.stored.Before(c.entries[oldest].stored) {
+				oldest = k
+			}
+		}
+		delete(c.entries, oldest)
+	}
+	c.entries[key] = &staleEntry{header: header.Clone(), body: bytes.Clone(body), stored: time.Now()}
+}
+
+// invalidate removes the matching responses.
+func (c *staleCache) invalidate(match func(key string) bool) int {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	n := 0
+	for key := range c.entries {
+		if match(key) {
+			delete(c.entries, key)
+			n++
+		}
+	}
+	return n
+}
+
+// load returns the kept response for key, unless it is older than the maximum age.
+func (c *staleCache) load(key string) *staleEntry {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	entry, ok := c.entries[key]
+	if !ok {
+		return nil
+	}
+	if time.Since(entry.stored) > c.maxAge {
+		delete(c.entries, key)
+		return nil
+	}
+	return entry
+}
+
+// isStaleCacheable reports whether a path may be served from the stale cache. Only
+// reads of vault data are kept, not e.g. generated passwords. TOTP codes are invalid
+// once their period has passed, so they are not kept either.
+func isStaleCacheable(path string) bool {
+	if strings.HasPrefix(path, "/object/totp/") {
+		return false
+	}
+	return strings.HasPrefix(path, "/list/") || strings.HasPrefix(path, "/object/")
+}
@@ -0,0 +1,86 @@
+package main
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+)
+
+func TestStaleCache(t *testing.T) {
+	t.Setenv("BW_STALE_CACHE", "true")
+	t.Setenv("BW_STALE_CACHE_MAX_ENTRIES", "2")
+	cache := staleCacheFromEnv()
+	if cache == nil || cache.maxEntries != 2 || cache.maxAge != defaultStaleCacheMaxAge {
+		t.Fatalf("unexpected cache %+v", cache)
+	}
+
+	status, body := http.StatusOK, `{"success":true,"data":{"id":"1"}}`
+	handler := cache.middleware(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.Header().Set("Content-Type", "application/json")
+		w.WriteHeader(status)
+		_, _ = w.Write([]byte(body))
+	}))
+	send := func(method, path string) *httptest.ResponseRecorder {
+		rr := httptest.NewRecorder()
+		handler.ServeHTTP(rr, httptest.NewRequest(method, path, nil))
+		return rr
+	}
+
+	if rr := send("GET", "/object/item/1"); rr.Code != http.StatusOK || rr.Header().Get("X-BW-Stale") != "" {
+		t.Fatalf("got %v %v", rr.Code, rr.Header())
+	}
+
+	// The kept response is served while the vault is locked or unreachable.
+	for _, failure := range []struct {
+		status int
+		body   string
+	}{
+		{http.StatusBadRequest, `{"success":false,"message":"Vault is locked."}`},
+		{http.StatusBadGateway, "Bad gateway"},
+	} {
+		status, body = failure.status, failure.body
+		rr := send("GET", "/object/item/1")
+		if rr.Code != http.StatusOK || rr.Body.String() != `{"success":true,"data":{"id":"1"}}` || rr.Header().Get("X-BW-Stale") != "true" {
+			t.Errorf("%d: got %v %q %v", failure.status, rr.Code, rr.Body.String(), rr.Header())
+		}
+	}
+
+	// Other errors, uncached paths and writes are passed on.
+	status, body = http.StatusNotFound, "Not found"
+	if rr := send("GET", "/object/item/1"); rr.Code != http.StatusNotFound {
+		t.Errorf("got %v want %v", rr.Code, http.StatusNotFound)
+	}
+	status, body = http.StatusBadGateway, "Bad gateway"
+	for _, req := range [][2]string{{"GET", "/object/item/2"}, {"GET", "/generate"}, {"POST", "/object/item/1"}} {
+		if rr := send(req[0], req[1]); rr.Code != http.StatusBadGateway {
+			t.Errorf("%s %s: got %v want %v", req[0], req[1], rr.Code, http.StatusBadGateway)
+		}
+	}
+
+	// TOTP codes expire with their period, so they are never served stale.
+	status, body = http.StatusOK, `{"success":true,"data":{"data":"123456"}}`
+	send("GET", "/object/totp/1")
+	status, body = http.StatusBadGateway, "Bad gateway"
+	if rr := send("GET", "/object/totp/1"); rr.Code != http.StatusBadGateway {
+		t.Errorf("stale TOTP code: got %v want %v", rr.Code, http.StatusBadGateway)
+	}
+
+	// Expired responses are dropped.
+	cache.maxAge = time.Nanosecond
+	time.Sleep(time.Millisecond)
+	if rr := send("GET", "/object/item/1"); rr.Code != http.StatusBadGateway {
+		t.Errorf("got %v want %v", rr.Code, http.StatusBadGateway)
+	}
+}
+
+func TestStaleCacheEviction(t *testing.T) {
+	cache := &staleCache{entries: make(map[string]*staleEntry), maxAge: time.Hour, maxEntries: 2}
+	for _, key := range []string{"/a", "/b", "/c"} {
+		cache.store(key, http.Header{}, []byte(key))
+		time.Sleep(time.Millisecond)
+	}
+	if cache.load("/a") != nil || cache.load("/b") == nil || cache.load("/c") == nil {
+		t.Error("expected the oldest entry to be evicted")
+	}
+}
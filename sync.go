@@ -0,0 +1,411 @@
+package main
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"net/http"
+	"os"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+)
+
+const (
+	defaultSyncInterval       = 2 * time.Minute
+	defaultSyncAlertThreshold = 3
+	defaultSyncMaxBackoff     = 1 * time.Hour
+)
+
+// syncInterval returns the interval of the periodic sync from BW_SYNC_INTERVAL, or the
+// default along with an error if it is invalid.
+func syncInterval() (time.Duration, error) {
+	val := getEnv("BW_SYNC_INTERVAL", "2m")
+	interval, err := time.ParseDuration(val)
+	if err != nil || interval <= 0 {
+		return defaultSyncInterval, fmt.Errorf("invalid BW_SYNC_INTERVAL '%s'", val)
+	}
+	return interval, nil
+}
+
+// syncSchedule decides when the periodic sync runs next.
+type syncSchedule interface {
+	next(t time.Time) time.Time
+	String() string
+}
+
+// intervalSchedule runs the sync at a fixed interval.
+type intervalSchedule time.Duration
+
+func (d intervalSchedule) next(t time.Time) time.Time { return t.Add(time.Duration(d)) }
+
+func (d intervalSchedule) String() string { return time.Duration(d).String() }
+
+// syncScheduleFromEnv returns the schedule of the periodic sync: the cron expression in
+// BW_SYNC_CRON if set, the interval in BW_SYNC_INTERVAL otherwise. If it is invalid,
+// the default interval is returned along with the error.
+func syncScheduleFromEnv() (syncSchedule, error) {
+	expr := os.Getenv("BW_SYNC_CRON")
+	if expr == "" {
+		interval, err := syncInterval()
+		return intervalSchedule(interval), err
+	}
+	schedule, err := parseCron(expr)
+	if err != nil {
+		return intervalSchedule(defaultSyncInterval), fmt.Errorf("invalid BW_SYNC_CRON '%s': %v", expr, err)
+	}
+	if schedule.next(time.Now()).IsZero() {
+		return intervalSchedule(defaultSyncInterval), fmt.Errorf("BW_SYNC_CRON '%s' never matches", expr)
+	}
+	return schedule, nil
+}
+
+// syncMaxBackoff returns BW_SYNC_MAX_BACKOFF, the longest the periodic sync backs off
+// after consecutive failures.
+func syncMaxBackoff() time.Duration {
+	val := os.Getenv("BW_SYNC_MAX_BACKOFF")
+	if val == "" {
+		return defaultSyncMaxBackoff
+	}
+	d, err := time.ParseDuration(val)
+	if err != nil || d < 0 {
+		syncLog.Warn("Invalid format for BW_SYNC_MAX_BACKOFF, using default", "value", val, "default", defaultSyncMaxBackoff, "error", err)
+		return defaultSyncMaxBackoff
+	}
+	return d
+}
+
+// nextSyncTime returns when the periodic sync runs next after now. After consecutive
+// failures, the gap to the next sync is doubled for every failure, up to maxBackoff,
+// and the sync runs at the first scheduled time after that, so that a broken server
+// is not hit on every tick.
+func nextSyncTime(schedule syncSchedule, now time.Time, failures int, maxBackoff time.Duration) time.Time {
+	next := schedule.next(now)
+	if failures == 0 || next.IsZero() {
+		return next
+	}
+	backoff := min(next.Sub(now)<<min(failures, 16), maxBackoff)
+	for next.Before(now.Add(backoff)) {
+		later := schedule.next(next)
+		if later.IsZero() {
+			break
+		}
+		next = later
+	}
+	return next
+}
+
+// syncEnabled reports whether the periodic sync is enabled.
+func syncEnabled() bool {
+	return getEnv("BW_DISABLE_SYNC", "false") != "true"
+}
+
+// syncFlight is the sync currently running, if any. Its err is set before done is closed.
+type syncFlight struct {
+	done chan struct{}
+	err  error
+}
+
+var (
+	syncFlightMu sync.Mutex
+	currentSync  *syncFlight
+)
+
+// runSync runs 'bw sync' and records its outcome. It is shared by the periodic sync and
+// the /sync endpoint, which run it in-process rather than calling the proxy. If a sync
+// is already running, no second 'bw sync' is started: the caller waits for the running
+// one and gets its result.
+func runSync(ctx context.Context) error {
+	syncFlightMu.Lock()
+	if flight := currentSync; flight != nil {
+		syncFlightMu.Unlock()
+		syncLog.Info("Sync already running, waiting for its result")
+		select {
+		case <-flight.done:
+			return flight.err
+		case <-ctx.Done():
+			return ctx.Err()
+		}
+	}
+	flight := &syncFlight{done: make(chan struct{})}
+	currentSync = flight
+	syncFlightMu.Unlock()
+
+	flight.err = execSync(ctx)
+	syncFlightMu.Lock()
+	currentSync = nil
+	syncFlightMu.Unlock()
+	close(flight.done)
+	return flight.err
+}
+
+// execSync runs 'bw sync' and records its outcome. With BW_SYNC_SKIP_UNCHANGED, the
+// sync is skipped if the vault has not changed on the server since the last one.
+func execSync(ctx context.Context) error {
+	start := time.Now()
+	if skipUnchangedSyncEnabled() {
+		unchanged, err := vaultUnchanged(ctx)
+		if err != nil {
+			syncLog.Warn("Could not tell whether the vault changed, syncing", "error", err)
+		} else if unchanged {
+			syncLog.Info("Vault unchanged since the last sync, skipping it")
+			syncs.record(start, nil)
+			return nil
+		}
+	}
+	cliCtx, cancel, err := cliContext(ctx)
+	if err != nil {
+		syncs.record(start, err)
+		return err
+	}
+	defer cancel()
+	cmd := execCommand(cliCtx, "bw", "sync")
+	var out bytes.Buffer
+	cmd.Stdout = &out
+	cmd.Stderr = &out
+	err = runTraced(ctx, "bw sync", cmd.Run)
+	if errors.Is(cliCtx.Err(), context.DeadlineExceeded) {
+		out.WriteString("timed out")
+	}
+	if err != nil {
+		err = fmt.Errorf("%v: %s", err, strings.TrimSpace(out.String()))
+	}
+	syncs.record(start, err)
+	if err == nil {
+		go vaultChanges.update(getEnv("BW_SERVE_PORT", "8088"))
+		go runSyncHook(start, time.Now())
+	}
+	return err
+}
+
+// syncOnStart runs a sync before the wrapper reports ready if BW_SYNC_ON_START is set,
+// so the first requests after a deploy see the current vault even if the local data
+// was kept from an earlier run. A failed sync is logged and startup continues.
+func syncOnStart(ctx context.Context) {
+	if getEnv("BW_SYNC_ON_START", "false") != "true" {
+		return
+	}
+	setStartupStage(stageSync)
+	syncLog.Info("Running the initial sync")
+	if err := runSync(ctx); err != nil {
+		syncLog.Warn("Initial sync failed, serving the vault as it is", "error", err)
+		return
+	}
+	syncLog.Info("Initial sync successful")
+}
+
+// syncRequests carries requests for an immediate periodic sync, made after responses
+// were restored from BW_CACHE_FILE and on push notifications of vault changes.
+var syncRequests = make(chan struct{}, 1)
+
+// requestSync asks the periodic sync to run now. Requests made while one is pending
+// are merged into it.
+func requestSync() {
+	select {
+	case syncRequests <- struct{}{}:
+	default:
+	}
+}
+
+// syncStatus describes the most recent syncs, served at /sync/status.
+type syncStatus struct {
+	LastAttempt    *time.Time `json:"lastAttempt"`
+	LastSuccess    *time.Time `json:"lastSuccess"`
+	LastError      string     `json:"lastError,omitempty"`
+	LastDurationMs int64      `json:"lastDurationMs"`
+	Interval       string     `json:"interval"`
+	NextSync       *time.Time `json:"nextSync,omitempty"`
+	Paused         bool       `json:"paused"`
+}
+
+// syncTracker records the outcome of every sync, periodic or requested.
+type syncTracker struct {
+	mu       sync.Mutex
+	status   syncStatus
+	failures int
+}
+
+var syncs = &syncTracker{}
+
+// record updates the status and metrics with a sync that started at start.
+func (t *syncTracker) record(start time.Time, err error) {
+	end := time.Now()
+	recordSync(end.Sub(start), err)
+
+	t.mu.Lock()
+	defer t.mu.Unlock()
+	t.status.LastAttempt = &start
+	t.status.LastDurationMs = end.Sub(start).Milliseconds()
+	if err != nil {
+		recordEvent(eventSyncFailed, "Sync failed", err)
+		t.status.LastError = err.Error()
+		t.failures++
+		// Alert once per outage, rather than on every failure after the threshold.
+		if t.failures == syncAlertThreshold() {
+			go sendSyncAlert(t.failures, t.status)
+		}
+		return
+	}
+	recordEvent(eventSync, "Sync successful", nil)
+	t.status.LastSuccess = &end
+	t.status.LastError = ""
+	t.failures = 0
+}
+
+// consecutiveFailures returns the number of syncs that failed since the last success.
+func (t *syncTracker) consecutiveFailures() int {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+	return t.failures
+}
+
+// sinceLastSync returns the time since the last successful sync. Startup counts as a
+// sync, since logging in fetches the vault.
+func sinceLastSync() time.Duration {
+	last := startTime
+	if status := syncs.snapshot(); status.LastSuccess != nil {
+		last = *status.LastSuccess
+	}
+	return time.Since(last)
+}
+
+// snapshot returns the current status.
+func (t *syncTracker) snapshot() syncStatus {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+	status := t.status
+	status.Interval = "disabled"
+	if syncEnabled() {
+		schedule, _ := syncScheduleFromEnv()
+		status.Interval = schedule.String()
+	}
+	return status
+}
+
+// pause stops or resumes the periodic sync, e.g. during maintenance of the server.
+// Requested syncs still run.
+func (t *syncTracker) pause(paused bool) {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+	t.status.Paused = paused
+}
+
+// paused reports whether the periodic sync is paused.
+func (t *syncTracker) paused() bool {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+	return t.status.Paused
+}
+
+// setNextSync records when the periodic sync runs next.
+func (t *syncTracker) setNextSync(next time.Time) {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+	t.status.NextSync = &next
+}
+
+// handleSync runs a sync (POST), in the background with ?async=true, or reports the
+// last one (GET).
+func handleSync(w http.ResponseWriter, r *http.Request) {
+	switch r.Method {
+	case http.MethodGet:
+		handleSyncStatus(w, r)
+		return
+	case http.MethodPost:
+	default:
+		http.Error(w, "Method not allowed", http.StatusMethodNotAllowed)
+		return
+	}
+	if r.URL.Query().Get("async") == "true" {
+		startSyncJob(w, r)
+		return
+	}
+	syncLog.Info("Executing 'bw sync'", "request_id", requestID(r))
+	if err := runSync(r.Context()); err != nil {
+		syncLog.Error("Sync failed", "request_id", requestID(r), "error", err)
+		http.Error(w, fmt.Sprintf("Sync failed: %v", err), http.StatusInternalServerError)
+		return
+	}
+	syncLog.Info("Sync successful", "request_id", requestID(r))
+	w.WriteHeader(http.StatusOK)
+	_, _ = fmt.Fprint(w, "Sync successful")
+}
+
+// handleSyncStatus serves the sync status as JSON, so monitoring can alert on stale data.
+func handleSyncStatus(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodGet {
+		http.Error(w, "Method not allowed", http.StatusMethodNotAllowed)
+		return
+	}
+	w.Header().Set("Content-Type", "application/json")
+	_ = json.NewEncoder(w).Encode(syncs.snapshot())
+}
+
+// handleSyncPause returns a handler that pauses or resumes the periodic sync and serves
+// the resulting sync status.
+func handleSyncPause(paused bool) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		if r.Method != http.MethodPost {
+			http.Error(w, "Method not allowed", http.StatusMethodNotAllowed)
+			return
+		}
+		if paused {
+			adminLog.Info("Pausing the periodic sync", "request_id", requestID(r))
+		} else {
+			adminLog.Info("Resuming the periodic sync", "request_id", requestID(r))
+		}
+		syncs.pause(paused)
+		w.Header().Set("Content-Type", "application/json")
+		_ = json.NewEncoder(w).Encode(syncs.snapshot())
+	}
+}
+
+// syncAlert is the payload posted to BW_SYNC_ALERT_WEBHOOK.
+type syncAlert struct {
+	Event               string     `json:"event"`
+	Instance            string     `json:"instance"`
+	ConsecutiveFailures int        `json:"consecutiveFailures"`
+	LastError           string     `json:"lastError"`
+	LastAttempt         *time.Time `json:"lastAttempt"`
+	LastSuccess         *time.Time `json:"lastSuccess"`
+}
+
+// syncAlertThreshold returns the number of consecutive failed syncs after which
+// BW_SYNC_ALERT_WEBHOOK is notified.
+func syncAlertThreshold() int {
+	val := os.Getenv("BW_SYNC_ALERT_THRESHOLD")
+	if val == "" {
+		return defaultSyncAlertThreshold
+	}
+	n, err := strconv.Atoi(val)
+	if err != nil || n <= 0 {
+		syncLog.Warn("Invalid format for BW_SYNC_ALERT_THRESHOLD, using default", "value", val, "default", defaultSyncAlertThreshold)
+		return defaultSyncAlertThreshold
+	}
+	return n
+}
+
+// sendSyncAlert notifies BW_SYNC_ALERT_WEBHOOK, if configured, that syncs keep failing,
+// e.g. because the credentials expired, before applications notice stale secrets.
+func sendSyncAlert(failures int, status syncStatus) {
+	url, err := getSecret("BW_SYNC_ALERT_WEBHOOK")
+	if err != nil || url == "" {
+		return
+	}
+	alert := syncAlert{
+		Event:               "sync_failed",
+		Instance:            instanceName(),
+		ConsecutiveFailures: failures,
+		LastError:           status.LastError,
+		LastAttempt:         status.LastAttempt,
+		LastSuccess:         status.LastSuccess,
+	}
+	if err := postWebhook(url, alert); err != nil {
+		syncLog.Error("Failed to send sync failure alert", "error", err)
+		return
+	}
+	syncLog.Info("Sent sync failure alert", "failures", failures)
+}
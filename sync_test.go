@@ -0,0 +1,253 @@
+package main
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"net/http"
+	"net/http/httptest"
+	"net/http/httputil"
+	"net/url"
+	"os/exec"
+	"testing"
+	"time"
+
+	"github.com/prometheus/client_golang/prometheus"
+	dto "github.com/prometheus/client_model/go"
+)
+
+func TestSyncStatus(t *testing.T) {
+	execCommand = mockExecCommand
+	defer func() { execCommand = exec.CommandContext }()
+	defer func() { syncs = &syncTracker{} }()
+	t.Setenv("BW_SYNC_INTERVAL", "5m")
+
+	syncs = &syncTracker{}
+	syncs.record(time.Now(), errors.New("exit status 1: Sync failed"))
+
+	u, _ := url.Parse("http://localhost:8080")
+	router := setupRouter(httputil.NewSingleHostReverseProxy(u))
+
+	status := func() syncStatus {
+		t.Helper()
+		rr := httptest.NewRecorder()
+		router.ServeHTTP(rr, httptest.NewRequest("GET", "/sync/status", nil))
+		if rr.Code != http.StatusOK {
+			t.Fatalf("GET /sync/status: got status %v want %v", rr.Code, http.StatusOK)
+		}
+		var s syncStatus
+		if err := json.Unmarshal(rr.Body.Bytes(), &s); err != nil {
+			t.Fatalf("expected JSON, got %q: %v", rr.Body.String(), err)
+		}
+		return s
+	}
+
+	s := status()
+	if s.LastAttempt == nil || s.LastSuccess != nil || s.LastError != "exit status 1: Sync failed" || s.Interval != "5m0s" {
+		t.Errorf("after failed sync: got %+v", s)
+	}
+
+	router.ServeHTTP(httptest.NewRecorder(), httptest.NewRequest("POST", "/sync", nil))
+	s = status()
+	if s.LastSuccess == nil || s.LastError != "" {
+		t.Errorf("after successful sync: got %+v", s)
+	}
+
+	// GET /sync reports the same status.
+	rr := httptest.NewRecorder()
+	router.ServeHTTP(rr, httptest.NewRequest("GET", "/sync", nil))
+	var got syncStatus
+	if err := json.NewDecoder(rr.Body).Decode(&got); err != nil || got.LastSuccess == nil || !got.LastSuccess.Equal(*s.LastSuccess) {
+		t.Errorf("GET /sync: got %d %+v, %v", rr.Code, got, err)
+	}
+
+	t.Setenv("BW_DISABLE_SYNC", "true")
+	if s := status(); s.Interval != "disabled" {
+		t.Errorf("interval = %q with BW_DISABLE_SYNC, want %q", s.Interval, "disabled")
+	}
+}
+
+func TestSyncAlert(t *testing.T) {
+	defer func() { syncs = &syncTracker{} }()
+
+	alerts := make(chan syncAlert, 10)
+	ts := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		var a syncAlert
+		if err := json.NewDecoder(r.Body).Decode(&a); err != nil {
+			t.Errorf("expected JSON alert: %v", err)
+		}
+		alerts <- a
+	}))
+	defer ts.Close()
+	t.Setenv("BW_SYNC_ALERT_WEBHOOK", ts.URL)
+	t.Setenv("BW_SYNC_ALERT_THRESHOLD", "2")
+
+	syncs = &syncTracker{}
+	syncs.record(time.Now(), errors.New("exit status 1: You are not logged in."))
+	syncs.record(time.Now(), nil)
+	syncs.record(time.Now(), errors.New("exit status 1: You are not logged in."))
+	select {
+	case a := <-alerts:
+		t.Fatalf("unexpected alert before threshold: %+v", a)
+	case <-time.After(100 * time.Millisecond):
+	}
+
+	for range 3 {
+		syncs.record(time.Now(), errors.New("exit status 1: You are not logged in."))
+	}
+	select {
+	case a := <-alerts:
+		if a.Event != "sync_failed" || a.ConsecutiveFailures != 2 || a.LastError != "exit status 1: You are not logged in." || a.LastSuccess == nil {
+			t.Errorf("unexpected alert: %+v", a)
+		}
+	case <-time.After(5 * time.Second):
+		t.Fatal("expected an alert after repeated failures")
+	}
+	select {
+	case a := <-alerts:
+		t.Errorf("expected a single alert per outage, got another: %+v", a)
+	case <-time.After(100 * time.Millisecond):
+	}
+}
+
+func TestSyncScheduleFromEnv(t *testing.T) {
+	t.Setenv("BW_SYNC_INTERVAL", "5m")
+	if s, err := syncScheduleFromEnv(); err != nil || s.String() != "5m0s" {
+		t.Errorf("got %v, %v", s, err)
+	}
+
+	t.Setenv("BW_SYNC_CRON", "*/10 8-18 * * mon-fri")
+	s, err := syncScheduleFromEnv()
+	if _, ok := s.(*cronSchedule); !ok || err != nil {
+		t.Errorf("got %v, %v, want the cron schedule", s, err)
+	}
+
+	for _, expr := range []string{"every minute", "0 0 31 2 *"} {
+		t.Setenv("BW_SYNC_CRON", expr)
+		if s, err := syncScheduleFromEnv(); err == nil || s.String() != defaultSyncInterval.String() {
+			t.Errorf("%q: got %v, %v, want the default interval and an error", expr, s, err)
+		}
+	}
+}
+
+func TestRunSync_Concurrent(t *testing.T) {
+	execCommand = mockExecCommandEnv("MOCK_BW_SYNC_DELAY=300ms")
+	defer func() { execCommand = exec.CommandContext }()
+	defer func() { syncs = &syncTracker{} }()
+
+	syncCount := func() uint64 {
+		metric := &dto.Metric{}
+		_ = cliCommandDuration.WithLabelValues("bw sync", "0").(prometheus.Histogram).Write(metric)
+		return metric.GetHistogram().GetSampleCount()
+	}
+	before := syncCount()
+
+	errs := make(chan error, 3)
+	for range 3 {
+		go func() { errs <- runSync(context.Background()) }()
+	}
+	for range 3 {
+		if err := <-errs; err != nil {
+			t.Errorf("sync failed: %v", err)
+		}
+	}
+	if got := syncCount() - before; got != 1 {
+		t.Errorf("got %d runs of 'bw sync' want 1", got)
+	}
+}
+
+func TestNextSyncTime(t *testing.T) {
+	now := time.Date(2026, 6, 3, 12, 0, 0, 0, time.UTC)
+	interval := intervalSchedule(2 * time.Minute)
+	tests := []struct {
+		failures int
+		want     time.Duration
+	}{
+		{0, 2 * time.Minute},
+		{1, 4 * time.Minute},
+		{3, 16 * time.Minute},
+		{6, time.Hour},
+		{100, time.Hour},
+	}
+	for _, tt := range tests {
+		if got := nextSyncTime(interval, now, tt.failures, time.Hour).Sub(now); got != tt.want {
+			t.Errorf("%d failures: got %v want %v", tt.failures, got, tt.want)
+		}
+	}
+
+	// A cron schedule backs off to one of its own times.
+	cron, _ := parseCron("*/15 * * * *")
+	if got, want := nextSyncTime(cron, now, 2, time.Hour), now.Add(time.Hour); !got.Equal(want) {
+		t.Errorf("cron: got %v want %v", got, want)
+	}
+}
+
+func TestSyncPause(t *testing.T) {
+	execCommand = mockExecCommand
+	defer func() { execCommand = exec.CommandContext }()
+	defer func() { syncs = &syncTracker{} }()
+	defer func() { reloadHooks = nil }()
+	t.Setenv("BW_ADMIN_TOKEN", "admin-token")
+	t.Setenv("BW_SYNC_INTERVAL", "1h")
+
+	u, _ := url.Parse("http://localhost:8080")
+	router := setupRouter(httputil.NewSingleHostReverseProxy(u))
+	send := func(path string) syncStatus {
+		t.Helper()
+		req := httptest.NewRequest("POST", path, nil)
+		req.Header.Set("Authorization", "Bearer admin-token")
+		rr := httptest.NewRecorder()
+		router.ServeHTTP(rr, req)
+		var s syncStatus
+		if err := json.NewDecoder(rr.Body).Decode(&s); err != nil {
+			t.Fatalf("%s: got %v %q", path, rr.Code, rr.Body.String())
+		}
+		return s
+	}
+
+	if s := send("/admin/sync/pause"); !s.Paused {
+		t.Errorf("after pause: got %+v", s)
+	}
+
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+	go startPeriodicSync(ctx)
+
+	// A paused periodic sync skips requested runs.
+	requestSync()
+	time.Sleep(200 * time.Millisecond)
+	if s := syncs.snapshot(); s.LastAttempt != nil {
+		t.Errorf("periodic sync ran while paused: %+v", s)
+	}
+
+	if s := send("/admin/sync/resume"); s.Paused {
+		t.Errorf("after resume: got %+v", s)
+	}
+	requestSync()
+	deadline := time.Now().Add(5 * time.Second)
+	for syncs.snapshot().LastAttempt == nil && time.Now().Before(deadline) {
+		time.Sleep(20 * time.Millisecond)
+	}
+	if s := syncs.snapshot(); s.LastAttempt == nil {
+		t.Errorf("periodic sync did not run after resume: %+v", s)
+	}
+}
+
+func TestSyncOnStart(t *testing.T) {
+	execCommand = mockExecCommand
+	defer func() { execCommand = exec.CommandContext }()
+	defer func() { syncs = &syncTracker{} }()
+	defer func() { startupSteps = []startupStep{{Stage: stageReady, Started: time.Now()}} }()
+	startupSteps = []startupStep{{Stage: stageServe, Started: time.Now()}}
+
+	syncOnStart(context.Background())
+	if s := syncs.snapshot(); s.LastAttempt != nil || currentStartupStage() != stageServe {
+		t.Fatalf("synced without BW_SYNC_ON_START: %+v", s)
+	}
+
+	t.Setenv("BW_SYNC_ON_START", "true")
+	syncOnStart(context.Background())
+	if s := syncs.snapshot(); s.LastSuccess == nil || currentStartupStage() != stageSync {
+		t.Errorf("got stage %s, status %+v", currentStartupStage(), s)
+	}
+}
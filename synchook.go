@@ -0,0 +1,56 @@
+package main
+
+import (
+	"bytes"
+	"context"
+	"errors"
+	"os"
+	"os/exec"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+)
+
+// syncHookTimeout bounds a run of BW_SYNC_HOOK, so a hanging hook cannot hold up the
+// ones of later syncs forever.
+const syncHookTimeout = 5 * time.Minute
+
+// syncHookMu keeps runs of the hook from overlapping.
+var syncHookMu sync.Mutex
+
+// runSyncHook runs the shell command in BW_SYNC_HOOK after a successful sync, e.g. to
+// regenerate config files or signal other processes. The result of the sync is passed
+// in BW_SYNC_* variables on top of the environment of the wrapper, which includes
+// BW_SESSION, so the hook can read the vault with 'bw'.
+func runSyncHook(start, end time.Time) {
+	hook := os.Getenv("BW_SYNC_HOOK")
+	if hook == "" {
+		return
+	}
+	syncHookMu.Lock()
+	defer syncHookMu.Unlock()
+
+	ctx, cancel := context.WithTimeout(context.Background(), syncHookTimeout)
+	defer cancel()
+	cmd := exec.CommandContext(ctx, "/bin/sh", "-c", hook)
+	cmd.Env = append(os.Environ(),
+		"BW_SYNC_STATUS=success",
+		"BW_SYNC_TIME="+end.UTC().Format(time.RFC3339),
+		"BW_SYNC_DURATION_MS="+strconv.FormatInt(end.Sub(start).Milliseconds(), 10),
+		"BW_SYNC_INSTANCE="+instanceName(),
+	)
+	var out bytes.Buffer
+	cmd.Stdout = &out
+	cmd.Stderr = &out
+	err := cmd.Run()
+	if errors.Is(ctx.Err(), context.DeadlineExceeded) {
+		syncLog.Error("Sync hook timed out", "timeout", syncHookTimeout, "output", strings.TrimSpace(out.String()))
+		return
+	}
+	if err != nil {
+		syncLog.Error("Sync hook failed", "error", err, "output", strings.TrimSpace(out.String()))
+		return
+	}
+	syncLog.Debug("Sync hook finished", "output", strings.TrimSpace(out.String()))
+}
@@ -0,0 +1,25 @@
+package main
+
+import (
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+)
+
+func TestRunSyncHook(t *testing.T) {
+	out := filepath.Join(t.TempDir(), "hook.out")
+	t.Setenv("BW_SYNC_HOOK", `echo "$BW_SYNC_STATUS $BW_SYNC_TIME $BW_SYNC_DURATION_MS" > `+out)
+
+	start := time.Date(2026, 6, 1, 12, 0, 0, 0, time.UTC)
+	runSyncHook(start, start.Add(1500*time.Millisecond))
+
+	got, err := os.ReadFile(out)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if want := "success 2026-06-01T12:00:01Z 1500"; strings.TrimSpace(string(got)) != want {
+		t.Errorf("got %q, want %q", got, want)
+	}
+}
@@ -0,0 +1,106 @@
+package main
+
+import (
+	"context"
+	"crypto/rand"
+	"encoding/json"
+	"net/http"
+	"sync"
+	"time"
+)
+
+// maxSyncJobs bounds the number of asynchronous sync jobs kept for GET /sync/jobs/{id}.
+const maxSyncJobs = 100
+
+// Statuses of an asynchronous sync job.
+const (
+	syncJobRunning   = "running"
+	syncJobSucceeded = "succeeded"
+	syncJobFailed    = "failed"
+)
+
+// syncJob is an asynchronous sync started with POST /sync?async=true.
+type syncJob struct {
+	ID       string     `json:"id"`
+	Status   string     `json:"status"`
+	Started  time.Time  `json:"started"`
+	Finished *time.Time `json:"finished,omitempty"`
+	Error    string     `json:"error,omitempty"`
+}
+
+// syncJobStore keeps the most recent asynchronous sync jobs, in the order they started.
+type syncJobStore struct {
+	mu    sync.Mutex
+	jobs  map[string]*syncJob
+	order []string
+}
+
+var syncJobs = &syncJobStore{jobs: make(map[string]*syncJob)}
+
+// start runs a sync in the background and returns its job. Like a synchronous sync, it
+// joins a sync that is already running rather than starting another one.
+func (s *syncJobStore) start(requestID string) syncJob {
+	job := &syncJob{ID: rand.Text(), Status: syncJobRunning, Started: time.Now()}
+	s.mu.Lock()
+	if len(s.order) >= maxSyncJobs {
+		delete(s.jobs, s.order[0])
+		s.order = s.order[1:]
+	}
+	s.jobs[job.ID] = job
+	s.order = append(s.order, job.ID)
+	started := *job
+	s.mu.Unlock()
+
+	go func() {
+		err := runSync(context.Background())
+		s.mu.Lock()
+		defer s.mu.Unlock()
+		job.Finished = new(time.Now())
+		if err != nil {
+			syncLog.Error("Sync failed", "request_id", requestID, "job", job.ID, "error", err)
+			job.Status = syncJobFailed
+			job.Error = err.Error()
+			return
+		}
+		syncLog.Info("Sync successful", "request_id", requestID, "job", job.ID)
+		job.Status = syncJobSucceeded
+	}()
+	return started
+}
+
+// get returns the job with the given ID.
+func (s *syncJobStore) get(id string) (syncJob, bool) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	job, ok := s.jobs[id]
+	if !ok {
+		return syncJob{}, false
+	}
+	return *job, true
+}
+
+// handleSyncJob serves the status of an asynchronous sync job as JSON.
+func handleSyncJob(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodGet {
+		http.Error(w, "Method not allowed", http.StatusMethodNotAllowed)
+		return
+	}
+	job, ok := syncJobs.get(r.PathValue("id"))
+	if !ok {
+		http.Error(w, "Sync job not found", http.StatusNotFound)
+		return
+	}
+	w.Header().Set("Content-Type", "application/json")
+	_ = json.NewEncoder(w).Encode(job)
+}
+
+// startSyncJob handles POST /sync?async=true: it starts the sync and answers 202 with
+// the job at once, for callers that cannot wait for a slow 'bw sync'.
+func startSyncJob(w http.ResponseWriter, r *http.Request) {
+	syncLog.Info("Starting 'bw sync' in the background", "request_id", requestID(r))
+	job := syncJobs.start(requestID(r))
+	w.Header().Set("Content-Type", "application/json")
+	w.Header().Set("Location", "/sync/jobs/"+job.ID)
+	w.WriteHeader(http.StatusAccepted)
+	_ = json.NewEncoder(w).Encode(job)
+}
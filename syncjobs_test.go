@@ -0,0 +1,57 @@
+package main
+
+import (
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"net/http/httputil"
+	"net/url"
+	"os/exec"
+	"testing"
+	"time"
+)
+
+func TestAsyncSync(t *testing.T) {
+	execCommand = mockExecCommandEnv("MOCK_BW_SYNC_DELAY=300ms")
+	defer func() { execCommand = exec.CommandContext }()
+	defer func() { syncs = &syncTracker{} }()
+
+	u, _ := url.Parse("http://localhost:8080")
+	router := setupRouter(httputil.NewSingleHostReverseProxy(u))
+
+	rr := httptest.NewRecorder()
+	router.ServeHTTP(rr, httptest.NewRequest("POST", "/sync?async=true", nil))
+	if rr.Code != http.StatusAccepted {
+		t.Fatalf("POST /sync?async=true: got status %d want %d", rr.Code, http.StatusAccepted)
+	}
+	var job syncJob
+	if err := json.NewDecoder(rr.Body).Decode(&job); err != nil {
+		t.Fatalf("expected JSON, got %q: %v", rr.Body.String(), err)
+	}
+	if job.ID == "" || job.Status != syncJobRunning {
+		t.Fatalf("unexpected job: %+v", job)
+	}
+	if got := rr.Header().Get("Location"); got != "/sync/jobs/"+job.ID {
+		t.Errorf("Location = %q", got)
+	}
+
+	deadline := time.Now().Add(5 * time.Second)
+	for job.Status == syncJobRunning && time.Now().Before(deadline) {
+		time.Sleep(50 * time.Millisecond)
+		rr = httptest.NewRecorder()
+		router.ServeHTTP(rr, httptest.NewRequest("GET", "/sync/jobs/"+job.ID, nil))
+		if rr.Code != http.StatusOK {
+			t.Fatalf("GET /sync/jobs/%s: got status %d", job.ID, rr.Code)
+		}
+		_ = json.NewDecoder(rr.Body).Decode(&job)
+	}
+	if job.Status != syncJobSucceeded || job.Finished == nil {
+		t.Errorf("job did not succeed: %+v", job)
+	}
+
+	rr = httptest.NewRecorder()
+	router.ServeHTTP(rr, httptest.NewRequest("GET", "/sync/jobs/unknown", nil))
+	if rr.Code != http.StatusNotFound {
+		t.Errorf("unknown job: got status %d want %d", rr.Code, http.StatusNotFound)
+	}
+}
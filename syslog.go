@@ -0,0 +1,147 @@
+package main
+
+import (
+	"bytes"
+	"context"
+	"fmt"
+	"log/slog"
+	"net"
+	"os"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+)
+
+// syslogFacility is the facility of all messages sent to syslog (daemon).
+const syslogFacility = 3
+
+// syslogHandler sends log records as RFC 5424 messages to a syslog server. The
+// message body is formatted like the console output, according to BW_LOG_FORMAT.
+type syslogHandler struct {
+	inner slog.Handler
+	w     *syslogWriter
+}
+
+// newSyslogHandler connects to the syslog server at addr, given as host:port (UDP)
+// or as udp://host:port or tcp://host:port.
+func newSyslogHandler(addr string, opts *slog.HandlerOptions) (*syslogHandler, error) {
+	network, address := "udp", addr
+	if n, a, ok := strings.Cut(addr, "://"); ok {
+		network, address = n, a
+	}
+	if network != "udp" && network != "tcp" {
+		return nil, fmt.Errorf("unsupported network '%s', expected udp or tcp", network)
+	}
+	if _, _, err := net.SplitHostPort(address); err != nil {
+		return nil, err
+	}
+
+	w := &syslogWriter{network: network, address: address}
+	if err := w.connect(); err != nil {
+		return nil, err
+	}
+	w.hostname, _ = os.Hostname()
+
+	// Time and level are part of the syslog header, so they are left out of the body.
+	bodyOpts := *opts
+	bodyOpts.ReplaceAttr = func(groups []string, a slog.Attr) slog.Attr {
+		if len(groups) == 0 && (a.Key == slog.TimeKey || a.Key == slog.LevelKey) {
+			return slog.Attr{}
+		}
+		return a
+	}
+	var inner slog.Handler
+	if logFormatJSON() {
+		inner = slog.NewJSONHandler(w, &bodyOpts)
+	} else {
+		inner = slog.NewTextHandler(w, &bodyOpts)
+	}
+	return &syslogHandler{inner: inner, w: w}, nil
+}
+
+func (h *syslogHandler) Enabled(ctx context.Context, level slog.Level) bool {
+	return h.inner.Enabled(ctx, level)
+}
+
+func (h *syslogHandler) Handle(ctx context.Context, r slog.Record) error {
+	h.w.mu.Lock()
+	defer h.w.mu.Unlock()
+	h.w.record = r
+	return h.inner.Handle(ctx, r)
+}
+
+func (h *syslogHandler) WithAttrs(attrs []slog.Attr) slog.Handler {
+	return &syslogHandler{inner: h.inner.WithAttrs(attrs), w: h.w}
+}
+
+func (h *syslogHandler) WithGroup(name string) slog.Handler {
+	return &syslogHandler{inner: h.inner.WithGroup(name), w: h.w}
+}
+
+// syslogWriter frames each line written by the inner handler with the syslog header
+// of the record being handled, and sends it to the server.
+type syslogWriter struct {
+	mu       sync.Mutex
+	network  string
+	address  string
+	hostname string
+	conn     net.Conn
+	record   slog.Record
+}
+
+func (w *syslogWriter) connect() error {
+	conn, err := net.DialTimeout(w.network, w.address, 5*time.Second)
+	if err != nil {
+		return err
+	}
+	w.conn = conn
+	return nil
+}
+
+func (w *syslogWriter) Write(p []byte) (int, error) {
+	msg := w.format(bytes.TrimRight(p, "\n"))
+	if w.network == "tcp" {
+		// Octet counting framing (RFC 6587), so messages may contain newlines.
+		msg = append([]byte(strconv.Itoa(len(msg))+" "), msg...)
+	}
+	if _, err := w.conn.Write(msg); err != nil {
+		// Reconnect once, e.g. after the server restarted and closed the connection.
+		_ = w.conn.Close()
+		if err := w.connect(); err != nil {
+			return 0, err
+		}
+		if _, err := w.conn.Write(msg); err != nil {
+			return 0, err
+		}
+	}
+	return len(p), nil
+}
+
+// format returns body with the RFC 5424 header: <PRI>VERSION TIMESTAMP HOSTNAME
+// APP-NAME PROCID MSGID STRUCTURED-DATA.
+func (w *syslogWriter) format(body []byte) []byte {
+	hostname := w.hostname
+	if hostname == "" {
+		hostname = "-"
+	}
+	header := fmt.Sprintf("<%d>1 %s %s bw-cli-docker %d - - ",
+		syslogFacility*8+syslogSeverity(w.record.Level),
+		w.record.Time.Format("2006-01-02T15:04:05.000000Z07:00"),
+		hostname, os.Getpid())
+	return append([]byte(header), body...)
+}
+
+// syslogSeverity maps a log level to the syslog severity.
+func syslogSeverity(level slog.Level) int {
+	switch {
+	case level >= slog.LevelError:
+		return 3
+	case level >= slog.LevelWarn:
+		return 4
+	case level >= slog.LevelInfo:
+		return 6
+	default:
+		return 7
+	}
+}
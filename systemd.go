@@ -0,0 +1,60 @@
+package main
+
+import (
+	"net"
+	"os"
+	"strconv"
+	"time"
+)
+
+// sdNotify sends a state change such as "READY=1" to systemd, if the wrapper runs as a
+// service of Type=notify. It does nothing when NOTIFY_SOCKET is not set.
+func sdNotify(state string) {
+	socket := os.Getenv("NOTIFY_SOCKET")
+	if socket == "" {
+		return
+	}
+	if socket[0] == '@' {
+		// Abstract namespace socket
+		socket = "\x00" + socket[1:]
+	}
+	conn, err := net.DialUnix("unixgram", nil, &net.UnixAddr{Name: socket, Net: "unixgram"})
+	if err != nil {
+		mainLog.Warn("Failed to notify systemd", "state", state, "error", err)
+		return
+	}
+	defer func() { _ = conn.Close() }()
+	if _, err := conn.Write([]byte(state)); err != nil {
+		mainLog.Warn("Failed to notify systemd", "state", state, "error", err)
+	}
+}
+
+// watchdogInterval returns the interval at which systemd expects keepalives, half
+// of WatchdogSec, or 0 if the watchdog is not enabled for this process.
+func watchdogInterval() time.Duration {
+	usec, err := strconv.ParseInt(os.Getenv("WATCHDOG_USEC"), 10, 64)
+	if err != nil || usec <= 0 {
+		return 0
+	}
+	if pid := os.Getenv("WATCHDOG_PID"); pid != "" && pid != strconv.Itoa(os.Getpid()) {
+		return 0
+	}
+	return time.Duration(usec) * time.Microsecond / 2
+}
+
+// startWatchdog sends keepalives to the systemd watchdog while the vault is usable,
+// so that systemd restarts the service if 'bw serve' stays down or locked.
+func startWatchdog(port string) {
+	interval := watchdogInterval()
+	if interval == 0 {
+		return
+	}
+	mainLog.Info("Sending keepalives to the systemd watchdog", "interval", interval)
+	ticker := time.NewTicker(interval)
+	defer ticker.Stop()
+	for range ticker.C {
+		if _, ok := checkVault(port); ok || bwServeRecovering.Load() {
+			sdNotify("WATCHDOG=1")
+		}
+	}
+}
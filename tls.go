@@ -0,0 +1,176 @@
+package main
+
+import (
+	"crypto/ecdsa"
+	"crypto/elliptic"
+	"crypto/rand"
+	"crypto/tls"
+	"crypto/x509"
+	"crypto/x509/pkix"
+	"fmt"
+	"math/big"
+	"net"
+	"net/http"
+	"os"
+	"sync/atomic"
+	"time"
+)
+
+// selfSignedValidity is how long a generated self-signed certificate is valid.
+const selfSignedValidity = 365 * 24 * time.Hour
+
+// proxyTLSEnabled reports whether the proxy listener serves HTTPS.
+func proxyTLSEnabled() bool {
+	return os.Getenv("BW_PROXY_TLS_CERT") != "" || getEnv("BW_PROXY_TLS_SELF_SIGNED", "false") == "true"
+}
+
+// proxyTLSConfig returns the TLS configuration for the proxy listener, or nil if
+// TLS is disabled. If BW_PROXY_CLIENT_CA is set, clients have to present a
+// certificate issued by one of the CAs in that bundle. A certificate given by BW_PROXY_TLS_CERT and BW_PROXY_TLS_KEY
+// is reloaded whenever either file changes, so renewed certificates (e.g. from
+// cert-manager) are picked up without a restart. Otherwise a self-signed
+// certificate is generated if BW_PROXY_TLS_SELF_SIGNED is set.
+func proxyTLSConfig() (*tls.Config, error) {
+	config, err := proxyServerTLSConfig()
+	if err != nil {
+		return nil, err
+	}
+	if config == nil {
+		if os.Getenv("BW_PROXY_CLIENT_CA") != "" {
+			return nil, fmt.Errorf("BW_PROXY_CLIENT_CA requires TLS to be enabled")
+		}
+		return nil, nil
+	}
+
+	if caFile := os.Getenv("BW_PROXY_CLIENT_CA"); caFile != "" {
+		pool, err := loadCertPool(caFile)
+		if err != nil {
+			return nil, err
+		}
+		// Verification is enforced per request by requireClientCertificate,
+		// so that health checks keep working without a client certificate.
+		config.ClientCAs = pool
+		config.ClientAuth = tls.VerifyClientCertIfGiven
+	}
+	return config, nil
+}
+
+// proxyServerTLSConfig returns the TLS configuration with the server certificate.
+func proxyServerTLSConfig() (*tls.Config, error) {
+	certFile := os.Getenv("BW_PROXY_TLS_CERT")
+	keyFile := os.Getenv("BW_PROXY_TLS_KEY")
+
+	switch {
+	case certFile != "" || keyFile != "":
+		if certFile == "" || keyFile == "" {
+			return nil, fmt.Errorf("both BW_PROXY_TLS_CERT and BW_PROXY_TLS_KEY must be set")
+		}
+		store := &certificateStore{certFile: certFile, keyFile: keyFile}
+		if err := store.reload(); err != nil {
+			return nil, err
+		}
+		for _, path := range []string{certFile, keyFile} {
+			if err := watchFile(path, store.reloadOrWarn); err != nil {
+				tlsLog.Warn("Certificate renewals will not be detected", "error", err)
+			}
+		}
+		onReload(store.reloadOrWarn)
+		return &tls.Config{MinVersion: tls.VersionTLS12, GetCertificate: store.getCertificate}, nil
+	case getEnv("BW_PROXY_TLS_SELF_SIGNED", "false") == "true":
+		cert, err := generateSelfSignedCertificate()
+		if err != nil {
+			return nil, err
+		}
+		tlsLog.Info("Serving HTTPS with a generated self-signed certificate")
+		return &tls.Config{MinVersion: tls.VersionTLS12, Certificates: []tls.Certificate{*cert}}, nil
+	}
+	return nil, nil
+}
+
+// certificateStore holds the current certificate of the proxy listener.
+type certificateStore struct {
+	certFile, keyFile string
+	cert              atomic.Pointer[tls.Certificate]
+}
+
+// reload loads the certificate and key from disk, replacing the current certificate.
+func (s *certificateStore) reload() error {
+	cert, err := tls.LoadX509KeyPair(s.certFile, s.keyFile)
+	if err != nil {
+		return fmt.Errorf("failed to load TLS certificate: %v", err)
+	}
+	s.cert.Store(&cert)
+	return nil
+}
+
+// reloadOrWarn reloads the certificate, keeping the previous one if the new files are
+// not (yet) a valid pair, e.g. while only one of them has been replaced.
+func (s *certificateStore) reloadOrWarn() {
+	if err := s.reload(); err != nil {
+		tlsLog.Warn("Keeping the previous certificate", "error", err)
+		return
+	}
+	tlsLog.Info("TLS certificate reloaded")
+}
+
+func (s *certificateStore) getCertificate(*tls.ClientHelloInfo) (*tls.Certificate, error) {
+	return s.cert.Load(), nil
+}
+
+// generateSelfSignedCertificate creates an ECDSA certificate for localhost and the
+// container hostname.
+func generateSelfSignedCertificate() (*tls.Certificate, error) {
+	key, err := ecdsa.GenerateKey(elliptic.P256(), rand.Reader)
+	if err != nil {
+		return nil, fmt.Errorf("failed to generate key: %v", err)
+	}
+	serial, err := rand.Int(rand.Reader, new(big.Int).Lsh(big.NewInt(1), 128))
+	if err != nil {
+		return nil, fmt.Errorf("failed to generate serial number: %v", err)
+	}
+
+	dnsNames := []string{"localhost"}
+	if hostname, err := os.Hostname(); err == nil && hostname != "" {
+		dnsNames = append(dnsNames, hostname)
+	}
+	template := &x509.Certificate{
+		SerialNumber: serial,
+		Subject:      pkix.Name{CommonName: dnsNames[len(dnsNames)-1]},
+		DNSNames:     dnsNames,
+		IPAddresses:  []net.IP{net.IPv4(127, 0, 0, 1), net.IPv6loopback},
+		NotBefore:    time.Now().Add(-time.Minute),
+		NotAfter:     time.Now().Add(selfSignedValidity),
+		KeyUsage:     x509.KeyUsageDigitalSignature,
+		ExtKeyUsage:  []x509.ExtKeyUsage{x509.ExtKeyUsageServerAuth},
+	}
+	der, err := x509.CreateCertificate(rand.Reader, template, template, &key.PublicKey, key)
+	if err != nil {
+		return nil, fmt.Errorf("failed to create certificate: %v", err)
+	}
+	return &tls.Certificate{Certificate: [][]byte{der}, PrivateKey: key}, nil
+}
+
+// loadCertPool reads a PEM bundle of CA certificates.
+func loadCertPool(path string) (*x509.CertPool, error) {
+	content, err := os.ReadFile(path)
+	if err != nil {
+		return nil, fmt.Errorf("failed to read client CA bundle '%s': %v", path, err)
+	}
+	pool := x509.NewCertPool()
+	if !pool.AppendCertsFromPEM(content) {
+		return nil, fmt.Errorf("no certificates found in client CA bundle '%s'", path)
+	}
+	return pool, nil
+}
+
+// requireClientCertificate rejects requests without a verified client certificate,
+// except for health checks.
+func requireClientCertificate(next http.Handler) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if !isHealthCheckPath(r.URL.Path) && (r.TLS == nil || len(r.TLS.VerifiedChains) == 0) {
+			http.Error(w, "Client certificate required", http.StatusUnauthorized)
+			return
+		}
+		next.ServeHTTP(w, r)
+	})
+}
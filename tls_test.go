@@ -0,0 +1,156 @@
+package main
+
+import (
+	"crypto/tls"
+	"crypto/x509"
+	"encoding/pem"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+)
+
+// writeTestCertificate writes a newly generated certificate and key as PEM files.
+func writeTestCertificate(t *testing.T, certFile, keyFile string) []byte {
+	t.Helper()
+	cert, err := generateSelfSignedCertificate()
+	if err != nil {
+		t.Fatalf("generateSelfSignedCertificate failed: %v", err)
+	}
+	key, err := x509.MarshalPKCS8PrivateKey(cert.PrivateKey)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err := os.WriteFile(certFile, pem.EncodeToMemory(&pem.Block{Type: "CERTIFICATE", Bytes: cert.Certificate[0]}), 0o600); err != nil {
+		t.Fatal(err)
+	}
+	if err := os.WriteFile(keyFile, pem.EncodeToMemory(&pem.Block{Type: "PRIVATE KEY", Bytes: key}), 0o600); err != nil {
+		t.Fatal(err)
+	}
+	return cert.Certificate[0]
+}
+
+func TestProxyTLSConfig_Disabled(t *testing.T) {
+	t.Setenv("BW_PROXY_TLS_CERT", "")
+	t.Setenv("BW_PROXY_TLS_KEY", "")
+	t.Setenv("BW_PROXY_TLS_SELF_SIGNED", "")
+
+	config, err := proxyTLSConfig()
+	if err != nil || config != nil {
+		t.Errorf("proxyTLSConfig() = %v, %v, want nil, nil", config, err)
+	}
+}
+
+func TestProxyTLSConfig_MissingKey(t *testing.T) {
+	t.Setenv("BW_PROXY_TLS_CERT", "/tls/tls.crt")
+	t.Setenv("BW_PROXY_TLS_KEY", "")
+
+	if _, err := proxyTLSConfig(); err == nil {
+		t.Fatal("expected error without BW_PROXY_TLS_KEY")
+	}
+}
+
+func TestProxyTLSConfig_SelfSigned(t *testing.T) {
+	t.Setenv("BW_PROXY_TLS_CERT", "")
+	t.Setenv("BW_PROXY_TLS_KEY", "")
+	t.Setenv("BW_PROXY_TLS_SELF_SIGNED", "true")
+
+	config, err := proxyTLSConfig()
+	if err != nil {
+		t.Fatalf("expected nil, got %v", err)
+	}
+	if len(config.Certificates) != 1 {
+		t.Fatalf("expected a generated certificate, got %d", len(config.Certificates))
+	}
+	leaf, err := x509.ParseCertificate(config.Certificates[0].Certificate[0])
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err := leaf.VerifyHostname("localhost"); err != nil {
+		t.Errorf("certificate is not valid for localhost: %v", err)
+	}
+}
+
+func TestProxyTLSConfig_Reload(t *testing.T) {
+	dir := t.TempDir()
+	certFile, keyFile := filepath.Join(dir, "tls.crt"), filepath.Join(dir, "tls.key")
+	first := writeTestCertificate(t, certFile, keyFile)
+	t.Setenv("BW_PROXY_TLS_CERT", certFile)
+	t.Setenv("BW_PROXY_TLS_KEY", keyFile)
+
+	config, err := proxyTLSConfig()
+	if err != nil {
+		t.Fatalf("expected nil, got %v", err)
+	}
+	cert, _ := config.GetCertificate(nil)
+	if string(cert.Certificate[0]) != string(first) {
+		t.Fatal("expected the certificate from BW_PROXY_TLS_CERT")
+	}
+
+	second := writeTestCertificate(t, certFile, keyFile)
+	deadline := time.Now().Add(fileWatchDebounce + 2*time.Second)
+	for time.Now().Before(deadline) {
+		cert, _ = config.GetCertificate(nil)
+		if string(cert.Certificate[0]) == string(second) {
+			return
+		}
+		time.Sleep(100 * time.Millisecond)
+	}
+	t.Fatal("expected the renewed certificate to be loaded")
+}
+
+func TestProxyTLSConfig_ClientCA(t *testing.T) {
+	dir := t.TempDir()
+	certFile, keyFile := filepath.Join(dir, "tls.crt"), filepath.Join(dir, "tls.key")
+	writeTestCertificate(t, certFile, keyFile)
+	t.Setenv("BW_PROXY_TLS_CERT", certFile)
+	t.Setenv("BW_PROXY_TLS_KEY", keyFile)
+	t.Setenv("BW_PROXY_CLIENT_CA", certFile)
+
+	config, err := proxyTLSConfig()
+	if err != nil {
+		t.Fatalf("expected nil, got %v", err)
+	}
+	if config.ClientCAs == nil || config.ClientAuth != tls.VerifyClientCertIfGiven {
+		t.Errorf("expected client certificates to be verified, got %v", config.ClientAuth)
+	}
+}
+
+func TestProxyTLSConfig_ClientCAWithoutTLS(t *testing.T) {
+	t.Setenv("BW_PROXY_TLS_CERT", "")
+	t.Setenv("BW_PROXY_TLS_KEY", "")
+	t.Setenv("BW_PROXY_TLS_SELF_SIGNED", "")
+	t.Setenv("BW_PROXY_CLIENT_CA", "/tls/ca.crt")
+
+	if _, err := proxyTLSConfig(); err == nil {
+		t.Fatal("expected error for a client CA without TLS")
+	}
+}
+
+func TestRequireClientCertificate(t *testing.T) {
+	handler := requireClientCertificate(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.WriteHeader(http.StatusOK)
+	}))
+
+	tests := []struct {
+		path  string
+		state *tls.ConnectionState
+		want  int
+	}{
+		{"/list/object/items", nil, http.StatusUnauthorized},
+		{"/list/object/items", &tls.ConnectionState{}, http.StatusUnauthorized},
+		{"/list/object/items", &tls.ConnectionState{VerifiedChains: [][]*x509.Certificate{{}}}, http.StatusOK},
+		{"/healthz", &tls.ConnectionState{}, http.StatusOK},
+	}
+	for _, tt := range tests {
+		req, _ := http.NewRequest("GET", tt.path, nil)
+		req.TLS = tt.state
+		rr := httptest.NewRecorder()
+		handler.ServeHTTP(rr, req)
+		if rr.Code != tt.want {
+			t.Errorf("%s: got status %v want %v", tt.path, rr.Code, tt.want)
+		}
+	}
+}
@@ -0,0 +1,45 @@
+package main
+
+import (
+	"crypto/hmac"
+	"crypto/sha1"
+	"encoding/base32"
+	"encoding/binary"
+	"fmt"
+	"net/url"
+	"strings"
+	"time"
+)
+
+const (
+	totpPeriod = 30
+	totpDigits = 6
+)
+
+// generateTOTP computes an RFC 6238 code for the given base32 secret at time t.
+// The secret may also be given as an otpauth:// URI, as exported by most authenticator apps.
+func generateTOTP(secret string, t time.Time) (string, error) {
+	if strings.HasPrefix(secret, "otpauth://") {
+		u, err := url.Parse(secret)
+		if err != nil {
+			return "", fmt.Errorf("invalid otpauth URI: %v", err)
+		}
+		secret = u.Query().Get("secret")
+	}
+
+	secret = strings.ToUpper(strings.ReplaceAll(strings.TrimSpace(secret), " ", ""))
+	key, err := base32.StdEncoding.WithPadding(base32.NoPadding).DecodeString(strings.TrimRight(secret, "="))
+	if err != nil {
+		return "", fmt.Errorf("invalid base32 TOTP secret: %v", err)
+	}
+
+	var counter [8]byte
+	binary.BigEndian.PutUint64(counter[:], uint64(t.Unix()/totpPeriod))
+	mac := hmac.New(sha1.New, key)
+	mac.Write(counter[:])
+	sum := mac.Sum(nil)
+
+	offset := sum[len(sum)-1] & 0x0f
+	code := binary.BigEndian.Uint32(sum[offset:offset+4]) & 0x7fffffff
+	return fmt.Sprintf("%0*d", totpDigits, code%1000000), nil
+}
@@ -0,0 +1,47 @@
+package main
+
+import (
+	"testing"
+	"time"
+)
+
+func TestGenerateTOTP(t *testing.T) {
+	// Test vectors from RFC 6238, truncated to 6 digits.
+	const secret = "GEZDGNBVGY3TQOJQGEZDGNBVGY3TQOJQ"
+	tests := []struct {
+		unix int64
+		want string
+	}{
+		{59, "287082"},
+		{1111111109, "081804"},
+		{1234567890, "005924"},
+		{2000000000, "279037"},
+	}
+
+	for _, tt := range tests {
+		got, err := generateTOTP(secret, time.Unix(tt.unix, 0))
+		if err != nil {
+			t.Fatalf("generateTOTP(%d) returned error: %v", tt.unix, err)
+		}
+		if got != tt.want {
+			t.Errorf("generateTOTP(%d) = %s, want %s", tt.unix, got, tt.want)
+		}
+	}
+}
+
+func TestGenerateTOTP_OtpauthURI(t *testing.T) {
+	uri := "otpauth://totp/Bitwarden:user@example.com?secret=gezdgnbvgy3tqojqgezdgnbvgy3tqojq&issuer=Bitwarden"
+	got, err := generateTOTP(uri, time.Unix(59, 0))
+	if err != nil {
+		t.Fatalf("expected nil, got %v", err)
+	}
+	if got != "287082" {
+		t.Errorf("generateTOTP() = %s, want 287082", got)
+	}
+}
+
+func TestGenerateTOTP_InvalidSecret(t *testing.T) {
+	if _, err := generateTOTP("not base32!", time.Now()); err == nil {
+		t.Fatal("expected error for invalid secret")
+	}
+}
@@ -0,0 +1,107 @@
+package main
+
+import (
+	"cmp"
+	"context"
+	"net/http"
+	"os"
+	"strings"
+
+	"go.opentelemetry.io/contrib/instrumentation/net/http/otelhttp"
+	"go.opentelemetry.io/otel"
+	"go.opentelemetry.io/otel/attribute"
+	"go.opentelemetry.io/otel/codes"
+	"go.opentelemetry.io/otel/exporters/otlp/otlptrace/otlptracehttp"
+	"go.opentelemetry.io/otel/propagation"
+	"go.opentelemetry.io/otel/sdk/resource"
+	sdktrace "go.opentelemetry.io/otel/sdk/trace"
+	"go.opentelemetry.io/otel/trace"
+)
+
+// tracer creates the spans of the wrapper. Until tracing is set up, it does nothing.
+var tracer = otel.Tracer("github.com/hononeko/bw-cli-docker")
+
+// tracerProvider exports the spans, if tracing is enabled.
+var tracerProvider *sdktrace.TracerProvider
+
+// tracingEnabled reports whether an OTLP endpoint is configured for traces.
+func tracingEnabled() bool {
+	return os.Getenv("OTEL_EXPORTER_OTLP_ENDPOINT") != "" || os.Getenv("OTEL_EXPORTER_OTLP_TRACES_ENDPOINT") != ""
+}
+
+// setupTracing exports spans over OTLP/HTTP if an endpoint is configured. The exporter,
+// sampler and resource are configured with the standard OTEL_* variables, e.g.
+// OTEL_EXPORTER_OTLP_HEADERS or OTEL_SERVICE_NAME.
+func setupTracing() error {
+	if !tracingEnabled() {
+		return nil
+	}
+	ctx := context.Background()
+	exporter, err := otlptracehttp.New(ctx)
+	if err != nil {
+		return err
+	}
+	// Detectors applied later take precedence, so OTEL_SERVICE_NAME overrides the default name.
+	res, err := resource.New(ctx,
+		resource.WithAttributes(attribute.String("service.name", "bw-cli-docker")),
+		resource.WithFromEnv(),
+	)
+	if err != nil {
+		return err
+	}
+	tracerProvider = sdktrace.NewTracerProvider(sdktrace.WithBatcher(exporter), sdktrace.WithResource(res))
+	otel.SetTracerProvider(tracerProvider)
+	otel.SetTextMapPropagator(propagation.NewCompositeTextMapPropagator(propagation.TraceContext{}, propagation.Baggage{}))
+	return nil
+}
+
+// shutdownTracing exports the spans still buffered, if tracing is enabled.
+func shutdownTracing(ctx context.Context) {
+	if tracerProvider == nil {
+		return
+	}
+	if err := tracerProvider.Shutdown(ctx); err != nil {
+		mainLog.Warn("Failed to export the remaining spans", "error", err)
+	}
+}
+
+// traceRequests starts a span for every request, continuing the trace of the client
+// if it sent a traceparent header. The span is named after the route by instrumentRoutes.
+func traceRequests(next http.Handler) http.Handler {
+	return otelhttp.NewHandler(next, "proxy", otelhttp.WithSpanNameFormatter(func(_ string, r *http.Request) string {
+		return requestSpanName(r, r.Pattern)
+	}))
+}
+
+// requestSpanName names the span of a request after its method and route.
+func requestSpanName(r *http.Request, route string) string {
+	if route == "" || strings.Contains(route, " ") {
+		// Routes registered for a method already start with it.
+		return cmp.Or(route, r.Method)
+	}
+	return r.Method + " " + route
+}
+
+// tracingTransport propagates the trace to 'bw serve' and records a span per upstream request.
+func tracingTransport(base http.RoundTripper) http.RoundTripper {
+	return otelhttp.NewTransport(base)
+}
+
+// nameRequestSpan names the span of a request after the matched route.
+func nameRequestSpan(r *http.Request, route string) {
+	span := trace.SpanFromContext(r.Context())
+	span.SetName(requestSpanName(r, route))
+	span.SetAttributes(attribute.String("http.route", route))
+}
+
+// runTraced runs a CLI command in a span named after it, e.g. "bw sync".
+func runTraced(ctx context.Context, name string, run func() error) error {
+	_, span := tracer.Start(ctx, name, trace.WithSpanKind(trace.SpanKindClient))
+	defer span.End()
+	err := observeCLI(name, run)
+	if err != nil {
+		span.RecordError(err)
+		span.SetStatus(codes.Error, err.Error())
+	}
+	return err
+}
@@ -0,0 +1,48 @@
+package main
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"net/http/httputil"
+	"net/url"
+	"os/exec"
+	"slices"
+	"testing"
+
+	"go.opentelemetry.io/otel"
+	sdktrace "go.opentelemetry.io/otel/sdk/trace"
+	"go.opentelemetry.io/otel/sdk/trace/tracetest"
+)
+
+func TestTracing(t *testing.T) {
+	execCommand = mockExecCommand
+	defer func() { execCommand = exec.CommandContext }()
+
+	recorder := tracetest.NewSpanRecorder()
+	previous := otel.GetTracerProvider()
+	otel.SetTracerProvider(sdktrace.NewTracerProvider(sdktrace.WithSpanProcessor(recorder)))
+	defer otel.SetTracerProvider(previous)
+
+	target, _ := url.Parse("http://localhost:8080")
+	router := traceRequests(setupRouter(httputil.NewSingleHostReverseProxy(target)))
+
+	rr := httptest.NewRecorder()
+	router.ServeHTTP(rr, httptest.NewRequest("POST", "/sync", nil))
+	if rr.Code != http.StatusOK {
+		t.Fatalf("POST /sync: got status %v want %v", rr.Code, http.StatusOK)
+	}
+
+	var names []string
+	spans := recorder.Ended()
+	for _, span := range spans {
+		names = append(names, span.Name())
+	}
+	if !slices.Contains(names, "POST /sync") || !slices.Contains(names, "bw sync") {
+		t.Fatalf("spans = %v, want 'POST /sync' and 'bw sync'", names)
+	}
+	for _, span := range spans {
+		if span.Name() == "bw sync" && span.Parent().SpanID() != spans[len(spans)-1].SpanContext().SpanID() {
+			t.Error("'bw sync' span is not a child of the request span")
+		}
+	}
+}
@@ -0,0 +1,66 @@
+package main
+
+import (
+	"net"
+	"net/http"
+	"os"
+	"strconv"
+	"time"
+)
+
+const (
+	defaultProxyMaxIdleConns    = 64
+	defaultProxyIdleConnTimeout = 90 * time.Second
+	defaultProxyDialTimeout     = 5 * time.Second
+)
+
+// proxyTransportFromEnv returns the transport of the proxy to 'bw serve'. The default
+// transport keeps only two idle connections per host, so under concurrent load most
+// requests open a new connection. 'bw serve' is always on the loopback interface, so
+// no proxy from the environment is used and compression, which would only cost CPU on
+// both ends, is left to the client. The pool and timeouts are configured by
+// BW_PROXY_MAX_IDLE_CONNS, BW_PROXY_IDLE_CONN_TIMEOUT, BW_PROXY_DIAL_TIMEOUT and
+// BW_PROXY_RESPONSE_HEADER_TIMEOUT.
+func proxyTransportFromEnv() *http.Transport {
+	maxIdleConns := defaultProxyMaxIdleConns
+	if val := os.Getenv("BW_PROXY_MAX_IDLE_CONNS"); val != "" {
+		n, err := strconv.Atoi(val)
+		if err != nil || n <= 0 {
+			proxyLog.Warn("Invalid format for BW_PROXY_MAX_IDLE_CONNS, using default", "value", val, "default", defaultProxyMaxIdleConns, "error", err)
+		} else {
+			maxIdleConns = n
+		}
+	}
+
+	idleConnTimeout := defaultProxyIdleConnTimeout
+	dialTimeout := defaultProxyDialTimeout
+	// Reads of large vaults can take a while, so responses are not limited by default.
+	var responseHeaderTimeout time.Duration
+	for _, setting := range []struct {
+		key   string
+		value *time.Duration
+	}{
+		{"BW_PROXY_IDLE_CONN_TIMEOUT", &idleConnTimeout},
+		{"BW_PROXY_DIAL_TIMEOUT", &dialTimeout},
+		{"BW_PROXY_RESPONSE_HEADER_TIMEOUT", &responseHeaderTimeout},
+	} {
+		val := os.Getenv(setting.key)
+		if val == "" {
+			continue
+		}
+		if d, err := time.ParseDuration(val); err != nil || d < 0 {
+			proxyLog.Warn("Invalid format for "+setting.key+", using default", "value", val, "default", *setting.value, "error", err)
+		} else {
+			*setting.value = d
+		}
+	}
+
+	return &http.Transport{
+		DialContext:           (&net.Dialer{Timeout: dialTimeout, KeepAlive: 30 * time.Second}).DialContext,
+		MaxIdleConns:          maxIdleConns,
+		MaxIdleConnsPerHost:   maxIdleConns,
+		IdleConnTimeout:       idleConnTimeout,
+		ResponseHeaderTimeout: responseHeaderTimeout,
+		DisableCompression:    true,
+	}
+}
@@ -0,0 +1,29 @@
+package main
+
+import (
+	"testing"
+	"time"
+)
+
+func TestProxyTransportFromEnv(t *testing.T) {
+	transport := proxyTransportFromEnv()
+	if transport.MaxIdleConnsPerHost != defaultProxyMaxIdleConns || transport.IdleConnTimeout != defaultProxyIdleConnTimeout ||
+		transport.ResponseHeaderTimeout != 0 || !transport.DisableCompression || transport.Proxy != nil {
+		t.Errorf("unexpected default transport %+v", transport)
+	}
+
+	t.Setenv("BW_PROXY_MAX_IDLE_CONNS", "8")
+	t.Setenv("BW_PROXY_IDLE_CONN_TIMEOUT", "30s")
+	t.Setenv("BW_PROXY_RESPONSE_HEADER_TIMEOUT", "1m")
+	transport = proxyTransportFromEnv()
+	if transport.MaxIdleConnsPerHost != 8 || transport.IdleConnTimeout != 30*time.Second || transport.ResponseHeaderTimeout != time.Minute {
+		t.Errorf("unexpected transport %+v", transport)
+	}
+
+	t.Setenv("BW_PROXY_MAX_IDLE_CONNS", "0")
+	t.Setenv("BW_PROXY_IDLE_CONN_TIMEOUT", "soon")
+	transport = proxyTransportFromEnv()
+	if transport.MaxIdleConnsPerHost != defaultProxyMaxIdleConns || transport.IdleConnTimeout != defaultProxyIdleConnTimeout {
+		t.Errorf("invalid settings: got %+v", transport)
+	}
+}
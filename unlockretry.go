@@ -0,0 +1,132 @@
+package main
+
+import (
+	"bytes"
+	"context"
+	"errors"
+	"fmt"
+	"io"
+	"net/http"
+	"net/http/httputil"
+	"os"
+	"strings"
+	"sync"
+	"time"
+)
+
+// lockedResponsePeek is how much of an error response of 'bw serve' is read to tell
+// whether it was caused by a locked vault.
+const lockedResponsePeek = 4 << 10
+
+// errVaultLocked is returned by detectLockedVault to hand a request that failed
+// because the vault is locked back to serveWithUnlockRetry.
+var errVaultLocked = errors.New("vault is locked")
+
+// lockedRetryKey marks a request in its context as retried after unlocking if
+// 'bw serve' answers it with a locked vault error.
+type lockedRetryKey struct{}
+
+// lockedRetry is set by the proxy when a retryable request hit a locked vault.
+type lockedRetry struct {
+	locked bool
+}
+
+// unlockRetryEnabled reports whether proxied requests failing because the vault is
+// locked are retried after unlocking it, which requires a session to unlock.
+func unlockRetryEnabled() bool {
+	return os.Getenv("BW_SESSION") != "" && getEnv("BW_DISABLE_AUTO_UNLOCK", "false") != "true"
+}
+
+// serveWithUnlockRetry proxies a request to 'bw serve'. If it fails because the vault
+// got locked, e.g. by a vault timeout, the vault is unlocked again and the request is
+// retried once, so that clients don't need retry logic of their own.
+func serveWithUnlockRetry(proxy *httputil.ReverseProxy, w http.ResponseWriter, r *http.Request) {
+	if !unlockRetryEnabled() {
+		serveBehindSessionGate(proxy, w, r)
+		return
+	}
+
+	// The body is kept to send it again.
+	var body []byte
+	if r.Body != nil && r.Body != http.NoBody {
+		var err error
+		if body, err = io.ReadAll(r.Body); err != nil {
+			proxyErrorHandler(w, r, err)
+			return
+		}
+		_ = r.Body.Close()
+		r.Body = io.NopCloser(bytes.NewReader(body))
+	}
+
+	retry := &lockedRetry{}
+	serveBehindSessionGate(proxy, w, r.WithContext(context.WithValue(r.Context(), lockedRetryKey{}, retry)))
+	if !retry.locked {
+		return
+	}
+
+	proxyLog.Info("Request failed because the vault is locked, unlocking it again and retrying", "request_id", requestID(r), "path", r.URL.Path)
+	if err := recoverLockedVault(getEnv("BW_SERVE_PORT", "8088")); err != nil {
+		proxyLog.Error("Failed to unlock the vault again", "request_id", requestID(r), "error", err)
+		recordEvent(eventUnlockFailed, "Failed to unlock the vault again", err)
+		http.Error(w, fmt.Sprintf("Service unavailable: the vault is locked (request ID: %s)", requestID(r)), http.StatusServiceUnavailable)
+		return
+	}
+	if body != nil {
+		r.Body = io.NopCloser(bytes.NewReader(body))
+	}
+	serveBehindSessionGate(proxy, w, r)
+}
+
+// serveBehindSessionGate proxies a request, queueing it while the session is swapped or
+// 'bw serve' restarted. If it cannot be queued, the client is asked to retry.
+func serveBehindSessionGate(proxy *httputil.ReverseProxy, w http.ResponseWriter, r *http.Request) {
+	if err := sessionGate.enter(r.Context()); err != nil {
+		if r.Context().Err() != nil {
+			return
+		}
+		proxyLog.Warn("Request could not be queued during maintenance", "request_id", requestID(r), "path", r.URL.Path, "error", err)
+		w.Header().Set("Retry-After", "5")
+		http.Error(w, fmt.Sprintf("Service unavailable: %v (request ID: %s)", err, requestID(r)), http.StatusServiceUnavailable)
+		return
+	}
+	defer sessionGate.leave()
+	proxy.ServeHTTP(w, r)
+}
+
+// detectLockedVault is the ModifyResponse hook of the proxy. It fails responses of
+// 'bw serve' reporting a locked vault with errVaultLocked if the request is to be
+// retried, in which case nothing is written to the client.
+func detectLockedVault(resp *http.Response) error {
+	retry, ok := resp.Request.Context().Value(lockedRetryKey{}).(*lockedRetry)
+	if !ok || resp.StatusCode < 400 || resp.StatusCode >= 500 {
+		return nil
+	}
+	peek, err := io.ReadAll(io.LimitReader(resp.Body, lockedResponsePeek))
+	resp.Body = struct {
+		io.Reader
+		io.Closer
+	}{io.MultiReader(bytes.NewReader(peek), resp.Body), resp.Body}
+	if err != nil || !strings.Contains(strings.ToLower(string(peek)), "vault is locked") {
+		return nil
+	}
+	retry.locked = true
+	return errVaultLocked
+}
+
+// lockedRecoveryMu serializes recoveries, so that concurrent requests hitting the
+// locked vault unlock it only once.
+var lockedRecoveryMu sync.Mutex
+
+// recoverLockedVault unlocks the vault again, unless it has been unlocked in the
+// meantime.
+func recoverLockedVault(port string) error {
+	lockedRecoveryMu.Lock()
+	defer lockedRecoveryMu.Unlock()
+	client := &http.Client{Timeout: 2 * time.Second}
+	if checkBwServeStatus(client, bwServeURL(port, "/status"), true) == nil {
+		return nil
+	}
+	recordVaultLockState(false)
+	recordEvent(eventVaultLocked, "Request failed because the vault is locked", nil)
+	return reunlockVault(port, false)
+}
@@ -0,0 +1,102 @@
+package main
+
+import (
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"net/http/httputil"
+	"net/url"
+	"os/exec"
+	"strings"
+	"sync/atomic"
+	"testing"
+)
+
+func TestUnlockRetry(t *testing.T) {
+	execCommand = mockExecCommand
+	defer func() { execCommand = exec.CommandContext }()
+
+	// 'bw serve' picks up the new session once the wrapper checks its status again.
+	var locked atomic.Bool
+	var unlocks atomic.Int32
+	upstream := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.URL.Path == "/status" {
+			if locked.Swap(false) {
+				unlocks.Add(1)
+				_, _ = w.Write([]byte(`{"data": {"template": {"status": "locked"}}}`))
+				return
+			}
+			_, _ = w.Write([]byte(`{"data": {"template": {"status": "unlocked"}}}`))
+			return
+		}
+		if locked.Load() {
+			w.WriteHeader(http.StatusBadRequest)
+			_, _ = w.Write([]byte(`{"success":false,"message":"Vault is locked."}`))
+			return
+		}
+		body, _ := io.ReadAll(r.Body)
+		_, _ = w.Write(append([]byte("OK "), body...))
+	}))
+	defer upstream.Close()
+	u, _ := url.Parse(upstream.URL)
+	t.Setenv("BW_SERVE_PORT", u.Port())
+	t.Setenv("BW_PASSWORD", "test-password")
+	t.Setenv("BW_SESSION", "expired-session")
+	t.Setenv("BW_SESSION_STATE_FILE", "")
+
+	proxy := httputil.NewSingleHostReverseProxy(u)
+	proxy.ModifyResponse = detectLockedVault
+	proxy.ErrorHandler = proxyErrorHandler
+	handler := vaultProxyHandler(proxy)
+
+	send := func() *httptest.ResponseRecorder {
+		rr := httptest.NewRecorder()
+		handler.ServeHTTP(rr, httptest.NewRequest("POST", "/object/item", strings.NewReader(`{"name":"test"}`)))
+		return rr
+	}
+
+	// The request is retried with its body after unlocking.
+	locked.Store(true)
+	rr := send()
+	if rr.Code != http.StatusOK || rr.Body.String() != `OK {"name":"test"}` {
+		t.Errorf("got %v %q", rr.Code, rr.Body.String())
+	}
+	if unlocks.Load() != 1 {
+		t.Errorf("got %d unlocks want 1", unlocks.Load())
+	}
+
+	// Without a session to unlock, the error of 'bw serve' is passed on.
+	t.Setenv("BW_SESSION", "")
+	locked.Store(true)
+	rr = send()
+	if rr.Code != http.StatusBadRequest || !strings.Contains(rr.Body.String(), "Vault is locked") {
+		t.Errorf("got %v %q", rr.Code, rr.Body.String())
+	}
+}
+
+func TestUnlockRetry_UnlockFails(t *testing.T) {
+	upstream := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.URL.Path == "/status" {
+			_, _ = w.Write([]byte(`{"data": {"template": {"status": "locked"}}}`))
+			return
+		}
+		w.WriteHeader(http.StatusBadRequest)
+		_, _ = w.Write([]byte(`{"success":false,"message":"Vault is locked."}`))
+	}))
+	defer upstream.Close()
+	u, _ := url.Parse(upstream.URL)
+	t.Setenv("BW_SERVE_PORT", u.Port())
+	t.Setenv("BW_SESSION", "expired-session")
+	t.Setenv("BW_PASSWORD", "")
+	t.Setenv("BW_PASSWORD_FILE", "")
+
+	proxy := httputil.NewSingleHostReverseProxy(u)
+	proxy.ModifyResponse = detectLockedVault
+	proxy.ErrorHandler = proxyErrorHandler
+
+	rr := httptest.NewRecorder()
+	vaultProxyHandler(proxy).ServeHTTP(rr, httptest.NewRequest("GET", "/list/object/items", nil))
+	if rr.Code != http.StatusServiceUnavailable {
+		t.Errorf("got status %v want %v", rr.Code, http.StatusServiceUnavailable)
+	}
+}
@@ -0,0 +1,72 @@
+package main
+
+import (
+	"context"
+	"encoding/json"
+	"net/http"
+	"runtime"
+	"runtime/debug"
+	"strings"
+)
+
+// version and commit are set at build time with -ldflags "-X main.version=... -X main.commit=...".
+var (
+	version = "dev"
+	commit  = ""
+)
+
+// cliVersion is the version of the bw or bws CLI, detected at startup.
+var cliVersion string
+
+// versionInfo describes the running wrapper and CLI, served at /version.
+type versionInfo struct {
+	Version    string `json:"version"`
+	Commit     string `json:"commit,omitempty"`
+	GoVersion  string `json:"goVersion"`
+	CLIVersion string `json:"cliVersion,omitempty"`
+}
+
+// currentVersion returns the version information of the running wrapper. Without a
+// commit from the build, the VCS revision embedded by the Go toolchain is used.
+func currentVersion() versionInfo {
+	info := versionInfo{Version: version, Commit: commit, GoVersion: runtime.Version(), CLIVersion: cliVersion}
+	if info.Commit == "" {
+		if build, ok := debug.ReadBuildInfo(); ok {
+			for _, setting := range build.Settings {
+				if setting.Key == "vcs.revision" {
+					info.Commit = setting.Value
+				}
+			}
+		}
+	}
+	return info
+}
+
+// detectCLIVersion runs '<cli> --version' and logs the versions in use, so they show
+// up in bug reports and mismatches between the image and the CLI can be spotted.
+func detectCLIVersion(cli string) {
+	ctx, cancel, err := cliContext(context.Background())
+	if err != nil {
+		mainLog.Warn("Could not determine the CLI version", "cli", cli, "error", err)
+		return
+	}
+	defer cancel()
+	output, err := observeCLIOutput(cli+" --version", execCommand(ctx, cli, "--version").Output)
+	if err != nil {
+		mainLog.Warn("Could not determine the CLI version", "cli", cli, "error", err)
+	}
+	cliVersion = strings.TrimSpace(string(output))
+
+	info := currentVersion()
+	mainLog.Info("Starting bw-cli-docker", "version", info.Version, "commit", info.Commit, "go", info.GoVersion, "cli", cli, "cliVersion", info.CLIVersion)
+}
+
+// handleVersion serves the version information as JSON.
+func handleVersion(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodGet {
+		http.Error(w, "Method not allowed", http.StatusMethodNotAllowed)
+		return
+	}
+	w.Header().Set("Content-Type", "application/json")
+	_ = json.NewEncoder(w).Encode(currentVersion())
+}
@@ -0,0 +1,33 @@
+package main
+
+import (
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"os/exec"
+	"runtime"
+	"testing"
+)
+
+func TestVersion(t *testing.T) {
+	execCommand = mockExecCommand
+	defer func() { execCommand = exec.CommandContext }()
+	defer func() { cliVersion = "" }()
+
+	detectCLIVersion("bw")
+
+	rr := httptest.NewRecorder()
+	handleVersion(rr, httptest.NewRequest("GET", "/version", nil))
+	if rr.Code != http.StatusOK {
+		t.Fatalf("got status %v want %v", rr.Code, http.StatusOK)
+	}
+
+	var info versionInfo
+	if err := json.Unmarshal(rr.Body.Bytes(), &info); err != nil {
+		t.Fatalf("expected JSON, got %q: %v", rr.Body.String(), err)
+	}
+	want := versionInfo{Version: "dev", Commit: info.Commit, GoVersion: runtime.Version(), CLIVersion: "2026.6.0"}
+	if info != want {
+		t.Errorf("got %+v want %+v", info, want)
+	}
+}
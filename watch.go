@@ -0,0 +1,92 @@
+package main
+
+import (
+	"bytes"
+	"context"
+	"crypto/sha256"
+	"fmt"
+	"os"
+	"path/filepath"
+	"strings"
+	"time"
+
+	"github.com/fsnotify/fsnotify"
+)
+
+// fileWatchDebounce groups the burst of events caused by a single update,
+// e.g. Kubernetes swapping the ..data symlink of a mounted secret.
+const fileWatchDebounce = 1 * time.Second
+
+// watchFile calls onChange whenever the contents of the file at path
+// change. The parent directory is watched rather than the file itself, so that
+// files replaced by rename or symlink swap keep being tracked.
+func watchFile(path string, onChange func()) error {
+	watcher, err := fsnotify.NewWatcher()
+	if err != nil {
+		return fmt.Errorf("failed to create file watcher: %v", err)
+	}
+	if err := watcher.Add(filepath.Dir(path)); err != nil {
+		_ = watcher.Close()
+		return fmt.Errorf("failed to watch '%s': %v", filepath.Dir(path), err)
+	}
+
+	lastHash := hashFile(path)
+	go func() {
+		defer func() { _ = watcher.Close() }()
+		debounce := time.NewTimer(fileWatchDebounce)
+		debounce.Stop()
+
+		for {
+			select {
+			case _, ok := <-watcher.Events:
+				if !ok {
+					return
+				}
+				debounce.Reset(fileWatchDebounce)
+			case err, ok := <-watcher.Errors:
+				if !ok {
+					return
+				}
+				mainLog.Warn("Error watching file", "path", path, "error", err)
+			case <-debounce.C:
+				hash := hashFile(path)
+				if hash == nil || bytes.Equal(hash, lastHash) {
+					continue
+				}
+				lastHash = hash
+				onChange()
+			}
+		}
+	}()
+	return nil
+}
+
+// hashFile returns the SHA-256 of the file contents, or nil if it cannot be read.
+func hashFile(path string) []byte {
+	content, err := os.ReadFile(path)
+	if err != nil {
+		return nil
+	}
+	sum := sha256.Sum256(content)
+	return sum[:]
+}
+
+// rotatePassword locks the vault after the master password has changed and
+// unlocks it again with the new password, restarting 'bw serve' with the new session.
+func rotatePassword(port string) {
+	authLog.Info("Master password file changed, locking and unlocking the vault with the new password")
+	recordEvent(eventPasswordRotated, "Master password file changed", nil)
+	if ctx, cancel, err := cliContext(context.Background()); err != nil {
+		authLog.Warn("bw lock failed", "error", err)
+	} else {
+		output, err := observeCLIOutput("bw lock", execCommand(ctx, "bw", "lock").CombinedOutput)
+		cancel()
+		if err != nil {
+			authLog.Warn("bw lock failed", "output", strings.TrimSpace(string(output)), "error", err)
+		}
+	}
+	if err := reunlockVault(port, true); err != nil {
+		authLog.Error("Failed to unlock the vault with the rotated password", "error", err)
+		recordEvent(eventUnlockFailed, "Failed to unlock the vault with the rotated password", err)
+	}
+}
@@ -0,0 +1,51 @@
+package main
+
+import (
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+)
+
+func TestWatchPasswordFile(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "password")
+	if err := os.WriteFile(path, []byte("old-password"), 0o600); err != nil {
+		t.Fatal(err)
+	}
+
+	changed := make(chan struct{}, 1)
+	if err := watchFile(path, func() { changed <- struct{}{} }); err != nil {
+		t.Fatalf("expected nil, got %v", err)
+	}
+
+	// Rewriting the same contents must not trigger a rotation.
+	if err := os.WriteFile(path, []byte("old-password"), 0o600); err != nil {
+		t.Fatal(err)
+	}
+	select {
+	case <-changed:
+		t.Fatal("unexpected change notification for identical contents")
+	case <-time.After(fileWatchDebounce + 500*time.Millisecond):
+	}
+
+	// Replace the file by rename, as secret mounts do.
+	tmp := filepath.Join(filepath.Dir(path), "password.tmp")
+	if err := os.WriteFile(tmp, []byte("new-password"), 0o600); err != nil {
+		t.Fatal(err)
+	}
+	if err := os.Rename(tmp, path); err != nil {
+		t.Fatal(err)
+	}
+	select {
+	case <-changed:
+	case <-time.After(5 * time.Second):
+		t.Fatal("expected change notification after the password was rotated")
+	}
+}
+
+func TestWatchPasswordFile_MissingDirectory(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "missing", "password")
+	if err := watchFile(path, func() {}); err == nil {
+		t.Fatal("expected error when the directory does not exist")
+	}
+}
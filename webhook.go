@@ -0,0 +1,39 @@
+package main
+
+import (
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"os"
+	"time"
+)
+
+const webhookTimeout = 10 * time.Second
+
+// postWebhook sends payload as JSON to url, failing on any non-2xx response.
+func postWebhook(url string, payload any) error {
+	body, err := json.Marshal(payload)
+	if err != nil {
+		return err
+	}
+	client := &http.Client{Timeout: webhookTimeout}
+	resp, err := client.Post(url, "application/json", bytes.NewReader(body))
+	if err != nil {
+		return err
+	}
+	defer func() { _ = resp.Body.Close() }()
+	if resp.StatusCode < 200 || resp.StatusCode > 299 {
+		return fmt.Errorf("webhook returned status %d", resp.StatusCode)
+	}
+	return nil
+}
+
+// instanceName identifies the container in notifications, e.g. by its pod name.
+func instanceName() string {
+	name, _ := os.Hostname()
+	if account := os.Getenv("BW_LOG_ACCOUNT"); account != "" {
+		name += "/" + account
+	}
+	return name
+}
@@ -0,0 +1,115 @@
+package main
+
+import (
+	"context"
+	"errors"
+	"io"
+	"io/fs"
+	"os"
+	"path/filepath"
+)
+
+// wipeOnExitEnabled reports whether BW_WIPE_ON_EXIT asks for the CLI data directory
+// to be wiped on shutdown.
+func wipeOnExitEnabled() bool {
+	return getEnv("BW_WIPE_ON_EXIT", "false") == "true"
+}
+
+// bwDataDir returns the data directory of the Bitwarden CLI, resolved the way the
+// CLI does on Linux.
+func bwDataDir() (string, error) {
+	if dir := os.Getenv("BITWARDENCLI_APPDATA_DIR"); dir != "" {
+		return dir, nil
+	}
+	config, err := os.UserConfigDir()
+	if err != nil {
+		return "", err
+	}
+	return filepath.Join(config, "Bitwarden CLI"), nil
+}
+
+// wipeDataDir logs out and removes the contents of the CLI data directory, so that
+// no vault data or keys are left on the node after the container stops. Files are
+// overwritten before they are removed. The directory itself is kept, as it may be a
+// mount point.
+func wipeDataDir(ctx context.Context) {
+	if !wipeOnExitEnabled() {
+		return
+	}
+	if os.Getenv("BW_SHUTDOWN_ACTION") != "logout" {
+		cmd := execCommand(ctx, "bw", "logout")
+		if output, err := observeCLIOutput("bw logout", cmd.CombinedOutput); err != nil {
+			authLog.Warn("bw logout failed on shutdown", "output", string(output), "error", err)
+		}
+	}
+
+	dir, err := bwDataDir()
+	if err != nil {
+		mainLog.Error("Failed to determine the Bitwarden CLI data directory, it is not wiped", "error", err)
+		return
+	}
+	if err := wipeDir(dir); err != nil {
+		mainLog.Error("Failed to wipe the Bitwarden CLI data directory", "dir", dir, "error", err)
+		return
+	}
+	mainLog.Info("Wiped the Bitwarden CLI data directory", "dir", dir)
+}
+
+// wipeDir overwrites every regular file below dir with zeros and removes the contents
+// of dir. A missing directory is not an error.
+func wipeDir(dir string) error {
+	if filepath.Clean(dir) == "/" {
+		return errors.New("refusing to wipe the root directory")
+	}
+	entries, err := os.ReadDir(dir)
+	if errors.Is(err, fs.ErrNotExist) {
+		return nil
+	}
+	if err != nil {
+		return err
+	}
+	var errs []error
+	err = filepath.WalkDir(dir, func(path string, d fs.DirEntry, err error) error {
+		if err != nil {
+			errs = append(errs, err)
+			return nil
+		}
+		if d.Type().IsRegular() {
+			if err := overwriteFile(path); err != nil {
+				errs = append(errs, err)
+			}
+		}
+		return nil
+	})
+	errs = append(errs, err)
+	for _, entry := range entries {
+		errs = append(errs, os.RemoveAll(filepath.Join(dir, entry.Name())))
+	}
+	return errors.Join(errs...)
+}
+
+// overwriteFile overwrites the content of the file at path with zeros and flushes it
+// to disk.
+func overwriteFile(path string) error {
+	f, err := os.OpenFile(path, os.O_WRONLY, 0)
+	if err != nil {
+		return err
+	}
+	defer f.Close()
+	info, err := f.Stat()
+	if err != nil {
+		return err
+	}
+	if _, err := io.CopyN(f, zeroReader{}, info.Size()); err != nil {
+		return err
+	}
+	return f.Sync()
+}
+
+// zeroReader is an endless source of zero bytes.
+type zeroReader struct{}
+
+func (zeroReader) Read(p []byte) (int, error) {
+	clear(p)
+	return len(p), nil
+}
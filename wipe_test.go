@@ -0,0 +1,78 @@
+package main
+
+import (
+	"context"
+	"os"
+	"os/exec"
+	"path/filepath"
+	"testing"
+
+	"github.com/prometheus/client_golang/prometheus"
+	dto "github.com/prometheus/client_model/go"
+)
+
+func TestWipeDataDir(t *testing.T) {
+	execCommand = mockExecCommand
+	defer func() { execCommand = exec.CommandContext }()
+	dir := t.TempDir()
+	t.Setenv("BITWARDENCLI_APPDATA_DIR", dir)
+	t.Setenv("BW_SHUTDOWN_ACTION", "")
+
+	data := filepath.Join(dir, "data.json")
+	if err := os.WriteFile(data, []byte(`{"key":"secret"}`), 0o600); err != nil {
+		t.Fatal(err)
+	}
+	if err := os.MkdirAll(filepath.Join(dir, "cache"), 0o700); err != nil {
+		t.Fatal(err)
+	}
+	if err := os.WriteFile(filepath.Join(dir, "cache", "items"), []byte("cached"), 0o600); err != nil {
+		t.Fatal(err)
+	}
+
+	// Nothing is touched unless enabled.
+	wipeDataDir(context.Background())
+	if _, err := os.Stat(data); err != nil {
+		t.Fatalf("data directory was wiped without BW_WIPE_ON_EXIT: %v", err)
+	}
+
+	t.Setenv("BW_WIPE_ON_EXIT", "true")
+	logouts := func() uint64 {
+		// The mock is not logged in, so 'bw logout' fails.
+		metric := &dto.Metric{}
+		_ = cliCommandDuration.WithLabelValues("bw logout", "1").(prometheus.Histogram).Write(metric)
+		return metric.GetHistogram().GetSampleCount()
+	}
+	before := logouts()
+	wipeDataDir(context.Background())
+	if got := logouts(); got != before+1 {
+		t.Errorf("expected 'bw logout' to be run once, got %v", got-before)
+	}
+	entries, err := os.ReadDir(dir)
+	if err != nil {
+		t.Fatalf("the data directory itself should be kept: %v", err)
+	}
+	if len(entries) != 0 {
+		t.Errorf("data directory still contains %v", entries)
+	}
+}
+
+func TestWipeDir(t *testing.T) {
+	if err := wipeDir(filepath.Join(t.TempDir(), "missing")); err != nil {
+		t.Errorf("missing directory: %v", err)
+	}
+	if err := wipeDir("/"); err == nil {
+		t.Error("expected wiping / to be refused")
+	}
+
+	path := filepath.Join(t.TempDir(), "file")
+	if err := os.WriteFile(path, []byte("secret"), 0o600); err != nil {
+		t.Fatal(err)
+	}
+	if err := overwriteFile(path); err != nil {
+		t.Fatal(err)
+	}
+	content, _ := os.ReadFile(path)
+	if string(content) != "\x00\x00\x00\x00\x00\x00" {
+		t.Errorf("got content %q", content)
+	}
+}